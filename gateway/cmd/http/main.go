@@ -1,26 +1,37 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/WALL-EEEEEEE/proxy-service/common"
 
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/config"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/accesslog"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/acl"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/breaker"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/bypass"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/client"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/handler"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/header"
 	meta "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/meta"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/pool"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/resolver"
 	route "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/route"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/selector"
 	server "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/server"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/service"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/util"
 	log "github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
@@ -57,153 +68,633 @@ func http_proto(req http.Request) string {
 	}
 }
 
-func proxy_http_request(ctx context.Context, conn net.Conn, req http.Request, proxy *model.Proxy) error {
-	resp := &http.Response{
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     http.Header{},
+// dial_upstream connects to addr through proxy, or directly if proxy is nil,
+// the host of addr is sent to proxy unresolved unless the resolver resolves it locally
+func dial_upstream(ctx context.Context, addr string, proxy *model.Proxy) (net.Conn, error) {
+	addr, err := dns_resolver.ResolveAddr(ctx, addr)
+	if err != nil {
+		return nil, err
 	}
-	var (
-		wrap_addr string
-		req_addr  string = real_addr(req)
-	)
+	wrap_addr := addr
 	if proxy != nil {
-		wrap_addr = net.JoinHostPort(proxy.UseConfig.Host, strconv.Itoa(int(proxy.UseConfig.Port)))
-	} else {
-		wrap_addr = req_addr
+		wrap_addr = util.ProxyAddr(proxy)
+	} else if wrap_addr, err = resolve_direct(ctx, addr); err != nil {
+		return nil, err
 	}
+	rec := accesslog.FromContext(ctx)
 	d := net.Dialer{}
 	dail_ctx, cancel := context.WithTimeout(ctx, DAIL_TIMEOUT*time.Second)
 	defer cancel()
+	start := time.Now()
 	wrap_conn, err := d.DialContext(dail_ctx, "tcp", wrap_addr)
+	rec.Dialed(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		start = time.Now()
+		err := util.HttpConnect(ctx, wrap_conn, addr, proxy, CONNECT_TIMEOUT*time.Second)
+		rec.Connected(time.Since(start))
+		if err != nil {
+			wrap_conn.Close()
+			return nil, err
+		}
+	}
+	return wrap_conn, nil
+}
+
+// check_destination checks addr against the destination acl before routing,
+// hostnames resolved by the upstream proxy are only checked by host patterns and ports
+func check_destination(ctx context.Context, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		resp.StatusCode = http.StatusServiceUnavailable
-		resp.Body = io.NopCloser(bytes.NewBufferString("proxy unreachable"))
-		resp.Write(conn)
 		return err
 	}
+	iport, _ := strconv.Atoi(port)
+	ips, err := dns_resolver.Resolve(ctx, host)
+	if err != nil {
+		return err
+	}
+	return dest_acl.Check(acl.FromContext(ctx), host, iport, ips...)
+}
+
+// resolve_direct resolves addr connected directly by the configured resolver and checks the addresses against the destination acl,
+// so the address dialed is the one checked. The hosts left to upstream by the resolver are resolved by the system,
+// as there is no upstream resolving them for direct connections
+func resolve_direct(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	iport, _ := strconv.Atoi(port)
+	ips, err := dns_resolver.Resolve(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) < 1 {
+		ip_addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		for _, ip_addr := range ip_addrs {
+			ips = append(ips, ip_addr.IP)
+		}
+	}
+	if len(ips) < 1 {
+		return "", fmt.Errorf("no address of %s", host)
+	}
+	if err := dest_acl.Check(acl.FromContext(ctx), host, iport, ips...); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// proxy_http_request tunnels a CONNECT request through proxy (or a direct connection),
+// it returns whether the tunnel has been established to the client
+func proxy_http_request(ctx context.Context, conn net.Conn, req http.Request, proxy *model.Proxy, headers *header.Policy) (bool, error) {
+	wrap_conn, err := dial_upstream(ctx, real_addr(req), proxy)
+	if err != nil {
+		return false, err
+	}
 	defer wrap_conn.Close()
+	resp := &http.Response{
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusOK,
+		Status:     "200 Connection established",
+		Header:     http.Header{},
+	}
+	headers.Response(resp, &req, proxy)
+	if err := resp.Write(conn); err != nil {
+		return true, err
+	}
+	accesslog.FromContext(ctx).SetStatus(http.StatusOK)
+	return true, util.Transport(conn, wrap_conn)
+}
 
+// forward_http_request forwards a plain http request through a pooled tunnel of proxy to the target (or a direct connection),
+// it returns whether the response has been written to the client
+func forward_http_request(ctx context.Context, conn net.Conn, req *http.Request, proxy *model.Proxy, headers *header.Policy) (bool, error) {
+	req_addr := real_addr(*req)
+	key := "direct|" + req_addr
 	if proxy != nil {
-		wrap_req := &http.Request{
-			Method:     http.MethodConnect,
-			URL:        &url.URL{Host: req_addr},
-			Host:       req_addr,
-			ProtoMajor: 1,
-			ProtoMinor: 1,
-			Header:     http.Header{},
-		}
-		wrap_req.Header.Set("Proxy-Connection", "keep-alive")
-		if proxy.UseConfig != nil && proxy.UseConfig.User != "" && proxy.UseConfig.Password != "" {
-			u := proxy.UseConfig.User
-			p := proxy.UseConfig.Password
-			wrap_req.Header.Set("Proxy-Authorization",
-				"Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+p)))
-		}
-		connect_ctx, cancel := context.WithTimeout(ctx, CONNECT_TIMEOUT*time.Second)
-		defer cancel()
-		wrap_req = wrap_req.WithContext(connect_ctx)
-		if err := wrap_req.Write(wrap_conn); err != nil {
-			return err
+		key = proxy.Id + "|" + req_addr
+	}
+	req.Header.Del("Proxy-Connection")
+	headers.Request(req, proxy)
+	// the requests with a body are sent on new connections, as the body can't be replayed on another one
+	// once an idle connection turns out to be closed by upstream
+	replayable := req.Body == nil || req.Body == http.NoBody
+	for {
+		var upstream *pool.Conn
+		reused := false
+		if replayable {
+			upstream, reused = upstream_pool.Get(key)
+		}
+		if !reused {
+			wrap_conn, err := dial_upstream(ctx, req_addr, proxy)
+			if err != nil {
+				return false, err
+			}
+			upstream = pool.NewConn(wrap_conn)
+		}
+		err := req.Write(upstream)
+		var resp *http.Response
+		if err == nil {
+			resp, err = http.ReadResponse(upstream.Reader, req)
 		}
-		wrap_resp, err := http.ReadResponse(bufio.NewReader(wrap_conn), wrap_req)
 		if err != nil {
-			return err
+			upstream.Close()
+			// the idle connection may have been closed by upstream, retry on another one
+			if reused {
+				continue
+			}
+			return false, err
 		}
-		if wrap_resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("%s", wrap_resp.Status)
+		headers.Response(resp, req, proxy)
+		accesslog.FromContext(ctx).SetStatus(resp.StatusCode)
+		err = resp.Write(conn)
+		resp.Body.Close()
+		if err != nil || resp.Close || req.Close {
+			upstream.Close()
+		} else {
+			upstream_pool.Put(key, upstream)
 		}
-	}
-	if req.Method == http.MethodConnect {
-		//proxy through connect protocol
-		resp.StatusCode = http.StatusOK
-		resp.Status = "200 Connection established"
-		if err := resp.Write(conn); err != nil {
-			return err
+		if err != nil {
+			return true, err
 		}
-	} else {
-		//proxy directly
-		req.Header.Del("Proxy-Connection")
-		if err := req.Write(wrap_conn); err != nil {
-			return err
+		if resp.Close {
+			return true, handler.ErrConnClose
 		}
+		return true, nil
 	}
-	err = util.Transport(conn, wrap_conn)
-	return err
+}
 
+func write_error_response(conn net.Conn, status int, msg string) error {
+	resp := &http.Response{
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    status,
+		Header:        http.Header{},
+		ContentLength: int64(len(msg)),
+		Body:          io.NopCloser(bytes.NewBufferString(msg)),
+	}
+	return resp.Write(conn)
 }
 
-func auto_proxy(ctx context.Context, handler *handler.HttpHandler, conn net.Conn, req *http.Request) (err error) {
-	logger := logger.WithFields(
-		logrus.Fields{
-			"class":  "HttpHandler",
-			"handle": "auto_proxy",
-		})
+// listenerRoute routes connections accepted by a listener through the route tables of its pool
+type listenerRoute struct {
+	name     string
+	brouter  *route.ProxyBrouter
+	selector route.RouteSelector
+	fallback string
+	headers  *header.Policy
+	bypass   *bypass.List
+	pac      string // path of the Proxy Auto-Config served, empty if disabled
+}
 
-	var metadata meta.Metadata = meta.Metadata{}
-	var target_addr string = real_addr(*req)
+// serve_pac serves the Proxy Auto-Config pointing to the listener by the address the client requested it from
+func (l listenerRoute) serve_pac(conn net.Conn, req *http.Request) error {
+	script := l.bypass.PAC(l.fallback != config.FALLBACK_NONE, "PROXY "+req.Host)
+	resp := &http.Response{
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{},
+		ContentLength: int64(len(script)),
+		Body:          io.NopCloser(bytes.NewBufferString(script)),
+	}
+	resp.Header.Set("Content-Type", bypass.PAC_CONTENT_TYPE)
+	return resp.Write(conn)
+}
 
-	metadata["addr"] = target_addr
-	metadata["proto"] = http_proto(*req)
-	if req.Header != nil {
-		header_str, _ := json.Marshal(req.Header)
-		metadata["header"] = string(header_str)
+// route routes cb through the route tables, the path taken by each attempt is recorded in the access record of ctx
+func (l listenerRoute) route(ctx context.Context, cb route.RouteCallback, metadata meta.Metadata) error {
+	rec := accesslog.FromContext(ctx)
+	primary := func(proxy *model.Proxy) error {
+		rec.Attempt(accesslog.PATH_PROXY, proxy)
+		return cb(proxy)
+	}
+	backup := func(proxy *model.Proxy) error {
+		rec.Attempt(accesslog.PATH_BACKUP, proxy)
+		return cb(proxy)
+	}
+	metadata["listener"] = l.name
+	opts := []route.RouteOption{route.MetadataRouteOption(metadata)}
+	if l.selector != nil {
+		opts = append(opts, route.SelectorRouteOption(l.selector))
 	}
-	cb := func(proxy *model.Proxy) error {
-		start := time.Now()
-		defer func() {
-			logger := logger.WithFields(logrus.Fields{
-				"cost": fmt.Sprintf(" %.2fs", time.Since(start).Seconds()),
+	switch l.fallback {
+	case config.FALLBACK_BACKUP:
+		opts = append(opts, route.FallbackRouteOption(backup))
+	case config.FALLBACK_NONE:
+		opts = append(opts, route.DirectRouteOption(false))
+	}
+	return l.brouter.Route(ctx, primary, opts...)
+}
+
+func auto_proxy(l listenerRoute) handler.HttpHandle {
+	return func(ctx context.Context, h *handler.HttpHandler, conn net.Conn, req *http.Request) (err error) {
+		logger := logger.WithFields(
+			logrus.Fields{
+				"class":    "HttpHandler",
+				"handle":   "auto_proxy",
+				"listener": l.name,
 			})
-			if proxy == nil {
-				logger.Infof("redirect %s -> %s (direct) ", target_addr, "localhost")
+
+		// requests in origin-form are sent to the gateway itself rather than proxied
+		if l.pac != "" && req.URL.Host == "" && req.URL.Path == l.pac {
+			return l.serve_pac(conn, req)
+		}
+		var metadata meta.Metadata = meta.Metadata{}
+		var target_addr string = real_addr(*req)
+
+		rec := accesslog.NewRecord(l.name, http_proto(*req), conn.RemoteAddr(), target_addr)
+		rec.User = auth.UserFrom(ctx)
+		rec.Method, rec.URI, rec.HttpProto = req.Method, req.RequestURI, req.Proto
+		rec.Referer, rec.UserAgent = req.Referer(), req.UserAgent()
+		ctx = accesslog.NewContext(ctx, rec)
+		ctx = acl.NewContext(ctx, acl.NewClient(conn.RemoteAddr(), rec.User))
+		conn = rec.Conn(conn)
+		req.Body = rec.Body(req.Body)
+		if err := check_destination(ctx, target_addr); err != nil {
+			logger.Warnf("refused %s from %s (err: %+v)", target_addr, conn.RemoteAddr(), err)
+			rec.SetStatus(http.StatusForbidden)
+			rec.Done(err)
+			access_logger.Log(rec)
+			return write_error_response(conn, http.StatusForbidden, "destination denied")
+		}
+
+		metadata["addr"] = target_addr
+		metadata["proto"] = http_proto(*req)
+		if req.Header != nil {
+			header_str, _ := json.Marshal(req.Header)
+			metadata["header"] = string(header_str)
+		}
+		var (
+			responded bool
+			serve_err error
+		)
+		cb := func(proxy *model.Proxy) error {
+			start := time.Now()
+			defer func() {
+				logger := logger.WithFields(logrus.Fields{
+					"cost": fmt.Sprintf(" %.2fs", time.Since(start).Seconds()),
+				})
+				if proxy == nil {
+					logger.Infof("redirect %s -> %s (direct) ", target_addr, "localhost")
+				} else {
+					logger.Infof("redirect %s -> %s (proxied) ", target_addr, proxy.Ip)
+				}
+			}()
+			var err error
+			if req.Method == http.MethodConnect {
+				responded, err = proxy_http_request(ctx, conn, *req, proxy, l.headers)
 			} else {
-				logger.Infof("redirect %s -> %s (proxied) ", target_addr, proxy.Ip)
+				responded, err = forward_http_request(ctx, conn, req, proxy, l.headers)
+			}
+			if responded {
+				// the request is served, the error left is caused by client or closes the connection
+				serve_err = err
+				return nil
+			}
+			if err != nil && proxy != nil {
+				return route.NewRouteError(proxy.Ip, target_addr, err)
+			}
+			return err
+		}
+		err = l.route(ctx, cb, metadata)
+		if err != nil && !responded {
+			status, msg := http.StatusBadGateway, "proxy unreachable"
+			if errors.Is(err, route.ErrNoRoute) {
+				status, msg = http.StatusServiceUnavailable, "no proxy available"
+			} else if errors.Is(err, acl.ErrDenied) {
+				status, msg = http.StatusForbidden, "destination denied"
 			}
-		}()
-		err := proxy_http_request(ctx, conn, *req, proxy)
-		if err != nil && proxy != nil {
-			return route.NewRouteError(proxy.Ip, target_addr, err)
+			rec.SetStatus(status)
+			write_error_response(conn, status, msg)
+		} else if !errors.Is(serve_err, handler.ErrConnClose) {
+			err = serve_err
 		}
+		rec.Done(err)
+		access_logger.Log(rec)
+		return serve_err
+	}
+}
+
+// auto_tunnel relays connections of socks5 and transparent listeners to their target through the routed proxy
+func auto_tunnel(l listenerRoute, proto string) handler.TunnelHandle {
+	return func(ctx context.Context, conn net.Conn, target_addr string, established func() error) error {
+		logger := logger.WithFields(
+			logrus.Fields{
+				"class":    "TunnelHandler",
+				"handle":   "auto_tunnel",
+				"listener": l.name,
+			})
+		var metadata meta.Metadata = meta.Metadata{}
+		metadata["addr"] = target_addr
+		metadata["proto"] = proto
+		rec := accesslog.NewRecord(l.name, proto, conn.RemoteAddr(), target_addr)
+		rec.User = auth.UserFrom(ctx)
+		ctx = accesslog.NewContext(ctx, rec)
+		ctx = acl.NewContext(ctx, acl.NewClient(conn.RemoteAddr(), rec.User))
+		conn = rec.Conn(conn)
+		if err := check_destination(ctx, target_addr); err != nil {
+			logger.Warnf("refused %s from %s (err: %+v)", target_addr, conn.RemoteAddr(), err)
+			rec.Done(err)
+			access_logger.Log(rec)
+			return err
+		}
+		cb := func(proxy *model.Proxy) error {
+			start := time.Now()
+			wrap_conn, err := dial_upstream(ctx, target_addr, proxy)
+			if err != nil {
+				if proxy != nil {
+					return route.NewRouteError(proxy.Ip, target_addr, err)
+				}
+				return err
+			}
+			defer wrap_conn.Close()
+			defer func() {
+				logger := logger.WithFields(logrus.Fields{
+					"cost": fmt.Sprintf(" %.2fs", time.Since(start).Seconds()),
+				})
+				if proxy == nil {
+					logger.Infof("redirect %s -> %s (direct) ", target_addr, "localhost")
+				} else {
+					logger.Infof("redirect %s -> %s (proxied) ", target_addr, proxy.Ip)
+				}
+			}()
+			if err := established(); err != nil {
+				return err
+			}
+			if err := util.Transport(conn, wrap_conn); err != nil {
+				logger.Debugf("tunnel %s closed (err: %+v)", target_addr, err)
+			}
+			return nil
+		}
+		err := l.route(ctx, cb, metadata)
+		rec.Done(err)
+		access_logger.Log(rec)
 		return err
 	}
-	brouter.Route(ctx, cb, route.FallbackRouteOption(cb), route.MetadataRouteOption(metadata))
-	return nil
+}
+
+func new_auth_policy(conf config.Auth) (*auth.Policy, error) {
+	opts := []auth.PolicyOption{auth.AllowPolicyOption(conf.Allow...)}
+	for _, u := range conf.Users {
+		opts = append(opts, auth.UserPolicyOption(u.User, u.Password))
+	}
+	return auth.NewPolicy(opts...)
+}
+
+// new_access_logger creates the access logger declared by config, it's nil if access log is disabled
+func new_access_logger(conf *config.Config) (*accesslog.AccessLogger, error) {
+	var w io.Writer
+	switch conf.AccessLog.Path {
+	case "":
+		return nil, nil
+	case "-":
+		w = os.Stdout
+	default:
+		rw, err := accesslog.NewRotateWriter(conf.AccessLog.Path, int64(conf.AccessLog.MaxSize)<<20, conf.AccessLog.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w = rw
+	}
+	return accesslog.NewAccessLogger(
+		accesslog.FormatAccessLoggerOption(conf.AccessLog.Format),
+		accesslog.WriterAccessLoggerOption(w),
+	)
+}
+
+func load_config() (*config.Config, error) {
+	var conf config.Config
+	if config_file != "" {
+		if err := common.ParseConfig(config_file, &conf); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Manager.Address == "" {
+		conf.Manager.Address = manager_api
+	}
+	if conf.Manager.Token == "" {
+		conf.Manager.Token = manager_token
+	}
+	conf.Filter.Where = append(conf.Filter.Where, filters...)
+	conf.BackupFilter.Where = append(conf.BackupFilter.Where, backup_filters...)
+	if conf.Breaker.Threshold == 0 {
+		conf.Breaker.Threshold = breaker_threshold
+	}
+	if conf.Breaker.Cooldown == 0 {
+		conf.Breaker.Cooldown = breaker_cooldown
+	}
+	if conf.Breaker.MaxCooldown == 0 {
+		conf.Breaker.MaxCooldown = breaker_max_cooldown
+	}
+	if conf.AccessLog.Path == "" {
+		conf.AccessLog.Path = access_log
+	}
+	if conf.AccessLog.Format == "" {
+		conf.AccessLog.Format = access_log_format
+	}
+	if conf.KeepAlive == 0 {
+		conf.KeepAlive = keepalive
+	}
+	if conf.Upstream.MaxIdle == 0 {
+		conf.Upstream.MaxIdle = upstream_max_idle
+	}
+	if conf.Upstream.IdleTimeout == 0 {
+		conf.Upstream.IdleTimeout = upstream_idle
+	}
+	if len(conf.Listeners) < 1 {
+		conf.Listeners = []config.Listener{{Proto: config.PROTO_HTTP, Port: port}}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+func new_server(l config.Listener, lr listenerRoute, conf *config.Config, _logger *log.Logger) (*server.Server, error) {
+	policy, err := new_auth_policy(l.Auth)
+	if err != nil {
+		return nil, err
+	}
+	switch l.Proto {
+	case config.PROTO_SOCKS5:
+		return server.NewSocks5ProxyServer(
+			l.Port,
+			server.NameSocks5ProxyServerOption(l.Name),
+			server.HostSocks5ProxyServerOption(l.Host),
+			server.AuthSocks5ProxyServerOption(policy),
+			server.LogSocks5ProxyServerOption(_logger),
+			server.HandshakeTimeoutSocks5ProxyServerOption(CONNECT_TIMEOUT*time.Second),
+			server.HandleSocks5ProxyServerOption(auto_tunnel(lr, l.Proto)),
+		)
+	case config.PROTO_TRANSPARENT:
+		return server.NewTransparentProxyServer(
+			l.Port,
+			server.NameTransparentProxyServerOption(l.Name),
+			server.HostTransparentProxyServerOption(l.Host),
+			server.AuthTransparentProxyServerOption(policy),
+			server.LogTransparentProxyServerOption(_logger),
+			server.HandleTransparentProxyServerOption(auto_tunnel(lr, l.Proto)),
+		)
+	default:
+		return server.NewHttpProxyServer(
+			l.Port,
+			server.NameHttpProxyServerOption(l.Name),
+			server.HostHttpProxyServerOption(l.Host),
+			server.AuthHttpProxyServerOption(policy),
+			server.LogHttpProxyServerOption(_logger),
+			server.KeepAliveHttpProxyServerOption(conf.KeepAlive),
+			server.HandleHttpProxyServerOption(auto_proxy(lr)),
+		)
+	}
 }
 
 var (
-	port        int
-	manager_api string
-	loglevel    string
-	logger      *logrus.Logger
-	brouter     *route.ProxyBrouter
-	cmd         = &cobra.Command{
+	port                 int
+	manager_api          string
+	manager_token        string
+	config_file          string
+	filters              []string
+	backup_filters       []string
+	loglevel             string
+	breaker_threshold    int
+	breaker_cooldown     time.Duration
+	breaker_max_cooldown time.Duration
+	keepalive            time.Duration
+	upstream_max_idle    int
+	upstream_idle        time.Duration
+	upstream_pool        *pool.ConnPool
+	dns_resolver         *resolver.Resolver
+	access_log           string
+	access_log_format    string
+	access_logger        *accesslog.AccessLogger
+	dest_acl             *acl.ACL
+	logger               *logrus.Logger
+	cmd                  = &cobra.Command{
 		Use:   "http",
 		Short: "http proxy server",
 		Run: func(cmd *cobra.Command, args []string) {
 			_logger := log.Logger{Logger: logger}
-			var err error
 			common.SetLevel(loglevel)
+			conf, err := load_config()
 			if err != nil {
 				logger.Error(err)
 				return
 			}
 			ctx := context.Background()
-			brouter, err = route.NewProxyBrouter(ctx, manager_api, route.LogProxyBrouterOption(&_logger), route.RouteTableCapProxyBrouterOption(1000), route.RouteTableSizeProxyBrouterOption(20))
+			// all listeners share one connection to manager, one circuit breaker and the route tables of their pools
+			conn, err := client.NewManagerConn(ctx, conf.Manager.Address, client.TokenDialOption(conf.Manager.Token))
 			if err != nil {
 				logger.Error(err)
 				return
 			}
-			http_serv, err := server.NewHttpProxyServer(
-				port,
-				server.LogHttpProxyServerOption(&_logger),
-				server.HandleHttpProxyServerOption(auto_proxy),
-			)
+			defer conn.Close()
+			gateway_serv, err := service.NewGatewayService(conf.Manager.Address, service.CtxGatewayServiceOption(&ctx), service.LogGatewayServiceOption(&_logger), service.ConnGatewayServiceOption(conn))
 			if err != nil {
 				logger.Error(err)
 				return
 			}
-			http_serv.Serve()
+			dns_resolver, err = resolver.NewResolver(append(conf.ResolverOptions(), resolver.LogResolverOption(&_logger))...)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			access_logger, err = new_access_logger(conf)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			dest_acl, err = acl.NewACL(conf.ACLOptions()...)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			upstream_pool = pool.NewConnPool(
+				pool.LogConnPoolOption(&_logger),
+				pool.MaxIdleConnPoolOption(max(conf.Upstream.MaxIdle, 0)),
+				pool.IdleTimeoutConnPoolOption(conf.Upstream.IdleTimeout),
+			)
+			defer upstream_pool.Close()
+			proxy_breaker := breaker.NewBreaker(
+				breaker.ThresholdBreakerOption(conf.Breaker.Threshold),
+				breaker.CooldownBreakerOption(conf.Breaker.Cooldown),
+				breaker.MaxCooldownBreakerOption(conf.Breaker.MaxCooldown),
+			)
+			brouters := make(map[string]*route.ProxyBrouter)
+			gateway := internal.NewGateway(_logger)
+			for _, l := range conf.Listeners {
+				brouter, ok := brouters[l.RouteTable()]
+				if !ok {
+					f, bf := conf.Filters(l)
+					proxy_filter, err := f.Pb()
+					if err != nil {
+						logger.Errorf("invalid filter of route table %s (error: %s)", l.RouteTable(), err)
+						return
+					}
+					backup_filter, err := bf.Pb()
+					if err != nil {
+						logger.Errorf("invalid backup filter of route table %s (error: %s)", l.RouteTable(), err)
+						return
+					}
+					logger.Infof("route table %s: filter %+v, backup filter %+v", l.RouteTable(), f, bf)
+					bypass_list, err := conf.BypassList(l)
+					if err != nil {
+						logger.Errorf("invalid bypass list of listener %s (error: %s)", l.Name, err)
+						return
+					}
+					brouter_opts := []route.ProxyBrouterOption{
+						route.BypassProxyBrouterOption(bypass_list),
+						route.LogProxyBrouterOption(&_logger),
+						route.RouteTableCapProxyBrouterOption(1000),
+						route.RouteTableSizeProxyBrouterOption(20),
+						route.BreakerProxyBrouterOption(proxy_breaker),
+						route.ConnProxyBrouterOption(conn),
+						route.GatewayServiceProxyBrouterOption(gateway_serv),
+						route.FilterProxyBrouterOption(proxy_filter),
+						route.BackupFilterProxyBrouterOption(backup_filter),
+					}
+					brouter, err = route.NewProxyBrouter(ctx, conf.Manager.Address, brouter_opts...)
+					if err != nil {
+						logger.Error(err)
+						return
+					}
+					brouters[l.RouteTable()] = brouter
+				}
+				lr := listenerRoute{name: l.Name, brouter: brouter, fallback: l.Fallback}
+				lr.bypass, err = conf.BypassList(l)
+				if err != nil {
+					logger.Errorf("invalid bypass list of listener %s (error: %s)", l.Name, err)
+					return
+				}
+				if !conf.PAC.Disabled {
+					lr.pac = conf.PAC.Path
+				}
+				lr.headers, err = header.NewPolicy(conf.HeaderRules(l)...)
+				if err != nil {
+					logger.Error(err)
+					return
+				}
+				if l.Selector != "" {
+					lr.selector, err = selector.NewSelector[route.Route[model.Proxy]](l.Selector)
+					if err != nil {
+						logger.Error(err)
+						return
+					}
+				}
+				serv, err := new_server(l, lr, conf, &_logger)
+				if err != nil {
+					logger.Errorf("failed to create listener %s (err: %+v)", l.Name, err)
+					return
+				}
+				gateway.AddServer(*serv)
+			}
+			gateway.Serve()
 		},
 	}
 )
@@ -211,8 +702,19 @@ var (
 func main() {
 	cmd.Flags().IntVarP(&port, "port", "p", 8000, "port listened on")
 	cmd.Flags().StringVarP(&manager_api, "manager-api", "m", "", "grpc service address of proxy service")
+	cmd.Flags().StringVarP(&manager_token, "manager-token", "", os.Getenv("MANAGER_TOKEN"), "token granted the scope of credentials by manager (required), proxies can't be routed through with credentials redacted")
+	cmd.Flags().StringVarP(&config_file, "conf", "c", "", "config file declaring listeners and pools")
+	cmd.Flags().StringArrayVarP(&filters, "filter", "f", nil, "condition of proxies applied to all pools, e.g. country=US,JP or latency<=300")
+	cmd.Flags().StringArrayVarP(&backup_filters, "backup-filter", "", nil, "condition of backup proxies applied to all pools")
 	cmd.Flags().StringVarP(&loglevel, "log", "l", "INFO", "log level")
-	cmd.MarkFlagRequired("manager-api")
+	cmd.Flags().IntVarP(&breaker_threshold, "breaker-threshold", "", 3, "consecutive failures before a proxy is quarantined")
+	cmd.Flags().DurationVarP(&breaker_cooldown, "breaker-cooldown", "", 30*time.Second, "quarantine duration of a proxy, doubled on each re-opening")
+	cmd.Flags().DurationVarP(&breaker_max_cooldown, "breaker-max-cooldown", "", 30*time.Minute, "maximum quarantine duration of a proxy")
+	cmd.Flags().StringVarP(&access_log, "access-log", "", "", "file of access log, - for stdout")
+	cmd.Flags().StringVarP(&access_log_format, "access-log-format", "", accesslog.FORMAT_JSON, "format of access log: json, common or combined")
+	cmd.Flags().DurationVarP(&keepalive, "keepalive", "", 60*time.Second, "idle timeout of keep-alive client connections, negative disables keep-alive")
+	cmd.Flags().IntVarP(&upstream_max_idle, "upstream-max-idle", "", 8, "idle upstream connections kept per proxy and target, negative disables pooling")
+	cmd.Flags().DurationVarP(&upstream_idle, "upstream-idle-timeout", "", 90*time.Second, "idle timeout of pooled upstream connections")
 	common.SetupLog("class", "method")
 	logger = logrus.StandardLogger()
 	if err := cmd.Execute(); err != nil {
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/accesslog"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/acl"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/bypass"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/filter"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/header"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/resolver"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/selector"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/service"
+)
+
+const (
+	PROTO_HTTP        = "http"
+	PROTO_SOCKS5      = "socks5"
+	PROTO_TRANSPARENT = "transparent"
+)
+
+const (
+	FALLBACK_BACKUP = "backup" // fallback to backup proxies, then connect directly
+	FALLBACK_DIRECT = "direct" // connect directly without trying backup proxies
+	FALLBACK_NONE   = "none"   // fail if no proxy could be routed
+)
+
+const (
+	DEFAULT_POOL     = "default"
+	DEFAULT_PAC_PATH = "/proxy.pac"
+)
+
+type User struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+type Auth struct {
+	Users []User   `yaml:"users"`
+	Allow []string `yaml:"allow"` // CIDRs or IPs of clients allowed to connect
+}
+
+// Pool declares the proxies routed by listeners, listeners with the same pool share the route tables
+type Pool struct {
+	Filter       filter.Filter `yaml:"filter"`
+	BackupFilter filter.Filter `yaml:"backup_filter"`
+	Headers      []header.Rule `yaml:"headers"`
+	Bypass       []string      `yaml:"bypass"`
+}
+
+type Listener struct {
+	Name     string `yaml:"name"`
+	Proto    string `yaml:"proto"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Auth     Auth   `yaml:"auth"`
+	Pool     string `yaml:"pool"`
+	Selector string `yaml:"selector"`
+	Fallback string `yaml:"fallback"`
+	// filters overriding the ones of pool, the listener owns its route tables once declared
+	Filter       filter.Filter `yaml:"filter"`
+	BackupFilter filter.Filter `yaml:"backup_filter"`
+	Headers      []header.Rule `yaml:"headers"`
+	Bypass       []string      `yaml:"bypass"`
+}
+
+// RouteTable returns the name of route tables used by the listener
+func (l Listener) RouteTable() string {
+	if l.Filter.IsZero() && l.BackupFilter.IsZero() && len(l.Bypass) < 1 {
+		return l.Pool
+	}
+	return l.Pool + "/" + l.Name
+}
+
+type Config struct {
+	Manager struct {
+		Address string `yaml:"address" envconfig:"MANAGER_ADDRESS"`
+		Token   string `yaml:"token" envconfig:"MANAGER_TOKEN"` // token granted the scope of credentials, which are redacted without it
+	} `yaml:"manager"`
+	Breaker struct {
+		Threshold   int           `yaml:"threshold"`
+		Cooldown    time.Duration `yaml:"cooldown"`
+		MaxCooldown time.Duration `yaml:"max_cooldown"`
+	} `yaml:"breaker"`
+	AccessLog struct {
+		Path       string `yaml:"path"`        // file of access log, `-` for stdout, empty disables access log
+		Format     string `yaml:"format"`      // json, common or combined
+		MaxSize    int    `yaml:"max_size"`    // megabytes of the file before rotated, 0 disables rotation
+		MaxBackups int    `yaml:"max_backups"` // rotated files kept
+	} `yaml:"access_log"`
+	// destinations clients are allowed to connect to, loopback, private and link-local ranges and manager are denied by default
+	ACL struct {
+		Defaults *bool      `yaml:"defaults"`
+		Rules    []acl.Rule `yaml:"rules"`
+	} `yaml:"acl"`
+	// idle timeout of keep-alive client connections of http listeners, negative disables keep-alive
+	KeepAlive time.Duration `yaml:"keepalive"`
+	Upstream  struct {
+		MaxIdle     int           `yaml:"max_idle"` // idle connections kept per proxy and target, negative disables pooling
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+	} `yaml:"upstream"`
+	// resolution of target hosts, hosts are resolved by the upstream proxy by default to avoid dns leaks
+	DNS struct {
+		Mode    string            `yaml:"mode"`
+		Server  string            `yaml:"server"` // e.g. `8.8.8.8`, `tcp://1.1.1.1:53` or `https://dns.google/dns-query`
+		Prefer  string            `yaml:"prefer"` // ipv4, ipv6, ipv4_only or ipv6_only
+		Timeout time.Duration     `yaml:"timeout"`
+		Hosts   map[string]string `yaml:"hosts"` // addresses of hostnames separated by comma
+		Rules   []resolver.Rule   `yaml:"rules"`
+	} `yaml:"dns"`
+	// filters applied to all pools
+	Filter       filter.Filter `yaml:"filter"`
+	BackupFilter filter.Filter `yaml:"backup_filter"`
+	Headers      []header.Rule `yaml:"headers"` // header rules applied to all listeners
+	// destinations connected directly by all pools, see bypass.List for the entries
+	Bypass []string `yaml:"bypass"`
+	// Proxy Auto-Config served by http listeners, built from the bypass list of the listener
+	PAC struct {
+		Disabled bool   `yaml:"disabled"`
+		Path     string `yaml:"path"`
+	} `yaml:"pac"`
+	Pools     map[string]Pool `yaml:"pools"`
+	Listeners []Listener      `yaml:"listeners"`
+}
+
+// Filters returns the filters of route tables used by the listener,
+// declarations of listener override those of its pool which override those of the gateway
+func (c *Config) Filters(l Listener) (filter.Filter, filter.Filter) {
+	pool := c.Pools[l.Pool]
+	f := service.DefaultFilter.Override(c.Filter).Override(pool.Filter).Override(l.Filter)
+	bf := service.DefaultBackupFilter.Override(c.BackupFilter).Override(pool.BackupFilter).Override(l.BackupFilter)
+	return f, bf
+}
+
+// HeaderRules returns the header rules of the listener, rules of the gateway are applied first, then those of its pool and its own
+func (c *Config) HeaderRules(l Listener) []header.Rule {
+	var rules []header.Rule
+	rules = append(rules, c.Headers...)
+	rules = append(rules, c.Pools[l.Pool].Headers...)
+	return append(rules, l.Headers...)
+}
+
+// ResolverOptions returns the options of resolver declared by dns
+func (c *Config) ResolverOptions() []resolver.ResolverOption {
+	return []resolver.ResolverOption{
+		resolver.ModeResolverOption(c.DNS.Mode),
+		resolver.ServerResolverOption(c.DNS.Server),
+		resolver.PreferResolverOption(c.DNS.Prefer),
+		resolver.TimeoutResolverOption(c.DNS.Timeout),
+		resolver.HostsResolverOption(c.DNS.Hosts),
+		resolver.RulesResolverOption(c.DNS.Rules...),
+	}
+}
+
+// BypassList returns the bypass list of the listener, entries of the gateway, its pool and its own are combined
+func (c *Config) BypassList(l Listener) (*bypass.List, error) {
+	var entries []string
+	entries = append(entries, c.Bypass...)
+	entries = append(entries, c.Pools[l.Pool].Bypass...)
+	return bypass.NewList(append(entries, l.Bypass...)...)
+}
+
+// ACLOptions returns the options of the destination acl, the address of manager is always denied
+func (c *Config) ACLOptions() []acl.ACLOption {
+	opts := []acl.ACLOption{acl.RulesACLOption(c.ACL.Rules...)}
+	if c.ACL.Defaults != nil {
+		opts = append(opts, acl.DefaultsACLOption(*c.ACL.Defaults))
+	}
+	if _, _, err := net.SplitHostPort(c.Manager.Address); err == nil {
+		opts = append(opts, acl.DenyAddrACLOption(c.Manager.Address))
+	}
+	return opts
+}
+
+// Validate checks the config and fills the defaults of listeners and pools
+func (c *Config) Validate() error {
+	if c.Manager.Address == "" {
+		return fmt.Errorf("address of manager is required")
+	}
+	if c.Manager.Token == "" {
+		return fmt.Errorf("token of manager is required, proxies can't be routed through with credentials redacted")
+	}
+	if len(c.Listeners) < 1 {
+		return fmt.Errorf("at least one listener is required")
+	}
+	if _, err := accesslog.NewAccessLogger(accesslog.FormatAccessLoggerOption(c.AccessLog.Format)); err != nil {
+		return err
+	}
+	if _, err := acl.NewACL(c.ACLOptions()...); err != nil {
+		return fmt.Errorf("invalid acl (err: %+v)", err)
+	}
+	if _, err := resolver.NewResolver(c.ResolverOptions()...); err != nil {
+		return fmt.Errorf("invalid dns (err: %+v)", err)
+	}
+	if c.Pools == nil {
+		c.Pools = make(map[string]Pool)
+	}
+	if c.PAC.Path == "" {
+		c.PAC.Path = DEFAULT_PAC_PATH
+	}
+	if _, ok := c.Pools[DEFAULT_POOL]; !ok {
+		c.Pools[DEFAULT_POOL] = Pool{}
+	}
+	names := make(map[string]bool)
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		if l.Proto == "" {
+			l.Proto = PROTO_HTTP
+		}
+		switch l.Proto {
+		case PROTO_HTTP, PROTO_SOCKS5, PROTO_TRANSPARENT:
+		default:
+			return fmt.Errorf("invalid proto %s of listener %d", l.Proto, i)
+		}
+		if l.Port <= 0 || l.Port > 65535 {
+			return fmt.Errorf("invalid port %d of listener %d", l.Port, i)
+		}
+		if l.Name == "" {
+			l.Name = fmt.Sprintf("%s-%d", l.Proto, l.Port)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("duplicated listener %s", l.Name)
+		}
+		names[l.Name] = true
+		if l.Pool == "" {
+			l.Pool = DEFAULT_POOL
+		}
+		if _, ok := c.Pools[l.Pool]; !ok {
+			return fmt.Errorf("pool %s of listener %s is not declared", l.Pool, l.Name)
+		}
+		if l.Selector != "" {
+			if _, err := selector.NewSelector[any](l.Selector); err != nil {
+				return fmt.Errorf("invalid selector of listener %s (err: %+v)", l.Name, err)
+			}
+		}
+		if l.Fallback == "" {
+			l.Fallback = FALLBACK_BACKUP
+		}
+		switch l.Fallback {
+		case FALLBACK_BACKUP, FALLBACK_DIRECT, FALLBACK_NONE:
+		default:
+			return fmt.Errorf("invalid fallback %s of listener %s", l.Fallback, l.Name)
+		}
+		if l.Proto == PROTO_TRANSPARENT && len(l.Auth.Users) > 0 {
+			return fmt.Errorf("transparent listener %s can't authenticate users", l.Name)
+		}
+		f, bf := c.Filters(*l)
+		if _, err := f.Pb(); err != nil {
+			return fmt.Errorf("invalid filter of listener %s (err: %+v)", l.Name, err)
+		}
+		if _, err := bf.Pb(); err != nil {
+			return fmt.Errorf("invalid backup filter of listener %s (err: %+v)", l.Name, err)
+		}
+		if _, err := c.BypassList(*l); err != nil {
+			return fmt.Errorf("invalid bypass of listener %s (err: %+v)", l.Name, err)
+		}
+		if _, err := header.NewPolicy(c.HeaderRules(*l)...); err != nil {
+			return fmt.Errorf("invalid headers of listener %s (err: %+v)", l.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	FORMAT_JSON     = "json"
+	FORMAT_COMMON   = "common"   // Common Log Format
+	FORMAT_COMBINED = "combined" // Combined Log Format, the Common Log Format with referer and user agent
+)
+
+const clf_time_layout = "02/Jan/2006:15:04:05 -0700"
+
+type AccessLoggerOptions struct {
+	format *string
+	writer io.Writer
+}
+
+type AccessLoggerOption func(*AccessLoggerOptions)
+
+// FormatAccessLoggerOption sets the format of records, defaults to FORMAT_JSON
+func FormatAccessLoggerOption(format string) AccessLoggerOption {
+	return func(options *AccessLoggerOptions) {
+		options.format = &format
+	}
+}
+
+func WriterAccessLoggerOption(writer io.Writer) AccessLoggerOption {
+	return func(options *AccessLoggerOptions) {
+		options.writer = writer
+	}
+}
+
+// AccessLogger writes one line per record, a nil logger discards records
+type AccessLogger struct {
+	mu     sync.Mutex
+	format string
+	writer io.Writer
+}
+
+func NewAccessLogger(opts ...AccessLoggerOption) (*AccessLogger, error) {
+	options := &AccessLoggerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	l := &AccessLogger{format: FORMAT_JSON, writer: io.Discard}
+	if options.format != nil && *options.format != "" {
+		l.format = *options.format
+	}
+	switch l.format {
+	case FORMAT_JSON, FORMAT_COMMON, FORMAT_COMBINED:
+	default:
+		return nil, fmt.Errorf("invalid access log format %s", l.format)
+	}
+	if options.writer != nil {
+		l.writer = options.writer
+	}
+	return l, nil
+}
+
+func (l *AccessLogger) Log(r *Record) error {
+	if l == nil || r == nil {
+		return nil
+	}
+	line, err := l.Format(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.writer.Write(line)
+	return err
+}
+
+// Format formats the record as a line in the format of logger
+func (l *AccessLogger) Format(r *Record) ([]byte, error) {
+	if l.format == FORMAT_JSON {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host := r.Client
+	if idx := strings.LastIndex(host, ":"); idx > 0 {
+		host = strings.Trim(host[:idx], "[]")
+	}
+	method, uri, proto := r.Method, r.URI, r.HttpProto
+	if method == "" {
+		method = "CONNECT"
+	}
+	if uri == "" {
+		uri = r.Target
+	}
+	if proto == "" {
+		proto = strings.ToUpper(r.Proto)
+	}
+	status := "-"
+	if r.Status > 0 {
+		status = strconv.Itoa(r.Status)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - %s [%s] %q %s %s", dash(host), dash(r.User), r.Time.Format(clf_time_layout),
+		method+" "+uri+" "+proto, status, dash(strconv.FormatInt(r.BytesOut(), 10)))
+	if l.format == FORMAT_COMBINED {
+		fmt.Fprintf(&b, " %q %q", dash(r.Referer), dash(r.UserAgent))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+func dash(s string) string {
+	if s == "" || s == "0" {
+		return "-"
+	}
+	return s
+}
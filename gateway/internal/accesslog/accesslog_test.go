@@ -0,0 +1,100 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRecord() *Record {
+	r := NewRecord("http", "http", &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, "example.com:80")
+	r.Time = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.User = "alice"
+	r.Method, r.URI, r.HttpProto = "GET", "http://example.com/", "HTTP/1.1"
+	r.UserAgent = "curl/8.0"
+	r.Attempt(PATH_PROXY, &model.Proxy{Id: "p1", Ip: "1.1.1.1"})
+	r.Attempt(PATH_BACKUP, &model.Proxy{Id: "p2", Ip: "2.2.2.2", Provider: "free"})
+	r.SetStatus(200)
+	r.bytes_out.Add(512)
+	return r
+}
+
+func TestAccessLoggerFormat(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "AccessLogger.Format.Common",
+			Input:    FORMAT_COMMON,
+			Error:    nil,
+			Expected: "10.0.0.1 - alice [02/Jan/2024:03:04:05 +0000] \"GET http://example.com/ HTTP/1.1\" 200 512\n",
+			Check: func(tc test.TestCase[any, any]) {
+				l, err := NewAccessLogger(FormatAccessLoggerOption(tc.Input.(string)))
+				assert.Nil(t, err)
+				line, err := l.Format(newTestRecord())
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, string(line))
+			},
+		},
+		{
+			Name:     "AccessLogger.Format.Combined",
+			Input:    FORMAT_COMBINED,
+			Error:    nil,
+			Expected: "10.0.0.1 - alice [02/Jan/2024:03:04:05 +0000] \"GET http://example.com/ HTTP/1.1\" 200 512 \"-\" \"curl/8.0\"\n",
+			Check: func(tc test.TestCase[any, any]) {
+				l, err := NewAccessLogger(FormatAccessLoggerOption(tc.Input.(string)))
+				assert.Nil(t, err)
+				line, err := l.Format(newTestRecord())
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, string(line))
+			},
+		},
+	}
+	test.Run(cases, t)
+	_, err := NewAccessLogger(FormatAccessLoggerOption("xml"))
+	assert.Error(t, err)
+}
+
+func TestAccessLoggerJSON(t *testing.T) {
+	l, err := NewAccessLogger()
+	assert.Nil(t, err)
+	r := newTestRecord()
+	r.Done(errors.New("reset"))
+	line, err := l.Format(r)
+	assert.Nil(t, err)
+	var fields map[string]any
+	assert.Nil(t, json.Unmarshal(line, &fields))
+	assert.Equal(t, "p2", fields["proxy_id"])
+	assert.Equal(t, "free", fields["proxy_provider"])
+	assert.Equal(t, PATH_BACKUP, fields["path"])
+	assert.Equal(t, float64(1), fields["retries"])
+	assert.Equal(t, "reset", fields["error"])
+
+	r.Attempt(PATH_PROXY, nil)
+	assert.Equal(t, PATH_DIRECT, r.Path)
+	assert.Equal(t, "", r.ProxyId)
+}
+
+func TestRotateWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w, err := NewRotateWriter(path, 10, 2)
+	assert.Nil(t, err)
+	defer w.Close()
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		_, err := w.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+	for name, expected := range map[string]string{path: "line-4\n", path + ".1": "line-3\n", path + ".2": "line-2\n"} {
+		data, err := os.ReadFile(name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(data))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
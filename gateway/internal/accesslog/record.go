@@ -0,0 +1,242 @@
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+// paths a connection or request is routed through
+const (
+	PATH_PROXY  = "proxy"
+	PATH_BACKUP = "backup"
+	PATH_DIRECT = "direct"
+)
+
+// Record is the access record of a client connection (socks5, transparent and CONNECT) or a plain http request.
+// Methods of record are safe for concurrent use and do nothing on a nil record.
+type Record struct {
+	mu            sync.Mutex
+	Time          time.Time
+	Listener      string
+	Proto         string
+	Client        string
+	User          string
+	Target        string
+	Method        string
+	URI           string
+	HttpProto     string
+	Referer       string
+	UserAgent     string
+	ProxyId       string
+	ProxyIp       string
+	ProxyProvider string
+	Path          string
+	Attempts      int
+	Status        int
+	Dial          time.Duration // dial of the last attempt
+	Connect       time.Duration // CONNECT handshake with the proxy of the last attempt
+	Duration      time.Duration
+	Error         string
+	bytes_in      atomic.Int64 // bytes received from client
+	bytes_out     atomic.Int64 // bytes sent to client
+}
+
+func NewRecord(listener string, proto string, client net.Addr, target string) *Record {
+	r := &Record{Time: time.Now(), Listener: listener, Proto: proto, Target: target}
+	if client != nil {
+		r.Client = client.String()
+	}
+	return r
+}
+
+// Attempt records a route attempt through proxy, proxy is nil for direct connections
+func (r *Record) Attempt(path string, proxy *model.Proxy) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Attempts++
+	r.ProxyId, r.ProxyIp, r.ProxyProvider = "", "", ""
+	if proxy == nil {
+		r.Path = PATH_DIRECT
+		return
+	}
+	r.Path = path
+	r.ProxyId, r.ProxyIp, r.ProxyProvider = proxy.Id, proxy.Ip, proxy.Provider
+}
+
+func (r *Record) Dialed(d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Dial = d
+	r.Connect = 0
+}
+
+func (r *Record) Connected(d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Connect = d
+}
+
+func (r *Record) SetStatus(status int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Status = status
+}
+
+// Done finishes the record with the error of the connection or request
+func (r *Record) Done(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Duration = time.Since(r.Time)
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Retries returns the number of attempts before the last one
+func (r *Record) Retries() int {
+	return max(r.Attempts-1, 0)
+}
+
+func (r *Record) BytesIn() int64 {
+	return r.bytes_in.Load()
+}
+
+func (r *Record) BytesOut() int64 {
+	return r.bytes_out.Load()
+}
+
+// Conn counts the bytes read from and written to the client connection
+func (r *Record) Conn(conn net.Conn) net.Conn {
+	if r == nil {
+		return conn
+	}
+	return &countConn{Conn: conn, r: r}
+}
+
+// Body counts the bytes of a request body read from client
+func (r *Record) Body(body io.ReadCloser) io.ReadCloser {
+	if r == nil || body == nil || body == http.NoBody {
+		return body
+	}
+	return &countBody{ReadCloser: body, r: r}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r *Record) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(struct {
+		Time          string  `json:"time"`
+		Listener      string  `json:"listener"`
+		Proto         string  `json:"proto"`
+		Client        string  `json:"client"`
+		User          string  `json:"user,omitempty"`
+		Target        string  `json:"target"`
+		Method        string  `json:"method,omitempty"`
+		URI           string  `json:"uri,omitempty"`
+		Referer       string  `json:"referer,omitempty"`
+		UserAgent     string  `json:"user_agent,omitempty"`
+		ProxyId       string  `json:"proxy_id,omitempty"`
+		ProxyIp       string  `json:"proxy_ip,omitempty"`
+		ProxyProvider string  `json:"proxy_provider,omitempty"`
+		Path          string  `json:"path,omitempty"`
+		Retries       int     `json:"retries"`
+		Status        int     `json:"status,omitempty"`
+		BytesIn       int64   `json:"bytes_in"`
+		BytesOut      int64   `json:"bytes_out"`
+		Dial          float64 `json:"dial_ms"`
+		Connect       float64 `json:"connect_ms"`
+		Duration      float64 `json:"duration_ms"`
+		Error         string  `json:"error,omitempty"`
+	}{
+		Time:          r.Time.Format(time.RFC3339Nano),
+		Listener:      r.Listener,
+		Proto:         r.Proto,
+		Client:        r.Client,
+		User:          r.User,
+		Target:        r.Target,
+		Method:        r.Method,
+		URI:           r.URI,
+		Referer:       r.Referer,
+		UserAgent:     r.UserAgent,
+		ProxyId:       r.ProxyId,
+		ProxyIp:       r.ProxyIp,
+		ProxyProvider: r.ProxyProvider,
+		Path:          r.Path,
+		Retries:       r.Retries(),
+		Status:        r.Status,
+		BytesIn:       r.BytesIn(),
+		BytesOut:      r.BytesOut(),
+		Dial:          ms(r.Dial),
+		Connect:       ms(r.Connect),
+		Duration:      ms(r.Duration),
+		Error:         r.Error,
+	})
+}
+
+type recordKey struct{}
+
+// NewContext returns a copy of ctx carrying the record
+func NewContext(ctx context.Context, r *Record) context.Context {
+	return context.WithValue(ctx, recordKey{}, r)
+}
+
+// FromContext returns the record carried by ctx, it's nil if there is none
+func FromContext(ctx context.Context) *Record {
+	r, _ := ctx.Value(recordKey{}).(*Record)
+	return r
+}
+
+type countConn struct {
+	net.Conn
+	r *Record
+}
+
+func (c *countConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.r.bytes_in.Add(int64(n))
+	return n, err
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.r.bytes_out.Add(int64(n))
+	return n, err
+}
+
+type countBody struct {
+	io.ReadCloser
+	r *Record
+}
+
+func (b *countBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.r.bytes_in.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,79 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const default_max_backups = 5
+
+// RotateWriter appends to a file and rotates it once it exceeds the max size,
+// rotated files are renamed to <path>.1 (the newest) ... <path>.<max backups>
+type RotateWriter struct {
+	mu          sync.Mutex
+	path        string
+	max_size    int64
+	max_backups int
+	file        *os.File
+	size        int64
+}
+
+// NewRotateWriter opens the file of path, max_size <= 0 disables rotation and max_backups <= 0 keeps 5 backups
+func NewRotateWriter(path string, max_size int64, max_backups int) (*RotateWriter, error) {
+	w := &RotateWriter{path: path, max_size: max_size, max_backups: max_backups}
+	if w.max_backups <= 0 {
+		w.max_backups = default_max_backups
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.max_size > 0 && w.size > 0 && w.size+int64(len(p)) > w.max_size {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.max_backups))
+	for i := w.max_backups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
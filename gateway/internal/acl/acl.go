@@ -0,0 +1,329 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	ACTION_ALLOW = "allow"
+	ACTION_DENY  = "deny"
+)
+
+var ErrDenied = errors.New("destination denied")
+
+// DefaultDenyCIDRs are the ranges of loopback, private, link-local, shared and reserved addresses denied by default
+var DefaultDenyCIDRs = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// DefaultDenyHosts are the patterns of hostnames denied by default
+var DefaultDenyHosts = []string{"localhost", "*.localhost"}
+
+// Client is the client a destination is checked for
+type Client struct {
+	IP   net.IP
+	User string
+}
+
+func NewClient(addr net.Addr, user string) Client {
+	c := Client{User: user}
+	if tcp_addr, ok := addr.(*net.TCPAddr); ok {
+		c.IP = tcp_addr.IP
+	} else if addr != nil {
+		host, _, _ := net.SplitHostPort(addr.String())
+		c.IP = net.ParseIP(host)
+	}
+	return c
+}
+
+type clientKey struct{}
+
+// NewContext returns a copy of ctx carrying the client
+func NewContext(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+func FromContext(ctx context.Context) Client {
+	c, _ := ctx.Value(clientKey{}).(Client)
+	return c
+}
+
+// Rule allows or denies destinations, declared conditions must all be matched,
+// e.g. a rule with clients and ports only matches destinations on the ports requested by the clients.
+type Rule struct {
+	Action  string   `yaml:"action"`
+	Clients []string `yaml:"clients"` // CIDRs or IPs of clients
+	Users   []string `yaml:"users"`   // users authenticated
+	Hosts   []string `yaml:"hosts"`   // patterns of destination hostnames, e.g. `*.internal`
+	CIDRs   []string `yaml:"cidrs"`   // CIDRs or IPs of destinations
+	Ports   []string `yaml:"ports"`   // ports or port ranges of destinations, e.g. `443` or `8000-8100`
+}
+
+type portRange struct {
+	from int
+	to   int
+}
+
+type rule struct {
+	deny    bool
+	clients []*net.IPNet
+	users   map[string]bool
+	hosts   []string
+	cidrs   []*net.IPNet
+	ports   []portRange
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+func parsePorts(ports []string) ([]portRange, error) {
+	var ranges []portRange
+	for _, p := range ports {
+		from, to, found := strings.Cut(p, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		end := start
+		if found {
+			if end, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || end < start {
+				return nil, fmt.Errorf("invalid port range %q", p)
+			}
+		}
+		ranges = append(ranges, portRange{from: start, to: end})
+	}
+	return ranges, nil
+}
+
+func newRule(r Rule) (*rule, error) {
+	compiled := &rule{users: make(map[string]bool)}
+	switch r.Action {
+	case ACTION_ALLOW:
+	case ACTION_DENY:
+		compiled.deny = true
+	default:
+		return nil, fmt.Errorf("invalid action %q", r.Action)
+	}
+	var err error
+	if compiled.clients, err = parseCIDRs(r.Clients); err != nil {
+		return nil, err
+	}
+	if compiled.cidrs, err = parseCIDRs(r.CIDRs); err != nil {
+		return nil, err
+	}
+	if compiled.ports, err = parsePorts(r.Ports); err != nil {
+		return nil, err
+	}
+	for _, pattern := range r.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid host pattern %q", pattern)
+		}
+		compiled.hosts = append(compiled.hosts, strings.ToLower(pattern))
+	}
+	for _, user := range r.Users {
+		compiled.users[user] = true
+	}
+	return compiled, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks a destination, ip is nil if the host is resolved by the upstream proxy
+func (r *rule) match(client Client, host string, ip net.IP, port int) bool {
+	if len(r.clients) > 0 || len(r.users) > 0 {
+		if !(client.IP != nil && contains(r.clients, client.IP)) && !r.users[client.User] {
+			return false
+		}
+	}
+	if len(r.hosts) > 0 || len(r.cidrs) > 0 {
+		if !matchHost(r.hosts, host) && !(ip != nil && contains(r.cidrs, ip)) {
+			return false
+		}
+	}
+	if len(r.ports) > 0 {
+		matched := false
+		for _, p := range r.ports {
+			if port >= p.from && port <= p.to {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+type ACLOptions struct {
+	rules    []Rule
+	defaults *bool
+	deny     []string
+}
+
+type ACLOption func(*ACLOptions)
+
+// RulesACLOption sets the rules of acl, the first rule matched decides whether a destination is allowed
+func RulesACLOption(rules ...Rule) ACLOption {
+	return func(options *ACLOptions) {
+		options.rules = append(options.rules, rules...)
+	}
+}
+
+// DefaultsACLOption sets whether DefaultDenyCIDRs and DefaultDenyHosts are denied, it's enabled by default
+func DefaultsACLOption(defaults bool) ACLOption {
+	return func(options *ACLOptions) {
+		options.defaults = &defaults
+	}
+}
+
+// DenyAddrACLOption denies the addresses (host:port), e.g. the one of manager
+func DenyAddrACLOption(addrs ...string) ACLOption {
+	return func(options *ACLOptions) {
+		options.deny = append(options.deny, addrs...)
+	}
+}
+
+// ACL checks destinations of clients after resolution and before dialing.
+// Rules are checked in order, then the addresses denied and the defaults, destinations matched by none are allowed.
+// A nil acl allows all destinations.
+type ACL struct {
+	rules []*rule
+}
+
+func NewACL(opts ...ACLOption) (*ACL, error) {
+	options := &ACLOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	a := &ACL{}
+	for i, r := range options.rules {
+		compiled, err := newRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("acl rule %d: %w", i, err)
+		}
+		a.rules = append(a.rules, compiled)
+	}
+	for _, addr := range options.deny {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied address %q", addr)
+		}
+		r := Rule{Action: ACTION_DENY, Ports: []string{port}}
+		if ip := net.ParseIP(host); ip != nil {
+			r.CIDRs = []string{host}
+		} else {
+			r.Hosts = []string{host}
+		}
+		compiled, err := newRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied address %q", addr)
+		}
+		a.rules = append(a.rules, compiled)
+	}
+	if options.defaults == nil || *options.defaults {
+		compiled, err := newRule(Rule{Action: ACTION_DENY, Hosts: DefaultDenyHosts, CIDRs: DefaultDenyCIDRs})
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, compiled)
+	}
+	return a, nil
+}
+
+// Check checks the destination host:port of client, ips are the addresses host resolved to,
+// they're empty if host is resolved by the upstream proxy, then only hosts and ports of rules are checked
+func (a *ACL) Check(client Client, host string, port int, ips ...net.IP) error {
+	if a == nil {
+		return nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if ip := net.ParseIP(host); ip != nil && len(ips) < 1 {
+		ips = []net.IP{ip}
+	}
+	if len(ips) < 1 {
+		return a.check(client, host, nil, port)
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if err := a.check(client, host, ip, port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *ACL) check(client Client, host string, ip net.IP, port int) error {
+	for _, r := range a.rules {
+		if !r.match(client, host, ip, port) {
+			continue
+		}
+		if r.deny {
+			target := net.JoinHostPort(host, strconv.Itoa(port))
+			if ip != nil && ip.String() != host {
+				target += " (" + ip.String() + ")"
+			}
+			return fmt.Errorf("%w: %s", ErrDenied, target)
+		}
+		return nil
+	}
+	return nil
+}
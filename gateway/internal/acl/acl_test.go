@@ -0,0 +1,129 @@
+package acl
+
+import (
+	"net"
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type destination struct {
+	client Client
+	host   string
+	port   int
+	ips    []net.IP
+}
+
+func TestACLCheck(t *testing.T) {
+	a, err := NewACL(
+		RulesACLOption(
+			Rule{Action: ACTION_ALLOW, Users: []string{"admin"}, CIDRs: []string{"10.0.0.0/8"}},
+			Rule{Action: ACTION_DENY, Ports: []string{"25", "6000-6100"}},
+			Rule{Action: ACTION_DENY, Hosts: []string{"*.internal"}},
+		),
+		DenyAddrACLOption("manager-server:8082"),
+	)
+	assert.Nil(t, err)
+	anonymous := Client{IP: net.ParseIP("192.0.2.10")}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "ACL.Public",
+			Input:    destination{client: anonymous, host: "example.com", port: 443, ips: []net.IP{net.ParseIP("93.184.216.34")}},
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.Nil(t, a.Check(d.client, d.host, d.port, d.ips...))
+			},
+		},
+		{
+			Name:     "ACL.Default.Loopback",
+			Input:    destination{client: anonymous, host: "127.0.0.1", port: 80},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Default.Resolved",
+			Input:    destination{client: anonymous, host: "rebind.example.com", port: 80, ips: []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("::ffff:169.254.169.254")}},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Default.Localhost",
+			Input:    destination{client: anonymous, host: "LOCALHOST.", port: 80},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Port",
+			Input:    destination{client: anonymous, host: "mail.example.com", port: 25},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Host",
+			Input:    destination{client: anonymous, host: "db.internal", port: 5432},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Manager",
+			Input:    destination{client: anonymous, host: "manager-server", port: 8082},
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.ErrorIs(t, a.Check(d.client, d.host, d.port, d.ips...), ErrDenied)
+			},
+		},
+		{
+			Name:     "ACL.Client.Override",
+			Input:    destination{client: Client{IP: net.ParseIP("192.0.2.10"), User: "admin"}, host: "10.1.2.3", port: 8080},
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				d := tc.Input.(destination)
+				assert.Nil(t, a.Check(d.client, d.host, d.port, d.ips...))
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestNewACL(t *testing.T) {
+	a, err := NewACL(DefaultsACLOption(false))
+	assert.Nil(t, err)
+	assert.Nil(t, a.Check(Client{}, "127.0.0.1", 80))
+	var nil_acl *ACL
+	assert.Nil(t, nil_acl.Check(Client{}, "127.0.0.1", 80))
+	for _, r := range []Rule{
+		{Action: "block"},
+		{Action: ACTION_DENY, CIDRs: []string{"10.0.0.0/33"}},
+		{Action: ACTION_DENY, Ports: []string{"100-10"}},
+		{Action: ACTION_DENY, Hosts: []string{"[a"}},
+	} {
+		_, err := NewACL(RulesACLOption(r))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the user authenticated
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user authenticated, it's empty for anonymous clients
+func UserFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+type PolicyOptions struct {
+	users map[string]string
+	allow []string
+}
+
+type PolicyOption func(*PolicyOptions)
+
+// UserPolicyOption adds a credential accepted by the policy
+func UserPolicyOption(user string, password string) PolicyOption {
+	return func(options *PolicyOptions) {
+		if options.users == nil {
+			options.users = make(map[string]string)
+		}
+		options.users[user] = password
+	}
+}
+
+// AllowPolicyOption restricts clients to the given CIDRs or IPs
+func AllowPolicyOption(cidrs ...string) PolicyOption {
+	return func(options *PolicyOptions) {
+		options.allow = append(options.allow, cidrs...)
+	}
+}
+
+// Policy authenticates clients of a listener by their address and credential,
+// a nil policy accepts every client
+type Policy struct {
+	users map[string]string
+	nets  []*net.IPNet
+}
+
+func NewPolicy(opts ...PolicyOption) (*Policy, error) {
+	options := &PolicyOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	p := &Policy{users: options.users}
+	for _, cidr := range options.allow {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %s", cidr)
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %s (err: %+v)", cidr, err)
+		}
+		p.nets = append(p.nets, ipnet)
+	}
+	return p, nil
+}
+
+// RequireCredential reports whether clients must present a credential
+func (p *Policy) RequireCredential() bool {
+	return p != nil && len(p.users) > 0
+}
+
+// AllowClient reports whether the client address is allowed to connect
+func (p *Policy) AllowClient(addr net.Addr) bool {
+	if p == nil || len(p.nets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range p.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the credential of a client
+func (p *Policy) Verify(user string, password string) bool {
+	if !p.RequireCredential() {
+		return true
+	}
+	expected, ok := p.users[user]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// VerifyBasic checks the credential carried by a basic authorization header
+func (p *Policy) VerifyBasic(header string) (string, bool) {
+	if !p.RequireCredential() {
+		return "", true
+	}
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", false
+	}
+	user, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", false
+	}
+	return user, p.Verify(user, password)
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net"
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Policy.Nil",
+			Input:    nil,
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				var p *Policy
+				assert.Equal(t, tc.Expected, p.AllowClient(&net.TCPAddr{IP: net.ParseIP("8.8.8.8"), Port: 80}))
+				assert.Equal(t, tc.Expected, p.Verify("", ""))
+				assert.False(t, p.RequireCredential())
+			},
+		},
+		{
+			Name:     "Policy.AllowClient",
+			Input:    []string{"10.0.0.0/8", "192.168.1.1"},
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(AllowPolicyOption(tc.Input.([]string)...))
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, p.AllowClient(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5000}))
+				assert.Equal(t, tc.Expected, p.AllowClient(&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}))
+				assert.False(t, p.AllowClient(&net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 5000}))
+			},
+		},
+		{
+			Name:     "Policy.VerifyBasic",
+			Input:    "user:pass",
+			Error:    nil,
+			Expected: "user",
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(UserPolicyOption("user", "pass"))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, p.RequireCredential())
+				user, ok := p.VerifyBasic("Basic " + base64.StdEncoding.EncodeToString([]byte(tc.Input.(string))))
+				assert.True(t, ok)
+				assert.Equal(t, tc.Expected, user)
+				_, ok = p.VerifyBasic("Basic " + base64.StdEncoding.EncodeToString([]byte("user:wrong")))
+				assert.False(t, ok)
+				_, ok = p.VerifyBasic("")
+				assert.False(t, ok)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
@@ -0,0 +1,235 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	default_threshold    = 3
+	default_cooldown     = time.Duration(30) * time.Second
+	default_max_cooldown = time.Duration(30) * time.Minute
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+type State int
+
+const (
+	STATE_CLOSED State = iota
+	STATE_OPEN
+	STATE_HALF_OPEN
+)
+
+func (s State) String() string {
+	switch s {
+	case STATE_CLOSED:
+		return "closed"
+	case STATE_OPEN:
+		return "open"
+	case STATE_HALF_OPEN:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type BreakerOptions struct {
+	threshold    *int
+	cooldown     *time.Duration
+	max_cooldown *time.Duration
+}
+
+type BreakerOption func(*BreakerOptions)
+
+// ThresholdBreakerOption sets the number of consecutive failures which opens the circuit
+func ThresholdBreakerOption(threshold int) BreakerOption {
+	return func(options *BreakerOptions) {
+		options.threshold = &threshold
+	}
+}
+
+// CooldownBreakerOption sets the cool-down of the first opening, it doubles on each re-opening
+func CooldownBreakerOption(cooldown time.Duration) BreakerOption {
+	return func(options *BreakerOptions) {
+		options.cooldown = &cooldown
+	}
+}
+
+func MaxCooldownBreakerOption(cooldown time.Duration) BreakerOption {
+	return func(options *BreakerOptions) {
+		options.max_cooldown = &cooldown
+	}
+}
+
+type circuit struct {
+	state    State
+	failures int
+	trips    int
+	until    time.Time
+	probing  bool
+}
+
+// Breaker keeps a circuit (closed/open/half-open) for each key
+type Breaker struct {
+	mu           sync.Mutex
+	circuits     map[string]*circuit
+	threshold    int
+	cooldown     time.Duration
+	max_cooldown time.Duration
+	now          func() time.Time
+}
+
+func NewBreaker(opts ...BreakerOption) *Breaker {
+	options := &BreakerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	b := &Breaker{circuits: make(map[string]*circuit), now: time.Now}
+	if options.threshold != nil && *options.threshold > 0 {
+		b.threshold = *options.threshold
+	} else {
+		b.threshold = default_threshold
+	}
+	if options.cooldown != nil && *options.cooldown > 0 {
+		b.cooldown = *options.cooldown
+	} else {
+		b.cooldown = default_cooldown
+	}
+	if options.max_cooldown != nil && *options.max_cooldown > 0 {
+		b.max_cooldown = *options.max_cooldown
+	} else {
+		b.max_cooldown = default_max_cooldown
+	}
+	if b.max_cooldown < b.cooldown {
+		b.max_cooldown = b.cooldown
+	}
+	return b
+}
+
+func (b *Breaker) get(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{state: STATE_CLOSED}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// transit moves the circuit of key into state to, the transitions are reported by the callers
+// which know the proxies behind the keys
+func (b *Breaker) transit(key string, c *circuit, to State) {
+	c.state = to
+}
+
+func (b *Breaker) backoff(trips int) time.Duration {
+	cooldown := b.cooldown
+	for i := 1; i < trips; i++ {
+		cooldown *= 2
+		if cooldown >= b.max_cooldown {
+			return b.max_cooldown
+		}
+	}
+	return cooldown
+}
+
+// Allow reports whether a request is allowed to go through the circuit of key,
+// an open circuit lets one probe through after the cool-down elapsed
+func (b *Breaker) Allow(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return true
+	}
+	switch c.state {
+	case STATE_OPEN:
+		if b.now().Before(c.until) {
+			return false
+		}
+		b.transit(key, c, STATE_HALF_OPEN)
+		c.probing = true
+		return true
+	case STATE_HALF_OPEN:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a succeeded request and closes the circuit
+func (b *Breaker) Success(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return
+	}
+	c.failures = 0
+	c.trips = 0
+	c.probing = false
+	c.until = time.Time{}
+	b.transit(key, c, STATE_CLOSED)
+	delete(b.circuits, key)
+}
+
+// Failure records a failed request, it returns true if the circuit is opened by this failure
+func (b *Breaker) Failure(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.get(key)
+	c.failures++
+	c.probing = false
+	switch c.state {
+	case STATE_HALF_OPEN:
+		// probe failed, re-open with a longer cool-down
+		c.trips++
+	case STATE_CLOSED:
+		if c.failures < b.threshold {
+			return false
+		}
+		c.trips++
+	default:
+		return false
+	}
+	c.until = b.now().Add(b.backoff(c.trips))
+	b.transit(key, c, STATE_OPEN)
+	return true
+}
+
+// Release gives back a probe of the half-open circuit without recording any outcome
+func (b *Breaker) Release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return
+	}
+	c.probing = false
+}
+
+func (b *Breaker) State(key string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return STATE_CLOSED
+	}
+	return c.state
+}
+
+// Until returns the time the open circuit of key will be probed again
+func (b *Breaker) Until(key string) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return time.Time{}
+	}
+	return c.until
+}
@@ -0,0 +1,80 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Breaker.OpenAfterThreshold",
+			Input:    3,
+			Error:    nil,
+			Expected: STATE_OPEN,
+			Check: func(tc test.TestCase[any, any]) {
+				b := NewBreaker(ThresholdBreakerOption(tc.Input.(int)))
+				assert.False(t, b.Failure("p1"))
+				assert.False(t, b.Failure("p1"))
+				assert.True(t, b.Failure("p1"))
+				assert.Equal(t, tc.Expected, b.State("p1"))
+				assert.False(t, b.Allow("p1"))
+				assert.True(t, b.Allow("p2"))
+			},
+		},
+		{
+			Name:     "Breaker.SuccessResetsFailures",
+			Input:    2,
+			Error:    nil,
+			Expected: STATE_CLOSED,
+			Check: func(tc test.TestCase[any, any]) {
+				b := NewBreaker(ThresholdBreakerOption(tc.Input.(int)))
+				b.Failure("p1")
+				b.Success("p1")
+				assert.False(t, b.Failure("p1"))
+				assert.Equal(t, tc.Expected, b.State("p1"))
+			},
+		},
+		{
+			Name:     "Breaker.HalfOpen.ExponentialCooldown",
+			Input:    time.Second,
+			Error:    nil,
+			Expected: 2 * time.Second,
+			Check: func(tc test.TestCase[any, any]) {
+				now := time.Now()
+				b := NewBreaker(ThresholdBreakerOption(1), CooldownBreakerOption(tc.Input.(time.Duration)))
+				b.now = func() time.Time { return now }
+				assert.True(t, b.Failure("p1"))
+				assert.Equal(t, now.Add(tc.Input.(time.Duration)), b.Until("p1"))
+				now = now.Add(tc.Input.(time.Duration))
+				// only one probe is allowed while half-open
+				assert.True(t, b.Allow("p1"))
+				assert.Equal(t, STATE_HALF_OPEN, b.State("p1"))
+				assert.False(t, b.Allow("p1"))
+				assert.True(t, b.Failure("p1"))
+				assert.Equal(t, now.Add(tc.Expected.(time.Duration)), b.Until("p1"))
+				now = now.Add(tc.Expected.(time.Duration))
+				assert.True(t, b.Allow("p1"))
+				b.Success("p1")
+				assert.Equal(t, STATE_CLOSED, b.State("p1"))
+			},
+		},
+		{
+			Name:     "Breaker.MaxCooldown",
+			Input:    time.Second,
+			Error:    nil,
+			Expected: 3 * time.Second,
+			Check: func(tc test.TestCase[any, any]) {
+				b := NewBreaker(CooldownBreakerOption(tc.Input.(time.Duration)), MaxCooldownBreakerOption(tc.Expected.(time.Duration)))
+				assert.Equal(t, tc.Input, b.backoff(1))
+				assert.Equal(t, 2*time.Second, b.backoff(2))
+				assert.Equal(t, tc.Expected, b.backoff(3))
+				assert.Equal(t, tc.Expected, b.backoff(10))
+			},
+		},
+	}
+	test.Run(cases, t)
+}
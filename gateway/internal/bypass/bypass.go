@@ -0,0 +1,113 @@
+package bypass
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// LOCAL matches plain hostnames without any dot, e.g. `intranet`
+const LOCAL = "<local>"
+
+// List is a list of destinations connected directly instead of through proxies,
+// entries are hostnames (`example.com`), domains with subdomains (`.example.com`),
+// patterns (`*.cdn.example.net`), IPs or CIDRs (`10.0.0.0/8`) and LOCAL.
+// A nil list bypasses nothing.
+type List struct {
+	entries []string
+	exact   map[string]bool
+	domains []string
+	globs   []string
+	nets    []*net.IPNet
+	local   bool
+}
+
+func NewList(entries ...string) (*List, error) {
+	l := &List{exact: make(map[string]bool)}
+	for _, entry := range entries {
+		e := strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case e == "":
+			continue
+		case e == LOCAL:
+			l.local = true
+		case strings.Contains(e, "/"):
+			_, ipnet, err := net.ParseCIDR(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bypass cidr %q", entry)
+			}
+			l.nets = append(l.nets, ipnet)
+		case net.ParseIP(e) != nil:
+			ip := net.ParseIP(e)
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			l.nets = append(l.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		case strings.HasPrefix(e, "."):
+			l.domains = append(l.domains, e)
+		case strings.ContainsAny(e, "*?["):
+			if _, err := path.Match(e, ""); err != nil {
+				return nil, fmt.Errorf("invalid bypass pattern %q", entry)
+			}
+			l.globs = append(l.globs, e)
+		default:
+			l.exact[e] = true
+		}
+		l.entries = append(l.entries, e)
+	}
+	return l, nil
+}
+
+// Match checks whether host (without port) is bypassed, hostnames are never resolved to match the cidrs
+func (l *List) Match(host string) bool {
+	if l == nil {
+		return false
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for _, n := range l.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if l.local && !strings.Contains(host, ".") {
+		return true
+	}
+	if l.exact[host] {
+		return true
+	}
+	for _, d := range l.domains {
+		if strings.HasSuffix(host, d) || host == d[1:] {
+			return true
+		}
+	}
+	for _, g := range l.globs {
+		if ok, _ := path.Match(g, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAddr checks whether the host of addr (host:port) is bypassed
+func (l *List) MatchAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return l.Match(host)
+}
+
+func (l *List) Entries() []string {
+	if l == nil {
+		return nil
+	}
+	return l.entries
+}
@@ -0,0 +1,119 @@
+package bypass
+
+import (
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListMatch(t *testing.T) {
+	l, err := NewList(LOCAL, "example.com", ".corp.example.org", "*.cdn.example.net", "10.0.0.0/8", "192.0.2.1")
+	assert.Nil(t, err)
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "List.Match.Local",
+			Input:    "intranet",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.Exact",
+			Input:    "Example.com.",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.Exact.Subdomain",
+			Input:    "www.example.com",
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.Domain",
+			Input:    "corp.example.org",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.Domain.Subdomain",
+			Input:    "wiki.corp.example.org",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.Glob",
+			Input:    "img.cdn.example.net",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.CIDR",
+			Input:    "10.1.2.3",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.IP",
+			Input:    "192.0.2.1",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "List.Match.None",
+			Input:    "www.example.org",
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, l.Match(tc.Input.(string)))
+			},
+		},
+	}
+	test.Run(cases, t)
+	assert.True(t, l.MatchAddr("example.com:443"))
+	var nil_list *List
+	assert.False(t, nil_list.Match("example.com"))
+	_, err = NewList("10.0.0.0/40")
+	assert.Error(t, err)
+}
+
+func TestListPAC(t *testing.T) {
+	l, err := NewList(LOCAL, ".corp.example.org", "*.cdn.example.net", "10.0.0.0/8")
+	assert.Nil(t, err)
+	expected := `function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host)) return "DIRECT";
+	if (dnsDomainIs(host, ".corp.example.org") || host == "corp.example.org") return "DIRECT";
+	if (shExpMatch(host, "*.cdn.example.net")) return "DIRECT";
+	if (/^\d{1,3}(\.\d{1,3}){3}$/.test(host) && (isInNet(host, "10.0.0.0", "255.0.0.0"))) return "DIRECT";
+	return "PROXY gateway:8000; DIRECT";
+}
+`
+	assert.Equal(t, expected, l.PAC(true, "PROXY gateway:8000"))
+	var nil_list *List
+	assert.Contains(t, nil_list.PAC(false, "PROXY gateway:8000"), `return "PROXY gateway:8000";`)
+}
@@ -0,0 +1,62 @@
+package bypass
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PAC_CONTENT_TYPE = "application/x-ns-proxy-autoconfig"
+
+// PAC generates a Proxy Auto-Config script sending the destinations bypassed directly and the others to proxies,
+// e.g. `PROXY gateway:8000` or `SOCKS5 gateway:1080`. Hostnames are never resolved by the script to avoid dns leaks,
+// so cidrs only match ip hosts and ipv6 cidrs are left to the gateway.
+func (l *List) PAC(direct bool, proxies ...string) string {
+	var conds []string
+	if l != nil {
+		if l.local {
+			conds = append(conds, "isPlainHostName(host)")
+		}
+		exact := make([]string, 0, len(l.exact))
+		for h := range l.exact {
+			exact = append(exact, h)
+		}
+		sort.Strings(exact)
+		for _, h := range exact {
+			conds = append(conds, fmt.Sprintf("host == %s", strconv.Quote(h)))
+		}
+		for _, d := range l.domains {
+			conds = append(conds, fmt.Sprintf("dnsDomainIs(host, %s) || host == %s", strconv.Quote(d), strconv.Quote(d[1:])))
+		}
+		for _, g := range l.globs {
+			conds = append(conds, fmt.Sprintf("shExpMatch(host, %s)", strconv.Quote(g)))
+		}
+	}
+	var nets []string
+	if l != nil {
+		for _, n := range l.nets {
+			if ip4 := n.IP.To4(); ip4 != nil && len(n.Mask) == net.IPv4len {
+				nets = append(nets, fmt.Sprintf("isInNet(host, %q, %q)", ip4.String(), net.IP(n.Mask).String()))
+			}
+		}
+	}
+	routes := make([]string, 0, len(proxies)+1)
+	routes = append(routes, proxies...)
+	if direct || len(routes) < 1 {
+		routes = append(routes, "DIRECT")
+	}
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("\thost = host.toLowerCase();\n")
+	for _, cond := range conds {
+		fmt.Fprintf(&b, "\tif (%s) return \"DIRECT\";\n", cond)
+	}
+	if len(nets) > 0 {
+		b.WriteString("\tif (/^\\d{1,3}(\\.\\d{1,3}){3}$/.test(host) && (" + strings.Join(nets, " || ") + ")) return \"DIRECT\";\n")
+	}
+	fmt.Fprintf(&b, "\treturn %s;\n", strconv.Quote(strings.Join(routes, "; ")))
+	b.WriteString("}\n")
+	return b.String()
+}
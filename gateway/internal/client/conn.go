@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// NewManagerConn dials the grpc server of manager, the connection can be shared by proxy and gateway clients
+func NewManagerConn(ctx context.Context, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	serviceConfig := grpc.WithDefaultServiceConfig(`
+	{
+		"loadBalancingPolicy": "round_robin"
+	}`)
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), serviceConfig}, opts...)
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial grpc server: %v", err)
+	}
+	return conn, nil
+}
+
+// tokenCredentials bears token in every call to manager
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity is false since manager is dialed without TLS in the cluster
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// TokenDialOption bears token to manager, which grants the scopes of it such as revealing the credentials of proxies
+func TokenDialOption(token string) grpc.DialOption {
+	if token == "" {
+		return grpc.EmptyDialOption{}
+	}
+	return grpc.WithPerRPCCredentials(tokenCredentials(token))
+}
@@ -3,16 +3,19 @@ package client
 import (
 	"context"
 	"fmt"
+	"time"
 
 	log "github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 	managerv1_pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type GatewayClientOptions struct {
 	logger *log.Logger
 	ctx    *context.Context
+	conn   *grpc.ClientConn
 }
 
 type GatewayClientOption func(*GatewayClientOptions)
@@ -28,6 +31,13 @@ func CtxGatewayClientOption(ctx *context.Context) GatewayClientOption {
 	}
 }
 
+// ConnGatewayClientOption reuses an established connection to manager instead of dialing a new one
+func ConnGatewayClientOption(conn *grpc.ClientConn) GatewayClientOption {
+	return func(options *GatewayClientOptions) {
+		options.conn = conn
+	}
+}
+
 func NewGatewayClient(grpc_addr string, opts ...GatewayClientOption) (*GatewayClient, error) {
 	options := &GatewayClientOptions{}
 	for _, opt := range opts {
@@ -48,13 +58,16 @@ func NewGatewayClient(grpc_addr string, opts ...GatewayClientOption) (*GatewayCl
 		logger = *options.logger
 	}
 	client := &GatewayClient{logger: logger}
+	if options.conn != nil {
+		client.grpc_client = managerv1_pb.NewGatewayServiceClient(options.conn)
+		return client, nil
+	}
 	if err := client.initGrpcClient(ctx, grpc_addr); err != nil {
 		return nil, err
 	}
 	return client, nil
 }
 
-// TODO: implement GatewayClient interacting with gateway service
 type GatewayClient struct {
 	logger      log.Logger
 	grpc_client managerv1_pb.GatewayServiceClient
@@ -72,7 +85,27 @@ func (c *GatewayClient) initGrpcClient(ctx context.Context, addr string) error {
 	if err != nil {
 		return fmt.Errorf("failed to dial grpc server: %v", err)
 	}
-	grpc_client := managerv1_pb.NewProxyServiceClient(conn)
+	grpc_client := managerv1_pb.NewGatewayServiceClient(conn)
 	c.grpc_client = grpc_client
 	return nil
 }
+
+func (c *GatewayClient) ReportProxyEvent(ctx context.Context, proxy_id string, event_type managerv1_pb.ProxyEventType, reason string, until time.Time) error {
+	req := &managerv1_pb.ReportProxyEventRequest{
+		ProxyId: proxy_id,
+		Type:    event_type,
+		Reason:  reason,
+		Time:    timestamppb.Now(),
+	}
+	if !until.IsZero() {
+		req.Until = timestamppb.New(until)
+	}
+	resp, err := c.grpc_client.ReportProxyEvent(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Status.Code != 0 {
+		return fmt.Errorf("failed to report proxy event: %v", resp.Status)
+	}
+	return nil
+}
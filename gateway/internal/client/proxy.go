@@ -14,14 +14,12 @@ import (
 
 var (
 	default_masks = []string{"id", "proto", "ip", "port", "status", "provider", "api", "attr", "created_at", "updated_at", "checked_at", "expire_time", "use_config"}
-	base_filters  = []*managerv1_pb.Filter{
-		ConstructPropertyFilter("status", managerv1_pb.PropertyFilter_EQUAL, managerv1_pb.Status_STATUS_CHECKED.String()),
-	}
 )
 
 type ProxyClientOptions struct {
 	logger *log.Logger
 	ctx    *context.Context
+	conn   *grpc.ClientConn
 }
 
 type ProxyClientOption func(*ProxyClientOptions)
@@ -37,15 +35,34 @@ func CtxProxyClientOption(ctx *context.Context) ProxyClientOption {
 	}
 }
 
+// ConnProxyClientOption reuses an established connection to manager instead of dialing a new one
+func ConnProxyClientOption(conn *grpc.ClientConn) ProxyClientOption {
+	return func(options *ProxyClientOptions) {
+		options.conn = conn
+	}
+}
+
 type ListProxiesOptions struct {
 	filters []*managerv1_pb.Filter
+	orders  []*managerv1_pb.PropertyOrder
 	masks   []string
 }
 type ListProxiesOption func(*ListProxiesOptions)
 
 func FilterListProxiesOption(filters ...*managerv1_pb.Filter) ListProxiesOption {
 	return func(options *ListProxiesOptions) {
-		options.filters = append(options.filters, filters...)
+		for _, filter := range filters {
+			if filter != nil {
+				options.filters = append(options.filters, filter)
+			}
+		}
+	}
+}
+
+// OrderByListProxiesOption sorts proxies by orders, the orders after the first one break ties of the ones before
+func OrderByListProxiesOption(orders ...*managerv1_pb.PropertyOrder) ListProxiesOption {
+	return func(options *ListProxiesOptions) {
+		options.orders = append(options.orders, orders...)
 	}
 }
 
@@ -81,6 +98,10 @@ func NewProxyClient(grpc_addr string, opts ...ProxyClientOption) (*ProxyClient,
 		logger = *options.logger
 	}
 	client := &ProxyClient{logger: logger, grpc_addr: grpc_addr}
+	if options.conn != nil {
+		client.grpc_client = managerv1_pb.NewProxyServiceClient(options.conn)
+		return client, nil
+	}
 	if err := client.initGrpcClient(ctx, grpc_addr); err != nil {
 		return nil, err
 	}
@@ -140,20 +161,17 @@ func ConstructListProxiesRequest(limit int, offset int, opts ...ListProxiesOptio
 			Offset: int32(offset),
 		},
 	}
-	var filters []*managerv1_pb.Filter
-	filters = append(filters, base_filters...)
-	if options.filters != nil {
-		filters = append(filters, options.filters...)
-
-	}
-	req.Query.Filter = &managerv1_pb.Filter{
-		FilterType: &managerv1_pb.Filter_CompositeFilter{
-			CompositeFilter: &managerv1_pb.CompositeFilter{
-				Op:      managerv1_pb.CompositeFilter_AND,
-				Filters: filters,
+	if len(options.filters) > 0 {
+		req.Query.Filter = &managerv1_pb.Filter{
+			FilterType: &managerv1_pb.Filter_CompositeFilter{
+				CompositeFilter: &managerv1_pb.CompositeFilter{
+					Op:      managerv1_pb.CompositeFilter_AND,
+					Filters: options.filters,
+				},
 			},
-		},
+		}
 	}
+	req.Query.OrderBy = options.orders
 	var (
 		masks []string
 	)
@@ -170,6 +188,13 @@ func ConstructListProxiesRequest(limit int, offset int, opts ...ListProxiesOptio
 	return req, nil
 }
 
+func ConstructPropertyOrder(name string, direction managerv1_pb.PropertyOrder_Direction) *managerv1_pb.PropertyOrder {
+	return &managerv1_pb.PropertyOrder{
+		Property:  &managerv1_pb.PropertyReference{Name: name},
+		Direction: direction,
+	}
+}
+
 func ConstructPropertyFilter(name string, op managerv1_pb.PropertyFilter_Operator, value string) *managerv1_pb.Filter {
 	return &managerv1_pb.Filter{
 		FilterType: &managerv1_pb.Filter_PropertyFilter{
@@ -0,0 +1,217 @@
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	managerv1 "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+)
+
+// ANY drops the condition of a field, e.g. `status: ["*"]` prefetches proxies of any status
+const ANY = "*"
+
+const (
+	PROPERTY_STATUS     = "status"
+	PROPERTY_PROTO      = "proto"
+	PROPERTY_TAGS       = "tags"
+	PROPERTY_PROVIDER   = "provider"
+	PROPERTY_COUNTRY    = "country"
+	PROPERTY_LATENCY    = "latency"
+	PROPERTY_AVAILABLE  = "available"
+	PROPERTY_CHECKED_AT = "checked_at"
+	PROPERTY_LOC        = "loc"
+)
+
+var (
+	DefaultStatus = []string{managerv1.Status_STATUS_CHECKED.String()}
+	DefaultProto  = []string{managerv1.Proto_PROTO_HTTP.String()}
+)
+
+// operators of conditions, two-character operators must be matched first
+var operators = []struct {
+	symbol string
+	op     managerv1.PropertyFilter_Operator
+}{
+	{"!=", managerv1.PropertyFilter_NOT_EQUAL},
+	{"<=", managerv1.PropertyFilter_LESS_THAN_OR_EQUAL},
+	{">=", managerv1.PropertyFilter_GREATER_THAN_OR_EQUAL},
+	{"=", managerv1.PropertyFilter_EQUAL},
+	{"<", managerv1.PropertyFilter_LESS_THAN},
+	{">", managerv1.PropertyFilter_GREATER_THAN},
+	{"~", managerv1.PropertyFilter_GEO_RADIUS},
+}
+
+// Filter declares the proxies prefetched into a route table.
+// Conditions of fields are combined with AND, values of the same field are combined with OR.
+// Status and proto default to STATUS_CHECKED and PROTO_HTTP when not declared.
+type Filter struct {
+	Status     []string `yaml:"status"`
+	Proto      []string `yaml:"proto"`
+	Tags       []string `yaml:"tags"`
+	Provider   []string `yaml:"provider"`
+	Country    []string `yaml:"country"`
+	MinLatency int64    `yaml:"min_latency"`
+	MaxLatency int64    `yaml:"max_latency"`
+	Available  *bool    `yaml:"available"`
+	Where      []string `yaml:"where"` // raw conditions, see ParseCondition
+}
+
+func (f Filter) IsZero() bool {
+	return reflect.DeepEqual(f, Filter{})
+}
+
+// Override returns a copy of f whose fields are replaced by the ones declared in o, conditions of where are appended
+func (f Filter) Override(o Filter) Filter {
+	if o.Status != nil {
+		f.Status = o.Status
+	}
+	if o.Proto != nil {
+		f.Proto = o.Proto
+	}
+	if o.Tags != nil {
+		f.Tags = o.Tags
+	}
+	if o.Provider != nil {
+		f.Provider = o.Provider
+	}
+	if o.Country != nil {
+		f.Country = o.Country
+	}
+	if o.MinLatency != 0 {
+		f.MinLatency = o.MinLatency
+	}
+	if o.MaxLatency != 0 {
+		f.MaxLatency = o.MaxLatency
+	}
+	if o.Available != nil {
+		f.Available = o.Available
+	}
+	if o.Where != nil {
+		f.Where = append(append([]string{}, f.Where...), o.Where...)
+	}
+	return f
+}
+
+// Pb builds the filter of manager query
+func (f Filter) Pb() (*managerv1.Filter, error) {
+	status := f.Status
+	if len(status) < 1 {
+		status = DefaultStatus
+	}
+	proto := f.Proto
+	if len(proto) < 1 {
+		proto = DefaultProto
+	}
+	var filters []*managerv1.Filter
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{PROPERTY_STATUS, status},
+		{PROPERTY_PROTO, proto},
+		{PROPERTY_TAGS, f.Tags},
+		{PROPERTY_PROVIDER, f.Provider},
+		{PROPERTY_COUNTRY, f.Country},
+	} {
+		if filter := anyOf(field.name, field.values...); filter != nil {
+			filters = append(filters, filter)
+		}
+	}
+	if f.MinLatency > 0 {
+		filters = append(filters, NewPropertyFilter(PROPERTY_LATENCY, managerv1.PropertyFilter_GREATER_THAN_OR_EQUAL, strconv.FormatInt(f.MinLatency, 10)))
+	}
+	if f.MaxLatency > 0 {
+		filters = append(filters, NewPropertyFilter(PROPERTY_LATENCY, managerv1.PropertyFilter_LESS_THAN_OR_EQUAL, strconv.FormatInt(f.MaxLatency, 10)))
+	}
+	if f.Available != nil {
+		filters = append(filters, NewPropertyFilter(PROPERTY_AVAILABLE, managerv1.PropertyFilter_EQUAL, strconv.FormatBool(*f.Available)))
+	}
+	for _, cond := range f.Where {
+		filter, err := ParseCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return And(filters...), nil
+}
+
+// ParseCondition parses a condition like `country=US,JP`, `latency<300`, `tags!=gateway` or `loc~-73.98 40.75 50 km`,
+// values separated by comma are combined with OR for `=` and with AND for the other operators except `~`
+func ParseCondition(cond string) (*managerv1.Filter, error) {
+	for _, o := range operators {
+		idx := strings.Index(cond, o.symbol)
+		if idx < 0 {
+			continue
+		}
+		name := strings.TrimSpace(cond[:idx])
+		value := strings.TrimSpace(cond[idx+len(o.symbol):])
+		if name == "" || value == "" {
+			break
+		}
+		if o.op == managerv1.PropertyFilter_GEO_RADIUS {
+			return NewPropertyFilter(name, o.op, value), nil
+		}
+		var filters []*managerv1.Filter
+		for _, v := range strings.Split(value, ",") {
+			filters = append(filters, NewPropertyFilter(name, o.op, strings.TrimSpace(v)))
+		}
+		if o.op == managerv1.PropertyFilter_EQUAL {
+			return Or(filters...), nil
+		}
+		return And(filters...), nil
+	}
+	return nil, fmt.Errorf("invalid filter condition %q", cond)
+}
+
+func anyOf(name string, values ...string) *managerv1.Filter {
+	var filters []*managerv1.Filter
+	for _, v := range values {
+		if v == ANY {
+			return nil
+		}
+		filters = append(filters, NewPropertyFilter(name, managerv1.PropertyFilter_EQUAL, v))
+	}
+	return Or(filters...)
+}
+
+func NewPropertyFilter(name string, op managerv1.PropertyFilter_Operator, value string) *managerv1.Filter {
+	return &managerv1.Filter{
+		FilterType: &managerv1.Filter_PropertyFilter{
+			PropertyFilter: &managerv1.PropertyFilter{
+				Property: &managerv1.PropertyReference{
+					Name: name,
+				},
+				Op:    op,
+				Value: value,
+			},
+		},
+	}
+}
+
+func And(filters ...*managerv1.Filter) *managerv1.Filter {
+	return composite(managerv1.CompositeFilter_AND, filters...)
+}
+
+func Or(filters ...*managerv1.Filter) *managerv1.Filter {
+	return composite(managerv1.CompositeFilter_OR, filters...)
+}
+
+func composite(op managerv1.CompositeFilter_Operator, filters ...*managerv1.Filter) *managerv1.Filter {
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return &managerv1.Filter{
+		FilterType: &managerv1.Filter_CompositeFilter{
+			CompositeFilter: &managerv1.CompositeFilter{
+				Op:      op,
+				Filters: filters,
+			},
+		},
+	}
+}
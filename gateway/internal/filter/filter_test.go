@@ -0,0 +1,111 @@
+package filter
+
+import (
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	managerv1 "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseCondition(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "ParseCondition.Equal",
+			Input:    "country=US",
+			Error:    nil,
+			Expected: NewPropertyFilter(PROPERTY_COUNTRY, managerv1.PropertyFilter_EQUAL, "US"),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := ParseCondition(tc.Input.(string))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+		{
+			Name:     "ParseCondition.Equal.Multiple",
+			Input:    "country = US,JP",
+			Error:    nil,
+			Expected: Or(NewPropertyFilter(PROPERTY_COUNTRY, managerv1.PropertyFilter_EQUAL, "US"), NewPropertyFilter(PROPERTY_COUNTRY, managerv1.PropertyFilter_EQUAL, "JP")),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := ParseCondition(tc.Input.(string))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+		{
+			Name:     "ParseCondition.NotEqual.Multiple",
+			Input:    "tags!=gateway,free",
+			Error:    nil,
+			Expected: And(NewPropertyFilter(PROPERTY_TAGS, managerv1.PropertyFilter_NOT_EQUAL, "gateway"), NewPropertyFilter(PROPERTY_TAGS, managerv1.PropertyFilter_NOT_EQUAL, "free")),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := ParseCondition(tc.Input.(string))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+		{
+			Name:     "ParseCondition.GeoRadius",
+			Input:    "loc ~ -73.98 40.75 50 km",
+			Error:    nil,
+			Expected: NewPropertyFilter(PROPERTY_LOC, managerv1.PropertyFilter_GEO_RADIUS, "-73.98 40.75 50 km"),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := ParseCondition(tc.Input.(string))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+		{
+			Name:     "ParseCondition.LessThanOrEqual",
+			Input:    "latency<=300",
+			Error:    nil,
+			Expected: NewPropertyFilter(PROPERTY_LATENCY, managerv1.PropertyFilter_LESS_THAN_OR_EQUAL, "300"),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := ParseCondition(tc.Input.(string))
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+	}
+	test.Run(cases, t)
+	_, err := ParseCondition("latency")
+	assert.Error(t, err)
+}
+
+func TestFilter(t *testing.T) {
+	available := true
+	cases := []test.TestCase[any, any]{
+		{
+			Name:  "Filter.Default",
+			Input: Filter{},
+			Error: nil,
+			Expected: And(
+				NewPropertyFilter(PROPERTY_STATUS, managerv1.PropertyFilter_EQUAL, managerv1.Status_STATUS_CHECKED.String()),
+				NewPropertyFilter(PROPERTY_PROTO, managerv1.PropertyFilter_EQUAL, managerv1.Proto_PROTO_HTTP.String()),
+			),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := tc.Input.(Filter).Pb()
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+		{
+			Name:  "Filter.Override",
+			Input: Filter{Tags: []string{"ip"}, Country: []string{"JP"}}.Override(Filter{Status: []string{ANY}, Country: []string{"US"}, MaxLatency: 300, Available: &available}),
+			Error: nil,
+			Expected: And(
+				NewPropertyFilter(PROPERTY_PROTO, managerv1.PropertyFilter_EQUAL, managerv1.Proto_PROTO_HTTP.String()),
+				NewPropertyFilter(PROPERTY_TAGS, managerv1.PropertyFilter_EQUAL, "ip"),
+				NewPropertyFilter(PROPERTY_COUNTRY, managerv1.PropertyFilter_EQUAL, "US"),
+				NewPropertyFilter(PROPERTY_LATENCY, managerv1.PropertyFilter_LESS_THAN_OR_EQUAL, "300"),
+				NewPropertyFilter(PROPERTY_AVAILABLE, managerv1.PropertyFilter_EQUAL, "true"),
+			),
+			Check: func(tc test.TestCase[any, any]) {
+				f, err := tc.Input.(Filter).Pb()
+				assert.Equal(t, tc.Error, err)
+				assert.True(t, proto.Equal(tc.Expected.(*managerv1.Filter), f), "%v != %v", tc.Expected, f)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
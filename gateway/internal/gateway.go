@@ -4,16 +4,17 @@ import (
 	"sync"
 
 	server "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/server"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 
-	"github.com/go-gost/core/logger"
+	"github.com/sirupsen/logrus"
 )
 
 type Gateway struct {
-	logger  logger.Logger
+	logger  log.Logger
 	servers []server.Server
 }
 
-func NewGateway(logger logger.Logger) *Gateway {
+func NewGateway(logger log.Logger) *Gateway {
 	return &Gateway{logger: logger}
 }
 
@@ -21,7 +22,13 @@ func (g *Gateway) AddServer(s server.Server) {
 	g.servers = append(g.servers, s)
 }
 
+// Serve serves all servers added and blocks until all of them stopped
 func (g *Gateway) Serve() error {
+	logger := g.logger.WithFields(logrus.Fields{
+		"class":  "Gateway",
+		"method": "Serve",
+	})
+	logger.Infof("serving %d servers", len(g.servers))
 	var wg sync.WaitGroup
 	for _, s := range g.servers {
 		serv := s
@@ -8,3 +8,6 @@ import (
 type Handler interface {
 	Handle(context.Context, net.Conn) error
 }
+
+// TunnelHandle relays conn to the target addr, established must be called once the upstream connection is ready
+type TunnelHandle func(ctx context.Context, conn net.Conn, addr string, established func() error) error
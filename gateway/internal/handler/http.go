@@ -3,19 +3,31 @@ package handler
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 )
 
+// HttpHandle handles a request read from the client connection, the connection is kept alive for the next request
+// unless the request is CONNECT, either side asked to close or ErrConnClose is returned
 type HttpHandle func(context.Context, *HttpHandler, net.Conn, *http.Request) error
 
+// ErrConnClose is returned by HttpHandle to close the client connection without reporting any error
+var ErrConnClose = errors.New("close connection")
+
+const default_keepalive = time.Duration(60) * time.Second
+
 type HttpHandlerOptions struct {
-	logger  *log.Logger
-	handle  *HttpHandle
-	timeout time.Duration
+	logger    *log.Logger
+	handle    *HttpHandle
+	timeout   time.Duration
+	auth      *auth.Policy
+	keepalive *time.Duration
 }
 
 type HttpHandlerOption func(*HttpHandlerOptions)
@@ -35,6 +47,18 @@ func HandleHttpHandlerOption(handle *HttpHandle) HttpHandlerOption {
 		options.handle = handle
 	}
 }
+func AuthHttpHandlerOption(policy *auth.Policy) HttpHandlerOption {
+	return func(options *HttpHandlerOptions) {
+		options.auth = policy
+	}
+}
+
+// KeepAliveHttpHandlerOption sets how long an idle client connection waits for the next request, 0 disables keep-alive
+func KeepAliveHttpHandlerOption(timeout time.Duration) HttpHandlerOption {
+	return func(options *HttpHandlerOptions) {
+		options.keepalive = &timeout
+	}
+}
 func defaultHandler(ctx context.Context, h *HttpHandler, conn net.Conn, r *http.Request) error {
 	logger := h.Logger()
 	logger.Warnf("no handle set")
@@ -46,7 +70,12 @@ func NewHttpHandler(opts ...HttpHandlerOption) *HttpHandler {
 	for _, opt := range opts {
 		opt(options)
 	}
-	h := &HttpHandler{options: *options}
+	h := &HttpHandler{options: *options, auth: options.auth}
+	if options.keepalive != nil {
+		h.keepalive = *options.keepalive
+	} else {
+		h.keepalive = default_keepalive
+	}
 	if options.handle == nil {
 		h.handle = defaultHandler
 	} else {
@@ -61,9 +90,21 @@ func NewHttpHandler(opts ...HttpHandlerOption) *HttpHandler {
 }
 
 type HttpHandler struct {
-	handle  HttpHandle
-	logger  log.Logger
-	options HttpHandlerOptions
+	handle    HttpHandle
+	logger    log.Logger
+	auth      *auth.Policy
+	keepalive time.Duration
+	options   HttpHandlerOptions
+}
+
+// bufferedConn reads through the reader requests are parsed with, so bytes already buffered are not lost
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
 }
 
 func (h *HttpHandler) Logger() log.Logger {
@@ -72,10 +113,54 @@ func (h *HttpHandler) Logger() log.Logger {
 
 func (h *HttpHandler) Handle(ctx context.Context, conn net.Conn) error {
 	defer conn.Close()
-	req, err := http.ReadRequest(bufio.NewReader(conn))
-	if err != nil {
-		return err
+	r := bufio.NewReader(conn)
+	for i := 0; ; i++ {
+		if i > 0 {
+			if h.keepalive <= 0 {
+				return nil
+			}
+			conn.SetReadDeadline(time.Now().Add(h.keepalive))
+		}
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			if i > 0 {
+				// client closed or idled out between requests
+				return nil
+			}
+			return err
+		}
+		conn.SetReadDeadline(time.Time{})
+		err = h.handleRequest(ctx, &bufferedConn{Conn: conn, r: r}, req)
+		// drain the body left so the next request could be read
+		req.Body.Close()
+		if err != nil {
+			if errors.Is(err, ErrConnClose) {
+				return nil
+			}
+			return err
+		}
+		if req.Method == http.MethodConnect || req.Close {
+			return nil
+		}
+	}
+}
+
+func (h *HttpHandler) handleRequest(ctx context.Context, conn net.Conn, req *http.Request) error {
+	if !h.auth.AllowClient(conn.RemoteAddr()) {
+		resp := &http.Response{ProtoMajor: 1, ProtoMinor: 1, StatusCode: http.StatusForbidden, Header: http.Header{}}
+		resp.Write(conn)
+		return fmt.Errorf("client %s is not allowed", conn.RemoteAddr())
+	}
+	user, ok := h.auth.VerifyBasic(req.Header.Get("Proxy-Authorization"))
+	if !ok {
+		resp := &http.Response{ProtoMajor: 1, ProtoMinor: 1, StatusCode: http.StatusProxyAuthRequired, Header: http.Header{}}
+		resp.Header.Set("Proxy-Authenticate", `Basic realm="proxy"`)
+		resp.Write(conn)
+		return fmt.Errorf("client %s failed to authenticate", conn.RemoteAddr())
+	}
+	req.Header.Del("Proxy-Authorization")
+	if user != "" {
+		ctx = auth.WithUser(ctx, user)
 	}
-	defer req.Body.Close()
 	return h.handle(ctx, h, conn, req)
 }
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+)
+
+const (
+	socks5_version                = 0x05
+	socks5_user_pass_version      = 0x01
+	socks5_method_no_auth         = 0x00
+	socks5_method_user_pass       = 0x02
+	socks5_method_no_acceptable   = 0xFF
+	socks5_cmd_connect            = 0x01
+	socks5_atyp_ipv4              = 0x01
+	socks5_atyp_domain            = 0x03
+	socks5_atyp_ipv6              = 0x04
+	socks5_rep_succeeded          = 0x00
+	socks5_rep_general_failure    = 0x01
+	socks5_rep_host_unreachable   = 0x04
+	socks5_rep_cmd_not_supported  = 0x07
+	socks5_rep_atyp_not_supported = 0x08
+)
+
+var (
+	ErrSocks5Version     = errors.New("unsupported socks version")
+	ErrSocks5Auth        = errors.New("socks5 authentication failed")
+	ErrSocks5Command     = errors.New("unsupported socks5 command")
+	ErrSocks5AddressType = errors.New("unsupported socks5 address type")
+)
+
+type Socks5HandlerOptions struct {
+	logger  *log.Logger
+	handle  *TunnelHandle
+	timeout time.Duration
+	auth    *auth.Policy
+}
+
+type Socks5HandlerOption func(*Socks5HandlerOptions)
+
+func LoggerSocks5HandlerOption(logger *log.Logger) Socks5HandlerOption {
+	return func(options *Socks5HandlerOptions) {
+		options.logger = logger
+	}
+}
+
+// TimeoutSocks5HandlerOption sets the timeout of socks5 handshake
+func TimeoutSocks5HandlerOption(timeout time.Duration) Socks5HandlerOption {
+	return func(options *Socks5HandlerOptions) {
+		options.timeout = timeout
+	}
+}
+func HandleSocks5HandlerOption(handle *TunnelHandle) Socks5HandlerOption {
+	return func(options *Socks5HandlerOptions) {
+		options.handle = handle
+	}
+}
+func AuthSocks5HandlerOption(policy *auth.Policy) Socks5HandlerOption {
+	return func(options *Socks5HandlerOptions) {
+		options.auth = policy
+	}
+}
+
+func defaultTunnelHandle(ctx context.Context, conn net.Conn, addr string, established func() error) error {
+	log.DefaultLogger.Warnf("no handle set")
+	return nil
+}
+
+func NewSocks5Handler(opts ...Socks5HandlerOption) *Socks5Handler {
+	options := &Socks5HandlerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	h := &Socks5Handler{timeout: options.timeout, auth: options.auth}
+	if options.handle == nil {
+		h.handle = defaultTunnelHandle
+	} else {
+		h.handle = *options.handle
+	}
+	if options.logger == nil {
+		h.logger = log.DefaultLogger
+	} else {
+		h.logger = *options.logger
+	}
+	return h
+}
+
+// Socks5Handler serves the CONNECT command of socks5 (RFC 1928) with optional username/password authentication (RFC 1929)
+type Socks5Handler struct {
+	handle  TunnelHandle
+	logger  log.Logger
+	timeout time.Duration
+	auth    *auth.Policy
+}
+
+func (h *Socks5Handler) Handle(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	if !h.auth.AllowClient(conn.RemoteAddr()) {
+		return fmt.Errorf("client %s is not allowed", conn.RemoteAddr())
+	}
+	if h.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(h.timeout))
+	}
+	user, err := h.negotiate(conn)
+	if err != nil {
+		return err
+	}
+	if user != "" {
+		ctx = auth.WithUser(ctx, user)
+	}
+	addr, err := h.readRequest(conn)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+	replied := false
+	established := func() error {
+		replied = true
+		return writeSocks5Reply(conn, socks5_rep_succeeded)
+	}
+	err = h.handle(ctx, conn, addr, established)
+	if err != nil && !replied {
+		writeSocks5Reply(conn, socks5_rep_host_unreachable)
+	}
+	return err
+}
+
+// negotiate selects the authentication method, it returns the user authenticated if any
+func (h *Socks5Handler) negotiate(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5_version {
+		return "", ErrSocks5Version
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	var expected byte = socks5_method_no_auth
+	if h.auth.RequireCredential() {
+		expected = socks5_method_user_pass
+	}
+	method := byte(socks5_method_no_acceptable)
+	for _, m := range methods {
+		if m == expected {
+			method = m
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{socks5_version, method}); err != nil {
+		return "", err
+	}
+	switch method {
+	case socks5_method_no_acceptable:
+		return "", ErrSocks5Auth
+	case socks5_method_user_pass:
+		return h.authenticate(conn)
+	default:
+		return "", nil
+	}
+}
+
+func (h *Socks5Handler) authenticate(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5_user_pass_version {
+		return "", ErrSocks5Version
+	}
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return "", err
+	}
+	plen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plen); err != nil {
+		return "", err
+	}
+	password := make([]byte, plen[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return "", err
+	}
+	if !h.auth.Verify(string(user), string(password)) {
+		conn.Write([]byte{socks5_user_pass_version, 0x01})
+		return "", ErrSocks5Auth
+	}
+	_, err := conn.Write([]byte{socks5_user_pass_version, 0x00})
+	return string(user), err
+}
+
+func (h *Socks5Handler) readRequest(conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5_version {
+		return "", ErrSocks5Version
+	}
+	if header[1] != socks5_cmd_connect {
+		writeSocks5Reply(conn, socks5_rep_cmd_not_supported)
+		return "", ErrSocks5Command
+	}
+	var host string
+	switch header[3] {
+	case socks5_atyp_ipv4, socks5_atyp_ipv6:
+		ip := make([]byte, net.IPv4len)
+		if header[3] == socks5_atyp_ipv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5_atyp_domain:
+		dlen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, dlen); err != nil {
+			return "", err
+		}
+		domain := make([]byte, dlen[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		writeSocks5Reply(conn, socks5_rep_atyp_not_supported)
+		return "", ErrSocks5AddressType
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func writeSocks5Reply(conn net.Conn, rep byte) error {
+	_, err := conn.Write([]byte{socks5_version, rep, 0x00, socks5_atyp_ipv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
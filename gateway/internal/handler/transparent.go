@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/util"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+)
+
+type TransparentHandlerOptions struct {
+	logger *log.Logger
+	handle *TunnelHandle
+	auth   *auth.Policy
+}
+
+type TransparentHandlerOption func(*TransparentHandlerOptions)
+
+func LoggerTransparentHandlerOption(logger *log.Logger) TransparentHandlerOption {
+	return func(options *TransparentHandlerOptions) {
+		options.logger = logger
+	}
+}
+func HandleTransparentHandlerOption(handle *TunnelHandle) TransparentHandlerOption {
+	return func(options *TransparentHandlerOptions) {
+		options.handle = handle
+	}
+}
+
+// AuthTransparentHandlerOption sets the policy of clients, only the client address is checked as no credential is carried
+func AuthTransparentHandlerOption(policy *auth.Policy) TransparentHandlerOption {
+	return func(options *TransparentHandlerOptions) {
+		options.auth = policy
+	}
+}
+
+func NewTransparentHandler(opts ...TransparentHandlerOption) *TransparentHandler {
+	options := &TransparentHandlerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	h := &TransparentHandler{auth: options.auth}
+	if options.handle == nil {
+		h.handle = defaultTunnelHandle
+	} else {
+		h.handle = *options.handle
+	}
+	if options.logger == nil {
+		h.logger = log.DefaultLogger
+	} else {
+		h.logger = *options.logger
+	}
+	return h
+}
+
+// TransparentHandler relays connections redirected to the listener to their original destination
+type TransparentHandler struct {
+	handle TunnelHandle
+	logger log.Logger
+	auth   *auth.Policy
+}
+
+func (h *TransparentHandler) Handle(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	if !h.auth.AllowClient(conn.RemoteAddr()) {
+		return fmt.Errorf("client %s is not allowed", conn.RemoteAddr())
+	}
+	addr, err := util.OriginalDst(conn)
+	if err != nil {
+		return fmt.Errorf("failed to get original destination of %s (err: %+v)", conn.RemoteAddr(), err)
+	}
+	return h.handle(ctx, conn, addr, func() error { return nil })
+}
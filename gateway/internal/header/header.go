@@ -0,0 +1,186 @@
+package header
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+const (
+	HEADER_PROXY_ID       = "X-Proxy-Id"
+	HEADER_PROXY_PROVIDER = "X-Proxy-Provider"
+	HEADER_PROXY_COUNTRY  = "X-Proxy-Country"
+)
+
+// IdentifyingHeaders are the request headers revealing the client or the gateway, removed by anonymous rules
+var IdentifyingHeaders = []string{"Via", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-Ip", "Forwarded", "Proxy-*"}
+
+// languages maps countries of proxies to the Accept-Language sent through them
+var languages = map[string]string{
+	"US": "en-US,en;q=0.9",
+	"GB": "en-GB,en;q=0.9",
+	"CA": "en-CA,en;q=0.9,fr-CA;q=0.8",
+	"AU": "en-AU,en;q=0.9",
+	"IN": "en-IN,en;q=0.9,hi;q=0.8",
+	"CN": "zh-CN,zh;q=0.9",
+	"HK": "zh-HK,zh;q=0.9,en;q=0.8",
+	"TW": "zh-TW,zh;q=0.9",
+	"JP": "ja-JP,ja;q=0.9",
+	"KR": "ko-KR,ko;q=0.9",
+	"DE": "de-DE,de;q=0.9",
+	"FR": "fr-FR,fr;q=0.9",
+	"ES": "es-ES,es;q=0.9",
+	"IT": "it-IT,it;q=0.9",
+	"NL": "nl-NL,nl;q=0.9",
+	"BR": "pt-BR,pt;q=0.9",
+	"PT": "pt-PT,pt;q=0.9",
+	"RU": "ru-RU,ru;q=0.9",
+	"MX": "es-MX,es;q=0.9",
+	"SG": "en-SG,en;q=0.9,zh;q=0.8",
+}
+
+// ResponseRule declares the headers of responses written back to clients
+type ResponseRule struct {
+	Remove    []string          `yaml:"remove"`
+	Set       map[string]string `yaml:"set"`
+	ProxyInfo bool              `yaml:"proxy_info"` // add X-Proxy-Id, X-Proxy-Provider and X-Proxy-Country of the exit proxy
+}
+
+// Rule declares the headers rewritten for requests to the matched hosts.
+// Headers are removed first, then set, so a removed header could be injected again.
+type Rule struct {
+	Hosts          []string          `yaml:"hosts"`     // patterns of target hosts, e.g. `*.example.com`, empty matches all
+	Anonymous      bool              `yaml:"anonymous"` // remove IdentifyingHeaders
+	Remove         []string          `yaml:"remove"`    // names of headers, `Proxy-*` removes headers by prefix
+	Set            map[string]string `yaml:"set"`
+	UserAgents     []string          `yaml:"user_agents"`     // User-Agent rotated by requests
+	AcceptLanguage bool              `yaml:"accept_language"` // Accept-Language matched to the country of proxy
+	Response       ResponseRule      `yaml:"response"`
+}
+
+func (r Rule) match(host string) bool {
+	if len(r.Hosts) < 1 {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range r.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) validate() error {
+	for _, pattern := range r.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Policy applies rules to requests sent to proxies and responses written back to clients, rules are applied in order.
+// A nil policy leaves headers untouched.
+type Policy struct {
+	rules []Rule
+	next  atomic.Uint64
+}
+
+func NewPolicy(rules ...Rule) (*Policy, error) {
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("header rule %d: %w", i, err)
+		}
+	}
+	return &Policy{rules: rules}, nil
+}
+
+// Request rewrites the headers of req sent through proxy, proxy is nil when connecting directly
+func (p *Policy) Request(req *http.Request, proxy *model.Proxy) {
+	if p == nil {
+		return
+	}
+	for _, r := range p.rules {
+		if !r.match(req.Host) {
+			continue
+		}
+		if r.Anonymous {
+			remove(req.Header, IdentifyingHeaders...)
+		}
+		remove(req.Header, r.Remove...)
+		for k, v := range r.Set {
+			req.Header.Set(k, v)
+		}
+		if len(r.UserAgents) > 0 {
+			req.Header.Set("User-Agent", r.UserAgents[(p.next.Add(1)-1)%uint64(len(r.UserAgents))])
+		}
+		if r.AcceptLanguage && proxy != nil && proxy.Attr != nil {
+			if lang, ok := languages[strings.ToUpper(proxy.Attr.Country)]; ok {
+				req.Header.Set("Accept-Language", lang)
+			}
+		}
+	}
+}
+
+// Response rewrites the headers of resp answering req routed through proxy
+func (p *Policy) Response(resp *http.Response, req *http.Request, proxy *model.Proxy) {
+	if p == nil {
+		return
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	for _, r := range p.rules {
+		if !r.match(req.Host) {
+			continue
+		}
+		remove(resp.Header, r.Response.Remove...)
+		for k, v := range r.Response.Set {
+			resp.Header.Set(k, v)
+		}
+		if r.Response.ProxyInfo {
+			setProxyInfo(resp.Header, proxy)
+		}
+	}
+}
+
+func setProxyInfo(header http.Header, proxy *model.Proxy) {
+	if proxy == nil {
+		header.Set(HEADER_PROXY_ID, "direct")
+		header.Del(HEADER_PROXY_PROVIDER)
+		header.Del(HEADER_PROXY_COUNTRY)
+		return
+	}
+	header.Set(HEADER_PROXY_ID, proxy.Id)
+	header.Set(HEADER_PROXY_PROVIDER, proxy.Provider)
+	if proxy.Attr != nil && proxy.Attr.Country != "" {
+		header.Set(HEADER_PROXY_COUNTRY, proxy.Attr.Country)
+	} else {
+		header.Del(HEADER_PROXY_COUNTRY)
+	}
+}
+
+func remove(header http.Header, names ...string) {
+	for _, name := range names {
+		prefix, ok := strings.CutSuffix(name, "*")
+		if !ok {
+			header.Del(name)
+			continue
+		}
+		prefix = http.CanonicalHeaderKey(prefix)
+		for k := range header {
+			if strings.HasPrefix(http.CanonicalHeaderKey(k), prefix) {
+				delete(header, k)
+			}
+		}
+	}
+}
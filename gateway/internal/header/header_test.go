@@ -0,0 +1,136 @@
+package header
+
+import (
+	"net/http"
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(host string, header http.Header) *http.Request {
+	return &http.Request{Host: host, Header: header}
+}
+
+func TestPolicyRequest(t *testing.T) {
+	proxy := &model.Proxy{Id: "p1", Provider: "free", Attr: &model.Attr{Country: "JP"}}
+	cases := []test.TestCase[any, any]{
+		{
+			Name: "Policy.Request.Anonymous",
+			Input: Rule{
+				Anonymous: true,
+			},
+			Error:    nil,
+			Expected: http.Header{"Accept": {"*/*"}},
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(tc.Input.(Rule))
+				assert.Equal(t, tc.Error, err)
+				req := newRequest("www.example.com:80", http.Header{
+					"Accept":              {"*/*"},
+					"Via":                 {"1.1 gateway"},
+					"X-Forwarded-For":     {"10.0.0.1"},
+					"Proxy-Authorization": {"Basic dTpw"},
+				})
+				p.Request(req, proxy)
+				assert.Equal(t, tc.Expected, req.Header)
+			},
+		},
+		{
+			Name: "Policy.Request.Set",
+			Input: Rule{
+				Remove: []string{"Accept"},
+				Set:    map[string]string{"Accept": "text/html", "X-Forwarded-For": "1.1.1.1"},
+			},
+			Error:    nil,
+			Expected: http.Header{"Accept": {"text/html"}, "Via": {"1.1 gateway"}, "X-Forwarded-For": {"1.1.1.1"}, "Proxy-Authorization": {"Basic dTpw"}},
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(tc.Input.(Rule))
+				assert.Equal(t, tc.Error, err)
+				req := newRequest("www.example.com:80", http.Header{
+					"Accept":              {"*/*"},
+					"Via":                 {"1.1 gateway"},
+					"X-Forwarded-For":     {"10.0.0.1"},
+					"Proxy-Authorization": {"Basic dTpw"},
+				})
+				p.Request(req, proxy)
+				assert.Equal(t, tc.Expected, req.Header)
+			},
+		},
+		{
+			Name: "Policy.Request.AcceptLanguage",
+			Input: Rule{
+				Anonymous:      true,
+				AcceptLanguage: true,
+			},
+			Error:    nil,
+			Expected: http.Header{"Accept": {"*/*"}, "Accept-Language": {"ja-JP,ja;q=0.9"}},
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(tc.Input.(Rule))
+				assert.Equal(t, tc.Error, err)
+				req := newRequest("www.example.com:80", http.Header{
+					"Accept":              {"*/*"},
+					"Via":                 {"1.1 gateway"},
+					"X-Forwarded-For":     {"10.0.0.1"},
+					"Proxy-Authorization": {"Basic dTpw"},
+				})
+				p.Request(req, proxy)
+				assert.Equal(t, tc.Expected, req.Header)
+			},
+		},
+		{
+			Name: "Policy.Request.Unmatched",
+			Input: Rule{
+				Hosts:     []string{"*.example.org"},
+				Anonymous: true,
+			},
+			Error:    nil,
+			Expected: http.Header{"Accept": {"*/*"}, "Via": {"1.1 gateway"}, "X-Forwarded-For": {"10.0.0.1"}, "Proxy-Authorization": {"Basic dTpw"}},
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := NewPolicy(tc.Input.(Rule))
+				assert.Equal(t, tc.Error, err)
+				req := newRequest("www.example.com:80", http.Header{
+					"Accept":              {"*/*"},
+					"Via":                 {"1.1 gateway"},
+					"X-Forwarded-For":     {"10.0.0.1"},
+					"Proxy-Authorization": {"Basic dTpw"},
+				})
+				p.Request(req, proxy)
+				assert.Equal(t, tc.Expected, req.Header)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestPolicyUserAgents(t *testing.T) {
+	p, err := NewPolicy(Rule{UserAgents: []string{"ua1", "ua2"}})
+	assert.Nil(t, err)
+	var agents []string
+	for i := 0; i < 3; i++ {
+		req := newRequest("example.com", http.Header{})
+		p.Request(req, nil)
+		agents = append(agents, req.Header.Get("User-Agent"))
+	}
+	assert.Equal(t, []string{"ua1", "ua2", "ua1"}, agents)
+}
+
+func TestPolicyResponse(t *testing.T) {
+	p, err := NewPolicy(Rule{Response: ResponseRule{Remove: []string{"Server"}, ProxyInfo: true}})
+	assert.Nil(t, err)
+	req := newRequest("example.com", http.Header{})
+	resp := &http.Response{Header: http.Header{"Server": {"nginx"}}}
+	p.Response(resp, req, &model.Proxy{Id: "p1", Provider: "free", Attr: &model.Attr{Country: "US"}})
+	assert.Equal(t, http.Header{HEADER_PROXY_ID: {"p1"}, HEADER_PROXY_PROVIDER: {"free"}, HEADER_PROXY_COUNTRY: {"US"}}, resp.Header)
+	resp = &http.Response{}
+	p.Response(resp, req, nil)
+	assert.Equal(t, "direct", resp.Header.Get(HEADER_PROXY_ID))
+
+	var nil_policy *Policy
+	resp = &http.Response{Header: http.Header{"Server": {"nginx"}}}
+	nil_policy.Response(resp, req, nil)
+	assert.Equal(t, "nginx", resp.Header.Get("Server"))
+
+	_, err = NewPolicy(Rule{Hosts: []string{"[example.com"}})
+	assert.Error(t, err)
+}
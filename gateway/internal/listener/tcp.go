@@ -2,10 +2,8 @@ package listener
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"strconv"
-	"strings"
 
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 
@@ -15,6 +13,7 @@ import (
 type TcpListenerOptions struct {
 	logger *log.Logger
 	ctx    context.Context
+	host   string
 }
 
 func LoggerTcpListenerOption(logger *log.Logger) TcpListenerOption {
@@ -23,6 +22,13 @@ func LoggerTcpListenerOption(logger *log.Logger) TcpListenerOption {
 	}
 }
 
+// HostTcpListenerOption sets the host to bind, all interfaces are bound by default
+func HostTcpListenerOption(host string) TcpListenerOption {
+	return func(options *TcpListenerOptions) {
+		options.host = host
+	}
+}
+
 type TcpListenerOption func(*TcpListenerOptions)
 
 type TcpListener struct {
@@ -43,7 +49,7 @@ func NewTcpListener(port int, opts ...TcpListenerOption) (*TcpListener, error) {
 		ctx = context.Background()
 	}
 	lc := net.ListenConfig{}
-	addr := fmt.Sprintf(":%d", port)
+	addr := net.JoinHostPort(options.host, strconv.Itoa(port))
 	ln, err := lc.Listen(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
@@ -71,15 +77,5 @@ func (l *TcpListener) Addr() string {
 }
 
 func (l *TcpListener) Port() int {
-	addr := l.ln.Addr().String()
-	parts := strings.Split(addr, ":")
-	var port int = -1
-	var err error
-	if len(parts) > 1 {
-		port, err = strconv.Atoi(parts[0])
-	}
-	if err != nil {
-		panic(err)
-	}
-	return port
+	return l.ln.Addr().(*net.TCPAddr).Port
 }
@@ -0,0 +1,196 @@
+package pool
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	default_max_idle     = 8
+	default_idle_timeout = time.Duration(90) * time.Second
+)
+
+// Conn is an upstream connection kept alive between requests, reads must go through Reader
+// as it may have buffered the data of the connection
+type Conn struct {
+	net.Conn
+	Reader  *bufio.Reader
+	Reused  bool
+	idle_at time.Time
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn, Reader: bufio.NewReader(conn)}
+}
+
+type ConnPoolOptions struct {
+	logger       *log.Logger
+	max_idle     *int
+	idle_timeout *time.Duration
+}
+
+type ConnPoolOption func(*ConnPoolOptions)
+
+func LogConnPoolOption(logger *log.Logger) ConnPoolOption {
+	return func(options *ConnPoolOptions) {
+		options.logger = logger
+	}
+}
+
+// MaxIdleConnPoolOption sets the number of idle connections kept for each key, 0 disables pooling
+func MaxIdleConnPoolOption(max_idle int) ConnPoolOption {
+	return func(options *ConnPoolOptions) {
+		options.max_idle = &max_idle
+	}
+}
+
+// IdleTimeoutConnPoolOption sets the time an idle connection is kept before closed
+func IdleTimeoutConnPoolOption(timeout time.Duration) ConnPoolOption {
+	return func(options *ConnPoolOptions) {
+		options.idle_timeout = &timeout
+	}
+}
+
+// ConnPool keeps idle upstream connections by key (e.g. the proxy and the target they tunnel to)
+type ConnPool struct {
+	mu           sync.Mutex
+	idle         map[string][]*Conn
+	logger       log.Logger
+	max_idle     int
+	idle_timeout time.Duration
+	now          func() time.Time
+	done         chan struct{}
+	close_once   sync.Once
+}
+
+func NewConnPool(opts ...ConnPoolOption) *ConnPool {
+	options := &ConnPoolOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	p := &ConnPool{idle: make(map[string][]*Conn), now: time.Now, done: make(chan struct{})}
+	if options.logger != nil {
+		p.logger = *options.logger
+	} else {
+		p.logger = log.DefaultLogger
+	}
+	if options.max_idle != nil && *options.max_idle >= 0 {
+		p.max_idle = *options.max_idle
+	} else {
+		p.max_idle = default_max_idle
+	}
+	if options.idle_timeout != nil && *options.idle_timeout > 0 {
+		p.idle_timeout = *options.idle_timeout
+	} else {
+		p.idle_timeout = default_idle_timeout
+	}
+	go p.sweep()
+	return p
+}
+
+// Get takes the most recently used idle connection of key
+func (p *ConnPool) Get(key string) (*Conn, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		c := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if p.now().Sub(c.idle_at) >= p.idle_timeout {
+			c.Close()
+			continue
+		}
+		if len(conns) > 0 {
+			p.idle[key] = conns
+		} else {
+			delete(p.idle, key)
+		}
+		c.Reused = true
+		return c, true
+	}
+	delete(p.idle, key)
+	return nil, false
+}
+
+// Put gives back a connection of key for reuse, it's closed if the pool of key is full
+func (p *ConnPool) Put(key string, c *Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.done:
+		c.Close()
+		return
+	default:
+	}
+	if len(p.idle[key]) >= p.max_idle {
+		c.Close()
+		return
+	}
+	c.idle_at = p.now()
+	p.idle[key] = append(p.idle[key], c)
+}
+
+// Idle returns the number of idle connections of key
+func (p *ConnPool) Idle(key string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle[key])
+}
+
+// Close closes all idle connections and stops pooling
+func (p *ConnPool) Close() {
+	p.close_once.Do(func() {
+		close(p.done)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for key, conns := range p.idle {
+			for _, c := range conns {
+				c.Close()
+			}
+			delete(p.idle, key)
+		}
+	})
+}
+
+func (p *ConnPool) sweep() {
+	logger := p.logger.WithFields(logrus.Fields{
+		"class":  "ConnPool",
+		"method": "sweep",
+	})
+	ticker := time.NewTicker(p.idle_timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		closed := 0
+		for key, conns := range p.idle {
+			alive := conns[:0]
+			for _, c := range conns {
+				if p.now().Sub(c.idle_at) >= p.idle_timeout {
+					c.Close()
+					closed++
+					continue
+				}
+				alive = append(alive, c)
+			}
+			if len(alive) > 0 {
+				p.idle[key] = alive
+			} else {
+				delete(p.idle, key)
+			}
+		}
+		p.mu.Unlock()
+		if closed > 0 {
+			logger.Debugf("closed %d idle connections", closed)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPipeConn() *Conn {
+	c, _ := net.Pipe()
+	return NewConn(c)
+}
+
+func TestConnPool(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "ConnPool.Reuse",
+			Input:    "p1|example.com:80",
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				p := NewConnPool()
+				defer p.Close()
+				c := newPipeConn()
+				_, ok := p.Get(tc.Input.(string))
+				assert.False(t, ok)
+				p.Put(tc.Input.(string), c)
+				reused, ok := p.Get(tc.Input.(string))
+				assert.Equal(t, tc.Expected, ok)
+				assert.Equal(t, c, reused)
+				assert.True(t, reused.Reused)
+				assert.Equal(t, 0, p.Idle(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "ConnPool.MaxIdle",
+			Input:    2,
+			Error:    nil,
+			Expected: 2,
+			Check: func(tc test.TestCase[any, any]) {
+				p := NewConnPool(MaxIdleConnPoolOption(tc.Input.(int)))
+				defer p.Close()
+				for i := 0; i < 3; i++ {
+					p.Put("p1", newPipeConn())
+				}
+				assert.Equal(t, tc.Expected, p.Idle("p1"))
+				assert.Equal(t, 0, p.Idle("p2"))
+			},
+		},
+		{
+			Name:     "ConnPool.IdleTimeout",
+			Input:    time.Minute,
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				now := time.Now()
+				p := NewConnPool(IdleTimeoutConnPoolOption(tc.Input.(time.Duration)))
+				defer p.Close()
+				p.now = func() time.Time { return now }
+				p.Put("p1", newPipeConn())
+				now = now.Add(tc.Input.(time.Duration))
+				_, ok := p.Get("p1")
+				assert.Equal(t, tc.Expected, ok)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
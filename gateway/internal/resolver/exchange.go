@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const dns_message_type = "application/dns-message"
+
+// exchanger sends a packed dns query to a dns server and returns the packed answer
+type exchanger interface {
+	exchange(ctx context.Context, query []byte) ([]byte, error)
+}
+
+// newExchanger parses the address of a dns server, e.g. `8.8.8.8`, `udp://8.8.8.8:53`, `tcp://1.1.1.1` or `https://dns.google/dns-query`
+func newExchanger(server string) (exchanger, error) {
+	if !strings.Contains(server, "://") {
+		server = "udp://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns server %q (err: %+v)", server, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		addr := u.Host
+		if _, port, _ := net.SplitHostPort(addr); port == "" {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+		}
+		return dnsExchanger{network: u.Scheme, addr: addr}, nil
+	case "https":
+		return dohExchanger{url: u.String(), client: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported scheme %s of dns server %q", u.Scheme, server)
+}
+
+type dnsExchanger struct {
+	network string
+	addr    string
+}
+
+func (e dnsExchanger) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, e.network, e.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if e.network == "tcp" {
+		buf := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(buf, uint16(len(query)))
+		copy(buf[2:], query)
+		if _, err := conn.Write(buf); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return nil, err
+		}
+		answer := make([]byte, binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return nil, err
+		}
+		return answer, nil
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, 65535)
+	n, err := conn.Read(answer)
+	if err != nil {
+		return nil, err
+	}
+	// the answer is truncated, retry over tcp
+	if n > 2 && answer[2]&0x02 != 0 {
+		return dnsExchanger{network: "tcp", addr: e.addr}.exchange(ctx, query)
+	}
+	return answer[:n], nil
+}
+
+// dohExchanger queries a DNS over HTTPS endpoint (RFC8484)
+type dohExchanger struct {
+	url    string
+	client *http.Client
+}
+
+func (e dohExchanger) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dns_message_type)
+	req.Header.Set("Accept", dns_message_type)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server %s responds %s", e.url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
@@ -0,0 +1,434 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	MODE_REMOTE = "remote" // hostnames are resolved by the upstream proxy, no dns query leaks from the gateway
+	MODE_LOCAL  = "local"  // hostnames are resolved by the gateway through the hosts map, then the dns server
+	MODE_HOSTS  = "hosts"  // hostnames are resolved through the hosts map, the others are resolved by the upstream proxy
+)
+
+const (
+	PREFER_IPV4 = "ipv4"
+	PREFER_IPV6 = "ipv6"
+	ONLY_IPV4   = "ipv4_only"
+	ONLY_IPV6   = "ipv6_only"
+)
+
+const (
+	default_timeout      = time.Duration(5) * time.Second
+	default_ttl          = time.Duration(60) * time.Second // ttl of addresses resolved by the system resolver
+	default_negative_ttl = time.Duration(30) * time.Second
+	min_ttl              = time.Duration(5) * time.Second
+	max_ttl              = time.Duration(1) * time.Hour
+	max_cache_size       = 4096
+)
+
+var ErrNotFound = errors.New("host not found")
+
+// Rule declares how the matched hosts are resolved
+type Rule struct {
+	Hosts  []string `yaml:"hosts"` // patterns of hosts, e.g. `*.example.com`, empty matches all
+	Mode   string   `yaml:"mode"`
+	Server string   `yaml:"server"` // dns server of local mode, the one of resolver is used if empty
+}
+
+func (r Rule) match(host string) bool {
+	if len(r.Hosts) < 1 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range r.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type ResolverOptions struct {
+	logger  *log.Logger
+	mode    *string
+	server  *string
+	prefer  *string
+	timeout *time.Duration
+	hosts   map[string]string
+	rules   []Rule
+}
+
+type ResolverOption func(*ResolverOptions)
+
+func LogResolverOption(logger *log.Logger) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.logger = logger
+	}
+}
+
+// ModeResolverOption sets the mode of hosts matched by no rule, defaults to MODE_REMOTE
+func ModeResolverOption(mode string) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.mode = &mode
+	}
+}
+
+// ServerResolverOption sets the dns server of local mode, the system resolver is used if empty
+func ServerResolverOption(server string) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.server = &server
+	}
+}
+
+// PreferResolverOption sets the preference of address families, defaults to PREFER_IPV4
+func PreferResolverOption(prefer string) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.prefer = &prefer
+	}
+}
+
+func TimeoutResolverOption(timeout time.Duration) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.timeout = &timeout
+	}
+}
+
+// HostsResolverOption pins hostnames to addresses
+func HostsResolverOption(hosts map[string]string) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.hosts = hosts
+	}
+}
+
+// RulesResolverOption sets the rules of resolver, the first rule matched decides the mode of a host
+func RulesResolverOption(rules ...Rule) ResolverOption {
+	return func(options *ResolverOptions) {
+		options.rules = append(options.rules, rules...)
+	}
+}
+
+type cacheEntry struct {
+	ips       []net.IP
+	expire_at time.Time
+}
+
+// Resolver decides whether hostnames are resolved by the gateway or by the upstream proxy,
+// addresses resolved by the gateway are cached by the ttl of their records.
+// A nil resolver leaves all hostnames to the upstream proxy.
+type Resolver struct {
+	logger  log.Logger
+	mode    string
+	prefer  string
+	timeout time.Duration
+	hosts   map[string][]net.IP
+	rules   []Rule
+	server  string               // dns server of resolver, empty for the system resolver
+	servers map[string]exchanger // dns servers by address
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+	now     func() time.Time
+}
+
+func NewResolver(opts ...ResolverOption) (*Resolver, error) {
+	options := &ResolverOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	r := &Resolver{
+		mode:    MODE_REMOTE,
+		prefer:  PREFER_IPV4,
+		timeout: default_timeout,
+		hosts:   make(map[string][]net.IP),
+		servers: make(map[string]exchanger),
+		cache:   make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+	if options.logger != nil {
+		r.logger = *options.logger
+	} else {
+		r.logger = log.DefaultLogger
+	}
+	if options.mode != nil && *options.mode != "" {
+		r.mode = *options.mode
+	}
+	if err := checkMode(r.mode); err != nil {
+		return nil, err
+	}
+	if options.prefer != nil && *options.prefer != "" {
+		r.prefer = *options.prefer
+	}
+	switch r.prefer {
+	case PREFER_IPV4, PREFER_IPV6, ONLY_IPV4, ONLY_IPV6:
+	default:
+		return nil, fmt.Errorf("invalid ip preference %s", r.prefer)
+	}
+	if options.timeout != nil && *options.timeout > 0 {
+		r.timeout = *options.timeout
+	}
+	if options.server != nil && *options.server != "" {
+		ex, err := newExchanger(*options.server)
+		if err != nil {
+			return nil, err
+		}
+		r.server = *options.server
+		r.servers[r.server] = ex
+	}
+	for host, addr := range options.hosts {
+		for _, a := range strings.Split(addr, ",") {
+			ip := net.ParseIP(strings.TrimSpace(a))
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q of host %s", a, host)
+			}
+			key := strings.ToLower(host)
+			r.hosts[key] = append(r.hosts[key], ip)
+		}
+	}
+	for i, rule := range options.rules {
+		if err := checkMode(rule.Mode); err != nil {
+			return nil, fmt.Errorf("dns rule %d: %w", i, err)
+		}
+		for _, pattern := range rule.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("dns rule %d: invalid host pattern %q", i, pattern)
+			}
+		}
+		if rule.Server != "" {
+			if _, ok := r.servers[rule.Server]; !ok {
+				ex, err := newExchanger(rule.Server)
+				if err != nil {
+					return nil, fmt.Errorf("dns rule %d: %w", i, err)
+				}
+				r.servers[rule.Server] = ex
+			}
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+func checkMode(mode string) error {
+	switch mode {
+	case MODE_REMOTE, MODE_LOCAL, MODE_HOSTS:
+		return nil
+	}
+	return fmt.Errorf("invalid dns mode %q", mode)
+}
+
+// Resolve returns the addresses of host ordered by preference,
+// it returns nil without error if host should be resolved by the upstream proxy
+func (r *Resolver) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	mode, server := r.mode, r.server
+	for _, rule := range r.rules {
+		if rule.match(host) {
+			mode = rule.Mode
+			if rule.Server != "" {
+				server = rule.Server
+			}
+			break
+		}
+	}
+	if mode == MODE_REMOTE {
+		return nil, nil
+	}
+	if ips, ok := r.hosts[host]; ok {
+		return r.order(ips), nil
+	}
+	if mode == MODE_HOSTS {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	var ips []net.IP
+	for _, qtype := range r.types() {
+		records, err := r.lookup(ctx, server, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, records...)
+	}
+	if len(ips) < 1 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, host)
+	}
+	return ips, nil
+}
+
+// ResolveAddr replaces the hostname of addr by its preferred address if it's resolved by the gateway
+func (r *Resolver) ResolveAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	ips, err := r.Resolve(ctx, host)
+	if err != nil || len(ips) < 1 {
+		return addr, err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+func (r *Resolver) types() []dnsmessage.Type {
+	switch r.prefer {
+	case PREFER_IPV6:
+		return []dnsmessage.Type{dnsmessage.TypeAAAA, dnsmessage.TypeA}
+	case ONLY_IPV4:
+		return []dnsmessage.Type{dnsmessage.TypeA}
+	case ONLY_IPV6:
+		return []dnsmessage.Type{dnsmessage.TypeAAAA}
+	}
+	return []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+}
+
+// order filters and sorts ips by the preference of address families
+func (r *Resolver) order(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	var ordered []net.IP
+	for _, qtype := range r.types() {
+		if qtype == dnsmessage.TypeA {
+			ordered = append(ordered, v4...)
+		} else {
+			ordered = append(ordered, v6...)
+		}
+	}
+	return ordered
+}
+
+func (r *Resolver) lookup(ctx context.Context, server string, host string, qtype dnsmessage.Type) ([]net.IP, error) {
+	logger := r.logger.WithFields(logrus.Fields{
+		"class":  "Resolver",
+		"method": "lookup",
+	})
+	key := server + "|" + qtype.String() + "|" + host
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expire_at) {
+		return entry.ips, nil
+	}
+	var (
+		ips []net.IP
+		ttl time.Duration
+		err error
+	)
+	if ex, ok := r.servers[server]; ok {
+		ips, ttl, err = query(ctx, ex, host, qtype)
+	} else {
+		ips, ttl, err = lookupSystem(ctx, host, qtype)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("resolved %s %s: %v (ttl: %s)", qtype, host, ips, ttl)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= max_cache_size {
+		now := r.now()
+		for k, e := range r.cache {
+			if !now.Before(e.expire_at) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= max_cache_size {
+			r.cache = make(map[string]cacheEntry)
+		}
+	}
+	r.cache[key] = cacheEntry{ips: ips, expire_at: r.now().Add(ttl)}
+	return ips, nil
+}
+
+func lookupSystem(ctx context.Context, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	network := "ip4"
+	if qtype == dnsmessage.TypeAAAA {
+		network = "ip6"
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	var dns_err *net.DNSError
+	if errors.As(err, &dns_err) && dns_err.IsNotFound {
+		return nil, default_negative_ttl, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return ips, default_ttl, nil
+}
+
+// query resolves the records of qtype through the dns server, the ttl returned is the minimum of records
+func query(ctx context.Context, ex exchanger, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	answer, err := ex.exchange(ctx, packed)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(answer); err != nil {
+		return nil, 0, err
+	}
+	if resp.ID != id {
+		return nil, 0, fmt.Errorf("mismatched id of dns answer for %s", host)
+	}
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, default_negative_ttl, nil
+	default:
+		return nil, 0, fmt.Errorf("failed to resolve %s (rcode: %s)", host, resp.RCode)
+	}
+	var ips []net.IP
+	ttl := max_ttl
+	for _, rr := range resp.Answers {
+		var ip net.IP
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			ip = net.IP(body.AAAA[:])
+		default:
+			continue
+		}
+		if rr.Header.Type != qtype {
+			continue
+		}
+		ips = append(ips, ip)
+		ttl = min(ttl, time.Duration(rr.Header.TTL)*time.Second)
+	}
+	if len(ips) < 1 {
+		return nil, default_negative_ttl, nil
+	}
+	return ips, max(ttl, min_ttl), nil
+}
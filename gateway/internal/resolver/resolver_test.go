@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeExchanger answers queries of example.com with fixed records and counts the queries
+type fakeExchanger struct {
+	queries int
+}
+
+func (e *fakeExchanger) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	e.queries++
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, err
+	}
+	q := msg.Questions[0]
+	msg.Header.Response = true
+	if q.Name.String() != "example.com." {
+		msg.Header.RCode = dnsmessage.RCodeNameError
+		return msg.Pack()
+	}
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 300}
+	switch q.Type {
+	case dnsmessage.TypeA:
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}}})
+	case dnsmessage.TypeAAAA:
+		aaaa := [16]byte{}
+		copy(aaaa[:], net.ParseIP("2606:2800:220:1::248"))
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: aaaa}})
+	}
+	return msg.Pack()
+}
+
+func newFakeResolver(t *testing.T, opts ...ResolverOption) (*Resolver, *fakeExchanger) {
+	r, err := NewResolver(append([]ResolverOption{ModeResolverOption(MODE_LOCAL), ServerResolverOption("udp://127.0.0.1:53")}, opts...)...)
+	assert.Nil(t, err)
+	ex := &fakeExchanger{}
+	r.servers[r.server] = ex
+	return r, ex
+}
+
+func TestResolveAddr(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Resolver.Local",
+			Input:    []ResolverOption{},
+			Error:    nil,
+			Expected: "93.184.216.34:443",
+			Check: func(tc test.TestCase[any, any]) {
+				r, _ := newFakeResolver(t, tc.Input.([]ResolverOption)...)
+				addr, err := r.ResolveAddr(context.Background(), "example.com:443")
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, addr)
+			},
+		},
+		{
+			Name:     "Resolver.Local.PreferIPv6",
+			Input:    []ResolverOption{PreferResolverOption(PREFER_IPV6)},
+			Error:    nil,
+			Expected: "[2606:2800:220:1::248]:443",
+			Check: func(tc test.TestCase[any, any]) {
+				r, _ := newFakeResolver(t, tc.Input.([]ResolverOption)...)
+				addr, err := r.ResolveAddr(context.Background(), "example.com:443")
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, addr)
+			},
+		},
+		{
+			Name:     "Resolver.Remote",
+			Input:    []ResolverOption{ModeResolverOption(MODE_REMOTE)},
+			Error:    nil,
+			Expected: "example.com:443",
+			Check: func(tc test.TestCase[any, any]) {
+				r, _ := newFakeResolver(t, tc.Input.([]ResolverOption)...)
+				addr, err := r.ResolveAddr(context.Background(), "example.com:443")
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, addr)
+			},
+		},
+		{
+			Name:     "Resolver.Rule.Remote",
+			Input:    []ResolverOption{RulesResolverOption(Rule{Hosts: []string{"*.com"}, Mode: MODE_REMOTE})},
+			Error:    nil,
+			Expected: "example.com:443",
+			Check: func(tc test.TestCase[any, any]) {
+				r, _ := newFakeResolver(t, tc.Input.([]ResolverOption)...)
+				addr, err := r.ResolveAddr(context.Background(), "example.com:443")
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, addr)
+			},
+		},
+		{
+			Name:     "Resolver.Hosts",
+			Input:    []ResolverOption{ModeResolverOption(MODE_HOSTS), HostsResolverOption(map[string]string{"Example.com": "::1, 127.0.0.1"})},
+			Error:    nil,
+			Expected: "127.0.0.1:443",
+			Check: func(tc test.TestCase[any, any]) {
+				r, _ := newFakeResolver(t, tc.Input.([]ResolverOption)...)
+				addr, err := r.ResolveAddr(context.Background(), "example.com:443")
+				assert.Equal(t, tc.Error, err)
+				assert.Equal(t, tc.Expected, addr)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestResolverCache(t *testing.T) {
+	now := time.Now()
+	r, ex := newFakeResolver(t, PreferResolverOption(ONLY_IPV4))
+	r.now = func() time.Time { return now }
+	ips, err := r.Resolve(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ips))
+	r.Resolve(context.Background(), "example.com")
+	assert.Equal(t, 1, ex.queries)
+	// expired by the ttl of records
+	now = now.Add(300 * time.Second)
+	r.Resolve(context.Background(), "example.com")
+	assert.Equal(t, 2, ex.queries)
+
+	_, err = r.Resolve(context.Background(), "unknown.example.org")
+	assert.ErrorIs(t, err, ErrNotFound)
+	r.Resolve(context.Background(), "unknown.example.org")
+	assert.Equal(t, 3, ex.queries)
+
+	var nil_resolver *Resolver
+	addr, err := nil_resolver.ResolveAddr(context.Background(), "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com:80", addr)
+
+	_, err = NewResolver(ModeResolverOption("dns"))
+	assert.Error(t, err)
+	_, err = NewResolver(ServerResolverOption("ftp://1.1.1.1"))
+	assert.Error(t, err)
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/breaker"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/bypass"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/selector"
 	service "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/service"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 
+	managerv1 "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	manager_model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -30,12 +34,18 @@ var (
 type RouteSelector selector.Selector[Route[manager_model.Proxy]]
 
 type ProxyBrouterOptions struct {
-	logger      *log.Logger
-	fb_tbl_size *int
-	fb_tbl_cap  *int
-	tbl_size    *int
-	tbl_cap     *int
-	selector    RouteSelector
+	logger        *log.Logger
+	fb_tbl_size   *int
+	fb_tbl_cap    *int
+	tbl_size      *int
+	tbl_cap       *int
+	selector      RouteSelector
+	breaker       *breaker.Breaker
+	conn          *grpc.ClientConn
+	gateway_serv  *service.GatewayService
+	filter        *managerv1.Filter
+	backup_filter *managerv1.Filter
+	bypass        *bypass.List
 }
 
 type ProxyBrouterOption func(*ProxyBrouterOptions)
@@ -70,6 +80,46 @@ func SelectorProxyBrouterOption(selector RouteSelector) ProxyBrouterOption {
 		options.selector = selector
 	}
 }
+func BreakerProxyBrouterOption(breaker *breaker.Breaker) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.breaker = breaker
+	}
+}
+
+// ConnProxyBrouterOption shares an established connection to manager between brouters
+func ConnProxyBrouterOption(conn *grpc.ClientConn) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.conn = conn
+	}
+}
+
+// GatewayServiceProxyBrouterOption shares the gateway service reporting events between brouters
+func GatewayServiceProxyBrouterOption(gateway_serv *service.GatewayService) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.gateway_serv = gateway_serv
+	}
+}
+
+// FilterProxyBrouterOption sets the filter of proxies loaded into the route table
+func FilterProxyBrouterOption(filter *managerv1.Filter) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.filter = filter
+	}
+}
+
+// BackupFilterProxyBrouterOption sets the filter of proxies loaded into the fallback route table
+func BackupFilterProxyBrouterOption(filter *managerv1.Filter) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.backup_filter = filter
+	}
+}
+
+// BypassProxyBrouterOption sets the destinations connected directly without routing through proxies
+func BypassProxyBrouterOption(list *bypass.List) ProxyBrouterOption {
+	return func(options *ProxyBrouterOptions) {
+		options.bypass = list
+	}
+}
 func MaxRetryRouteOption(retry int) RouteOption {
 	return func(options *RouteOptions) {
 		options.max_retry = &retry
@@ -81,7 +131,7 @@ type ProxyBrouter struct {
 	addr             string
 	ctx              context.Context
 	proxy_serv       service.ProxyService
-	gateway_serv     service.GatewayService
+	gateway_serv     *service.GatewayService
 	dyn_route_tbl    *RouteTable[manager_model.Proxy] //route table for proxies
 	dyn_fb_route_tbl *RouteTable[manager_model.Proxy] //route table for fallback proxies
 	tbl_size         int
@@ -89,6 +139,8 @@ type ProxyBrouter struct {
 	fb_tbl_size      int
 	fb_tbl_cap       int
 	selector         RouteSelector
+	breaker          *breaker.Breaker //circuit breaker for quarantining failing proxies
+	bypass           *bypass.List     //destinations connected directly
 }
 
 func NewProxyBrouter(ctx context.Context, addr string, opts ...ProxyBrouterOption) (*ProxyBrouter, error) {
@@ -96,7 +148,7 @@ func NewProxyBrouter(ctx context.Context, addr string, opts ...ProxyBrouterOptio
 	for _, opt := range opts {
 		opt(options)
 	}
-	s := ProxyBrouter{ctx: ctx, addr: addr}
+	s := ProxyBrouter{ctx: ctx, addr: addr, bypass: options.bypass}
 	if options.logger != nil {
 		s.logger = *options.logger
 	} else {
@@ -127,16 +179,21 @@ func NewProxyBrouter(ctx context.Context, addr string, opts ...ProxyBrouterOptio
 	} else {
 		s.selector = options.selector
 	}
-	err := s.init()
+	if options.breaker == nil {
+		s.breaker = breaker.NewBreaker()
+	} else {
+		s.breaker = options.breaker
+	}
+	err := s.init(options)
 	if err != nil {
 		return nil, err
 	}
 	return &s, nil
 }
 
-func (s *ProxyBrouter) init() error {
+func (s *ProxyBrouter) init(options *ProxyBrouterOptions) error {
 	var err error
-	err = s.initService()
+	err = s.initService(options)
 	if err != nil {
 		return err
 	}
@@ -147,17 +204,35 @@ func (s *ProxyBrouter) init() error {
 	return nil
 }
 
-func (s *ProxyBrouter) initService() error {
-	proxy_serv, err := service.NewProxyService(s.addr, service.CtxProxyServiceOption(&s.ctx), service.PrefetchIntervalProxyServiceOption(time.Duration(60)*time.Second), service.LogProxyServiceOption(&s.logger))
+func (s *ProxyBrouter) initService(options *ProxyBrouterOptions) error {
+	proxy_serv_opts := []service.ProxyServiceOption{service.CtxProxyServiceOption(&s.ctx), service.PrefetchIntervalProxyServiceOption(time.Duration(60) * time.Second), service.LogProxyServiceOption(&s.logger)}
+	if options.conn != nil {
+		proxy_serv_opts = append(proxy_serv_opts, service.ConnProxyServiceOption(options.conn))
+	}
+	if options.filter != nil {
+		proxy_serv_opts = append(proxy_serv_opts, service.FilterProxyServiceOption(options.filter))
+	}
+	if options.backup_filter != nil {
+		proxy_serv_opts = append(proxy_serv_opts, service.BackupFilterProxyServiceOption(options.backup_filter))
+	}
+	proxy_serv, err := service.NewProxyService(s.addr, proxy_serv_opts...)
 	if err != nil {
 		return err
 	}
 	s.proxy_serv = *proxy_serv
-	gateway_serv, err := service.NewGatewayService(s.addr, service.CtxGatewayServiceOption(&s.ctx), service.LogGatewayServiceOption(&s.logger))
+	if options.gateway_serv != nil {
+		s.gateway_serv = options.gateway_serv
+		return nil
+	}
+	gateway_serv_opts := []service.GatewayServiceOption{service.CtxGatewayServiceOption(&s.ctx), service.LogGatewayServiceOption(&s.logger)}
+	if options.conn != nil {
+		gateway_serv_opts = append(gateway_serv_opts, service.ConnGatewayServiceOption(options.conn))
+	}
+	gateway_serv, err := service.NewGatewayService(s.addr, gateway_serv_opts...)
 	if err != nil {
 		return err
 	}
-	s.gateway_serv = *gateway_serv
+	s.gateway_serv = gateway_serv
 	return nil
 }
 
@@ -176,6 +251,9 @@ func (s *ProxyBrouter) initRouteTbl() error {
 			if v == nil {
 				break
 			}
+			if !s.routable(v) {
+				continue
+			}
 			route := NewRoute(*v, *NewRouteRule(func(v any) bool { return true }))
 			proxies = append(proxies, *route)
 		}
@@ -190,6 +268,9 @@ func (s *ProxyBrouter) initRouteTbl() error {
 			if v == nil {
 				break
 			}
+			if !s.routable(v) {
+				continue
+			}
 			route := NewRoute(*v, *NewRouteRule(func(v any) bool { return true }))
 			proxies = append(proxies, *route)
 		}
@@ -201,46 +282,93 @@ func (s *ProxyBrouter) initRouteTbl() error {
 	return nil
 }
 
-func (s *ProxyBrouter) handleCb(cb RouteCallback, opts ...RouteOption) error {
+// routable tells whether p could be routed through, proxies whose credentials are redacted by manager are left out
+// as they would refuse the connections
+func (s *ProxyBrouter) routable(p *manager_model.Proxy) bool {
+	if p.UseConfig != nil && p.UseConfig.Redacted {
+		s.logger.Warnf("credentials of proxy %s (%s) are redacted, it's not routed through (a manager token granted the scope of credentials is required)", p.Id, p.Ip)
+		return false
+	}
+	return true
+}
+
+// next returns the next route in tbl whose circuit allows it to be used
+func (s *ProxyBrouter) next(tbl *RouteTable[manager_model.Proxy], opts ...RouteOption) *manager_model.Proxy {
 	options := &RouteOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
-	start := time.Now()
-	p := s.dyn_route_tbl.Route(opts...)
-	if p == nil {
-		return ErrNoRoute
+	if options.selector != nil {
+		return s.pick(tbl, options, opts...)
 	}
-	err := cb(p)
-	if err != nil {
-		err, ok := err.(RouteError)
-		if ok {
-			s.gateway_serv.CreateEvent(service.BlockedEvent{Time: time.Now(), Proxy: err.from, Site: err.to, Cost: time.Since(start)})
-			s.logger.Errorf("failed to callback (err: %+v)", err)
+	for i := 0; i <= tbl.Size(); i++ {
+		p := tbl.Route(opts...)
+		if p == nil {
+			return nil
 		}
-		return err
-	} else {
-		var src string = ""
-		if options.metadata != nil {
-			src = (*options.metadata)["addr"]
+		if s.breaker.Allow(p.Id) {
+			return p
+		}
+	}
+	return nil
+}
+
+// pick chooses a route in tbl with the selector of options among routes not quarantined
+func (s *ProxyBrouter) pick(tbl *RouteTable[manager_model.Proxy], options *RouteOptions, opts ...RouteOption) *manager_model.Proxy {
+	now := time.Now()
+	candidates := make([]Route[manager_model.Proxy], 0)
+	for _, r := range tbl.Routes(opts...) {
+		if s.breaker.State(r.v.Id) == breaker.STATE_CLOSED || !now.Before(s.breaker.Until(r.v.Id)) {
+			candidates = append(candidates, r)
+		}
+	}
+	for len(candidates) > 0 {
+		r := options.selector.Select(s.ctx, options.metadata, candidates...)
+		if s.breaker.Allow(r.v.Id) {
+			return &r.v
+		}
+		for i := range candidates {
+			if candidates[i].v.Id == r.v.Id {
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
 		}
-		s.gateway_serv.CreateEvent(service.PassedEvent{Time: time.Now(), Proxy: p.Ip, Site: src, Cost: time.Since(start)})
-		return nil
 	}
+	return nil
+}
 
+// feedback records the outcome of routing through p into the circuit breaker,
+// proxies whose circuit opened are reported as unavailable
+func (s *ProxyBrouter) feedback(p *manager_model.Proxy, err error) {
+	if err == nil {
+		state := s.breaker.State(p.Id)
+		s.breaker.Success(p.Id)
+		if state != breaker.STATE_CLOSED {
+			s.gateway_serv.CreateEvent(service.AvailableEvent{Time: time.Now(), Id: p.Id, Proxy: p.Ip})
+		}
+		return
+	}
+	if !errors.As(err, &RouteError{}) {
+		// failure not caused by the proxy
+		s.breaker.Release(p.Id)
+		return
+	}
+	if s.breaker.Failure(p.Id) {
+		until := s.breaker.Until(p.Id)
+		s.logger.Warnf("circuit of proxy %s (%s) opened until %s", p.Id, p.Ip, until.Format(time.RFC3339))
+		s.gateway_serv.CreateEvent(service.UnavailableEvent{Time: time.Now(), Id: p.Id, Proxy: p.Ip, Reason: err.Error(), Until: until})
+	}
 }
 
-func (s *ProxyBrouter) handlFb(fb RouteCallback, opts ...RouteOption) error {
+// attempt calls cb with p, the outcome is fed back to the circuit breaker and reported to manager
+func (s *ProxyBrouter) attempt(p *manager_model.Proxy, cb RouteCallback, opts ...RouteOption) error {
 	options := &RouteOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
 	start := time.Now()
-	route := s.dyn_fb_route_tbl.Route(opts...)
-	if route == nil {
-		return ErrNoRoute
-	}
-	err := fb(route)
+	err := cb(p)
+	s.feedback(p, err)
 	if err != nil {
 		err, ok := err.(RouteError)
 		if ok {
@@ -253,17 +381,48 @@ func (s *ProxyBrouter) handlFb(fb RouteCallback, opts ...RouteOption) error {
 		if options.metadata != nil {
 			src = (*options.metadata)["addr"]
 		}
-		s.gateway_serv.CreateEvent(service.PassedEvent{Time: time.Now(), Proxy: route.Ip, Site: src, Cost: time.Since(start)})
+		s.gateway_serv.CreateEvent(service.PassedEvent{Time: time.Now(), Proxy: p.Ip, Site: src, Cost: time.Since(start)})
 		return nil
 	}
 }
 
-func (s *ProxyBrouter) Route(ctx context.Context, callback RouteCallback, opts ...RouteOption) {
+func (s *ProxyBrouter) handleCb(cb RouteCallback, opts ...RouteOption) error {
+	p := s.next(s.dyn_route_tbl, opts...)
+	if p == nil {
+		return ErrNoRoute
+	}
+	return s.attempt(p, cb, opts...)
+}
+
+func (s *ProxyBrouter) handlFb(fb RouteCallback, opts ...RouteOption) error {
+	route := s.next(s.dyn_fb_route_tbl, opts...)
+	if route == nil {
+		return ErrNoRoute
+	}
+	return s.attempt(route, fb, opts...)
+}
+
+// RouteTo routes callback through p, e.g. the proxy a sticky session is bound to,
+// it returns ErrNoRoute if the circuit of p is open
+func (s *ProxyBrouter) RouteTo(ctx context.Context, p *manager_model.Proxy, callback RouteCallback, opts ...RouteOption) error {
+	if !s.breaker.Allow(p.Id) {
+		return ErrNoRoute
+	}
+	return s.attempt(p, callback, opts...)
+}
+
+// Route routes callback through proxies of route table, fallbacks to backup proxies and direct connection,
+// it returns the error of the last attempt if all of them failed.
+// Destinations (addr of metadata) in the bypass list are connected directly.
+func (s *ProxyBrouter) Route(ctx context.Context, callback RouteCallback, opts ...RouteOption) error {
 	options := &RouteOptions{}
 
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.metadata != nil && s.bypass.MatchAddr((*options.metadata)["addr"]) {
+		return callback(nil)
+	}
 	var max_retry int = default_max_retry
 	if options.max_retry != nil {
 		max_retry = *options.max_retry
@@ -271,11 +430,12 @@ func (s *ProxyBrouter) Route(ctx context.Context, callback RouteCallback, opts .
 	if s.dyn_route_tbl.Size() > 0 && s.dyn_route_tbl.Size() < max_retry {
 		max_retry = s.dyn_route_tbl.Size()
 	}
+	var err error = ErrNoRoute
 	for i := 0; i < max_retry; i++ {
-		err := s.handleCb(callback, opts...)
+		err = s.handleCb(callback, opts...)
 		//stop proxy routing after proxy routed successfully
 		if err == nil {
-			return
+			return nil
 		}
 		//inavaliable proxy incurred failure route, continue to next route
 		if errors.As(err, &RouteError{}) {
@@ -285,12 +445,16 @@ func (s *ProxyBrouter) Route(ctx context.Context, callback RouteCallback, opts .
 		if options.fallback != nil {
 			err = s.handlFb(*options.fallback, opts...)
 			if err == nil {
-				return
+				return nil
 			}
 		}
+		if options.direct != nil && !*options.direct {
+			continue
+		}
 		err = callback(nil)
 		if err == nil {
-			return
+			return nil
 		}
 	}
+	return err
 }
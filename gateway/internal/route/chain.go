@@ -160,6 +160,17 @@ func (c *EChain[T]) Value() *T {
 	return &val
 }
 
+// Values returns a copy of the loaded values
+func (c *EChain[T]) Values() []T {
+	if c.cntr == nil || len(*c.cntr) == 0 || c.max_end == 0 {
+		go sync.OnceFunc(func() { c.prefetch(int(c.init_cap)) })()
+		return nil
+	}
+	vs := make([]T, c.max_end)
+	copy(vs, (*c.cntr)[:c.max_end])
+	return vs
+}
+
 func (c *EChain[T]) prefetch(size int) {
 	cnt := 0
 	vs := c.loader(size)
@@ -26,12 +26,28 @@ func NewRouteError(from string, to string, err error) RouteError {
 	return RouteError{from: from, to: to, err: err}
 }
 
+// From returns the proxy routed through
+func (err RouteError) From() string {
+	return err.from
+}
+
+// To returns the destination routed to
+func (err RouteError) To() string {
+	return err.to
+}
+
+func (err RouteError) Unwrap() error {
+	return err.err
+}
+
 type RouteCallback func(*model.Proxy) error
 
 type RouteOptions struct {
 	fallback  *RouteCallback
 	metadata  *meta.Metadata
 	max_retry *int
+	direct    *bool
+	selector  RouteSelector
 }
 
 type RouteOption func(*RouteOptions)
@@ -47,6 +63,20 @@ func MetadataRouteOption(metadata meta.Metadata) RouteOption {
 	}
 }
 
+// DirectRouteOption sets whether to connect directly once no proxy could be routed, it's enabled by default
+func DirectRouteOption(direct bool) RouteOption {
+	return func(options *RouteOptions) {
+		options.direct = &direct
+	}
+}
+
+// SelectorRouteOption selects routes with selector instead of iterating the route table in order
+func SelectorRouteOption(selector RouteSelector) RouteOption {
+	return func(options *RouteOptions) {
+		options.selector = selector
+	}
+}
+
 type RouteRuleMatch[T any] func(T) bool
 
 type RouteRule struct {
@@ -153,6 +183,17 @@ func (r *RouteTable[T]) Add(v T) {
 	r.chain.Add(*route)
 }
 
+// Routes returns the loaded routes matched
+func (r *RouteTable[T]) Routes(opts ...RouteOption) []Route[T] {
+	routes := make([]Route[T], 0)
+	for _, route := range r.chain.Values() {
+		if route.Match(opts...) != nil {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
 func (r *RouteTable[T]) Route(opts ...RouteOption) *T {
 	logger := r.logger.WithFields(logrus.Fields{
 		"class":  fmt.Sprintf("RouteTable (%p)", r),
@@ -2,6 +2,8 @@ package selector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -14,6 +16,31 @@ type Selector[T any] interface {
 	Select(context.Context, *meta.Metadata, ...T) T
 }
 
+const (
+	SELECTOR_ROUND_ROBIN = "round_robin"
+	SELECTOR_RANDOM      = "random"
+	SELECTOR_FIFO        = "fifo"
+	SELECTOR_HASH        = "hash"
+)
+
+var ErrUnknownSelector = errors.New("unknown selector")
+
+// NewSelector creates the selector of strategy name
+func NewSelector[T any](name string) (Selector[T], error) {
+	switch name {
+	case SELECTOR_ROUND_ROBIN:
+		return NewRoundRobin[T](), nil
+	case SELECTOR_RANDOM:
+		return Random[T](), nil
+	case SELECTOR_FIFO:
+		return FIFO[T](), nil
+	case SELECTOR_HASH:
+		return Hash[T](), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSelector, name)
+	}
+}
+
 type Weight interface {
 	Weight() int
 }
@@ -3,16 +3,21 @@ package internal
 import (
 	"time"
 
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/handler"
 	listener "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/listener"
 	log "github.com/WALL-EEEEEEE/proxy-service/gateway/log"
 )
 
 type HttpProxyServerOptions struct {
+	name          string
+	host          string
+	auth          *auth.Policy
 	logger        *log.Logger
 	handle        *handler.HttpHandle
 	DailTimetout  time.Duration
 	HandleTimeout time.Duration
+	KeepAlive     *time.Duration
 }
 
 type HttpProxyServerOption func(*HttpProxyServerOptions)
@@ -22,6 +27,21 @@ func LogHttpProxyServerOption(logger *log.Logger) HttpProxyServerOption {
 		options.logger = logger
 	}
 }
+func NameHttpProxyServerOption(name string) HttpProxyServerOption {
+	return func(options *HttpProxyServerOptions) {
+		options.name = name
+	}
+}
+func HostHttpProxyServerOption(host string) HttpProxyServerOption {
+	return func(options *HttpProxyServerOptions) {
+		options.host = host
+	}
+}
+func AuthHttpProxyServerOption(policy *auth.Policy) HttpProxyServerOption {
+	return func(options *HttpProxyServerOptions) {
+		options.auth = policy
+	}
+}
 func HandleTimeoutHttpProxyServerOption(timeout time.Duration) HttpProxyServerOption {
 	return func(options *HttpProxyServerOptions) {
 		options.HandleTimeout = timeout
@@ -33,6 +53,12 @@ func HandleHttpProxyServerOption(handle handler.HttpHandle) HttpProxyServerOptio
 	}
 }
 
+func KeepAliveHttpProxyServerOption(timeout time.Duration) HttpProxyServerOption {
+	return func(options *HttpProxyServerOptions) {
+		options.KeepAlive = &timeout
+	}
+}
+
 func DailTimeoutHttpProxyServerOption(timeout time.Duration) HttpProxyServerOption {
 	return func(options *HttpProxyServerOptions) {
 		options.DailTimetout = timeout
@@ -46,17 +72,24 @@ func NewHttpProxyServer(port int, opts ...HttpProxyServerOption) (serv *Server,
 	}
 	ln, err := listener.NewTcpListener(port,
 		listener.LoggerTcpListenerOption(options.logger),
+		listener.HostTcpListenerOption(options.host),
 	)
 	if err != nil {
 		return nil, err
 	}
-	hd := handler.NewHttpHandler(
+	hd_opts := []handler.HttpHandlerOption{
 		handler.LoggerHttpHandlerOption(options.logger),
 		handler.TimeoutHttpHandlerOption(options.HandleTimeout),
 		handler.HandleHttpHandlerOption(options.handle),
-	)
+		handler.AuthHttpHandlerOption(options.auth),
+	}
+	if options.KeepAlive != nil {
+		hd_opts = append(hd_opts, handler.KeepAliveHttpHandlerOption(*options.KeepAlive))
+	}
+	hd := handler.NewHttpHandler(hd_opts...)
 	serv = NewServer(ln, hd,
 		LogServerOption(options.logger),
+		NameServerOption(options.name),
 	)
 	return serv, nil
 }
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/handler"
+	listener "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/listener"
+	log "github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+)
+
+type Socks5ProxyServerOptions struct {
+	name             string
+	host             string
+	auth             *auth.Policy
+	logger           *log.Logger
+	handle           *handler.TunnelHandle
+	HandshakeTimeout time.Duration
+}
+
+type Socks5ProxyServerOption func(*Socks5ProxyServerOptions)
+
+func NameSocks5ProxyServerOption(name string) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.name = name
+	}
+}
+func HostSocks5ProxyServerOption(host string) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.host = host
+	}
+}
+func AuthSocks5ProxyServerOption(policy *auth.Policy) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.auth = policy
+	}
+}
+func LogSocks5ProxyServerOption(logger *log.Logger) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.logger = logger
+	}
+}
+func HandleSocks5ProxyServerOption(handle handler.TunnelHandle) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.handle = &handle
+	}
+}
+func HandshakeTimeoutSocks5ProxyServerOption(timeout time.Duration) Socks5ProxyServerOption {
+	return func(options *Socks5ProxyServerOptions) {
+		options.HandshakeTimeout = timeout
+	}
+}
+
+func NewSocks5ProxyServer(port int, opts ...Socks5ProxyServerOption) (serv *Server, err error) {
+	options := &Socks5ProxyServerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	ln, err := listener.NewTcpListener(port,
+		listener.LoggerTcpListenerOption(options.logger),
+		listener.HostTcpListenerOption(options.host),
+	)
+	if err != nil {
+		return nil, err
+	}
+	hd := handler.NewSocks5Handler(
+		handler.LoggerSocks5HandlerOption(options.logger),
+		handler.TimeoutSocks5HandlerOption(options.HandshakeTimeout),
+		handler.HandleSocks5HandlerOption(options.handle),
+		handler.AuthSocks5HandlerOption(options.auth),
+	)
+	serv = NewServer(ln, hd,
+		LogServerOption(options.logger),
+		NameServerOption(options.name),
+	)
+	return serv, nil
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/handler"
+	listener "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/listener"
+	log "github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+)
+
+type TransparentProxyServerOptions struct {
+	name   string
+	host   string
+	auth   *auth.Policy
+	logger *log.Logger
+	handle *handler.TunnelHandle
+}
+
+type TransparentProxyServerOption func(*TransparentProxyServerOptions)
+
+func NameTransparentProxyServerOption(name string) TransparentProxyServerOption {
+	return func(options *TransparentProxyServerOptions) {
+		options.name = name
+	}
+}
+func HostTransparentProxyServerOption(host string) TransparentProxyServerOption {
+	return func(options *TransparentProxyServerOptions) {
+		options.host = host
+	}
+}
+func AuthTransparentProxyServerOption(policy *auth.Policy) TransparentProxyServerOption {
+	return func(options *TransparentProxyServerOptions) {
+		options.auth = policy
+	}
+}
+func LogTransparentProxyServerOption(logger *log.Logger) TransparentProxyServerOption {
+	return func(options *TransparentProxyServerOptions) {
+		options.logger = logger
+	}
+}
+func HandleTransparentProxyServerOption(handle handler.TunnelHandle) TransparentProxyServerOption {
+	return func(options *TransparentProxyServerOptions) {
+		options.handle = &handle
+	}
+}
+
+// NewTransparentProxyServer creates a server accepting connections redirected by iptables
+func NewTransparentProxyServer(port int, opts ...TransparentProxyServerOption) (serv *Server, err error) {
+	options := &TransparentProxyServerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	ln, err := listener.NewTcpListener(port,
+		listener.LoggerTcpListenerOption(options.logger),
+		listener.HostTcpListenerOption(options.host),
+	)
+	if err != nil {
+		return nil, err
+	}
+	hd := handler.NewTransparentHandler(
+		handler.LoggerTransparentHandlerOption(options.logger),
+		handler.HandleTransparentHandlerOption(options.handle),
+		handler.AuthTransparentHandlerOption(options.auth),
+	)
+	serv = NewServer(ln, hd,
+		LogServerOption(options.logger),
+		NameServerOption(options.name),
+	)
+	return serv, nil
+}
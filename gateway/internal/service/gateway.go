@@ -6,6 +6,9 @@ import (
 
 	client "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/client"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+	managerv1 "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 type EventType string
@@ -14,6 +17,7 @@ const (
 	EVENT_PROXY_BLOCKED     EventType = "blocked"
 	EVENT_PROXY_PASSED      EventType = "passed"
 	EVENT_PROXY_UNAVAILABLE EventType = "unavailable"
+	EVENT_PROXY_AVAILABLE   EventType = "available"
 )
 
 type Event interface {
@@ -43,16 +47,31 @@ func (e PassedEvent) Event() EventType {
 }
 
 type UnavailableEvent struct {
-	Proxy string `json:"proxy"`
+	Time   time.Time `json:"time"`
+	Id     string    `json:"id"`
+	Proxy  string    `json:"proxy"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
 }
 
 func (e UnavailableEvent) Event() EventType {
 	return EVENT_PROXY_UNAVAILABLE
 }
 
+type AvailableEvent struct {
+	Time  time.Time `json:"time"`
+	Id    string    `json:"id"`
+	Proxy string    `json:"proxy"`
+}
+
+func (e AvailableEvent) Event() EventType {
+	return EVENT_PROXY_AVAILABLE
+}
+
 type GatewayServiceOptions struct {
 	logger *log.Logger
 	ctx    *context.Context
+	conn   *grpc.ClientConn
 }
 
 type GatewayServiceOption func(*GatewayServiceOptions)
@@ -67,8 +86,14 @@ func CtxGatewayServiceOption(ctx *context.Context) GatewayServiceOption {
 		options.ctx = ctx
 	}
 }
+func ConnGatewayServiceOption(conn *grpc.ClientConn) GatewayServiceOption {
+	return func(options *GatewayServiceOptions) {
+		options.conn = conn
+	}
+}
 
 type GatewayService struct {
+	ctx    context.Context
 	events chan Event
 	logger log.Logger
 	client client.GatewayClient
@@ -80,7 +105,11 @@ func NewGatewayService(grpc_addr string, opts ...GatewayServiceOption) (*Gateway
 		opt(options)
 	}
 	events := make(chan Event, 1)
-	client, err := client.NewGatewayClient(grpc_addr, client.CtxGatewayClientOption(options.ctx), client.LogGatewayClientOption(options.logger))
+	client_opts := []client.GatewayClientOption{client.CtxGatewayClientOption(options.ctx), client.LogGatewayClientOption(options.logger)}
+	if options.conn != nil {
+		client_opts = append(client_opts, client.ConnGatewayClientOption(options.conn))
+	}
+	client, err := client.NewGatewayClient(grpc_addr, client_opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +120,11 @@ func NewGatewayService(grpc_addr string, opts ...GatewayServiceOption) (*Gateway
 		logger = log.DefaultLogger
 	}
 	service := &GatewayService{client: *client, events: events, logger: logger}
+	if options.ctx != nil {
+		service.ctx = *options.ctx
+	} else {
+		service.ctx = context.Background()
+	}
 	service.tuneInEvents()
 	return service, nil
 }
@@ -100,9 +134,23 @@ func (s *GatewayService) CreateEvent(e Event) {
 }
 
 func (s *GatewayService) tuneInEvents() {
+	logger := s.logger.WithFields(logrus.Fields{
+		"class":  "GatewayService",
+		"method": "tuneInEvents",
+	})
 	go func() {
 		for event := range s.events {
-			s.logger.Infof("Recv: %s - %+v", event.Event(), event)
+			logger.Infof("Recv: %s - %+v", event.Event(), event)
+			var err error
+			switch e := event.(type) {
+			case UnavailableEvent:
+				err = s.client.ReportProxyEvent(s.ctx, e.Id, managerv1.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE, e.Reason, e.Until)
+			case AvailableEvent:
+				err = s.client.ReportProxyEvent(s.ctx, e.Id, managerv1.ProxyEventType_PROXY_EVENT_TYPE_AVAILABLE, "", time.Time{})
+			}
+			if err != nil {
+				logger.Warnf("failed to report %s event of proxy %+v to manager (err: %+v)", event.Event(), event, err)
+			}
 		}
 	}()
 }
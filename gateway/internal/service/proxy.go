@@ -11,7 +11,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/client"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/filter"
 	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	grpc_status "google.golang.org/grpc/status"
 )
@@ -22,6 +24,16 @@ const (
 	default_prefetch_interval = time.Duration(3) * time.Second
 )
 
+var (
+	DefaultFilter       = filter.Filter{Tags: []string{"ip"}}
+	DefaultBackupFilter = filter.Filter{Tags: []string{"gateway"}}
+	// DefaultOrder prefetches the proxies of the lowest latency first, then the most recently checked
+	DefaultOrder = []*managerv1.PropertyOrder{
+		client.ConstructPropertyOrder(filter.PROPERTY_LATENCY, managerv1.PropertyOrder_ASCENDING),
+		client.ConstructPropertyOrder(filter.PROPERTY_CHECKED_AT, managerv1.PropertyOrder_DESCENDING),
+	}
+)
+
 type prefetchMode int
 
 const (
@@ -36,6 +48,10 @@ type ProxyServiceOptions struct {
 	ctx               *context.Context
 	prefetch_interval *time.Duration
 	size              *int
+	conn              *grpc.ClientConn
+	filter            *managerv1.Filter
+	backup_filter     *managerv1.Filter
+	orders            []*managerv1.PropertyOrder
 }
 
 type ProxyServiceOption func(*ProxyServiceOptions)
@@ -63,12 +79,42 @@ func PrefetchIntervalProxyServiceOption(interval time.Duration) ProxyServiceOpti
 	}
 }
 
+func ConnProxyServiceOption(conn *grpc.ClientConn) ProxyServiceOption {
+	return func(options *ProxyServiceOptions) {
+		options.conn = conn
+	}
+}
+
+// FilterProxyServiceOption sets the filter of proxies to prefetch, DefaultFilter is used if not set
+func FilterProxyServiceOption(filter *managerv1.Filter) ProxyServiceOption {
+	return func(options *ProxyServiceOptions) {
+		options.filter = filter
+	}
+}
+
+// OrderByProxyServiceOption sets the order proxies are prefetched in, DefaultOrder is used if not set
+func OrderByProxyServiceOption(orders ...*managerv1.PropertyOrder) ProxyServiceOption {
+	return func(options *ProxyServiceOptions) {
+		options.orders = append(options.orders, orders...)
+	}
+}
+
+// BackupFilterProxyServiceOption sets the filter of backup proxies to prefetch, DefaultBackupFilter is used if not set
+func BackupFilterProxyServiceOption(filter *managerv1.Filter) ProxyServiceOption {
+	return func(options *ProxyServiceOptions) {
+		options.backup_filter = filter
+	}
+}
+
 type ProxyService struct {
 	ctx                  context.Context
 	client               client.ProxyClient
 	logger               log.Logger
 	pos                  int
 	size                 int
+	filter               *managerv1.Filter
+	backup_filter        *managerv1.Filter
+	orders               []*managerv1.PropertyOrder
 	prefetch_interval    time.Duration
 	prefetch_chan        chan int
 	prefetch_backup_chan chan int
@@ -81,7 +127,11 @@ func NewProxyService(grpc_addr string, opts ...ProxyServiceOption) (*ProxyServic
 	for _, opt := range opts {
 		opt(options)
 	}
-	client, err := client.NewProxyClient(grpc_addr, client.CtxProxyClientOption(options.ctx), client.LogProxyClientOption(options.logger))
+	client_opts := []client.ProxyClientOption{client.CtxProxyClientOption(options.ctx), client.LogProxyClientOption(options.logger)}
+	if options.conn != nil {
+		client_opts = append(client_opts, client.ConnProxyClientOption(options.conn))
+	}
+	client, err := client.NewProxyClient(grpc_addr, client_opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +160,21 @@ func NewProxyService(grpc_addr string, opts ...ProxyServiceOption) (*ProxyServic
 	} else {
 		service.size = default_size
 	}
+	if options.filter != nil {
+		service.filter = options.filter
+	} else if service.filter, err = DefaultFilter.Pb(); err != nil {
+		return nil, err
+	}
+	if options.backup_filter != nil {
+		service.backup_filter = options.backup_filter
+	} else if service.backup_filter, err = DefaultBackupFilter.Pb(); err != nil {
+		return nil, err
+	}
+	if options.orders != nil {
+		service.orders = options.orders
+	} else {
+		service.orders = DefaultOrder
+	}
 	service.initPrefetcher(service.ctx)
 	return service, nil
 }
@@ -240,11 +305,7 @@ func (s *ProxyService) GetBackupStream() <-chan *manager_model.Proxy {
 
 func (s *ProxyService) ListProxies(ctx context.Context, limit int, offset int) ([]manager_model.Proxy, error) {
 	var ret []manager_model.Proxy
-	filter_options := client.FilterListProxiesOption(
-		client.ConstructPropertyFilter("tags", managerv1.PropertyFilter_EQUAL, "ip"),
-		client.ConstructPropertyFilter("proto", managerv1.PropertyFilter_EQUAL, managerv1.Proto_PROTO_HTTP.String()),
-	)
-	proxies, err := s.client.ListProxies(ctx, limit, offset, filter_options)
+	proxies, err := s.client.ListProxies(ctx, limit, offset, client.FilterListProxiesOption(s.filter), client.OrderByListProxiesOption(s.orders...))
 	for _, p := range proxies {
 		ret = append(ret, *manager_util.ProxyFromPb(p))
 	}
@@ -253,11 +314,7 @@ func (s *ProxyService) ListProxies(ctx context.Context, limit int, offset int) (
 
 func (s *ProxyService) ListBackupProxies(ctx context.Context, limit int, offset int) ([]manager_model.Proxy, error) {
 	var ret []manager_model.Proxy
-	filter_options := client.FilterListProxiesOption(
-		client.ConstructPropertyFilter("tags", managerv1.PropertyFilter_EQUAL, "gateway"),
-		client.ConstructPropertyFilter("proto", managerv1.PropertyFilter_EQUAL, managerv1.Proto_PROTO_HTTP.String()),
-	)
-	proxies, err := s.client.ListProxies(ctx, limit, offset, filter_options)
+	proxies, err := s.client.ListProxies(ctx, limit, offset, client.FilterListProxiesOption(s.backup_filter), client.OrderByListProxiesOption(s.orders...))
 	for _, p := range proxies {
 		ret = append(ret, *manager_util.ProxyFromPb(p))
 	}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+// ErrRedactedCredentials is returned for the proxies whose credentials were redacted by manager,
+// which happens to the callers without the scope of credentials
+var ErrRedactedCredentials = errors.New("credentials of proxy are redacted, a manager token granted the scope of credentials is required")
+
+// HttpConnect establishes a tunnel to addr through the CONNECT method of proxy on conn
+func HttpConnect(ctx context.Context, conn net.Conn, addr string, proxy *model.Proxy, timeout time.Duration) error {
+	if proxy.UseConfig != nil && proxy.UseConfig.Redacted {
+		return ErrRedactedCredentials
+	}
+	req := &http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Host: addr},
+		Host:       addr,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+	}
+	req.Header.Set("Proxy-Connection", "keep-alive")
+	if proxy.UseConfig != nil && proxy.UseConfig.User != "" && proxy.UseConfig.Password != "" {
+		u := proxy.UseConfig.User
+		p := proxy.UseConfig.Password
+		req.Header.Set("Proxy-Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+p)))
+	}
+	connect_ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req = req.WithContext(connect_ctx)
+	if deadline, ok := connect_ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// ProxyAddr returns the address proxy is dialed on
+func ProxyAddr(proxy *model.Proxy) string {
+	return net.JoinHostPort(proxy.UseConfig.Host, fmt.Sprint(proxy.UseConfig.Port))
+}
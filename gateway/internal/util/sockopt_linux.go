@@ -0,0 +1,46 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+const so_original_dst = 80
+
+// OriginalDst returns the destination of a connection redirected by iptables (REDIRECT/TPROXY), only ipv4 is supported
+func OriginalDst(conn net.Conn) (string, error) {
+	tcp_conn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return "", errors.New("not a tcp connection")
+	}
+	raw_conn, err := tcp_conn.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+	var (
+		addr     string
+		sock_err error
+	)
+	err = raw_conn.Control(func(fd uintptr) {
+		// sockaddr_in is returned in the buffer of ipv6_mreq
+		mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IP, so_original_dst)
+		if err != nil {
+			sock_err = err
+			return
+		}
+		ip := net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7])
+		port := int(mreq.Multiaddr[2])<<8 | int(mreq.Multiaddr[3])
+		addr = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	})
+	if err != nil {
+		return "", err
+	}
+	if sock_err != nil {
+		return "", sock_err
+	}
+	return addr, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package util
+
+import (
+	"errors"
+	"net"
+)
+
+// OriginalDst returns the destination of a redirected connection, it's only supported on linux
+func OriginalDst(conn net.Conn) (string, error) {
+	return "", errors.New("transparent proxy is only supported on linux")
+}
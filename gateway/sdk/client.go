@@ -0,0 +1,389 @@
+// Package sdk routes connections and http requests of Go programs through the proxy pool of manager in-process,
+// without running a gateway.
+//
+//	client, err := sdk.NewClient(ctx, "manager:8082", sdk.FilterClientOption("country=US"))
+//	http_client := &http.Client{Transport: client.Transport()}
+//	resp, err := http_client.Get("https://example.com")
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/breaker"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/client"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/filter"
+	meta "github.com/WALL-EEEEEEE/proxy-service/gateway/internal/meta"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/route"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/selector"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/service"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/util"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/log"
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+)
+
+const (
+	default_max_retry    = 3
+	default_session_ttl  = time.Duration(10) * time.Minute
+	default_dial_timeout = time.Duration(10) * time.Second
+)
+
+var (
+	ErrNoProxy = route.ErrNoRoute
+	ErrNoToken = errors.New("token of manager is required, proxies can't be routed through with credentials redacted")
+)
+
+// ProxyError is returned when the proxies routed through all failed, it carries the failure of the last one
+type ProxyError struct {
+	Proxy string // ip of the proxy
+	Addr  string // destination routed to
+	Err   error
+}
+
+func (err *ProxyError) Error() string {
+	return fmt.Sprintf("failed to route to %s through proxy %s (err: %v)", err.Addr, err.Proxy, err.Err)
+}
+
+func (err *ProxyError) Unwrap() error {
+	return err.Err
+}
+
+// proxyError converts the route errors returned by the router into ProxyError
+func proxyError(err error) error {
+	var route_err route.RouteError
+	if errors.As(err, &route_err) {
+		return &ProxyError{Proxy: route_err.From(), Addr: route_err.To(), Err: route_err.Unwrap()}
+	}
+	return err
+}
+
+type ClientOptions struct {
+	logger       *log.Logger
+	where        []string
+	backup_where []string
+	selector     *string
+	max_retry    *int
+	session_ttl  *time.Duration
+	dial_timeout *time.Duration
+	direct       *bool
+	backup       *bool
+	retry_status []int
+	token        string
+}
+
+type ClientOption func(*ClientOptions)
+
+func LogClientOption(logger *log.Logger) ClientOption {
+	return func(options *ClientOptions) {
+		options.logger = logger
+	}
+}
+
+// FilterClientOption sets the conditions of proxies routed, e.g. `country=US,JP` or `latency<=300`
+func FilterClientOption(conds ...string) ClientOption {
+	return func(options *ClientOptions) {
+		options.where = append(options.where, conds...)
+	}
+}
+
+// BackupFilterClientOption sets the conditions of backup proxies
+func BackupFilterClientOption(conds ...string) ClientOption {
+	return func(options *ClientOptions) {
+		options.backup_where = append(options.backup_where, conds...)
+	}
+}
+
+// SelectorClientOption sets how proxies are selected: round_robin, random, fifo or hash
+func SelectorClientOption(name string) ClientOption {
+	return func(options *ClientOptions) {
+		options.selector = &name
+	}
+}
+
+// MaxRetryClientOption sets the proxies tried for a connection or request, defaults to 3
+func MaxRetryClientOption(retry int) ClientOption {
+	return func(options *ClientOptions) {
+		options.max_retry = &retry
+	}
+}
+
+// SessionTTLClientOption sets how long a sticky session keeps its proxy since last used, defaults to 10 minutes
+func SessionTTLClientOption(ttl time.Duration) ClientOption {
+	return func(options *ClientOptions) {
+		options.session_ttl = &ttl
+	}
+}
+
+func DialTimeoutClientOption(timeout time.Duration) ClientOption {
+	return func(options *ClientOptions) {
+		options.dial_timeout = &timeout
+	}
+}
+
+// DirectClientOption sets whether to connect directly once no proxy could be routed, it's disabled by default
+func DirectClientOption(direct bool) ClientOption {
+	return func(options *ClientOptions) {
+		options.direct = &direct
+	}
+}
+
+// BackupClientOption sets whether to fallback to backup proxies, it's enabled by default
+func BackupClientOption(backup bool) ClientOption {
+	return func(options *ClientOptions) {
+		options.backup = &backup
+	}
+}
+
+// RetryStatusClientOption sets the status codes of responses taken as failures of proxies, e.g. 407 or 429,
+// such requests are retried through another proxy if their bodies could be replayed
+func RetryStatusClientOption(codes ...int) ClientOption {
+	return func(options *ClientOptions) {
+		options.retry_status = append(options.retry_status, codes...)
+	}
+}
+
+// TokenClientOption sets the token granted the scope of credentials by manager, it's required as the passwords of proxies
+// are redacted without it
+func TokenClientOption(token string) ClientOption {
+	return func(options *ClientOptions) {
+		options.token = token
+	}
+}
+
+type session struct {
+	proxy     model.Proxy
+	expire_at time.Time
+}
+
+// Client routes connections through the route tables of proxies prefetched from manager,
+// failing proxies are quarantined by a circuit breaker and outcomes are reported to manager as the gateway does
+type Client struct {
+	logger       log.Logger
+	conn         *grpc.ClientConn
+	brouter      *route.ProxyBrouter
+	selector     route.RouteSelector
+	max_retry    int
+	session_ttl  time.Duration
+	dial_timeout time.Duration
+	direct       bool
+	backup       bool
+	retry_status map[int]bool
+	mu           sync.Mutex
+	sessions     map[string]session
+	now          func() time.Time
+}
+
+var _ proxy.ContextDialer = (*Client)(nil)
+var _ proxy.Dialer = (*Client)(nil)
+
+func NewClient(ctx context.Context, addr string, opts ...ClientOption) (*Client, error) {
+	options := &ClientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.token == "" {
+		return nil, ErrNoToken
+	}
+	c := &Client{
+		max_retry:    default_max_retry,
+		session_ttl:  default_session_ttl,
+		dial_timeout: default_dial_timeout,
+		backup:       true,
+		retry_status: make(map[int]bool),
+		sessions:     make(map[string]session),
+		now:          time.Now,
+	}
+	if options.logger != nil {
+		c.logger = *options.logger
+	} else {
+		c.logger = log.DefaultLogger
+	}
+	if options.max_retry != nil && *options.max_retry > 0 {
+		c.max_retry = *options.max_retry
+	}
+	if options.session_ttl != nil && *options.session_ttl > 0 {
+		c.session_ttl = *options.session_ttl
+	}
+	if options.dial_timeout != nil && *options.dial_timeout > 0 {
+		c.dial_timeout = *options.dial_timeout
+	}
+	if options.direct != nil {
+		c.direct = *options.direct
+	}
+	if options.backup != nil {
+		c.backup = *options.backup
+	}
+	for _, code := range options.retry_status {
+		c.retry_status[code] = true
+	}
+	if options.selector != nil {
+		s, err := selector.NewSelector[route.Route[model.Proxy]](*options.selector)
+		if err != nil {
+			return nil, err
+		}
+		c.selector = s
+	}
+	proxy_filter, err := service.DefaultFilter.Override(filter.Filter{Where: options.where}).Pb()
+	if err != nil {
+		return nil, err
+	}
+	backup_filter, err := service.DefaultBackupFilter.Override(filter.Filter{Where: options.backup_where}).Pb()
+	if err != nil {
+		return nil, err
+	}
+	c.conn, err = client.NewManagerConn(ctx, addr, client.TokenDialOption(options.token))
+	if err != nil {
+		return nil, err
+	}
+	c.brouter, err = route.NewProxyBrouter(ctx, addr,
+		route.LogProxyBrouterOption(&c.logger),
+		route.ConnProxyBrouterOption(c.conn),
+		route.BreakerProxyBrouterOption(breaker.NewBreaker()),
+		route.FilterProxyBrouterOption(proxy_filter),
+		route.BackupFilterProxyBrouterOption(backup_filter),
+	)
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to manager
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx whose connections and requests stick to the same proxy while it works
+func WithSession(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, key)
+}
+
+func sessionFrom(ctx context.Context) string {
+	key, _ := ctx.Value(sessionKey{}).(string)
+	return key
+}
+
+func (c *Client) session(key string) (*model.Proxy, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sessions[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(s.expire_at) {
+		delete(c.sessions, key)
+		return nil, false
+	}
+	p := s.proxy
+	return &p, true
+}
+
+func (c *Client) stick(key string, p *model.Proxy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, s := range c.sessions {
+		if !now.Before(s.expire_at) {
+			delete(c.sessions, k)
+		}
+	}
+	c.sessions[key] = session{proxy: *p, expire_at: now.Add(c.session_ttl)}
+}
+
+func (c *Client) unstick(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, key)
+}
+
+// route routes cb to addr through the proxy of the session of ctx first, then through the route tables
+func (c *Client) route(ctx context.Context, addr string, cb route.RouteCallback) error {
+	metadata := meta.Metadata{"addr": addr}
+	opts := []route.RouteOption{
+		route.MetadataRouteOption(metadata),
+		route.MaxRetryRouteOption(c.max_retry),
+		route.DirectRouteOption(c.direct),
+	}
+	if c.selector != nil {
+		opts = append(opts, route.SelectorRouteOption(c.selector))
+	}
+	if key := sessionFrom(ctx); key != "" {
+		if p, ok := c.session(key); ok {
+			err := c.brouter.RouteTo(ctx, p, cb, opts...)
+			if err == nil {
+				c.stick(key, p)
+				return nil
+			}
+			if !errors.As(err, &route.RouteError{}) && !errors.Is(err, route.ErrNoRoute) {
+				return err
+			}
+			c.unstick(key)
+		}
+		session_cb := cb
+		cb = func(p *model.Proxy) error {
+			err := session_cb(p)
+			if err == nil && p != nil {
+				c.stick(key, p)
+			}
+			return err
+		}
+	}
+	if c.backup {
+		opts = append(opts, route.FallbackRouteOption(cb))
+	}
+	return c.brouter.Route(ctx, cb, opts...)
+}
+
+// DialContext connects to addr through a proxy by CONNECT, only tcp is supported
+func (c *Client) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("unsupported network " + network)
+	}
+	var conn net.Conn
+	err := c.route(ctx, addr, func(p *model.Proxy) error {
+		cn, err := c.dial(ctx, network, addr, p)
+		if err != nil {
+			if p != nil {
+				return route.NewRouteError(p.Ip, addr, err)
+			}
+			return err
+		}
+		conn = cn
+		return nil
+	})
+	if err != nil {
+		return nil, proxyError(err)
+	}
+	return conn, nil
+}
+
+func (c *Client) Dial(network string, addr string) (net.Conn, error) {
+	return c.DialContext(context.Background(), network, addr)
+}
+
+func (c *Client) dial(ctx context.Context, network string, addr string, p *model.Proxy) (net.Conn, error) {
+	d := net.Dialer{Timeout: c.dial_timeout}
+	if p == nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	conn, err := d.DialContext(ctx, "tcp", util.ProxyAddr(p))
+	if err != nil {
+		return nil, err
+	}
+	if err := util.HttpConnect(ctx, conn, addr, p, c.dial_timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/route"
+	"github.com/WALL-EEEEEEE/proxy-service/gateway/internal/util"
+	model "github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+var ErrBodyNotReplayable = errors.New("request body could not be replayed, set GetBody to retry it")
+
+type proxyKey struct{}
+
+// Transport is an http.RoundTripper sending each request through a proxy routed by client,
+// connections to the same proxy are reused by the underlying http.Transport
+type Transport struct {
+	client *Client
+	base   *http.Transport
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport returns a RoundTripper routing requests through the proxies of client
+func (c *Client) Transport() *Transport {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = func(req *http.Request) (*url.URL, error) {
+		p, _ := req.Context().Value(proxyKey{}).(*model.Proxy)
+		if p == nil {
+			return nil, nil
+		}
+		return proxyURL(p)
+	}
+	return &Transport{client: c, base: base}
+}
+
+func proxyURL(p *model.Proxy) (*url.URL, error) {
+	if p.UseConfig != nil && p.UseConfig.Redacted {
+		return nil, util.ErrRedactedCredentials
+	}
+	u := &url.URL{Scheme: "http", Host: util.ProxyAddr(p)}
+	if p.UseConfig != nil && p.UseConfig.User != "" && p.UseConfig.Password != "" {
+		u.User = url.UserPassword(p.UseConfig.User, p.UseConfig.Password)
+	}
+	return u, nil
+}
+
+func targetAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+}
+
+// RoundTrip sends req through the proxies routed, the responses of the status codes retried are taken as failures
+// of proxies, the last of them is returned if no more proxy could be tried
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := targetAddr(req.URL)
+	var (
+		resp     *http.Response
+		retried  *http.Response // the last response of the status codes retried
+		attempts int
+	)
+	err := t.client.route(req.Context(), addr, func(p *model.Proxy) error {
+		r := req.WithContext(context.WithValue(req.Context(), proxyKey{}, p))
+		if attempts > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return ErrBodyNotReplayable
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			r.Body = body
+		}
+		attempts++
+		res, err := t.base.RoundTrip(r)
+		if err != nil {
+			if p != nil {
+				return route.NewRouteError(p.Ip, addr, err)
+			}
+			return err
+		}
+		if p != nil && t.client.retry_status[res.StatusCode] {
+			if retried != nil {
+				retried.Body.Close()
+			}
+			retried = res
+			return route.NewRouteError(p.Ip, addr, fmt.Errorf("responded %s", res.Status))
+		}
+		resp = res
+		return nil
+	})
+	if err != nil {
+		if retried != nil {
+			return retried, nil
+		}
+		return nil, proxyError(err)
+	}
+	if retried != nil {
+		retried.Body.Close()
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections to proxies
+func (t *Transport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
@@ -3,12 +3,12 @@ package manager
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	net_url "net/url"
-	"strings"
 	"sync"
 	"time"
 
@@ -48,6 +48,11 @@ var http_api = "https://lumtest.com/myip.json"
 var websocket_api = "wss://ws.postman-echo.com/raw/"
 var socket_api = "tcpbin.com:4242"
 var statsCache = cache.New(cache.NoExpiration, cache.NoExpiration)
+
+// the ip the checker exits from is looked up again after own_ip_ttl, in case it changes
+const own_ip_ttl = 10 * time.Minute
+
+var ownIpCache = cache.New(own_ip_ttl, own_ip_ttl)
 var mutStatsUpdate sync.Mutex
 
 type Stats struct {
@@ -57,6 +62,20 @@ type Stats struct {
 	HttpSupport      bool
 	WebSocketSupport bool
 	SocketSupport    bool
+	ExitIp           string //ip the proxy is seen from by http_api
+	Error            string //errors of the metrics failed, joined by `; `
+}
+
+// withError appends err of a metric to the errors of stats
+func withError(stats Stats, err error) Stats {
+	if err == nil {
+		return stats
+	}
+	if stats.Error != "" {
+		stats.Error += "; "
+	}
+	stats.Error += err.Error()
+	return stats
 }
 
 type UpdateStatsOption func(stats Stats) Stats
@@ -135,16 +154,19 @@ func NewAssess(param ...Params) Assess {
 	}
 }
 
+// http_test gets url via proxy, or directly if proxy is empty
 func http_test(url string, proxy string, timeout int) (int, string, error) {
-	_proxy, err := net_url.Parse(proxy)
-	if err != nil {
-		return 0, "", err
-	}
-	log.Debugf("Http Get %s via proxy %+v", url, _proxy)
 	tr := &http.Transport{
-		Proxy:           http.ProxyURL(_proxy),
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
+	if proxy != "" {
+		_proxy, err := net_url.Parse(proxy)
+		if err != nil {
+			return 0, "", err
+		}
+		tr.Proxy = http.ProxyURL(_proxy)
+	}
+	log.Debugf("Http Get %s via proxy %+v", url, proxy)
 	client := &http.Client{
 		Transport: tr,
 		Timeout:   time.Second * time.Duration(timeout), //超时时间
@@ -161,6 +183,35 @@ func http_test(url string, proxy string, timeout int) (int, string, error) {
 	return resp.StatusCode, string(body), nil
 }
 
+// parse_my_ip returns the ip reported by a response of http_api, empty if none is reported
+func parse_my_ip(code int, resp string) string {
+	var my_ip struct {
+		Ip string `json:"ip"`
+	}
+	if code != 200 || json.Unmarshal([]byte(resp), &my_ip) != nil {
+		return ""
+	}
+	return my_ip.Ip
+}
+
+// own_ip returns the ip the checker itself exits from, which is reported by the proxies forwarding nothing,
+// e.g. transparent ones failing open
+var own_ip = func(timeout int) (string, error) {
+	if ip, ok := ownIpCache.Get(http_api); ok {
+		return ip.(string), nil
+	}
+	code, resp, err := http_test(http_api, "", timeout)
+	if err != nil {
+		return "", err
+	}
+	ip := parse_my_ip(code, resp)
+	if ip == "" {
+		return "", fmt.Errorf("no ip reported by %s (code: %d)", http_api, code)
+	}
+	ownIpCache.Set(http_api, ip, cache.DefaultExpiration)
+	return ip, nil
+}
+
 func websocket_test(url string, proxy string, timeout int) error {
 	websocket.DefaultDialer.Proxy = func(req *http.Request) (*net_url.URL, error) {
 		return net_url.Parse(proxy)
@@ -201,24 +252,29 @@ func (assess *Assess) Ping(proxy *Proxy) {
 	logger.Info("start")
 	go func() {
 		var ping_durations []int64
+		var ping_err error
 		defer assess.wg.Done()
 		defer func(begin time.Time) {
 			updateStats(proxy, func(stats Stats) Stats {
 				stats.Latency = func([]int64) int64 {
+					//no reply is no latency
+					if len(ping_durations) < 1 {
+						return 0
+					}
 					var ttl int64
 					for _, duration := range ping_durations {
 						ttl += duration
 					}
 					return ttl / int64(len(ping_durations))
 				}(ping_durations)
-				return stats
+				return withError(stats, ping_err)
 			})
 			logger.WithField("cost", fmt.Sprintf(" %fs", time.Since(begin).Seconds())).Infof("%v", ping_durations)
 		}(time.Now())
 		ping_ip := proxy.UseConfig.Host
-		ping_durations, err := ping_timeout(ping_ip, assess.param.PingMaxRTT, assess.param.PingTimes)
-		if err != nil {
-			logger.Error(err)
+		ping_durations, ping_err = ping_timeout(ping_ip, assess.param.PingMaxRTT, assess.param.PingTimes)
+		if ping_err != nil {
+			logger.Error(ping_err)
 		}
 	}()
 }
@@ -238,10 +294,11 @@ func (assess *Assess) Dial(proxy *Proxy) {
 	go func() {
 		defer assess.wg.Done()
 		var dailable bool
+		var dail_err error
 		defer func(begin time.Time) {
 			updateStats(proxy, func(stats Stats) Stats {
 				stats.Dialable = dailable
-				return stats
+				return withError(stats, dail_err)
 			})
 			logger.WithField("cost", fmt.Sprintf(" %fs", time.Since(begin).Seconds())).Infof("%v", dailable)
 		}(time.Now())
@@ -253,6 +310,7 @@ func (assess *Assess) Dial(proxy *Proxy) {
 		if err != nil {
 			log.Error(err)
 			dailable = false
+			dail_err = err
 			return
 		}
 		dailable = true
@@ -272,11 +330,14 @@ func (assess *Assess) Http(proxy *Proxy) {
 	logger.Info("start")
 	go func() {
 		var http_support bool
+		var exit_ip string
+		var http_err error
 		defer assess.wg.Done()
 		defer func(begin time.Time) {
 			updateStats(proxy, func(stats Stats) Stats {
 				stats.HttpSupport = http_support
-				return stats
+				stats.ExitIp = exit_ip
+				return withError(stats, http_err)
 			})
 			logger.WithField("cost", fmt.Sprintf(" %fs", time.Since(begin).Seconds())).Infof("%v", http_support)
 		}(time.Now())
@@ -285,14 +346,27 @@ func (assess *Assess) Http(proxy *Proxy) {
 		if err != nil {
 			log.Error(err)
 			http_support = false
+			http_err = err
 			return
 		}
-		if code == 200 && strings.Contains(resp, proxy.Ip) {
-			http_support = true
-		} else {
+		//gateway proxies and the proxies of rotating providers exit from other ips than theirs,
+		//so a proxy supports http as long as the ip it exits from is reported and is not the checker's own
+		log.Debugf(resp)
+		my_ip := parse_my_ip(code, resp)
+		if my_ip == "" {
 			http_support = false
+			return
 		}
-		log.Debugf(resp)
+		own, err := own_ip(assess.param.HttpTimeOut)
+		if err != nil {
+			logger.Warnf("failed to look up the ip of checker, the exit ip is taken as it is (error: %s)", err.Error())
+		} else if own == my_ip {
+			http_support = false
+			http_err = fmt.Errorf("proxy exits from the ip of checker %s", own)
+			return
+		}
+		http_support = true
+		exit_ip = my_ip
 	}()
 }
 func (assess *Assess) Socket(proxy *Proxy) {
@@ -306,11 +380,12 @@ func (assess *Assess) Socket(proxy *Proxy) {
 	logger.Info("start")
 	go func() {
 		var socket_support bool
+		var socket_err error
 		defer assess.wg.Done()
 		defer func(begin time.Time) {
 			updateStats(proxy, func(stats Stats) Stats {
 				stats.SocketSupport = socket_support
-				return stats
+				return withError(stats, socket_err)
 			})
 			logger.WithField("cost", fmt.Sprintf(" %ds", time.Since(begin))).Infof("%v", socket_support)
 		}(time.Now())
@@ -319,6 +394,7 @@ func (assess *Assess) Socket(proxy *Proxy) {
 		if err != nil {
 			log.Error(err)
 			socket_support = false
+			socket_err = err
 			return
 		}
 		socket_support = true
@@ -336,11 +412,12 @@ func (assess *Assess) WebSocket(proxy *Proxy) {
 	logger.Info("start")
 	go func() {
 		var websocket_support bool
+		var websocket_err error
 		defer assess.wg.Done()
 		defer func(begin time.Time) {
 			updateStats(proxy, func(stats Stats) Stats {
 				stats.WebSocketSupport = websocket_support
-				return stats
+				return withError(stats, websocket_err)
 			})
 			logger.WithField("cost", fmt.Sprintf(" %fs", time.Since(begin).Seconds())).Infof("%v", websocket_support)
 		}(time.Now())
@@ -349,6 +426,7 @@ func (assess *Assess) WebSocket(proxy *Proxy) {
 		if err != nil {
 			log.Error(err)
 			websocket_support = false
+			websocket_err = err
 			return
 		}
 		websocket_support = true
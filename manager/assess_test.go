@@ -137,6 +137,7 @@ func TestAssess(t *testing.T) {
 				for _, proxy := range proxies {
 					stats := newStats(&proxy)
 					stats.Dialable = false
+					stats.Error = "i/o timeout"
 					stats_list = append(stats_list, stats)
 				}
 				return stats_list
@@ -178,6 +179,7 @@ func TestAssess(t *testing.T) {
 				for _, proxy := range proxies {
 					stats := newStats(&proxy)
 					stats.Dialable = false
+					stats.Error = "address xxxxx: invalid address"
 					stats_list = append(stats_list, stats)
 				}
 				return stats_list
@@ -220,6 +222,7 @@ func TestAssess(t *testing.T) {
 				for _, proxy := range proxies {
 					stats := newStats(&proxy)
 					stats.HttpSupport = true
+					stats.ExitIp = "58.20.82.115"
 					stats_list = append(stats_list, stats)
 				}
 				return stats_list
@@ -307,6 +310,7 @@ func TestAssess(t *testing.T) {
 				for _, proxy := range proxies {
 					stats := newStats(&proxy)
 					stats.HttpSupport = true
+					stats.ExitIp = "58.20.82.115"
 					stats.Dialable = true
 					stats.WebSocketSupport = true
 					stats.SocketSupport = true
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type Scope = string
+
+const (
+	// SCOPE_CREDENTIALS reveals the credentials of proxies and apis, which are redacted for the other callers
+	SCOPE_CREDENTIALS Scope = "credentials"
+)
+
+const bearer_prefix = "bearer "
+
+// tokens shorter than min_token_size are refused, as they could be guessed
+const min_token_size = 16
+
+// placeholders are the tokens of examples, which must be replaced before serving
+var placeholders = map[string]bool{"change-me": true, "changeme": true, "token": true, "secret": true, "xxxx": true}
+
+var InvalidTokenError = errors.New("invalid token")
+
+type scopesKey struct{}
+
+// NewContext returns a copy of ctx granted scopes
+func NewContext(ctx context.Context, scopes ...Scope) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// HasScope tells whether the caller of ctx is granted scope
+func HasScope(ctx context.Context, scope Scope) bool {
+	scopes, _ := ctx.Value(scopesKey{}).([]Scope)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTokens refuses the tokens which are empty, placeholders or shorter than min_token_size, since they grant
+// scopes to whoever guesses them
+func ValidateTokens(tokens map[string]string) error {
+	for token, scopes := range tokens {
+		token = strings.TrimSpace(token)
+		switch {
+		case token == "":
+			return fmt.Errorf("%w: an empty token is granted %q", InvalidTokenError, scopes)
+		case placeholders[strings.ToLower(token)]:
+			return fmt.Errorf("%w: the placeholder token %q is granted %q, replace it", InvalidTokenError, token, scopes)
+		case len(token) < min_token_size:
+			return fmt.Errorf("%w: a token granted %q is shorter than %d characters", InvalidTokenError, scopes, min_token_size)
+		}
+	}
+	return nil
+}
+
+// UnaryServerInterceptor grants callers the scopes of the token they bear as `authorization: Bearer <token>`,
+// tokens maps tokens to their scopes separated by spaces. Callers bearing no token known are granted no scope
+func UnaryServerInterceptor(tokens map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if scopes := scopesOf(ctx, tokens); len(scopes) > 0 {
+			ctx = NewContext(ctx, scopes...)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func scopesOf(ctx context.Context, tokens map[string]string) []Scope {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, value := range md.Get("authorization") {
+		if len(value) <= len(bearer_prefix) || !strings.EqualFold(value[:len(bearer_prefix)], bearer_prefix) {
+			continue
+		}
+		bearer := []byte(strings.TrimSpace(value[len(bearer_prefix):]))
+		for token, scopes := range tokens {
+			//the tokens refused by ValidateTokens never grant scopes, even if they're served
+			if ValidateTokens(map[string]string{token: scopes}) != nil {
+				continue
+			}
+			if subtle.ConstantTimeCompare(bearer, []byte(token)) == 1 {
+				return strings.Fields(scopes)
+			}
+		}
+	}
+	return nil
+}
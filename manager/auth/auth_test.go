@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidateTokens(t *testing.T) {
+	token := strings.Repeat("t", min_token_size)
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Tokens.Valid",
+			Input:    map[string]string{token: SCOPE_CREDENTIALS},
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Nil(t, ValidateTokens(tc.Input.(map[string]string)))
+			},
+		},
+		{
+			Name:     "Tokens.None",
+			Input:    map[string]string{},
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Nil(t, ValidateTokens(tc.Input.(map[string]string)))
+			},
+		},
+		{
+			Name:     "Tokens.Empty",
+			Input:    map[string]string{" ": SCOPE_CREDENTIALS},
+			Error:    InvalidTokenError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, ValidateTokens(tc.Input.(map[string]string)), tc.Error)
+			},
+		},
+		{
+			Name:     "Tokens.Placeholder",
+			Input:    map[string]string{"change-me": SCOPE_CREDENTIALS},
+			Error:    InvalidTokenError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, ValidateTokens(tc.Input.(map[string]string)), tc.Error)
+			},
+		},
+		{
+			Name:     "Tokens.Short",
+			Input:    map[string]string{"short": SCOPE_CREDENTIALS},
+			Error:    InvalidTokenError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, ValidateTokens(tc.Input.(map[string]string)), tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestScopesOf(t *testing.T) {
+	token := strings.Repeat("t", min_token_size)
+	tokens := map[string]string{token: SCOPE_CREDENTIALS, "change-me": SCOPE_CREDENTIALS}
+	bearing := func(value string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", value))
+	}
+	assert.Equal(t, []Scope{SCOPE_CREDENTIALS}, scopesOf(bearing("Bearer "+token), tokens))
+	assert.Nil(t, scopesOf(bearing("Bearer change-me"), tokens))
+	assert.Nil(t, scopesOf(bearing("Bearer other"), tokens))
+	assert.Nil(t, scopesOf(context.Background(), tokens))
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Shadows are copies of the proxies which expire, kept out of the prefix of the index and a while longer
+// than the proxies, so that an expired proxy is still known when redis notifies its key expired
+const shadow_prefix = "shadow"
+const shadow_grace = time.Duration(10) * time.Minute
+const shadow_scan_count = 500
+
+// disabled_key is the sorted set of the ids of proxies made unavailable, scored by the unix milliseconds
+// they're made available again at, which is swept every disabled_sweep_interval
+const disabled_key = "disabled"
+const disabled_sweep_interval = time.Second
+
+// expire_retries is how many times the expiry of a proxy is retried if its shadow changes in between
+const expire_retries = 3
+
+func shadowKey(proxy_key string) string {
+	return shadow_prefix + sep + proxy_key
+}
+
+// pipeShadow queues the shadow of the proxy stored at proxy_key, proxies never expiring have no shadow
+func pipeShadow(ctx context.Context, pipe redis.Pipeliner, proxy_key string, p *Proxy) {
+	if p.Ttl == -1 {
+		pipe.Del(ctx, shadowKey(proxy_key))
+		return
+	}
+	pipe.Set(ctx, shadowKey(proxy_key), p, time.Duration(p.Ttl)*time.Second+shadow_grace)
+}
+
+// refreshShadow copies the proxy stored at proxy_key to its shadow if it has one
+func (s ProxyStore) refreshShadow(ctx context.Context, proxy_key string) error {
+	result, err := s.client.JSONGet(ctx, proxy_key, "$").Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var proxies []Proxy
+	if err := json.Unmarshal([]byte(result), &proxies); err != nil || len(proxies) < 1 {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	err = s.client.SetArgs(ctx, shadowKey(proxy_key), &proxies[0], redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// WatchExpiry publishes proxy_expired and proxy_deleted events with the shadows of the proxies expired until ctx is done,
+// the proxies expired while no one watched are published at the start. Several managers may watch at once,
+// the one taking a shadow away publishes its events. The proxies whose unavailability is over are made available
+// again along the way
+func (s ProxyStore) WatchExpiry(ctx context.Context) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "WatchExpiry",
+	})
+	if err := s.enableExpiryNotification(ctx); err != nil {
+		//notifications may be enabled by the operator where CONFIG is disabled
+		logger.WithField("error", err).Warn("failed to enable expiry notifications")
+	}
+	channel := fmt.Sprintf("__keyevent@%d__:expired", s.client.Options().DB)
+	sub := s.client.Subscribe(ctx, channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		logger.WithField("error", err).Error("failed to subscribe to expiry notifications")
+		return errors.WithStack(err)
+	}
+	logger.Infof("subscribe to %s", channel)
+	if err := s.sweepShadows(ctx); err != nil {
+		logger.WithField("error", err).Error("failed to sweep shadows")
+	}
+	msgs := sub.Channel()
+	ticker := time.NewTicker(disabled_sweep_interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("exit")
+			return nil
+		case <-ticker.C:
+			if err := s.sweepDisabled(ctx); err != nil {
+				logger.WithField("error", err).Error("failed to sweep proxies disabled")
+			}
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if !strings.HasPrefix(msg.Payload, proxy_prefix+sep) {
+				continue
+			}
+			if err := s.expire(ctx, msg.Payload); err != nil {
+				logger.WithField("error", err).Error(fmt.Sprintf("failed to publish expiry of %s", msg.Payload))
+			}
+		}
+	}
+}
+
+// enableExpiryNotification adds keyevent notifications of expired keys to notify-keyspace-events
+func (s ProxyStore) enableExpiryNotification(ctx context.Context) error {
+	config, err := s.client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	current := config["notify-keyspace-events"]
+	flags := current
+	if !strings.Contains(flags, "E") {
+		flags += "E"
+	}
+	//A is the alias of all the classes of events, expired ones included
+	if !strings.Contains(flags, "x") && !strings.Contains(flags, "A") {
+		flags += "x"
+	}
+	if flags == current {
+		return nil
+	}
+	return errors.WithStack(s.client.ConfigSet(ctx, "notify-keyspace-events", flags).Err())
+}
+
+// sweepShadows publishes the expiry of the proxies whose shadows are left without them
+func (s ProxyStore) sweepShadows(ctx context.Context) error {
+	iter := s.client.Scan(ctx, 0, shadowKey(proxy_prefix+sep+"*"), shadow_scan_count).Iterator()
+	for iter.Next(ctx) {
+		proxy_key := strings.TrimPrefix(iter.Val(), shadow_prefix+sep)
+		exists, err := s.client.Exists(ctx, proxy_key).Result()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if exists > 0 {
+			continue
+		}
+		if err := s.expire(ctx, proxy_key); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(iter.Err())
+}
+
+// undisable_script takes the proxy out of the proxies disabled if it's due, so that a proxy disabled again
+// in between is left, and only one of the managers sweeping at once enables it
+//
+//	KEYS[1]: disabled key
+//	ARGV[1]: proxy id
+//	ARGV[2]: now in unix milliseconds
+var undisable_script = redis.NewScript(`
+local until = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not until or tonumber(until) > tonumber(ARGV[2]) then
+  return 0
+end
+return redis.call('ZREM', KEYS[1], ARGV[1])
+`)
+
+// sweepDisabled makes the proxies whose unavailability is over available again
+func (s ProxyStore) sweepDisabled(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	ids, err := s.client.ZRangeByScore(ctx, disabled_key, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, id := range ids {
+		taken, err := undisable_script.Run(ctx, s.client, []string{disabled_key}, id, now).Int()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if taken < 1 {
+			continue
+		}
+		if err := s.SetAvailable(ctx, id, true, time.Time{}); err != nil && !errors.Is(err, ProxyNotFoundError) {
+			return err
+		}
+	}
+	return nil
+}
+
+// expire takes the shadow of the proxy expired at proxy_key away and publishes its expiry in one transaction,
+// so the shadow is kept to be swept again if the events fail to be published. The shadow is watched,
+// nothing is published if it's taken by another manager in between or the proxy never expires
+func (s ProxyStore) expire(ctx context.Context, proxy_key string) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "expire",
+		"key":    proxy_key,
+	})
+	shadow_key := shadowKey(proxy_key)
+	var p Proxy
+	take := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, shadow_key).Result()
+		if err != nil {
+			return err
+		}
+		if err := p.UnmarshalBinary([]byte(data)); err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, shadow_key, historyKey(p.Id))
+			for _, stream := range []event.Event{event.EVENT_PROXY_EXPIRED, event.EVENT_PROXY_DELETED} {
+				//an event failed to be encoded fails the transaction before it's sent
+				if err := s.publisher.PublishProxy(ctx, pipe, stream, model.Proxy(p)).Err(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	}
+	var err error
+	for i := 0; i < expire_retries; i++ {
+		err = s.client.Watch(ctx, take, shadow_key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	logger.WithFields(log.Fields{
+		"event": event.EVENT_PROXY_EXPIRED,
+		"value": p.Id,
+	}).Info("event sent")
+	return nil
+}
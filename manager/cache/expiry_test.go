@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyStoreExpire(t *testing.T) {
+	store, client, ids := newTestRedisProxyStore(t,
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.1", Port: 80, Ttl: 60, Proto: []model.PROTO{model.PROTO_HTTP}},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := store.Watch(ctx, event.EVENT_PROXY_EXPIRED, event.EVENT_PROXY_DELETED)
+	assert.Nil(t, err)
+	proxy_key := proxyKey(ids[0])
+	//the proxy expires, its shadow is left
+	assert.Nil(t, client.Del(ctx, proxy_key).Err())
+	assert.Equal(t, int64(1), client.Exists(ctx, shadowKey(proxy_key)).Val())
+	assert.Nil(t, store.expire(ctx, proxy_key))
+	for _, expected := range []event.Event{event.EVENT_PROXY_EXPIRED, event.EVENT_PROXY_DELETED} {
+		e := <-events
+		assert.Equal(t, expected, e.Type)
+		assert.Equal(t, ids[0], e.Proxy.Id)
+	}
+	assert.Equal(t, int64(0), client.Exists(ctx, shadowKey(proxy_key), historyKey(ids[0])).Val())
+	//the shadow is taken, the expiry is published once
+	assert.Nil(t, store.expire(ctx, proxy_key))
+}
+
+func TestProxyStoreExpireKeepsShadow(t *testing.T) {
+	store, client, ids := newTestRedisProxyStore(t,
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.2", Port: 80, Ttl: 60, Proto: []model.PROTO{model.PROTO_HTTP}},
+	)
+	ctx := context.Background()
+	proxy_key := proxyKey(ids[0])
+	assert.Nil(t, client.Del(ctx, proxy_key).Err())
+	//a shadow whose expiry fails to be published is kept to be swept again
+	assert.Nil(t, client.Set(ctx, shadowKey(proxy_key), "{", 0).Err())
+	assert.NotNil(t, store.expire(ctx, proxy_key))
+	assert.Equal(t, int64(1), client.Exists(ctx, shadowKey(proxy_key)).Val())
+	assert.Nil(t, client.Del(ctx, shadowKey(proxy_key)).Err())
+}
+
+func TestProxyStoreSweepDisabled(t *testing.T) {
+	store, client, ids := newTestRedisProxyStore(t,
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.3", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}},
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.4", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}},
+	)
+	ctx := context.Background()
+	assert.Nil(t, store.SetAvailable(ctx, ids[0], false, time.Now().Add(-time.Second)))
+	assert.Nil(t, store.SetAvailable(ctx, ids[1], false, time.Now().Add(time.Hour)))
+	assert.Nil(t, store.sweepDisabled(ctx))
+	var proxy model.Proxy
+	assert.Nil(t, store.GetById(ctx, ids[0], &proxy))
+	assert.True(t, proxy.Attr.Availiable)
+	assert.Nil(t, store.GetById(ctx, ids[1], &proxy))
+	assert.False(t, proxy.Attr.Availiable)
+	//the schedule goes away with the proxy
+	assert.Nil(t, store.Delete(ctx, ids[1]))
+	_, err := client.ZScore(ctx, disabled_key, ids[1]).Result()
+	assert.ErrorIs(t, err, redis.Nil)
+}
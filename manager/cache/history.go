@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The check results of a proxy are kept newest first in a list bounded by history_size,
+// attr.stability of the proxy is the ratio of the checks succeeded in it
+const history_prefix = "history"
+const history_size = 100
+
+func historyKey(proxy_id string) string {
+	return strings.Join([]string{history_prefix, proxy_id}, sep)
+}
+
+// AddCheckResult records result of the proxy and sets its stability over the results recorded, which is returned
+func (s ProxyStore) AddCheckResult(ctx context.Context, id string, result model.CheckResult) (float64, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "AddCheckResult",
+		"param":  fmt.Sprintf("%+v", map[string]string{"id": id, "checked_at": result.CheckedAt.String()}),
+	})
+	var proxy model.Proxy
+	if err := s.GetById(ctx, id, &proxy); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	pipe := s.client.TxPipeline()
+	pipe.LPush(ctx, historyKey(id), data)
+	pipe.LTrim(ctx, historyKey(id), 0, history_size-1)
+	range_cmd := pipe.LRange(ctx, historyKey(id), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.WithField("error", err).Error("failed to record check result")
+		return 0, errors.WithStack(err)
+	}
+	results, err := parseCheckResults(range_cmd.Val())
+	if err != nil {
+		return 0, err
+	}
+	stability := model.Stability(results)
+	proxy_key := proxyKey(proxy.Id)
+	//attr.stability is omitted while 0, so merge it explicitly
+	merge_value := fmt.Sprintf(`{"attr":{"stability":%g}}`, stability)
+	if err := s.client.JSONMerge(ctx, proxy_key, "$", merge_value).Err(); err != nil {
+		logger.WithField("error", err).Error("failed to set stability")
+		return 0, errors.WithStack(err)
+	}
+	if err := s.refreshShadow(ctx, proxy_key); err != nil {
+		logger.WithField("error", err).Warn("failed to refresh shadow")
+	}
+	logger.WithField("result", stability).Info()
+	return stability, nil
+}
+
+// ListCheckResults lists at most limit of the latest check results of the proxy, newest first,
+// all of them if limit is not positive, with the stability over all of them
+func (s ProxyStore) ListCheckResults(ctx context.Context, id string, limit int) ([]model.CheckResult, float64, error) {
+	exists, err := s.ExistsId(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !exists {
+		return nil, 0, errors.WithStack(ProxyNotFoundError)
+	}
+	values, err := s.client.LRange(ctx, historyKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	results, err := parseCheckResults(values)
+	if err != nil {
+		return nil, 0, err
+	}
+	stability := model.Stability(results)
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, stability, nil
+}
+
+func parseCheckResults(values []string) ([]model.CheckResult, error) {
+	results := make([]model.CheckResult, 0, len(values))
+	for _, value := range values {
+		var result model.CheckResult
+		if err := json.Unmarshal([]byte(value), &result); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redisearch "github.com/WALL-EEEEEEE/proxy-service/manager/util/redisearch"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// proxy_index is the alias every search goes through, it points to the index of the current version named `idx:proxy:v<version>`.
+// Earlier managers created the index under this name, which is taken as version 0
+const proxy_index = "idx:proxy"
+const index_lock_key = proxy_index + sep + "migration"
+const index_lock_ttl = time.Minute
+const index_wait_interval = time.Duration(500) * time.Millisecond
+const index_wait_timeout = time.Duration(30) * time.Minute
+
+// key_version is the version of the index since which proxies are keyed by id instead of `proxy:<ip>:<port>`
+const key_version = 2
+const key_scan_count = 500
+
+// index_unlock_script and index_extend_script release and extend the migration lock only if it's still held by the token
+var index_unlock_script = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+var index_extend_script = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+func indexName(version int) string {
+	return fmt.Sprintf("%s:v%d", proxy_index, version)
+}
+
+func indexVersion(name string) int {
+	version, err := strconv.Atoi(strings.TrimPrefix(name, proxy_index+":v"))
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// initIndex migrates the index to the version of the store without interrupting searches: the index of the version
+// is built aside, then the alias is switched to it and the index of the last version is dropped.
+// Managers migrate one at a time under a lock, and none of them downgrades the index
+func (s *ProxyStore) initIndex() {
+	if len(s.option.Schemas) < 1 {
+		return
+	}
+	logger := s.logger.WithFields(log.Fields{
+		"method":  "initIndex",
+		"version": s.option.Version,
+	})
+	ctx := context.Background()
+	if err := s.client.Do(ctx, redisearch.FtConfigSet("MAXSEARCHRESULTS", "-1")...).Err(); err != nil {
+		logger.WithField("error", err).Error("failed to set config")
+	}
+	token := uuid.New().String()
+	for {
+		locked, err := s.client.SetNX(ctx, index_lock_key, token, index_lock_ttl).Result()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to lock index")
+			return
+		}
+		if locked {
+			break
+		}
+		logger.Debug("index is being migrated by another manager")
+		time.Sleep(index_wait_interval)
+	}
+	defer index_unlock_script.Run(ctx, s.client, []string{index_lock_key}, token)
+	if err := s.migrateIndex(ctx, logger, token); err != nil {
+		logger.WithField("error", err).Error("failed to migrate index")
+	}
+}
+
+func (s *ProxyStore) migrateIndex(ctx context.Context, logger *log.Entry, token string) error {
+	current, err := s.indexInfo(ctx, proxy_index)
+	if err != nil {
+		return err
+	}
+	var current_name string
+	if current != nil {
+		current_name = current.Name
+		if indexVersion(current_name) >= s.option.Version {
+			logger.Infof("index %s is up to date", current_name)
+			return nil
+		}
+	}
+	if current != nil && indexVersion(current_name) < key_version && s.option.Version >= key_version {
+		if err := s.migrateKeys(ctx, logger, token); err != nil {
+			return err
+		}
+	}
+	name := indexName(s.option.Version)
+	create_idx := redisearch.FtCreate(name, redisearch.FTCREATE_ON_JSON, []string{proxy_prefix + sep}, s.option.Schemas)
+	//the index is left by a migration interrupted if it exists already
+	if err := s.client.Do(ctx, create_idx...).Err(); err != nil && !strings.Contains(strings.ToLower(err.Error()), "already exists") {
+		return errors.WithStack(err)
+	}
+	deadline := time.Now().Add(index_wait_timeout)
+	for {
+		info, err := s.indexInfo(ctx, name)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return errors.WithStack(fmt.Errorf("index %s is dropped while being built", name))
+		}
+		if !info.Indexing {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.WithStack(fmt.Errorf("index %s isn't built in %s (%.0f%% indexed)", name, index_wait_timeout, info.PercentIndexed*100))
+		}
+		logger.Debugf("index %s is %.0f%% indexed", name, info.PercentIndexed*100)
+		if err := index_extend_script.Run(ctx, s.client, []string{index_lock_key}, token, index_lock_ttl.Milliseconds()).Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		time.Sleep(index_wait_interval)
+	}
+	//the alias is switched before the old index is dropped, but an alias can't be named as an index,
+	//so the index of version 0 is dropped in the transaction switching it, and no search misses the index in between
+	pipe := s.client.TxPipeline()
+	if current_name == proxy_index {
+		pipe.Do(ctx, redisearch.FtDropIndex(current_name)...)
+	}
+	pipe.Do(ctx, redisearch.FtAliasUpdate(proxy_index, name)...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	if current_name != "" && current_name != proxy_index {
+		if err := s.client.Do(ctx, redisearch.FtDropIndex(current_name)...).Err(); err != nil {
+			logger.WithField("error", err).Errorf("failed to drop index %s", current_name)
+		}
+	}
+	logger.Infof("index migrated from %q to %s", current_name, name)
+	return nil
+}
+
+// migrateKeys renames the proxies keyed by `proxy:<ip>:<port>` to the keys of their ids along with their shadows,
+// a proxy whose id is taken by a key already is a stale copy of it and dropped
+func (s *ProxyStore) migrateKeys(ctx context.Context, logger *log.Entry, token string) error {
+	migrated := 0
+	iter := s.client.Scan(ctx, 0, proxy_prefix+sep+"*", key_scan_count).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		//ids are hex digests, so only the keys of ip and port hold a separator
+		if !strings.Contains(strings.TrimPrefix(key, proxy_prefix+sep), sep) {
+			continue
+		}
+		result, err := s.client.JSONGet(ctx, key, "$.id").Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return errors.WithStack(err)
+		}
+		var ids []string
+		if err := json.Unmarshal([]byte(result), &ids); err != nil || len(ids) < 1 || ids[0] == "" {
+			//the key is expired since it's scanned, or it isn't a proxy
+			logger.Warnf("key %s isn't a proxy with id, skipped", key)
+			continue
+		}
+		id_key := proxyKey(ids[0])
+		renamed, err := s.client.RenameNX(ctx, key, id_key).Result()
+		if err != nil {
+			if isNoSuchKey(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		if !renamed {
+			if err := s.client.Del(ctx, key, shadowKey(key)).Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		if err := s.client.Rename(ctx, shadowKey(key), shadowKey(id_key)).Err(); err != nil && !isNoSuchKey(err) {
+			logger.WithField("error", err).Warnf("failed to rename shadow of %s", key)
+		}
+		migrated++
+		if migrated%key_scan_count == 0 {
+			if err := index_extend_script.Run(ctx, s.client, []string{index_lock_key}, token, index_lock_ttl.Milliseconds()).Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			logger.Debugf("%d proxies rekeyed", migrated)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	logger.Infof("%d proxies rekeyed by id", migrated)
+	return nil
+}
+
+func isNoSuchKey(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "no such key")
+}
+
+// indexInfo returns the info of the index or alias named name, or nil if it doesn't exist
+func (s *ProxyStore) indexInfo(ctx context.Context, name string) (*redisearch.IndexInfo, error) {
+	result, err := s.client.Do(ctx, redisearch.FtInfo(name)...).Result()
+	if err != nil {
+		msg := strings.ToLower(err.Error())
+		if strings.Contains(msg, "unknown index") || strings.Contains(msg, "no such index") {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	info, err := redisearch.ParseInfoResult(result)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return info, nil
+}
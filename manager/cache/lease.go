@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	redisearch "github.com/WALL-EEEEEEE/proxy-service/manager/util/redisearch"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const lease_prefix = "lease"
+const lease_candidates = 100
+
+var (
+	LeaseNotFoundError    = errors.New("lease not found")
+	LeaseUnavailableError = errors.New("no proxy could be leased")
+)
+
+// proxyLease is kept in $.lease of the proxy document, proxies are leased in the order of leased_at
+// so that every consumer is handed the least recently leased proxy. The outcomes the leases are released with
+// are counted along, so that they're kept by upserts and go away with the proxy
+type proxyLease struct {
+	LeasedAt int64 `json:"leased_at"`
+	Success  int64 `json:"success,omitempty"`
+	Failure  int64 `json:"failure,omitempty"`
+}
+
+// outcomes returns the outcomes counted, nil if no lease was released with an outcome
+func (l proxyLease) outcomes() *model.LeaseOutcomes {
+	if l.Success == 0 && l.Failure == 0 {
+		return nil
+	}
+	return &model.LeaseOutcomes{Success: l.Success, Failure: l.Failure}
+}
+
+// acquire_script holds the first of the candidates which isn't held by an exclusive lease of the scope for the lease,
+// an exclusive lease requires no other lease of the scope to hold the proxy as well. It returns the position of
+// the candidate held from 1, or 0 if none of them could be held.
+// KEYS: lease, then the lock and holders of each candidate;
+// ARGV: lease id, now, expire time, ttl (in milliseconds), exclusive, number of candidates, ids of candidates..., fields of lease...
+var acquire_script = redis.NewScript(`
+local n = tonumber(ARGV[6])
+for i = 1, n do
+	local lock, holders = KEYS[2 * i], KEYS[2 * i + 1]
+	redis.call('ZREMRANGEBYSCORE', holders, '-inf', ARGV[2])
+	if redis.call('EXISTS', lock) == 0 and (ARGV[5] ~= '1' or redis.call('ZCARD', holders) == 0) then
+		if ARGV[5] == '1' then
+			redis.call('SET', lock, ARGV[1], 'PX', ARGV[4])
+		end
+		redis.call('ZADD', holders, ARGV[3], ARGV[1])
+		if redis.call('PTTL', holders) < tonumber(ARGV[4]) then
+			redis.call('PEXPIRE', holders, ARGV[4])
+		end
+		redis.call('HSET', KEYS[1], 'proxy_id', ARGV[6 + i], unpack(ARGV, 7 + n))
+		redis.call('PEXPIRE', KEYS[1], ARGV[4])
+		return i
+	end
+end
+return 0
+`)
+
+// release_script drops the hold of the lease and counts its outcome in the lease of the proxy document if it still exists.
+// KEYS: lease, holders, lock, proxy; ARGV: lease id, outcome field or empty
+var release_script = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+if redis.call('GET', KEYS[3]) == ARGV[1] then
+	redis.call('DEL', KEYS[3])
+end
+if ARGV[2] ~= '' and redis.call('EXISTS', KEYS[4]) == 1 then
+	local path = '$.lease.' .. ARGV[2]
+	if #redis.call('JSON.TYPE', KEYS[4], '$.lease') == 0 then
+		redis.call('JSON.SET', KEYS[4], '$.lease', '{"leased_at":0}')
+	end
+	if #redis.call('JSON.TYPE', KEYS[4], path) == 0 then
+		redis.call('JSON.SET', KEYS[4], path, '0')
+	end
+	redis.call('JSON.NUMINCRBY', KEYS[4], path, 1)
+end
+return 1
+`)
+
+// set_document_script replaces the proxy document but keeps its lease, so that upserting a proxy doesn't
+// reset the order it's leased in. KEYS: proxy; ARGV: document
+var set_document_script = redis.NewScript(`
+local lease = redis.call('JSON.GET', KEYS[1], '$.lease')
+redis.call('JSON.SET', KEYS[1], '$', ARGV[1])
+if lease and lease ~= '[]' then
+	redis.call('JSON.SET', KEYS[1], '$.lease', string.sub(lease, 2, -2))
+end
+return 1
+`)
+
+// pipeDocument writes doc to proxy_key by pipe, the lease of the document replaced is kept
+func pipeDocument(ctx context.Context, pipe redis.Pipeliner, proxy_key string, doc proxyDocument) *redis.Cmd {
+	value, err := json.Marshal(doc)
+	if err != nil {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(errors.WithStack(err))
+		return cmd
+	}
+	//scripts aren't loaded by pipelines, so it's sent as a whole rather than by sha
+	return set_document_script.Eval(ctx, pipe, []string{proxy_key}, string(value))
+}
+
+func leaseKey(id string) string {
+	return strings.Join([]string{lease_prefix, id}, sep)
+}
+
+func leaseLockKey(proxy_id string, scope string) string {
+	return strings.Join([]string{lease_prefix, "lock", proxy_id, scope}, sep)
+}
+
+func leaseHoldersKey(proxy_id string, scope string) string {
+	return strings.Join([]string{lease_prefix, "holders", proxy_id, scope}, sep)
+}
+
+// Acquire leases the least recently leased proxy matched by filter which could be held for the lease, the candidates
+// are tried by pages of lease_candidates. It fails with ProxyNotFoundError if no proxy is matched,
+// or LeaseUnavailableError if all of them are held exclusively
+func (s ProxyStore) Acquire(ctx context.Context, filter *pb.Filter, duration time.Duration, exclusive bool, scope string, consumer string) (*model.Lease, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "Acquire",
+		"param":  fmt.Sprintf("%+v", map[string]string{"filter": fmt.Sprintf("%+v", filter), "duration": duration.String(), "exclusive": fmt.Sprintf("%t", exclusive), "scope": scope, "consumer": consumer}),
+	})
+	query_field, err := createFieldFromFilter(filter, s.kinds)
+	if err != nil {
+		return nil, err
+	}
+	if query_field == nil {
+		query_field = redisearch.NewAnyField()
+	}
+	total := 0
+	for offset := 0; ; offset += lease_candidates {
+		q := redisearch.NewQuery(lease_candidates, offset, query_field).SortBy(redisearch.NewSortKey("leased_at", redisearch.SORT_ORDER_ASC))
+		search := redisearch.FtSearch("idx:proxy", q)
+		logger.Debug(search)
+		result, err := s.client.Do(ctx, search...).Result()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to get proxy")
+			return nil, errors.WithStack(err)
+		}
+		search_result, err := redisearch.ParseSearchResult[proxyDocument](result)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to get proxy")
+			return nil, errors.WithStack(err)
+		}
+		total = search_result.Total
+		candidates := make([]model.Proxy, 0, len(search_result.Items))
+		for _, v := range search_result.Items {
+			candidates = append(candidates, v.Item.proxy())
+		}
+		lease, err := s.hold(ctx, candidates, duration, exclusive, scope, consumer)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to hold proxy")
+			return nil, err
+		}
+		if lease != nil {
+			logger.WithFields(log.Fields{
+				"lease": lease.Id,
+				"proxy": lease.ProxyId,
+			}).Info()
+			return lease, nil
+		}
+		if len(search_result.Items) < lease_candidates || offset+lease_candidates >= total {
+			break
+		}
+	}
+	if total < 1 {
+		return nil, errors.WithStack(ProxyNotFoundError)
+	}
+	return nil, errors.WithStack(LeaseUnavailableError)
+}
+
+// hold holds the first of candidates which could be held for a new lease by one script, no lease is returned
+// if all of them are held exclusively
+func (s ProxyStore) hold(ctx context.Context, candidates []model.Proxy, duration time.Duration, exclusive bool, scope string, consumer string) (*model.Lease, error) {
+	if len(candidates) < 1 {
+		return nil, nil
+	}
+	now := time.Now()
+	lease := model.Lease{
+		Id:         uuid.New().String(),
+		Scope:      scope,
+		Consumer:   consumer,
+		Exclusive:  exclusive,
+		AcquiredAt: now,
+		ExpiredAt:  now.Add(duration),
+	}
+	keys := make([]string, 0, 1+2*len(candidates))
+	keys = append(keys, leaseKey(lease.Id))
+	args := []interface{}{lease.Id, now.UnixMilli(), lease.ExpiredAt.UnixMilli(), duration.Milliseconds(), exclusive, len(candidates)}
+	for _, proxy := range candidates {
+		keys = append(keys, leaseLockKey(proxy.Id, scope), leaseHoldersKey(proxy.Id, scope))
+		args = append(args, proxy.Id)
+	}
+	args = append(args,
+		"scope", lease.Scope,
+		"consumer", lease.Consumer,
+		"exclusive", exclusive,
+		"acquired_at", lease.AcquiredAt.UnixMilli(),
+		"expired_at", lease.ExpiredAt.UnixMilli(),
+	)
+	held, err := acquire_script.Run(ctx, s.client, keys, args...).Int()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if held < 1 || held > len(candidates) {
+		return nil, nil
+	}
+	proxy := candidates[held-1]
+	lease.ProxyId = proxy.Id
+	lease.Proxy = &proxy
+	//the order of leasing is best effort, a lease isn't failed by it
+	proxy_key := proxyKey(proxy.Id)
+	merge_value := fmt.Sprintf(`{"lease":{"leased_at":%d}}`, now.UnixMilli())
+	if err := s.client.JSONMerge(ctx, proxy_key, "$", merge_value).Err(); err != nil {
+		s.logger.WithFields(log.Fields{
+			"method": "hold",
+			"error":  err,
+		}).Warn("failed to set leased_at")
+	}
+	return &lease, nil
+}
+
+// Release releases the lease and counts outcome for its proxy, outcome is skipped if unspecified
+func (s ProxyStore) Release(ctx context.Context, id string, outcome model.LEASE_OUTCOME) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "Release",
+		"param":  fmt.Sprintf("%+v", map[string]string{"id": id, "outcome": outcome}),
+	})
+	fields, err := s.client.HGetAll(ctx, leaseKey(id)).Result()
+	if err != nil {
+		logger.WithField("error", err).Error("failed to get lease")
+		return errors.WithStack(err)
+	}
+	proxy_id, ok := fields["proxy_id"]
+	if !ok {
+		return errors.WithStack(LeaseNotFoundError)
+	}
+	scope := fields["scope"]
+	var outcome_field string
+	switch outcome {
+	case model.LEASE_OUTCOME_SUCCESS:
+		outcome_field = "success"
+	case model.LEASE_OUTCOME_FAILURE:
+		outcome_field = "failure"
+	}
+	keys := []string{leaseKey(id), leaseHoldersKey(proxy_id, scope), leaseLockKey(proxy_id, scope), proxyKey(proxy_id)}
+	released, err := release_script.Run(ctx, s.client, keys, id, outcome_field).Int()
+	if err != nil {
+		logger.WithField("error", err).Error("failed to release lease")
+		return errors.WithStack(err)
+	}
+	//the lease expired or was released in between
+	if released != 1 {
+		return errors.WithStack(LeaseNotFoundError)
+	}
+	logger.WithField("proxy", proxy_id).Info()
+	return nil
+}
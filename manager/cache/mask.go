@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/pkg/errors"
+)
+
+// list_fields maps the fields proxies are listed with to the keys of their documents
+var list_fields = map[string]string{
+	"id":          "id",
+	"proto":       "proto",
+	"ip":          "ip",
+	"port":        "port",
+	"status":      "status",
+	"provider":    "provider",
+	"api":         "api",
+	"provider_id": "provider_id",
+	"api_id":      "api_id",
+	"attr":        "attr",
+	"created_at":  "created_at",
+	"updated_at":  "updated_at",
+	"checked_at":  "checked_at",
+	"expire_time": "expired_at",
+	"use_config":  "use_config",
+}
+
+// string_keys are the keys of documents holding strings, which FT.SEARCH returns unquoted while the others in JSON
+var string_keys = map[string]bool{
+	"id":          true,
+	"ip":          true,
+	"status":      true,
+	"provider":    true,
+	"api":         true,
+	"provider_id": true,
+	"api_id":      true,
+	"created_at":  true,
+	"updated_at":  true,
+	"checked_at":  true,
+	"expired_at":  true,
+}
+
+// listKeys returns the keys of documents fields are mapped to, nil if fields is empty so that the whole documents are listed
+func listKeys(fields []string) ([]string, error) {
+	var keys []string
+	seen := map[string]bool{}
+	for _, field := range fields {
+		key, ok := list_fields[field]
+		if !ok {
+			return nil, errors.WithStack(fmt.Errorf("%w: proxies are not listed with field %s", InvalidFieldError, field))
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// proxyFromValues decodes a proxy from the values of its document keyed by their keys
+func proxyFromValues(values map[string]json.RawMessage) (model.Proxy, error) {
+	var proxy model.Proxy
+	data, err := json.Marshal(values)
+	if err != nil {
+		return proxy, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(data, &proxy); err != nil {
+		return proxy, errors.WithStack(err)
+	}
+	return proxy, nil
+}
+
+// proxyFromAttributes decodes a proxy from the values of the paths of keys FT.SEARCH returns
+func proxyFromAttributes(attributes map[string]string, keys []string) (model.Proxy, error) {
+	values := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		value, ok := attributes["$."+key]
+		if !ok {
+			continue
+		}
+		if string_keys[key] {
+			quoted, _ := json.Marshal(value)
+			values[key] = quoted
+			continue
+		}
+		values[key] = json.RawMessage(value)
+	}
+	return proxyFromValues(values)
+}
+
+// maskProxy keeps the values of keys of proxy only
+func maskProxy(proxy model.Proxy, keys []string) (model.Proxy, error) {
+	data, err := json.Marshal(proxy)
+	if err != nil {
+		return proxy, errors.WithStack(err)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return proxy, errors.WithStack(err)
+	}
+	masked := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			masked[key] = value
+		}
+	}
+	return proxyFromValues(masked)
+}
+
+func returnPaths(keys []string) []string {
+	paths := make([]string, 0, len(keys))
+	for _, key := range keys {
+		paths = append(paths, "$."+key)
+	}
+	return paths
+}
@@ -0,0 +1,1055 @@
+package cache
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/common"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	redisearch "github.com/WALL-EEEEEEE/proxy-service/manager/util/redisearch"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const memory_expiry_interval = time.Second
+const memory_watch_buffer = 1024
+
+// earth radius in meters redis measures geo distances by
+const earth_radius = 6372797.560856
+
+var geo_units = map[redisearch.GeoUnit]float64{
+	redisearch.GEO_UNIT_M:  1,
+	redisearch.GEO_UNIT_KM: 1000,
+	redisearch.GEO_UNIT_MI: 1609.34,
+	redisearch.GEO_UNIT_FT: 0.3048,
+}
+
+// memoryProxy is a proxy document kept as the json redis would store, values is the json decoded to look up
+// the properties filtered and sorted by, expire_at is zero if the proxy never expires
+type memoryProxy struct {
+	key       string
+	data      []byte
+	values    map[string]interface{}
+	expire_at time.Time
+}
+
+func (m memoryProxy) proxy() model.Proxy {
+	return m.document().proxy()
+}
+
+func (m memoryProxy) document() proxyDocument {
+	var doc proxyDocument
+	_ = json.Unmarshal(m.data, &doc)
+	return doc
+}
+
+// memoryExpiry is when the proxy at key expires, it's outdated once the proxy is removed or given another expire_at
+type memoryExpiry struct {
+	key       string
+	expire_at time.Time
+}
+
+// memoryExpiries is a min-heap of expiries by expire_at, so that expire finds the proxies expired without a scan
+type memoryExpiries []memoryExpiry
+
+func (h memoryExpiries) Len() int           { return len(h) }
+func (h memoryExpiries) Less(i, j int) bool { return h[i].expire_at.Before(h[j].expire_at) }
+func (h memoryExpiries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *memoryExpiries) Push(x any) {
+	*h = append(*h, x.(memoryExpiry))
+}
+
+func (h *memoryExpiries) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// memoryMatcher tells whether the values of a proxy document are matched by a filter
+type memoryMatcher func(values map[string]interface{}) bool
+
+type memoryWatcher struct {
+	events map[event.Event]bool
+	ch     chan ProxyEvent
+}
+
+// MemoryProxyStore keeps proxies in process, it evaluates filters, orders and stats by the schemas of StoreOption
+// the way ProxyStore has them evaluated by RediSearch, and publishes events to its watchers instead of redis streams.
+// It serves a single node, whose proxies are checked by the job watching the store in process
+type MemoryProxyStore struct {
+	mu        sync.Mutex
+	proxies   map[string]*memoryProxy //by the key ProxyStore stores the proxy at
+	expiries  memoryExpiries
+	leases    map[string]model.Lease
+	holders   map[string]map[string]bool     //lease ids by proxy and scope
+	histories map[string][]model.CheckResult //check results by proxy id, newest first
+	disabled  map[string]time.Time           //until when the proxies made unavailable are, by proxy id
+	watchers  map[*memoryWatcher]bool
+	fields    map[string]string //json paths of indexed properties by name
+	kinds     map[string]redisearch.SchemaKind
+	sortable  map[string]bool
+	now       func() time.Time
+	logger    *log.Entry
+}
+
+func lookupValue(values map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = values
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+func (s *MemoryProxyStore) numericValue(values map[string]interface{}, name string) (float64, bool) {
+	value, ok := lookupValue(values, s.fields[name])
+	if !ok {
+		return 0, false
+	}
+	n, ok := value.(float64)
+	return n, ok
+}
+
+// tagValues returns the tags of name, an array is indexed as a tag for each of its items
+func (s *MemoryProxyStore) tagValues(values map[string]interface{}, name string) []string {
+	value, ok := lookupValue(values, s.fields[name])
+	if !ok {
+		return nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	var tags []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			tags = append(tags, v)
+		case bool:
+			tags = append(tags, strconv.FormatBool(v))
+		}
+	}
+	return tags
+}
+
+// geoDistance returns the distance in meters between two points by the haversine formula, as redis does
+func geoDistance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+	rad := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+	u := math.Sin((rad(lat2) - rad(lat1)) / 2)
+	v := math.Sin((rad(lon2) - rad(lon1)) / 2)
+	return 2 * earth_radius * math.Asin(math.Sqrt(u*u+math.Cos(rad(lat1))*math.Cos(rad(lat2))*v*v))
+}
+
+// createMatcherFromFilter is createFieldFromFilter evaluated in process, nil is returned if filter matches no field
+func (s *MemoryProxyStore) createMatcherFromFilter(filter *pb.Filter) (memoryMatcher, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	not := func(matcher memoryMatcher) memoryMatcher {
+		return func(values map[string]interface{}) bool {
+			return !matcher(values)
+		}
+	}
+	create_numeric_filter := func(f *pb.PropertyFilter) (memoryMatcher, error) {
+		name := f.GetProperty().GetName()
+		v, err := parseNumeric(name, f.GetValue())
+		if err != nil {
+			return nil, err
+		}
+		var compare func(n float64) bool
+		switch f.Op {
+		case pb.PropertyFilter_EQUAL, pb.PropertyFilter_IN, pb.PropertyFilter_NOT_EQUAL, pb.PropertyFilter_NOT_IN:
+			compare = func(n float64) bool { return n == v }
+		case pb.PropertyFilter_LESS_THAN:
+			compare = func(n float64) bool { return n < v }
+		case pb.PropertyFilter_LESS_THAN_OR_EQUAL:
+			compare = func(n float64) bool { return n <= v }
+		case pb.PropertyFilter_GREATER_THAN:
+			compare = func(n float64) bool { return n > v }
+		case pb.PropertyFilter_GREATER_THAN_OR_EQUAL:
+			compare = func(n float64) bool { return n >= v }
+		default:
+			return nil, nil
+		}
+		matcher := func(values map[string]interface{}) bool {
+			n, ok := s.numericValue(values, name)
+			return ok && compare(n)
+		}
+		if f.Op == pb.PropertyFilter_NOT_EQUAL || f.Op == pb.PropertyFilter_NOT_IN {
+			return not(matcher), nil
+		}
+		return matcher, nil
+	}
+	create_prop_filter := func(f *pb.PropertyFilter) (memoryMatcher, error) {
+		if f == nil {
+			return nil, nil
+		}
+		name := f.GetProperty().GetName()
+		kind, ok := s.kinds[name]
+		if !ok {
+			return nil, errors.WithStack(fmt.Errorf("%w: property %s is not indexed", InvalidFilterError, name))
+		}
+		if kind == redisearch.SCHEMA_KIND_GEO || f.Op == pb.PropertyFilter_GEO_RADIUS {
+			if kind != redisearch.SCHEMA_KIND_GEO || f.Op != pb.PropertyFilter_GEO_RADIUS {
+				return nil, errors.WithStack(fmt.Errorf("%w: operator %s is not supported by property %s", InvalidFilterError, f.Op, name))
+			}
+			value, err := parseGeoRadius(name, f.GetValue())
+			if err != nil {
+				return nil, err
+			}
+			center := value.GetValue()
+			radius := center[2] * geo_units[value.Unit()]
+			return func(values map[string]interface{}) bool {
+				tags := s.tagValues(values, name)
+				if len(tags) < 1 {
+					return false
+				}
+				parts := strings.Split(tags[0], ",")
+				if len(parts) != 2 {
+					return false
+				}
+				lon, err := strconv.ParseFloat(parts[0], 64)
+				if err != nil {
+					return false
+				}
+				lat, err := strconv.ParseFloat(parts[1], 64)
+				if err != nil {
+					return false
+				}
+				return geoDistance(center[0], center[1], lon, lat) <= radius
+			}, nil
+		}
+		if kind == redisearch.SCHEMA_KIND_NUMERIC {
+			return create_numeric_filter(f)
+		}
+		//tags are matched case-insensitively as RediSearch does by default
+		matcher := func(values map[string]interface{}) bool {
+			for _, tag := range s.tagValues(values, name) {
+				if strings.EqualFold(tag, f.GetValue()) {
+					return true
+				}
+			}
+			return false
+		}
+		switch f.Op {
+		case pb.PropertyFilter_EQUAL, pb.PropertyFilter_IN:
+			return matcher, nil
+		case pb.PropertyFilter_NOT_EQUAL, pb.PropertyFilter_NOT_IN:
+			return not(matcher), nil
+		}
+		return nil, errors.WithStack(fmt.Errorf("%w: operator %s is not supported by property %s", InvalidFilterError, f.Op, name))
+	}
+	create_compo_filter := func(f *pb.CompositeFilter) (memoryMatcher, error) {
+		if f == nil || f.Filters == nil || len(f.Filters) < 1 {
+			return nil, nil
+		}
+		var matcher memoryMatcher
+		for _, filter := range f.Filters {
+			next_matcher, err := s.createMatcherFromFilter(filter)
+			if err != nil {
+				return nil, err
+			}
+			if next_matcher == nil {
+				continue
+			}
+			if matcher == nil {
+				matcher = next_matcher
+				continue
+			}
+			prev_matcher := matcher
+			if f.GetOp() == pb.CompositeFilter_AND {
+				matcher = func(values map[string]interface{}) bool {
+					return prev_matcher(values) && next_matcher(values)
+				}
+			} else if f.GetOp() == pb.CompositeFilter_OR {
+				matcher = func(values map[string]interface{}) bool {
+					return prev_matcher(values) || next_matcher(values)
+				}
+			}
+		}
+		return matcher, nil
+	}
+
+	switch filter.GetFilterType().(type) {
+	case *pb.Filter_PropertyFilter:
+		return create_prop_filter(filter.GetPropertyFilter())
+	case *pb.Filter_CompositeFilter:
+		return create_compo_filter(filter.GetCompositeFilter())
+	default:
+		return nil, nil
+	}
+}
+
+// createLessFromOrders compares two proxy documents by orders, proxies missing a property are sorted after the others
+func (s *MemoryProxyStore) createLessFromOrders(orders []*pb.PropertyOrder) (func(a *memoryProxy, b *memoryProxy) bool, error) {
+	for _, order := range orders {
+		name := order.GetProperty().GetName()
+		if !s.sortable[name] {
+			return nil, errors.WithStack(fmt.Errorf("%w: property %s is not sortable", InvalidOrderError, name))
+		}
+	}
+	return func(a *memoryProxy, b *memoryProxy) bool {
+		for _, order := range orders {
+			name := order.GetProperty().GetName()
+			va, a_ok := s.numericValue(a.values, name)
+			vb, b_ok := s.numericValue(b.values, name)
+			if a_ok != b_ok {
+				return a_ok
+			}
+			if va == vb {
+				continue
+			}
+			if order.GetDirection() == pb.PropertyOrder_DESCENDING {
+				return va > vb
+			}
+			return va < vb
+		}
+		return false
+	}, nil
+}
+
+// match returns the proxies matched by matcher in the order of their keys, all of them if matcher is nil
+func (s *MemoryProxyStore) match(matcher memoryMatcher) []*memoryProxy {
+	keys := make([]string, 0, len(s.proxies))
+	for key := range s.proxies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var matched []*memoryProxy
+	for _, key := range keys {
+		m := s.proxies[key]
+		if matcher == nil || matcher(m.values) {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+// first returns the proxy of the least key matched by matcher without sorting the proxies
+func (s *MemoryProxyStore) first(matcher memoryMatcher) (*memoryProxy, bool) {
+	var found *memoryProxy
+	for key, m := range s.proxies {
+		if (found == nil || key < found.key) && matcher(m.values) {
+			found = m
+		}
+	}
+	return found, found != nil
+}
+
+func (s *MemoryProxyStore) getById(id string) (*memoryProxy, bool) {
+	m, ok := s.proxies[proxyKey(id)]
+	return m, ok
+}
+
+func (s *MemoryProxyStore) getByIp(ip string) (*memoryProxy, bool) {
+	return s.first(func(values map[string]interface{}) bool {
+		v, _ := values["ip"].(string)
+		return strings.EqualFold(v, ip)
+	})
+}
+
+// put stores doc at key, expire_at is kept as it is
+func (s *MemoryProxyStore) put(key string, doc proxyDocument, expire_at time.Time) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.WithStack(err)
+	}
+	if old, ok := s.proxies[key]; !expire_at.IsZero() && (!ok || !old.expire_at.Equal(expire_at)) {
+		heap.Push(&s.expiries, memoryExpiry{key: key, expire_at: expire_at})
+	}
+	s.proxies[key] = &memoryProxy{key: key, data: data, values: values, expire_at: expire_at}
+	return nil
+}
+
+// set stores proxy as Add does, replacing the proxy stored at the same key but keeping its lease order
+func (s *MemoryProxyStore) set(proxy model.Proxy) error {
+	key := proxyKey(proxy.Id)
+	var expire_at time.Time
+	if proxy.Ttl != -1 {
+		expire_at = s.now().Add(time.Duration(proxy.Ttl) * time.Second)
+	}
+	doc := proxyDocument{Proxy: Proxy(proxy), Index: newProxyIndex(proxy)}
+	if m, ok := s.proxies[key]; ok {
+		doc.Lease = m.document().Lease
+	}
+	return s.put(key, doc, expire_at)
+}
+
+// remove drops the proxy with its check results
+func (s *MemoryProxyStore) remove(m *memoryProxy) model.Proxy {
+	proxy := m.proxy()
+	delete(s.proxies, m.key)
+	delete(s.histories, proxy.Id)
+	delete(s.disabled, proxy.Id)
+	return proxy
+}
+
+func (s *MemoryProxyStore) publish(stream event.Event, proxy model.Proxy) {
+	for watcher := range s.watchers {
+		if !watcher.events[stream] {
+			continue
+		}
+		select {
+		case watcher.ch <- ProxyEvent{Type: stream, Proxy: proxy}:
+		default:
+			s.logger.WithFields(log.Fields{
+				"method": "publish",
+				"event":  stream,
+			}).Warn("watcher is full, event dropped")
+		}
+	}
+}
+
+// expire removes the proxies expired and publishes their expiry, it's run before every access of the proxies
+// so that an expired proxy is never seen whether WatchExpiry runs or not
+func (s *MemoryProxyStore) expire() {
+	now := s.now()
+	for len(s.expiries) > 0 && !s.expiries[0].expire_at.After(now) {
+		expiry := heap.Pop(&s.expiries).(memoryExpiry)
+		m, ok := s.proxies[expiry.key]
+		if !ok || !m.expire_at.Equal(expiry.expire_at) {
+			continue
+		}
+		proxy := s.remove(m)
+		s.publish(event.EVENT_PROXY_EXPIRED, proxy)
+		s.publish(event.EVENT_PROXY_DELETED, proxy)
+		s.logger.WithFields(log.Fields{
+			"method": "expire",
+			"event":  event.EVENT_PROXY_EXPIRED,
+			"value":  proxy.Id,
+		}).Info("event sent")
+	}
+}
+
+// enable makes the proxies whose unavailability is over available again, it's run along with expire
+func (s *MemoryProxyStore) enable() {
+	now := s.now()
+	for id, until := range s.disabled {
+		if until.After(now) {
+			continue
+		}
+		delete(s.disabled, id)
+		m, ok := s.getById(id)
+		if !ok {
+			continue
+		}
+		if err := s.setAvailable(m, true); err != nil {
+			s.logger.WithFields(log.Fields{
+				"method": "enable",
+				"id":     id,
+			}).WithField("error", err).Error("failed to enable proxy")
+		}
+	}
+}
+
+// lock holds the store, drops the proxies expired and enables the proxies whose unavailability is over
+func (s *MemoryProxyStore) lock() {
+	s.mu.Lock()
+	s.expire()
+	s.enable()
+}
+
+func (s *MemoryProxyStore) GetById(ctx context.Context, id string, proxy *model.Proxy) error {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getById(id)
+	if !ok {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	*proxy = m.proxy()
+	return nil
+}
+
+func (s *MemoryProxyStore) GetByIp(ctx context.Context, ip string, proxy *model.Proxy) error {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getByIp(ip)
+	if !ok {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	*proxy = m.proxy()
+	return nil
+}
+
+func (s *MemoryProxyStore) ExistsId(ctx context.Context, id string) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	_, ok := s.getById(id)
+	return ok, nil
+}
+
+func (s *MemoryProxyStore) ExistsIp(ctx context.Context, ip string) (bool, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	_, ok := s.getByIp(ip)
+	return ok, nil
+}
+
+func (s *MemoryProxyStore) Add(ctx context.Context, proxy *model.Proxy, options ...SetOption) (*string, error) {
+	setOption := DefaultSetOption
+	if len(options) > 0 {
+		setOption = options[0]
+	}
+	proxy_id, err := ProxyId(*proxy)
+	if err != nil {
+		return nil, err
+	}
+	proxy.Id = proxy_id
+	s.lock()
+	defer s.mu.Unlock()
+	if err := s.set(*proxy); err != nil {
+		return nil, err
+	}
+	var stream event.Event
+	if setOption.Operation == SETOP_CRETATE {
+		stream = event.EVENT_PROXY_CREATED
+	} else if setOption.Operation == SETOP_UPDATE {
+		stream = event.EVENT_PROXY_UPDATED
+	}
+	s.publish(stream, *proxy)
+	return &proxy.Id, nil
+}
+
+// AddBatch adds proxies as ProxyStore.AddBatch does, see it for the results
+func (s *MemoryProxyStore) AddBatch(ctx context.Context, proxies []model.Proxy, upsert bool) ([]model.AddProxyResult, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	results := make([]model.AddProxyResult, len(proxies))
+	seen := make(map[string]int, len(proxies)) //id to the index of the first proxy of it
+	for i := range proxies {
+		proxy := &proxies[i]
+		if err := validateProxy(*proxy); err != nil {
+			results[i] = model.AddProxyResult{Result: model.ADD_RESULT_INVALID, Message: err.Error()}
+			continue
+		}
+		proxy_id, err := ProxyId(*proxy)
+		if err != nil {
+			results[i] = model.AddProxyResult{Result: model.ADD_RESULT_INVALID, Message: err.Error()}
+			continue
+		}
+		proxy.Id = proxy_id
+		if first, ok := seen[proxy.Id]; ok {
+			results[i] = model.AddProxyResult{Result: model.ADD_RESULT_ALREADY_EXISTS, Id: proxy.Id, Message: fmt.Sprintf("proxy %s is duplicated with proxy %d of the batch", proxy.Id, first)}
+			continue
+		}
+		seen[proxy.Id] = i
+		result, stream := model.ADD_RESULT_CREATED, event.EVENT_PROXY_CREATED
+		if _, ok := s.proxies[proxyKey(proxy.Id)]; ok {
+			if !upsert {
+				results[i] = model.AddProxyResult{Result: model.ADD_RESULT_ALREADY_EXISTS, Id: proxy.Id, Message: fmt.Sprintf("proxy %s already exists", proxy.Id)}
+				continue
+			}
+			result, stream = model.ADD_RESULT_UPDATED, event.EVENT_PROXY_UPDATED
+		}
+		if err := s.set(*proxy); err != nil {
+			results[i] = model.AddProxyResult{Result: model.ADD_RESULT_FAILED, Id: proxy.Id, Message: fmt.Sprintf("failed to add proxy %s (error: %+v)", proxy.Id, err)}
+			continue
+		}
+		s.publish(stream, *proxy)
+		results[i] = model.AddProxyResult{Result: result, Id: proxy.Id}
+	}
+	return results, nil
+}
+
+// Update merges the values of paths of proxy into the stored one as JSON.MERGE does
+func (s *MemoryProxyStore) Update(ctx context.Context, id string, proxy model.Proxy, paths []string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getById(id)
+	if !ok {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	p_bytes, _ := json.Marshal(proxy)
+	var p_json map[string]interface{}
+	_ = json.Unmarshal(p_bytes, &p_json)
+	var doc_json map[string]interface{}
+	if err := json.Unmarshal(m.data, &doc_json); err != nil {
+		return errors.WithStack(err)
+	}
+	refresh_index := false
+	for _, path := range paths {
+		path_value, ok := p_json[path]
+		if !ok {
+			continue
+		}
+		doc_json[path] = mergePatch(doc_json[path], path_value)
+		if path == "attr" || path == "checked_at" || path == "created_at" {
+			refresh_index = true
+		}
+	}
+	doc_bytes, _ := json.Marshal(doc_json)
+	var doc proxyDocument
+	if err := json.Unmarshal(doc_bytes, &doc); err != nil {
+		return errors.WithStack(fmt.Errorf("failed to update proxy %s (err: %+v) ", id, err))
+	}
+	if refresh_index {
+		doc.Index = newProxyIndex(model.Proxy(doc.Proxy))
+	}
+	return s.put(m.key, doc, m.expire_at)
+}
+
+// mergePatch applies patch to target as RFC 7396 describes, which JSON.MERGE follows
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patch_map, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target_map, ok := target.(map[string]interface{})
+	if !ok {
+		target_map = make(map[string]interface{}, len(patch_map))
+	}
+	for k, v := range patch_map {
+		if v == nil {
+			delete(target_map, k)
+			continue
+		}
+		target_map[k] = mergePatch(target_map[k], v)
+	}
+	return target_map
+}
+
+// SetAvailable flips attr.availiable of the proxy without touching the other attributes,
+// a proxy made unavailable with until isn't zero is made available again once until is passed
+func (s *MemoryProxyStore) SetAvailable(ctx context.Context, id string, available bool, until time.Time) error {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getById(id)
+	if !ok {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	delete(s.disabled, id)
+	if !available && !until.IsZero() {
+		s.disabled[id] = until
+	}
+	return s.setAvailable(m, available)
+}
+
+func (s *MemoryProxyStore) setAvailable(m *memoryProxy, available bool) error {
+	doc := m.document()
+	if doc.Attr == nil {
+		doc.Attr = &model.Attr{}
+	}
+	doc.Attr.Availiable = available
+	doc.Index.Available = strconv.FormatBool(available)
+	return s.put(m.key, doc, m.expire_at)
+}
+
+// Delete removes the proxy and publishes its deletion to the watchers
+func (s *MemoryProxyStore) Delete(ctx context.Context, id string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getById(id)
+	if !ok {
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	s.publish(event.EVENT_PROXY_DELETED, s.remove(m))
+	return nil
+}
+
+// DeleteWithFilters removes every proxy matched by filter and returns the ids deleted,
+// a filter matching nothing is refused to avoid dropping the whole pool by accident
+func (s *MemoryProxyStore) DeleteWithFilters(ctx context.Context, filter *pb.Filter) ([]string, error) {
+	matcher, err := s.createMatcherFromFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if matcher == nil {
+		return nil, errors.WithStack(EmptyFilterError)
+	}
+	s.lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, m := range s.match(matcher) {
+		proxy := s.remove(m)
+		s.publish(event.EVENT_PROXY_DELETED, proxy)
+		ids = append(ids, proxy.Id)
+	}
+	s.logger.WithFields(log.Fields{
+		"method": "DeleteWithFilters",
+		"result": len(ids),
+	}).Info()
+	return ids, nil
+}
+
+// ListWithFilters lists the proxies matched by filter in the order of orders, the orders after the first one
+// break ties of the ones before, ties of all of them are in the order of the keys of proxies.
+// Only the values of fields are kept, all of them if fields is empty
+func (s *MemoryProxyStore) ListWithFilters(ctx context.Context, pager *common.Paginator[model.Proxy], filter *pb.Filter, fields []string, orders ...*pb.PropertyOrder) error {
+	matcher, err := s.createMatcherFromFilter(filter)
+	if err != nil {
+		return err
+	}
+	less, err := s.createLessFromOrders(orders)
+	if err != nil {
+		return err
+	}
+	keys, err := listKeys(fields)
+	if err != nil {
+		return err
+	}
+	s.lock()
+	defer s.mu.Unlock()
+	matched := s.match(matcher)
+	sort.SliceStable(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+	start := min(max(pager.Offset, 0), int64(len(matched)))
+	end := min(start+max(pager.Limit, 0), int64(len(matched)))
+	var ret_proxies []model.Proxy
+	for _, m := range matched[start:end] {
+		proxy := m.proxy()
+		if len(keys) > 0 {
+			if proxy, err = maskProxy(proxy, keys); err != nil {
+				return err
+			}
+		}
+		ret_proxies = append(ret_proxies, proxy)
+	}
+	pager.Total = int64(len(matched))
+	pager.Count = int64(len(ret_proxies))
+	pager.Items = ret_proxies
+	return nil
+}
+
+// poolStats reduces proxies as stats_reducers do, values missing are left out of the averages and quantiles
+func (s *MemoryProxyStore) poolStats(proxies []*memoryProxy) model.PoolStats {
+	stats := model.PoolStats{Count: int64(len(proxies))}
+	var latencies []float64
+	var stability_sum float64
+	stability_count := 0
+	for _, m := range proxies {
+		if v, ok := s.numericValue(m.values, "latency"); ok {
+			latencies = append(latencies, v)
+		}
+		if v, ok := s.numericValue(m.values, "stability"); ok {
+			stability_sum += v
+			stability_count++
+		}
+	}
+	if stability_count > 0 {
+		stats.AvgStability = stability_sum / float64(stability_count)
+	}
+	if len(latencies) < 1 {
+		return stats
+	}
+	sort.Float64s(latencies)
+	var latency_sum float64
+	for _, v := range latencies {
+		latency_sum += v
+	}
+	quantile := func(q float64) float64 {
+		rank := int(math.Ceil(q*float64(len(latencies)))) - 1
+		return latencies[min(max(rank, 0), len(latencies)-1)]
+	}
+	stats.AvgLatency = latency_sum / float64(len(latencies))
+	stats.MinLatency = latencies[0]
+	stats.MaxLatency = latencies[len(latencies)-1]
+	stats.P50Latency = quantile(0.5)
+	stats.P90Latency = quantile(0.9)
+	stats.P99Latency = quantile(0.99)
+	return stats
+}
+
+// Stats aggregates the proxies matched by filter as a whole and grouped by each of group_by,
+// StatsProperties are grouped by if group_by is empty. Groups of a property are in the order of their values
+func (s *MemoryProxyStore) Stats(ctx context.Context, filter *pb.Filter, group_by ...string) (*model.PoolStats, []model.PoolStatsGroup, error) {
+	matcher, err := s.createMatcherFromFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(group_by) < 1 {
+		group_by = StatsProperties
+	}
+	for _, property := range group_by {
+		if _, ok := s.kinds[property]; !ok {
+			return nil, nil, errors.WithStack(fmt.Errorf("%w: property %s is not indexed", InvalidFilterError, property))
+		}
+	}
+	s.lock()
+	defer s.mu.Unlock()
+	matched := s.match(matcher)
+	total := s.poolStats(matched)
+	var groups []model.PoolStatsGroup
+	for _, property := range group_by {
+		members := make(map[string][]*memoryProxy)
+		for _, m := range matched {
+			var values []string
+			if s.kinds[property] == redisearch.SCHEMA_KIND_NUMERIC {
+				if v, ok := s.numericValue(m.values, property); ok {
+					values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+				}
+			} else {
+				values = s.tagValues(m.values, property)
+			}
+			for _, value := range values {
+				members[value] = append(members[value], m)
+			}
+		}
+		values := make([]string, 0, len(members))
+		for value := range members {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			groups = append(groups, model.PoolStatsGroup{Property: property, Value: value, Stats: s.poolStats(members[value])})
+		}
+	}
+	return &total, groups, nil
+}
+
+// AddCheckResult records result of the proxy and sets its stability over the results recorded, which is returned
+func (s *MemoryProxyStore) AddCheckResult(ctx context.Context, id string, result model.CheckResult) (float64, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	m, ok := s.getById(id)
+	if !ok {
+		return 0, errors.WithStack(ProxyNotFoundError)
+	}
+	results := append([]model.CheckResult{result}, s.histories[id]...)
+	if len(results) > history_size {
+		results = results[:history_size]
+	}
+	s.histories[id] = results
+	stability := model.Stability(results)
+	doc := m.document()
+	if doc.Attr == nil {
+		doc.Attr = &model.Attr{}
+	}
+	doc.Attr.Stability = stability
+	if err := s.put(m.key, doc, m.expire_at); err != nil {
+		return 0, err
+	}
+	return stability, nil
+}
+
+// ListCheckResults lists at most limit of the latest check results of the proxy, newest first,
+// all of them if limit is not positive, with the stability over all of them
+func (s *MemoryProxyStore) ListCheckResults(ctx context.Context, id string, limit int) ([]model.CheckResult, float64, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	if _, ok := s.getById(id); !ok {
+		return nil, 0, errors.WithStack(ProxyNotFoundError)
+	}
+	results := s.histories[id]
+	stability := model.Stability(results)
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return append([]model.CheckResult{}, results...), stability, nil
+}
+
+func holdersKey(proxy_id string, scope string) string {
+	return strings.Join([]string{proxy_id, scope}, sep)
+}
+
+// Acquire leases the least recently leased proxy matched by filter which could be held for the lease,
+// it fails with ProxyNotFoundError if no proxy is matched, or LeaseUnavailableError if all of them are held exclusively
+func (s *MemoryProxyStore) Acquire(ctx context.Context, filter *pb.Filter, duration time.Duration, exclusive bool, scope string, consumer string) (*model.Lease, error) {
+	matcher, err := s.createMatcherFromFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	less, err := s.createLessFromOrders([]*pb.PropertyOrder{{Property: &pb.PropertyReference{Name: "leased_at"}}})
+	if err != nil {
+		return nil, err
+	}
+	s.lock()
+	defer s.mu.Unlock()
+	s.expireLeases()
+	matched := s.match(matcher)
+	if len(matched) < 1 {
+		return nil, errors.WithStack(ProxyNotFoundError)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+	for _, m := range matched {
+		proxy := m.proxy()
+		key := holdersKey(proxy.Id, scope)
+		holders := s.holders[key]
+		held_exclusively := false
+		for id := range holders {
+			if s.leases[id].Exclusive {
+				held_exclusively = true
+				break
+			}
+		}
+		if held_exclusively || (exclusive && len(holders) > 0) {
+			continue
+		}
+		now := s.now()
+		lease := model.Lease{
+			Id:         uuid.New().String(),
+			ProxyId:    proxy.Id,
+			Proxy:      &proxy,
+			Scope:      scope,
+			Consumer:   consumer,
+			Exclusive:  exclusive,
+			AcquiredAt: now,
+			ExpiredAt:  now.Add(duration),
+		}
+		s.leases[lease.Id] = lease
+		if holders == nil {
+			holders = make(map[string]bool)
+			s.holders[key] = holders
+		}
+		holders[lease.Id] = true
+		doc := m.document()
+		doc.Lease.LeasedAt = now.UnixMilli()
+		if err := s.put(m.key, doc, m.expire_at); err != nil {
+			return nil, err
+		}
+		return &lease, nil
+	}
+	return nil, errors.WithStack(LeaseUnavailableError)
+}
+
+// expireLeases drops the leases expired from their holders
+func (s *MemoryProxyStore) expireLeases() {
+	now := s.now()
+	for id, lease := range s.leases {
+		if lease.ExpiredAt.After(now) {
+			continue
+		}
+		delete(s.leases, id)
+		key := holdersKey(lease.ProxyId, lease.Scope)
+		delete(s.holders[key], id)
+		if len(s.holders[key]) < 1 {
+			delete(s.holders, key)
+		}
+	}
+}
+
+// Release releases the lease and counts outcome for its proxy, outcome is skipped if unspecified
+func (s *MemoryProxyStore) Release(ctx context.Context, id string, outcome model.LEASE_OUTCOME) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.expireLeases()
+	lease, ok := s.leases[id]
+	if !ok {
+		return errors.WithStack(LeaseNotFoundError)
+	}
+	delete(s.leases, id)
+	key := holdersKey(lease.ProxyId, lease.Scope)
+	delete(s.holders[key], id)
+	if len(s.holders[key]) < 1 {
+		delete(s.holders, key)
+	}
+	//the outcome is counted in the lease of the proxy document as ProxyStore does, it's gone with the proxy
+	m, ok := s.getById(lease.ProxyId)
+	if !ok {
+		return nil
+	}
+	doc := m.document()
+	switch outcome {
+	case model.LEASE_OUTCOME_SUCCESS:
+		doc.Lease.Success++
+	case model.LEASE_OUTCOME_FAILURE:
+		doc.Lease.Failure++
+	default:
+		return nil
+	}
+	return s.put(m.key, doc, m.expire_at)
+}
+
+// Watch sends the events published to the store after it returns until ctx is done,
+// events are dropped for a watcher which falls behind by more than memory_watch_buffer of them
+func (s *MemoryProxyStore) Watch(ctx context.Context, events ...event.Event) (<-chan ProxyEvent, error) {
+	if len(events) < 1 {
+		events = ProxyEvents
+	}
+	watcher := &memoryWatcher{events: make(map[event.Event]bool, len(events)), ch: make(chan ProxyEvent, memory_watch_buffer)}
+	for _, e := range events {
+		watcher.events[e] = true
+	}
+	s.mu.Lock()
+	s.watchers[watcher] = true
+	s.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, watcher)
+		close(watcher.ch)
+	}()
+	return watcher.ch, nil
+}
+
+// WatchExpiry publishes the expiry of proxies as soon as they expire and enables the proxies whose unavailability is over
+// until ctx is done, without it both are done once the store is accessed
+func (s *MemoryProxyStore) WatchExpiry(ctx context.Context) error {
+	ticker := time.NewTicker(memory_expiry_interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.lock()
+			s.mu.Unlock()
+		}
+	}
+}
+
+func NewMemoryProxyStore(option ...StoreOption) *MemoryProxyStore {
+	var _option StoreOption
+	if len(option) == 0 {
+		_option = DefaultStoreOption
+	} else {
+		_option = option[0]
+	}
+	logger := log.WithFields(
+		log.Fields{
+			"class": "MemoryProxyStore",
+		})
+	fields := make(map[string]string, len(_option.Schemas))
+	kinds := make(map[string]redisearch.SchemaKind, len(_option.Schemas))
+	sortable := make(map[string]bool)
+	for _, schema := range _option.Schemas {
+		fields[schema.Name()] = schema.Field()
+		kinds[schema.Name()] = schema.Kind()
+		if schema.Sortable() {
+			sortable[schema.Name()] = true
+		}
+	}
+	return &MemoryProxyStore{
+		proxies:   make(map[string]*memoryProxy),
+		leases:    make(map[string]model.Lease),
+		holders:   make(map[string]map[string]bool),
+		histories: make(map[string][]model.CheckResult),
+		disabled:  make(map[string]time.Time),
+		watchers:  make(map[*memoryWatcher]bool),
+		fields:    fields,
+		kinds:     kinds,
+		sortable:  sortable,
+		now:       time.Now,
+		logger:    logger,
+	}
+}
@@ -0,0 +1,582 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/common"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+
+	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMemoryProxyStore(t *testing.T) *MemoryProxyStore {
+	store := NewMemoryProxyStore()
+	checked_at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	proxies := []model.Proxy{
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.1", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}, CheckedAt: &checked_at,
+			Attr: &model.Attr{Latency: 100, Stability: 0.9, Availiable: true, Country: "US", Latitude: 40.75, Longitude: -73.98}},
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.2", Port: 8080, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP, model.PROTO_HTTPS},
+			Attr: &model.Attr{Latency: 300, Stability: 0.5, Country: "FR", Latitude: 48.85, Longitude: 2.35}},
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.3", Port: 3128, Ttl: -1, Proto: []model.PROTO{model.PROTO_SOCKET},
+			Attr: &model.Attr{Latency: 200, Availiable: true, Country: "US"}},
+	}
+	for i := range proxies {
+		if _, err := store.Add(context.Background(), &proxies[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestMemoryProxyStoreListWithFilters(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	prop := func(name string, op pb.PropertyFilter_Operator, value string) *pb.Filter {
+		return &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+			Property: &pb.PropertyReference{Name: name}, Op: op, Value: value,
+		}}}
+	}
+	compo := func(op pb.CompositeFilter_Operator, filters ...*pb.Filter) *pb.Filter {
+		return &pb.Filter{FilterType: &pb.Filter_CompositeFilter{CompositeFilter: &pb.CompositeFilter{Op: op, Filters: filters}}}
+	}
+	order := func(name string, direction pb.PropertyOrder_Direction) *pb.PropertyOrder {
+		return &pb.PropertyOrder{Property: &pb.PropertyReference{Name: name}, Direction: direction}
+	}
+	type input struct {
+		filter *pb.Filter
+		orders []*pb.PropertyOrder
+	}
+	// list returns the ips of the proxies listed, proxies are listed by their keys, which are ids, unless ordered
+	list := func(in input) ([]string, int64, error) {
+		pager := common.Paginator[model.Proxy]{Limit: 10}
+		if err := store.ListWithFilters(context.Background(), &pager, in.filter, nil, in.orders...); err != nil {
+			return nil, 0, err
+		}
+		ips := []string{}
+		for _, p := range pager.Items {
+			ips = append(ips, p.Ip)
+		}
+		if len(in.orders) < 1 {
+			sort.Strings(ips)
+		}
+		return ips, pager.Total, nil
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Memory.Filter.None",
+			Input:    input{nil, nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Tag",
+			Input:    input{prop("country", pb.PropertyFilter_EQUAL, "us"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1", "192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Tag.Array",
+			Input:    input{prop("proto", pb.PropertyFilter_EQUAL, "PROTO_HTTPS"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.2"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Tag.NotEqual",
+			Input:    input{prop("available", pb.PropertyFilter_NOT_EQUAL, "true"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.2"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Numeric",
+			Input:    input{prop("latency", pb.PropertyFilter_LESS_THAN, "300"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1", "192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Numeric.Missing",
+			Input:    input{prop("stability", pb.PropertyFilter_NOT_EQUAL, "0.5"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1", "192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Time",
+			Input:    input{prop("checked_at", pb.PropertyFilter_GREATER_THAN_OR_EQUAL, "2024-01-01T00:00:00Z"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Geo",
+			Input:    input{prop("loc", pb.PropertyFilter_GEO_RADIUS, "-74 40.7 10 km"), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.And",
+			Input:    input{compo(pb.CompositeFilter_AND, prop("country", pb.PropertyFilter_EQUAL, "US"), prop("port", pb.PropertyFilter_GREATER_THAN, "80")), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Or",
+			Input:    input{compo(pb.CompositeFilter_OR, prop("country", pb.PropertyFilter_EQUAL, "FR"), prop("port", pb.PropertyFilter_EQUAL, "80")), nil},
+			Error:    nil,
+			Expected: []string{"192.0.2.1", "192.0.2.2"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Order",
+			Input:    input{nil, []*pb.PropertyOrder{order("latency", pb.PropertyOrder_DESCENDING)}},
+			Error:    nil,
+			Expected: []string{"192.0.2.2", "192.0.2.3", "192.0.2.1"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Order.Missing",
+			Input:    input{nil, []*pb.PropertyOrder{order("stability", pb.PropertyOrder_ASCENDING)}},
+			Error:    nil,
+			Expected: []string{"192.0.2.2", "192.0.2.1", "192.0.2.3"},
+			Check: func(tc test.TestCase[any, any]) {
+				ips, total, err := list(tc.Input.(input))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, ips)
+				assert.Equal(t, int64(len(ips)), total)
+			},
+		},
+		{
+			Name:     "Memory.Filter.Unknown",
+			Input:    input{prop("color", pb.PropertyFilter_EQUAL, "red"), nil},
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, _, err := list(tc.Input.(input))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Memory.Order.NotSortable",
+			Input:    input{nil, []*pb.PropertyOrder{order("country", pb.PropertyOrder_ASCENDING)}},
+			Error:    InvalidOrderError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, _, err := list(tc.Input.(input))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestMemoryProxyStoreUpdate(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.2", &proxy))
+	assert.Nil(t, store.Update(ctx, proxy.Id, model.Proxy{Attr: &model.Attr{Latency: 50}}, []string{"attr"}))
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, true, time.Time{}))
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	//attr is merged
+	assert.Equal(t, int64(50), proxy.Attr.Latency)
+	assert.Equal(t, "FR", proxy.Attr.Country)
+	assert.True(t, proxy.Attr.Availiable)
+	//the index is refreshed
+	pager := common.Paginator[model.Proxy]{Limit: 10}
+	filter := &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "latency"}, Op: pb.PropertyFilter_LESS_THAN, Value: "100",
+	}}}
+	assert.Nil(t, store.ListWithFilters(ctx, &pager, filter, nil))
+	assert.Equal(t, int64(1), pager.Total)
+	assert.Equal(t, proxy.Id, pager.Items[0].Id)
+	assert.ErrorIs(t, store.Update(ctx, "missing", model.Proxy{}, []string{"attr"}), ProxyNotFoundError)
+}
+
+func TestMemoryProxyStoreListFields(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.1", &proxy))
+	assert.Nil(t, store.Update(ctx, proxy.Id, model.Proxy{UseConfig: &model.UseConfig{User: "user", Password: "pass"}}, []string{"use_config"}))
+	filter := &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "ip"}, Op: pb.PropertyFilter_EQUAL, Value: "192.0.2.1",
+	}}}
+	list := func(fields []string) (*model.Proxy, error) {
+		pager := common.Paginator[model.Proxy]{Limit: 10}
+		if err := store.ListWithFilters(ctx, &pager, filter, fields); err != nil {
+			return nil, err
+		}
+		assert.Equal(t, int64(1), pager.Count)
+		return &pager.Items[0], nil
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Memory.Fields.All",
+			Input:    []string(nil),
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := list(tc.Input.([]string))
+				assert.Nil(t, err)
+				assert.NotNil(t, p.UseConfig)
+				assert.NotNil(t, p.Attr)
+				assert.Equal(t, int64(80), p.Port)
+			},
+		},
+		{
+			Name:     "Memory.Fields.Mask",
+			Input:    []string{"id", "ip", "port", "checked_at"},
+			Error:    nil,
+			Expected: model.Proxy{Id: proxy.Id, Ip: "192.0.2.1", Port: 80, CheckedAt: proxy.CheckedAt},
+			Check: func(tc test.TestCase[any, any]) {
+				p, err := list(tc.Input.([]string))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, *p)
+			},
+		},
+		{
+			Name:     "Memory.Fields.Unknown",
+			Input:    []string{"id", "color"},
+			Error:    InvalidFieldError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := list(tc.Input.([]string))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+	//the values FT.SEARCH returns for the paths of fields are strings unquoted and the others in JSON
+	keys, _ := listKeys([]string{"id", "port", "proto", "expire_time"})
+	returned, err := proxyFromAttributes(map[string]string{"$.id": "1", "$.port": "8080", "$.proto": `["PROTO_HTTP"]`, "$.expired_at": "2024-01-01T00:00:00Z"}, keys)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", returned.Id)
+	assert.Equal(t, int64(8080), returned.Port)
+	assert.Equal(t, []model.PROTO{model.PROTO_HTTP}, returned.Proto)
+	assert.NotNil(t, returned.ExpiredAt)
+}
+
+func TestMemoryProxyStoreExpiry(t *testing.T) {
+	store := NewMemoryProxyStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := store.Watch(ctx, event.EVENT_PROXY_CREATED, event.EVENT_PROXY_EXPIRED)
+	assert.Nil(t, err)
+	proxy := model.Proxy{ProviderId: "p", ApiId: "a", Ip: "192.0.2.1", Port: 80, Ttl: 60}
+	_, err = store.Add(ctx, &proxy)
+	assert.Nil(t, err)
+	now = now.Add(time.Minute)
+	exists, _ := store.ExistsId(ctx, proxy.Id)
+	assert.False(t, exists)
+	for _, expected := range []event.Event{event.EVENT_PROXY_CREATED, event.EVENT_PROXY_EXPIRED} {
+		select {
+		case e := <-events:
+			assert.Equal(t, expected, e.Type)
+			assert.Equal(t, proxy.Id, e.Proxy.Id)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s", expected)
+		}
+	}
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	//the expiry outdated by adding the proxy again is skipped
+	proxy.Ttl = 60
+	_, err = store.Add(context.Background(), &proxy)
+	assert.Nil(t, err)
+	now = now.Add(30 * time.Second)
+	_, err = store.Add(context.Background(), &proxy)
+	assert.Nil(t, err)
+	now = now.Add(30 * time.Second)
+	exists, _ = store.ExistsId(context.Background(), proxy.Id)
+	assert.True(t, exists)
+	now = now.Add(30 * time.Second)
+	exists, _ = store.ExistsId(context.Background(), proxy.Id)
+	assert.False(t, exists)
+}
+
+func TestMemoryProxyStoreLease(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	filter := &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "country"}, Op: pb.PropertyFilter_EQUAL, Value: "US",
+	}}}
+	first, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c1")
+	assert.Nil(t, err)
+	second, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c2")
+	assert.Nil(t, err)
+	//the exclusive leases are on different proxies
+	assert.NotEqual(t, first.ProxyId, second.ProxyId)
+	_, err = store.Acquire(ctx, filter, time.Minute, false, "crawler", "c3")
+	assert.ErrorIs(t, err, LeaseUnavailableError)
+	//the leases of other scopes are granted
+	_, err = store.Acquire(ctx, filter, time.Minute, false, "checker", "c4")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Release(ctx, first.Id, model.LEASE_OUTCOME_SUCCESS))
+	assert.ErrorIs(t, store.Release(ctx, first.Id, model.LEASE_OUTCOME_SUCCESS), LeaseNotFoundError)
+	third, err := store.Acquire(ctx, filter, time.Minute, false, "crawler", "c3")
+	assert.Nil(t, err)
+	assert.Equal(t, first.ProxyId, third.ProxyId)
+	//the lease order is kept by upserts
+	m, _ := store.getById(third.ProxyId)
+	leased_at := m.document().Lease.LeasedAt
+	assert.NotZero(t, leased_at)
+	var proxy model.Proxy
+	assert.Nil(t, store.GetById(ctx, third.ProxyId, &proxy))
+	_, err = store.AddBatch(ctx, []model.Proxy{proxy}, true)
+	assert.Nil(t, err)
+	m, _ = store.getById(third.ProxyId)
+	assert.Equal(t, leased_at, m.document().Lease.LeasedAt)
+}
+
+func TestMemoryProxyStoreLeaseOutcomes(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.3", &proxy))
+	assert.Nil(t, proxy.LeaseOutcomes)
+	filter := &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "ip"}, Op: pb.PropertyFilter_EQUAL, Value: "192.0.2.3",
+	}}}
+	for _, outcome := range []model.LEASE_OUTCOME{model.LEASE_OUTCOME_SUCCESS, model.LEASE_OUTCOME_SUCCESS, model.LEASE_OUTCOME_FAILURE, model.LEASE_OUTCOME_UNSPECIFIED} {
+		lease, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c1")
+		assert.Nil(t, err)
+		assert.Nil(t, store.Release(ctx, lease.Id, outcome))
+	}
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.Equal(t, &model.LeaseOutcomes{Success: 2, Failure: 1}, proxy.LeaseOutcomes)
+	//the outcomes are kept by upserts and listed along
+	_, err := store.AddBatch(ctx, []model.Proxy{proxy}, true)
+	assert.Nil(t, err)
+	pager := common.Paginator[model.Proxy]{Limit: 10}
+	assert.Nil(t, store.ListWithFilters(ctx, &pager, filter, nil))
+	assert.Equal(t, &model.LeaseOutcomes{Success: 2, Failure: 1}, pager.Items[0].LeaseOutcomes)
+	//the outcomes go away with the proxy, and a lease released after is counted for none
+	lease, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c1")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Delete(ctx, proxy.Id))
+	assert.Nil(t, store.Release(ctx, lease.Id, model.LEASE_OUTCOME_FAILURE))
+	proxy.LeaseOutcomes = nil
+	_, err = store.Add(ctx, &proxy)
+	assert.Nil(t, err)
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.Nil(t, proxy.LeaseOutcomes)
+}
+
+func TestMemoryProxyStoreAddBatch(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	proxies := []model.Proxy{
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.4", Port: 80, Ttl: -1},
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.4", Port: 80, Ttl: 60},
+		{ProviderId: "p", ApiId: "b", Ip: "192.0.2.1", Port: 80, Ttl: -1},
+		{ProviderId: "p", ApiId: "a", Ip: "192.0.2.1", Port: 80, Ttl: -1, Attr: &model.Attr{Country: "CA"}},
+		{ProviderId: "p", ApiId: "a", Ip: "gateway_zone", Port: -1, Ttl: -1},
+		{ProviderId: "p", ApiId: "a", Ip: "", Port: 80, Ttl: -1},
+	}
+	results, err := store.AddBatch(ctx, proxies, false)
+	assert.Nil(t, err)
+	expected := []model.ADD_RESULT{model.ADD_RESULT_CREATED, model.ADD_RESULT_ALREADY_EXISTS, model.ADD_RESULT_CREATED, model.ADD_RESULT_ALREADY_EXISTS, model.ADD_RESULT_CREATED, model.ADD_RESULT_INVALID}
+	for i, result := range results {
+		assert.Equal(t, expected[i], result.Result)
+	}
+	results, err = store.AddBatch(ctx, proxies[3:4], true)
+	assert.Nil(t, err)
+	assert.Equal(t, model.ADD_RESULT_UPDATED, results[0].Result)
+	var proxy model.Proxy
+	assert.Nil(t, store.GetById(ctx, results[0].Id, &proxy))
+	assert.Equal(t, "CA", proxy.Attr.Country)
+	//the proxies of an ip served by several apis coexist
+	pager := common.Paginator[model.Proxy]{Limit: 10}
+	filter := &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "ip"}, Op: pb.PropertyFilter_EQUAL, Value: "192.0.2.1",
+	}}}
+	assert.Nil(t, store.ListWithFilters(ctx, &pager, filter, nil))
+	assert.Equal(t, int64(2), pager.Total)
+}
+
+func TestMemoryProxyStoreStats(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	total, groups, err := store.Stats(context.Background(), nil, "country")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), total.Count)
+	assert.Equal(t, float64(200), total.AvgLatency)
+	assert.Equal(t, float64(100), total.MinLatency)
+	assert.Equal(t, float64(300), total.MaxLatency)
+	assert.Equal(t, 0.7, total.AvgStability)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "FR", groups[0].Value)
+	assert.Equal(t, "US", groups[1].Value)
+	assert.Equal(t, int64(2), groups[1].Stats.Count)
+	assert.Equal(t, float64(100), groups[1].Stats.P50Latency)
+	_, _, err = store.Stats(context.Background(), nil, "color")
+	assert.ErrorIs(t, err, InvalidFilterError)
+}
+
+func TestMemoryProxyStoreHistory(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.3", &proxy))
+	now := time.Now()
+	for i := 0; i < history_size+10; i++ {
+		result := model.CheckResult{CheckedAt: now.Add(time.Duration(i) * time.Minute), Dialable: true, Latency: 100}
+		if i%4 == 0 {
+			result = model.CheckResult{CheckedAt: result.CheckedAt, Error: "i/o timeout"}
+		}
+		_, err := store.AddCheckResult(ctx, proxy.Id, result)
+		assert.Nil(t, err)
+	}
+	//the latest results come first
+	results, stability, err := store.ListCheckResults(ctx, proxy.Id, 5)
+	assert.Nil(t, err)
+	assert.Len(t, results, 5)
+	assert.True(t, results[0].CheckedAt.Equal(now.Add(time.Duration(history_size+9)*time.Minute)))
+	assert.Equal(t, 0.75, stability)
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.Equal(t, 0.75, proxy.Attr.Stability)
+	assert.Nil(t, store.Delete(ctx, proxy.Id))
+	_, _, err = store.ListCheckResults(ctx, proxy.Id, 0)
+	assert.ErrorIs(t, err, ProxyNotFoundError)
+	_, err = store.AddCheckResult(ctx, proxy.Id, model.CheckResult{})
+	assert.ErrorIs(t, err, ProxyNotFoundError)
+}
+
+func TestMemoryProxyStoreSetAvailableUntil(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.1", &proxy))
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, false, now.Add(time.Minute)))
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.False(t, proxy.Attr.Availiable)
+	//the proxy is made available again once until is passed
+	now = now.Add(time.Minute)
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.True(t, proxy.Attr.Availiable)
+	//a proxy made unavailable without until or available in between isn't made available by the schedule
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, false, time.Time{}))
+	now = now.Add(time.Hour)
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.False(t, proxy.Attr.Availiable)
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, false, now.Add(time.Minute)))
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, true, time.Time{}))
+	assert.Nil(t, store.SetAvailable(ctx, proxy.Id, false, time.Time{}))
+	now = now.Add(time.Minute)
+	assert.Nil(t, store.GetById(ctx, proxy.Id, &proxy))
+	assert.False(t, proxy.Attr.Availiable)
+}
+
+func TestMemoryProxyStoreDelete(t *testing.T) {
+	store := newTestMemoryProxyStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := store.Watch(ctx, event.EVENT_PROXY_DELETED)
+	assert.Nil(t, err)
+	country := func(value string) *pb.Filter {
+		return &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+			Property: &pb.PropertyReference{Name: "country"}, Op: pb.PropertyFilter_EQUAL, Value: value,
+		}}}
+	}
+	//a filter matching no field is refused rather than dropping the whole pool
+	for _, filter := range []*pb.Filter{nil, {}} {
+		_, err := store.DeleteWithFilters(ctx, filter)
+		assert.ErrorIs(t, err, EmptyFilterError)
+	}
+	var first, third model.Proxy
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.1", &first))
+	assert.Nil(t, store.GetByIp(ctx, "192.0.2.3", &third))
+	_, err = store.AddCheckResult(ctx, first.Id, model.CheckResult{CheckedAt: time.Now(), Dialable: true, Latency: 100})
+	assert.Nil(t, err)
+	ids, err := store.DeleteWithFilters(ctx, country("US"))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{first.Id, third.Id}, ids)
+	for range ids {
+		e := <-events
+		assert.Contains(t, ids, e.Proxy.Id)
+	}
+	exists, _ := store.ExistsIp(ctx, "192.0.2.2")
+	assert.True(t, exists)
+	ids, err = store.DeleteWithFilters(ctx, country("US"))
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	//the history goes away with the proxy
+	first.Id = ""
+	_, err = store.Add(ctx, &first)
+	assert.Nil(t, err)
+	results, _, err := store.ListCheckResults(ctx, first.Id, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, results)
+	assert.Nil(t, store.Delete(ctx, first.Id))
+	assert.ErrorIs(t, store.Delete(ctx, first.Id), ProxyNotFoundError)
+}
@@ -5,6 +5,8 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,6 +37,7 @@ func (p *Proxy) UnmarshalBinary(data []byte) error {
 
 type StoreOption struct {
 	Schemas []redisearch.Schema //index for Cache Store
+	Version int                 //version of Schemas, bump it whenever they change so that the index is migrated
 }
 type SetOp = string
 
@@ -53,52 +56,176 @@ var DefaultSetOption = SetOption{
 
 var (
 	DefaultStoreOption StoreOption = StoreOption{
+		Version: 2,
 		Schemas: []redisearch.Schema{
 			redisearch.NewSchema("proto", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("proto")),
 			redisearch.NewSchema("status", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("status")),
 			redisearch.NewSchema("attr.tags", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("tags")),
 			redisearch.NewSchema("id", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("id")),
 			redisearch.NewSchema("ip", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("ip")),
+			redisearch.NewSchema("attr.exit_ip", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("exit_ip")),
+			redisearch.NewSchema("provider", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("provider")),
+			redisearch.NewSchema("api", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("api")),
+			redisearch.NewSchema("api_id", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("api_id")),
+			redisearch.NewSchema("attr.country", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("country")),
+			redisearch.NewSchema("attr.city", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("city")),
+			redisearch.NewSchema("attr.region", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("region")),
+			redisearch.NewSchema("attr.organization", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("organization")),
+			redisearch.NewSchema("index.available", redisearch.SCHEMA_KIND_TAG, redisearch.AliasSchemaOption("available")),
+			redisearch.NewSchema("attr.stability", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("stability"), redisearch.SortableSchemaOption()),
+			redisearch.NewSchema("port", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("port"), redisearch.SortableSchemaOption()),
+			redisearch.NewSchema("ttl", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("ttl"), redisearch.SortableSchemaOption()),
+			//attr.latency is stored as string and timestamps as RFC3339, so their numbers are indexed from $.index
+			redisearch.NewSchema("index.latency", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("latency"), redisearch.SortableSchemaOption()),
+			redisearch.NewSchema("index.checked_at", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("checked_at"), redisearch.SortableSchemaOption()),
+			redisearch.NewSchema("index.created_at", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("created_at"), redisearch.SortableSchemaOption()),
+			redisearch.NewSchema("index.location", redisearch.SCHEMA_KIND_GEO, redisearch.AliasSchemaOption("loc")),
+			redisearch.NewSchema("lease.leased_at", redisearch.SCHEMA_KIND_NUMERIC, redisearch.AliasSchemaOption("leased_at"), redisearch.SortableSchemaOption()),
 		},
 	}
+	// StatsProperties are the properties pool stats could be grouped by
+	StatsProperties    = []string{"provider", "api", "country", "status", "proto", "available"}
 	ProxyNotFoundError = errors.New("proxy not found")
+	EmptyFilterError   = errors.New("filter matches no field")
+	InvalidFilterError = errors.New("invalid filter")
+	InvalidOrderError  = errors.New("invalid order")
+	InvalidFieldError  = errors.New("invalid field")
+	InvalidProxyError  = errors.New("invalid proxy")
 )
 
-func createFieldFromFilter(filter *pb.Filter) redisearch.Field {
+// time properties are indexed as unix seconds, and filtered by unix seconds, RFC3339 or a duration relative to now like `-10m`
+var time_properties = map[string]bool{
+	"checked_at": true,
+	"created_at": true,
+}
+
+func parseNumeric(name string, value string) (float64, error) {
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v, nil
+	}
+	if time_properties[name] {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return float64(t.Unix()), nil
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return float64(time.Now().Add(d).Unix()), nil
+		}
+	}
+	return 0, errors.WithStack(fmt.Errorf("%w: value %s of %s is not a number", InvalidFilterError, value, name))
+}
+
+// parseGeoRadius parses a circle formatted as `longitude latitude radius unit`, unit defaults to km
+func parseGeoRadius(name string, value string) (redisearch.GeoValue, error) {
+	parts := strings.Fields(value)
+	invalid := errors.WithStack(fmt.Errorf("%w: value %s of %s is not formatted as `longitude latitude radius unit`", InvalidFilterError, value, name))
+	if len(parts) != 3 && len(parts) != 4 {
+		return redisearch.GeoValue{}, invalid
+	}
+	var nums [3]float64
+	for i := range nums {
+		v, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return redisearch.GeoValue{}, invalid
+		}
+		nums[i] = v
+	}
+	if nums[0] < -180 || nums[0] > 180 || nums[1] < -85.05112878 || nums[1] > 85.05112878 || nums[2] <= 0 {
+		return redisearch.GeoValue{}, invalid
+	}
+	unit := redisearch.GEO_UNIT_KM
+	if len(parts) == 4 {
+		unit = redisearch.GeoUnit(strings.ToLower(parts[3]))
+		switch unit {
+		case redisearch.GEO_UNIT_M, redisearch.GEO_UNIT_KM, redisearch.GEO_UNIT_MI, redisearch.GEO_UNIT_FT:
+		default:
+			return redisearch.GeoValue{}, invalid
+		}
+	}
+	return redisearch.NewGeoValue(nums[0], nums[1], nums[2], unit), nil
+}
+
+func createFieldFromFilter(filter *pb.Filter, kinds map[string]redisearch.SchemaKind) (redisearch.Field, error) {
 	if filter == nil {
-		return nil
+		return nil, nil
+	}
+	create_numeric_filter := func(f *pb.PropertyFilter) (redisearch.Field, error) {
+		name := f.GetProperty().GetName()
+		v, err := parseNumeric(name, f.GetValue())
+		if err != nil {
+			return nil, err
+		}
+		var value redisearch.NumericValue
+		switch f.Op {
+		case pb.PropertyFilter_EQUAL, pb.PropertyFilter_IN, pb.PropertyFilter_NOT_EQUAL, pb.PropertyFilter_NOT_IN:
+			value = redisearch.NewNumericRangeValue(v, false, v, false)
+		case pb.PropertyFilter_LESS_THAN:
+			value = redisearch.NewNumericRangeValue(math.Inf(-1), false, v, true)
+		case pb.PropertyFilter_LESS_THAN_OR_EQUAL:
+			value = redisearch.NewNumericRangeValue(math.Inf(-1), false, v, false)
+		case pb.PropertyFilter_GREATER_THAN:
+			value = redisearch.NewNumericRangeValue(v, true, math.Inf(1), false)
+		case pb.PropertyFilter_GREATER_THAN_OR_EQUAL:
+			value = redisearch.NewNumericRangeValue(v, false, math.Inf(1), false)
+		default:
+			return nil, nil
+		}
+		field := redisearch.NewNumericField(name, value)
+		if f.Op == pb.PropertyFilter_NOT_EQUAL || f.Op == pb.PropertyFilter_NOT_IN {
+			return redisearch.NewFieldOperatorNot(field), nil
+		}
+		return field, nil
 	}
-	create_prop_filter := func(f *pb.PropertyFilter) redisearch.Field {
+	create_prop_filter := func(f *pb.PropertyFilter) (redisearch.Field, error) {
 		if f == nil {
-			return nil
+			return nil, nil
 		}
 		name := f.GetProperty().GetName()
+		kind, ok := kinds[name]
+		if !ok {
+			return nil, errors.WithStack(fmt.Errorf("%w: property %s is not indexed", InvalidFilterError, name))
+		}
+		if kind == redisearch.SCHEMA_KIND_GEO || f.Op == pb.PropertyFilter_GEO_RADIUS {
+			if kind != redisearch.SCHEMA_KIND_GEO || f.Op != pb.PropertyFilter_GEO_RADIUS {
+				return nil, errors.WithStack(fmt.Errorf("%w: operator %s is not supported by property %s", InvalidFilterError, f.Op, name))
+			}
+			value, err := parseGeoRadius(name, f.GetValue())
+			if err != nil {
+				return nil, err
+			}
+			return redisearch.NewGeoField(name, value), nil
+		}
+		if kind == redisearch.SCHEMA_KIND_NUMERIC {
+			return create_numeric_filter(f)
+		}
 		value := redisearch.NewStringValue(f.GetValue())
 		if f.Op == pb.PropertyFilter_EQUAL {
-			return redisearch.NewTagField(name, value)
+			return redisearch.NewTagField(name, value), nil
 		} else if f.Op == pb.PropertyFilter_NOT_EQUAL {
 			value := redisearch.NewValueOperatorNot(value)
-			return redisearch.NewTagField(name, value)
+			return redisearch.NewTagField(name, value), nil
 		} else if f.Op == pb.PropertyFilter_NOT_IN {
 			value := redisearch.NewValueOperatorNot(value)
-			return redisearch.NewTagField(name, value)
+			return redisearch.NewTagField(name, value), nil
 		} else if f.Op == pb.PropertyFilter_IN {
-			return redisearch.NewTagField(name, value)
+			return redisearch.NewTagField(name, value), nil
 		}
-		return nil
+		return nil, errors.WithStack(fmt.Errorf("%w: operator %s is not supported by property %s", InvalidFilterError, f.Op, name))
 	}
-	create_compo_filter := func(f *pb.CompositeFilter) redisearch.Field {
+	create_compo_filter := func(f *pb.CompositeFilter) (redisearch.Field, error) {
 		if f == nil || f.Filters == nil || len(f.Filters) < 1 {
-			return nil
+			return nil, nil
 		}
 		var field redisearch.Field
 		for _, filter := range f.Filters {
-			next_field := createFieldFromFilter(filter)
+			next_field, err := createFieldFromFilter(filter, kinds)
+			if err != nil {
+				return nil, err
+			}
 			if next_field == nil {
 				continue
 			}
 			if field == nil {
-				field = createFieldFromFilter(filter)
+				field = next_field
 				continue
 			}
 			if f.GetOp() == pb.CompositeFilter_AND {
@@ -107,7 +234,7 @@ func createFieldFromFilter(filter *pb.Filter) redisearch.Field {
 				field = redisearch.NewFieldOperatorOr(field, next_field)
 			}
 		}
-		return field
+		return field, nil
 	}
 
 	switch filter.GetFilterType().(type) {
@@ -116,50 +243,128 @@ func createFieldFromFilter(filter *pb.Filter) redisearch.Field {
 	case *pb.Filter_CompositeFilter:
 		return create_compo_filter(filter.GetCompositeFilter())
 	default:
-		return nil
+		return nil, nil
 	}
 }
 
-const sep = ":"
-const proxy_prefix = "proxy"
+func createSortKeysFromOrders(orders []*pb.PropertyOrder, sortable map[string]bool) ([]redisearch.SortKey, error) {
+	keys := make([]redisearch.SortKey, 0, len(orders))
+	for _, order := range orders {
+		name := order.GetProperty().GetName()
+		if !sortable[name] {
+			return nil, errors.WithStack(fmt.Errorf("%w: property %s is not sortable", InvalidOrderError, name))
+		}
+		sort_order := redisearch.SORT_ORDER_ASC
+		if order.GetDirection() == pb.PropertyOrder_DESCENDING {
+			sort_order = redisearch.SORT_ORDER_DESC
+		}
+		keys = append(keys, redisearch.NewSortKey(name, sort_order))
+	}
+	return keys, nil
+}
 
-type ProxyStore struct {
-	Proxy
-	client *redis.Client
-	option StoreOption
-	logger *log.Entry
+// proxyIndex holds the values indexed from a proxy which model.Proxy doesn't store as json numbers or strings,
+// it's kept under $.index of the proxy document
+type proxyIndex struct {
+	Latency   *int64 `json:"latency,omitempty"`
+	Available string `json:"available"`
+	CheckedAt *int64 `json:"checked_at,omitempty"`
+	CreatedAt *int64 `json:"created_at,omitempty"`
+	Location  string `json:"location,omitempty"` //`longitude,latitude` as geo fields require, unlike attr.location
 }
 
-func (s *ProxyStore) initIndex() {
-	schemas := s.option.Schemas
-	if len(schemas) < 1 {
-		return
+// coordinates returns the latitude and longitude of attr, attr.location formatted as `latitude,longitude` is parsed
+// if they're not set. Coordinates out of the range redis accepts are dropped, or the document would fail to be indexed
+func coordinates(attr *model.Attr) (float64, float64, bool) {
+	valid := func(lat float64, lon float64) bool {
+		return lat >= -85.05112878 && lat <= 85.05112878 && lon >= -180 && lon <= 180
 	}
-	ctx := context.Background()
-	idx_name := "idx:proxy"
-	drop_idx := redisearch.FtDropIndex(idx_name)
-	create_idx := redisearch.FtCreate(idx_name, redisearch.FTCREATE_ON_JSON, []string{proxy_prefix + sep}, schemas)
-	ft_config := redisearch.FtConfigSet("MAXSEARCHRESULTS", "-1")
-	pipe := s.client.TxPipeline()
-	//TODO: elegant delete index
-	ft_config_cmd := pipe.Do(ctx, ft_config...)
-	drop_cmd := pipe.Do(ctx, drop_idx...)
-	create_cmd := pipe.Do(ctx, create_idx...)
-	pipe.Exec(ctx)
-	if ft_config_cmd.Err() != nil {
-		s.logger.WithField("error", ft_config_cmd.Err()).Error("failed to set config")
+	if attr.Latitude != 0 || attr.Longitude != 0 {
+		return attr.Latitude, attr.Longitude, valid(attr.Latitude, attr.Longitude)
+	}
+	parts := strings.Split(attr.Location, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lon, valid(lat, lon)
+}
+
+func newProxyIndex(proxy model.Proxy) proxyIndex {
+	index := proxyIndex{Available: strconv.FormatBool(false)}
+	if proxy.Attr != nil {
+		latency := proxy.Attr.Latency
+		index.Latency = &latency
+		index.Available = strconv.FormatBool(proxy.Attr.Availiable)
+		if lat, lon, ok := coordinates(proxy.Attr); ok {
+			index.Location = strconv.FormatFloat(lon, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+		}
 	}
-	if drop_cmd.Err() != nil {
-		s.logger.WithField("error", drop_cmd.Err()).Error("failed to drop index")
-		return
+	if proxy.CheckedAt != nil {
+		checked_at := proxy.CheckedAt.Unix()
+		index.CheckedAt = &checked_at
 	}
-	if create_cmd.Err() != nil {
-		s.logger.WithField("error", create_cmd.Err()).Error("failed to create index")
+	if proxy.CreatedAt != nil {
+		created_at := proxy.CreatedAt.Unix()
+		index.CreatedAt = &created_at
 	}
+	return index
+}
+
+type proxyDocument struct {
+	Proxy
+	Index proxyIndex `json:"index"`
+	Lease proxyLease `json:"lease"`
+}
+
+// proxy returns the proxy of the document with the outcomes of its leases
+func (doc proxyDocument) proxy() model.Proxy {
+	proxy := model.Proxy(doc.Proxy)
+	proxy.LeaseOutcomes = doc.Lease.outcomes()
+	return proxy
+}
+
+const sep = ":"
+const proxy_prefix = "proxy"
+const delete_batch_size = 500
+const add_batch_size = 500
+const gateway_port = -1
+
+// proxyKey is the key of the proxy document, proxies of different providers or apis may share an ip and port,
+// so they are keyed by id rather than by `proxy:<ip>:<port>` as they were before
+func proxyKey(id string) string {
+	return proxy_prefix + sep + id
+}
+
+// ProxyId derives the id of the proxy from its provider, api, ip and port
+func ProxyId(proxy model.Proxy) (string, error) {
+	proxy_id, err := common.GenerateUidByStrs(proxy.ProviderId, proxy.ApiId, proxy.Ip, fmt.Sprintf("%d", proxy.Port))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return *proxy_id, nil
+}
+
+type ProxyStore struct {
+	Proxy
+	client    *redis.Client
+	option    StoreOption
+	kinds     map[string]redisearch.SchemaKind //kinds of indexed properties by name
+	sortable  map[string]bool
+	publisher event.Publisher
+	logger    *log.Entry
 }
 
 func (s *ProxyStore) init() {
-	s.initIndex()
+	//searches go through the alias of the index of the last version while it's migrated
+	go s.initIndex()
 }
 
 func (s ProxyStore) GetByKey(ctx context.Context, key string, proxy *model.Proxy) error {
@@ -196,7 +401,7 @@ func (s ProxyStore) GetByIp(ctx context.Context, ip string, proxy *model.Proxy)
 		logger.WithField("error", err).Error("failed to get proxy")
 		return errors.WithStack(err)
 	}
-	search_result, err := redisearch.ParseSearchResult[Proxy](result)
+	search_result, err := redisearch.ParseSearchResult[proxyDocument](result)
 	if err != nil {
 		logger.WithField("error", err).Error("failed to get proxy")
 		return errors.WithStack(err)
@@ -204,7 +409,7 @@ func (s ProxyStore) GetByIp(ctx context.Context, ip string, proxy *model.Proxy)
 	if search_result.Total < 1 {
 		return errors.WithStack(ProxyNotFoundError)
 	}
-	*proxy = model.Proxy(search_result.Items[0].Item)
+	*proxy = search_result.Items[0].Item.proxy()
 	logger.WithField("result", proxy).Info()
 	return nil
 }
@@ -223,7 +428,7 @@ func (s ProxyStore) GetById(ctx context.Context, id string, proxy *model.Proxy)
 		logger.WithField("error", err).Error("failed to get proxy")
 		return errors.WithStack(err)
 	}
-	search_result, err := redisearch.ParseSearchResult[Proxy](result)
+	search_result, err := redisearch.ParseSearchResult[proxyDocument](result)
 	if err != nil {
 		logger.WithField("error", err).Error("failed to get proxy")
 		return errors.WithStack(err)
@@ -231,7 +436,7 @@ func (s ProxyStore) GetById(ctx context.Context, id string, proxy *model.Proxy)
 	if search_result.Total < 1 {
 		return errors.WithStack(ProxyNotFoundError)
 	}
-	*proxy = model.Proxy(search_result.Items[0].Item)
+	*proxy = search_result.Items[0].Item.proxy()
 	logger.WithField("result", proxy).Info()
 	return nil
 }
@@ -282,24 +487,24 @@ func (s ProxyStore) Add(ctx context.Context, proxy *model.Proxy, options ...SetO
 	logger := s.logger.WithFields(log.Fields{
 		"method": "Add",
 	})
-	port_str := fmt.Sprintf("%d", proxy.Port)
-	proxy_id, err := common.GenerateUidByStrs(proxy.ProviderId, proxy.ApiId, proxy.Ip, port_str)
+	proxy_id, err := ProxyId(*proxy)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
-	proxy.Id = *proxy_id
+	proxy.Id = proxy_id
 	pipe := s.client.TxPipeline()
-	proxy_key := strings.Join([]string{proxy_prefix, proxy.Ip, port_str}, sep)
+	proxy_key := proxyKey(proxy.Id)
 	p := Proxy(*proxy)
 	var (
-		add_cmd    *redis.StatusCmd
+		add_cmd    *redis.Cmd
 		expire_cmd *redis.BoolCmd
 		event_cmd  *redis.StringCmd
 	)
-	add_cmd = pipe.JSONSet(ctx, proxy_key, "$", p)
+	add_cmd = pipeDocument(ctx, pipe, proxy_key, proxyDocument{Proxy: p, Index: newProxyIndex(*proxy)})
 	if p.Ttl != -1 {
 		expire_cmd = pipe.Expire(ctx, proxy_key, time.Duration(p.Ttl)*time.Second)
 	}
+	pipeShadow(ctx, pipe, proxy_key, &p)
 	logger.WithFields(
 		log.Fields{
 			"key":   proxy_key,
@@ -312,12 +517,7 @@ func (s ProxyStore) Add(ctx context.Context, proxy *model.Proxy, options ...SetO
 	} else if setOption.Operation == SETOP_UPDATE {
 		stream = event.EVENT_PROXY_UPDATED
 	}
-	event_cmd = pipe.XAdd(ctx, &redis.XAddArgs{
-		Stream:     stream,
-		NoMkStream: false,
-		Values: map[string]interface{}{
-			"proxy": &p,
-		}})
+	event_cmd = s.publisher.PublishProxy(ctx, pipe, stream, model.Proxy(p))
 	logger.WithFields(
 		log.Fields{
 			"event": stream,
@@ -339,6 +539,147 @@ func (s ProxyStore) Add(ctx context.Context, proxy *model.Proxy, options ...SetO
 	return &proxy.Id, nil
 }
 
+// AddBatch adds proxies in chunks, the ids of a chunk are looked up by one query and the proxies are written by one pipeline.
+// Proxies whose id exists are reported as already exists unless upsert, in which case they replace the existing ones,
+// and proxies whose id appears earlier in proxies are always reported as already exists. Proxies sharing an ip
+// but served by different providers or apis have different ids, so they're stored side by side. Results are in the order of proxies
+func (s ProxyStore) AddBatch(ctx context.Context, proxies []model.Proxy, upsert bool) ([]model.AddProxyResult, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "AddBatch",
+		"param":  fmt.Sprintf("%+v", map[string]string{"proxies": fmt.Sprintf("%d", len(proxies)), "upsert": fmt.Sprintf("%t", upsert)}),
+	})
+	results := make([]model.AddProxyResult, len(proxies))
+	seen := make(map[string]int, len(proxies)) //id to the index of the first proxy of it
+	for start := 0; start < len(proxies); start += add_batch_size {
+		end := min(start+add_batch_size, len(proxies))
+		var (
+			pending []int
+			ids     []string
+		)
+		for i := start; i < end; i++ {
+			proxy := &proxies[i]
+			if err := validateProxy(*proxy); err != nil {
+				results[i] = model.AddProxyResult{Result: model.ADD_RESULT_INVALID, Message: err.Error()}
+				continue
+			}
+			proxy_id, err := ProxyId(*proxy)
+			if err != nil {
+				results[i] = model.AddProxyResult{Result: model.ADD_RESULT_INVALID, Message: err.Error()}
+				continue
+			}
+			proxy.Id = proxy_id
+			if first, ok := seen[proxy.Id]; ok {
+				results[i] = model.AddProxyResult{Result: model.ADD_RESULT_ALREADY_EXISTS, Id: proxy.Id, Message: fmt.Sprintf("proxy %s is duplicated with proxy %d of the batch", proxy.Id, first)}
+				continue
+			}
+			seen[proxy.Id] = i
+			pending = append(pending, i)
+			ids = append(ids, proxy.Id)
+		}
+		existing, err := s.getByIds(ctx, ids)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to look up proxies")
+			return results, err
+		}
+		type write struct {
+			index      int
+			result     model.ADD_RESULT
+			stream     event.Event
+			add_cmd    *redis.Cmd
+			expire_cmd *redis.BoolCmd
+			event_cmd  *redis.StringCmd
+		}
+		var writes []write
+		pipe := s.client.Pipeline()
+		for _, i := range pending {
+			p := Proxy(proxies[i])
+			proxy_key := proxyKey(p.Id)
+			w := write{index: i, result: model.ADD_RESULT_CREATED, stream: event.EVENT_PROXY_CREATED}
+			if existing[p.Id] {
+				if !upsert {
+					results[i] = model.AddProxyResult{Result: model.ADD_RESULT_ALREADY_EXISTS, Id: p.Id, Message: fmt.Sprintf("proxy %s already exists", p.Id)}
+					continue
+				}
+				w.result = model.ADD_RESULT_UPDATED
+				w.stream = event.EVENT_PROXY_UPDATED
+			}
+			w.add_cmd = pipeDocument(ctx, pipe, proxy_key, proxyDocument{Proxy: p, Index: newProxyIndex(proxies[i])})
+			if p.Ttl != -1 {
+				w.expire_cmd = pipe.Expire(ctx, proxy_key, time.Duration(p.Ttl)*time.Second)
+			}
+			pipeShadow(ctx, pipe, proxy_key, &p)
+			w.event_cmd = s.publisher.PublishProxy(ctx, pipe, w.stream, model.Proxy(p))
+			writes = append(writes, w)
+		}
+		if len(writes) < 1 {
+			continue
+		}
+		//errors are checked by command below, a failed one fails its proxy only
+		pipe.Exec(ctx)
+		for _, w := range writes {
+			id := proxies[w.index].Id
+			if w.add_cmd.Err() != nil {
+				results[w.index] = model.AddProxyResult{Result: model.ADD_RESULT_FAILED, Id: id, Message: fmt.Sprintf("failed to add proxy %s (error: %+v)", id, w.add_cmd.Err())}
+				continue
+			}
+			if w.expire_cmd != nil && w.expire_cmd.Err() != nil {
+				results[w.index] = model.AddProxyResult{Result: model.ADD_RESULT_FAILED, Id: id, Message: fmt.Sprintf("failed to set expire for proxy %s (error: %+v)", id, w.expire_cmd.Err())}
+				continue
+			}
+			if w.event_cmd.Err() != nil {
+				logger.WithField("error", w.event_cmd.Err()).Error(fmt.Sprintf("failed to send event to stream %s", w.stream))
+			}
+			results[w.index] = model.AddProxyResult{Result: w.result, Id: id}
+		}
+		logger.WithFields(log.Fields{
+			"offset":  start,
+			"written": len(writes),
+		}).Debug("chunk added")
+	}
+	logger.WithField("result", len(results)).Info()
+	return results, nil
+}
+
+// getByIds tells which of ids are stored by one round trip, the ids given are at most add_batch_size
+func (s ProxyStore) getByIds(ctx context.Context, ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(ids))
+	if len(ids) < 1 {
+		return existing, nil
+	}
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.Exists(ctx, proxyKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, id := range ids {
+		if cmds[i].Val() > 0 {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+// validateProxy checks what a proxy needs to be stored and looked up
+func validateProxy(proxy model.Proxy) error {
+	if proxy.Ip == "" {
+		return fmt.Errorf("%w: ip is required", InvalidProxyError)
+	}
+	//gateway proxies, whose exit ips rotate behind one endpoint, are stored with port -1
+	if proxy.Port != gateway_port && (proxy.Port < 1 || proxy.Port > 65535) {
+		return fmt.Errorf("%w: port %d is out of range", InvalidProxyError, proxy.Port)
+	}
+	if proxy.ProviderId == "" || proxy.ApiId == "" {
+		return fmt.Errorf("%w: provider_id and api_id are required", InvalidProxyError)
+	}
+	if proxy.Ttl != -1 && proxy.Ttl < 1 {
+		return fmt.Errorf("%w: ttl must equal to -1 or greater than 0", InvalidProxyError)
+	}
+	return nil
+}
+
 func (s ProxyStore) Update(ctx context.Context, id string, proxy model.Proxy, paths []string) error {
 	logger := s.logger.WithFields(log.Fields{
 		"method": "Update",
@@ -349,8 +690,7 @@ func (s ProxyStore) Update(ctx context.Context, id string, proxy model.Proxy, pa
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	port_str := fmt.Sprintf("%d", old_proxy.Port)
-	proxy_key := strings.Join([]string{proxy_prefix, old_proxy.Ip, port_str}, sep)
+	proxy_key := proxyKey(old_proxy.Id)
 	p_bytes, _ := json.Marshal(proxy)
 	var p_json map[string]interface{}
 	_ = json.Unmarshal(p_bytes, &p_json)
@@ -373,48 +713,369 @@ func (s ProxyStore) Update(ctx context.Context, id string, proxy model.Proxy, pa
 		logger.WithField("error", err).Error(err)
 		return errors.WithStack(err)
 	}
+	for _, path := range paths {
+		if path == "attr" || path == "checked_at" || path == "created_at" {
+			if err := s.refreshIndex(ctx, proxy_key); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if err := s.refreshShadow(ctx, proxy_key); err != nil {
+		logger.WithField("error", err).Warn("failed to refresh shadow")
+	}
 	return nil
 }
 
-func (s ProxyStore) ListWithFilters(ctx context.Context, pager *common.Paginator[model.Proxy], filter *pb.Filter) error {
+// refreshIndex recomputes $.index of the proxy document after its values are merged
+func (s ProxyStore) refreshIndex(ctx context.Context, proxy_key string) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "refreshIndex",
+		"key":    proxy_key,
+	})
+	result, err := s.client.JSONGet(ctx, proxy_key, "$").Result()
+	if err != nil {
+		logger.WithField("error", err).Error("failed to get proxy")
+		return errors.WithStack(err)
+	}
+	var proxies []Proxy
+	if err := json.Unmarshal([]byte(result), &proxies); err != nil || len(proxies) < 1 {
+		logger.WithField("error", err).Error("failed to parse proxy")
+		return errors.WithStack(ProxyNotFoundError)
+	}
+	err = s.client.JSONSet(ctx, proxy_key, "$.index", newProxyIndex(model.Proxy(proxies[0]))).Err()
+	if err != nil {
+		logger.WithField("error", err).Error("failed to set index")
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAvailable flips attr.availiable of the proxy without touching the other attributes,
+// a proxy made unavailable with until isn't zero is scheduled to be made available again by WatchExpiry
+func (s ProxyStore) SetAvailable(ctx context.Context, id string, available bool, until time.Time) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "SetAvailable",
+		"param":  fmt.Sprintf("%+v", map[string]string{"id": id, "available": fmt.Sprintf("%t", available), "until": until.String()}),
+	})
+	var old_proxy model.Proxy
+	err := s.GetById(ctx, id, &old_proxy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	proxy_key := proxyKey(old_proxy.Id)
+	//attr.availiable is omitted while false, so merge it explicitly
+	merge_value := fmt.Sprintf(`{"attr":{"availiable":%t},"index":{"available":"%t"}}`, available, available)
+	pipe := s.client.TxPipeline()
+	pipe.JSONMerge(ctx, proxy_key, "$", merge_value)
+	if !available && !until.IsZero() {
+		pipe.ZAdd(ctx, disabled_key, redis.Z{Score: float64(until.UnixMilli()), Member: old_proxy.Id})
+	} else {
+		pipe.ZRem(ctx, disabled_key, old_proxy.Id)
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		err := fmt.Errorf("failed to set availability of proxy %s (err: %+v) ", id, err)
+		logger.WithField("error", err).Error(err)
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Delete removes the proxy and publishes its deletion to the event stream
+func (s ProxyStore) Delete(ctx context.Context, id string) error {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "Delete",
+		"param":  fmt.Sprintf("%+v", map[string]string{"id": id}),
+	})
+	var proxy model.Proxy
+	err := s.GetById(ctx, id, &proxy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.delete(ctx, []model.Proxy{proxy})
+	if err != nil {
+		logger.WithField("error", err).Error(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteWithFilters removes every proxy matched by filter and returns the ids deleted,
+// a filter matching nothing is refused to avoid dropping the whole pool by accident
+func (s ProxyStore) DeleteWithFilters(ctx context.Context, filter *pb.Filter) ([]string, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "DeleteWithFilters",
+		"param":  fmt.Sprintf("%+v", map[string]string{"filter": fmt.Sprintf("%+v", filter)}),
+	})
+	query_field, err := createFieldFromFilter(filter, s.kinds)
+	if err != nil {
+		return nil, err
+	}
+	if query_field == nil {
+		return nil, errors.WithStack(EmptyFilterError)
+	}
+	var ids []string
+	for {
+		//the index drops deleted keys at once, so the first page always holds the proxies left
+		q := redisearch.NewQuery(delete_batch_size, 0, query_field)
+		search := redisearch.FtSearch("idx:proxy", q)
+		logger.Debug(search)
+		result, err := s.client.Do(ctx, search...).Result()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to get proxy")
+			return ids, errors.WithStack(err)
+		}
+		search_result, err := redisearch.ParseSearchResult[Proxy](result)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to get proxy")
+			return ids, errors.WithStack(err)
+		}
+		if len(search_result.Items) < 1 {
+			break
+		}
+		proxies := make([]model.Proxy, 0, len(search_result.Items))
+		for _, v := range search_result.Items {
+			proxies = append(proxies, model.Proxy(v.Item))
+		}
+		deleted, err := s.delete(ctx, proxies)
+		ids = append(ids, deleted...)
+		if err != nil {
+			logger.WithField("error", err).Error(err)
+			return ids, err
+		}
+		if len(deleted) < 1 {
+			break
+		}
+	}
+	logger.WithField("result", len(ids)).Info()
+	return ids, nil
+}
+
+// delete removes the keys of proxies in one transaction and sends an event for each of them
+func (s ProxyStore) delete(ctx context.Context, proxies []model.Proxy) ([]string, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "delete",
+	})
+	pipe := s.client.TxPipeline()
+	del_cmds := make([]*redis.IntCmd, len(proxies))
+	event_cmds := make([]*redis.StringCmd, len(proxies))
+	for i := range proxies {
+		p := Proxy(proxies[i])
+		proxy_key := proxyKey(p.Id)
+		del_cmds[i] = pipe.Del(ctx, proxy_key)
+		pipe.Del(ctx, shadowKey(proxy_key), historyKey(p.Id))
+		pipe.ZRem(ctx, disabled_key, p.Id)
+		event_cmds[i] = s.publisher.PublishProxy(ctx, pipe, event.EVENT_PROXY_DELETED, model.Proxy(p))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		err := fmt.Errorf("failed to delete proxies (error: %+v)", err)
+		return nil, errors.WithStack(err)
+	}
+	var ids []string
+	for i, p := range proxies {
+		if del_cmds[i].Val() < 1 {
+			continue
+		}
+		ids = append(ids, p.Id)
+		if event_cmds[i].Err() != nil {
+			logger.WithField("error", event_cmds[i].Err()).Error(fmt.Sprintf("failed to send event to stream %s", event.EVENT_PROXY_DELETED))
+			continue
+		}
+		logger.WithFields(
+			log.Fields{
+				"event": event.EVENT_PROXY_DELETED,
+				"value": p.Id,
+			},
+		).Info("event sent")
+	}
+	return ids, nil
+}
+
+// ListWithFilters lists the proxies matched by filter in the order of orders, the orders after the first one
+// break ties of the ones before, they are sorted by FT.AGGREGATE since FT.SEARCH sorts by one key only.
+// Only the paths of fields are returned, the whole documents if fields is empty
+func (s ProxyStore) ListWithFilters(ctx context.Context, pager *common.Paginator[model.Proxy], filter *pb.Filter, fields []string, orders ...*pb.PropertyOrder) error {
 	logger := s.logger.WithFields(log.Fields{
 		"method": "ListWithFilters",
-		"param":  fmt.Sprintf("%+v", map[string]string{"filter": fmt.Sprintf("%+v", filter), "offset": fmt.Sprintf("%d", pager.Offset), "limit": fmt.Sprintf("%d", pager.Limit)}),
+		"param":  fmt.Sprintf("%+v", map[string]string{"filter": fmt.Sprintf("%+v", filter), "fields": fmt.Sprintf("%+v", fields), "order_by": fmt.Sprintf("%+v", orders), "offset": fmt.Sprintf("%d", pager.Offset), "limit": fmt.Sprintf("%d", pager.Limit)}),
 	})
 	logger.Info()
-	query_field := createFieldFromFilter(filter)
+	query_field, err := createFieldFromFilter(filter, s.kinds)
+	if err != nil {
+		logger.WithField("error", err).Error("invalid filter")
+		return err
+	}
 	logger.Debug(query_field)
 	if query_field == nil {
 		query_field = redisearch.NewAnyField()
 	}
-	q := redisearch.NewQuery(int(pager.Limit), int(pager.Offset), query_field)
+	sort_keys, err := createSortKeysFromOrders(orders, s.sortable)
+	if err != nil {
+		logger.WithField("error", err).Error("invalid order")
+		return err
+	}
+	keys, err := listKeys(fields)
+	if err != nil {
+		logger.WithField("error", err).Error("invalid field")
+		return err
+	}
+	q := redisearch.NewQuery(int(pager.Limit), int(pager.Offset), query_field).SortBy(sort_keys...).Return(returnPaths(keys)...)
 	logger.Debug(q)
-	search := redisearch.FtSearch("idx:proxy", q)
-	logger.Debug(search)
+	var search []interface{}
+	if q.Sorts() > 1 {
+		search = redisearch.FtAggregate("idx:proxy", q)
+	} else {
+		search = redisearch.FtSearch("idx:proxy", q)
+	}
 	pipe := s.client.TxPipeline()
 	logger.Debug(search)
 	cmd := pipe.Do(ctx, search...)
+	//the total of FT.AGGREGATE is not the number of proxies matched, they are counted by FT.SEARCH
+	var count_cmd *redis.Cmd
+	if q.Sorts() > 1 {
+		count_cmd = pipe.Do(ctx, redisearch.FtCount("idx:proxy", q)...)
+	}
 	pipe.Exec(ctx)
 	result, err := cmd.Result()
 	if err != nil {
 		logger.WithField("error", cmd.Err()).Error("failed to get proxy")
 		return errors.WithStack(cmd.Err())
 	}
-	search_result, err := redisearch.ParseSearchResult[Proxy](result)
-	if err != nil {
-		logger.Error(err)
-	}
 	var ret_proxies []model.Proxy
-	for _, v := range search_result.Items {
-		ret_proxies = append(ret_proxies, model.Proxy(v.Item))
+	var total int
+	if len(keys) > 0 {
+		search_result, err := redisearch.ParseSearchAttributes(result)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to parse proxies")
+			return errors.WithStack(err)
+		}
+		for _, v := range search_result.Items {
+			proxy, err := proxyFromAttributes(v.Item, keys)
+			if err != nil {
+				logger.WithFields(log.Fields{"id": v.Id, "error": err}).Error("failed to parse proxy")
+				return err
+			}
+			ret_proxies = append(ret_proxies, proxy)
+		}
+		total = search_result.Total
+	} else {
+		search_result, err := redisearch.ParseSearchResult[proxyDocument](result)
+		if err != nil {
+			logger.WithField("error", err).Error("failed to parse proxies")
+			return errors.WithStack(err)
+		}
+		for _, v := range search_result.Items {
+			ret_proxies = append(ret_proxies, v.Item.proxy())
+		}
+		total = search_result.Total
 	}
-	pager.Total = int64(search_result.Total)
+	if count_cmd != nil {
+		count_result, err := count_cmd.Result()
+		if err != nil {
+			logger.WithField("error", err).Error("failed to count proxies")
+			return errors.WithStack(err)
+		}
+		if total, err = redisearch.ParseSearchTotal(count_result); err != nil {
+			logger.WithField("error", err).Error("failed to count proxies")
+			return errors.WithStack(err)
+		}
+	}
+	pager.Total = int64(total)
 	pager.Count = int64(len(ret_proxies))
 	pager.Items = ret_proxies
 	logger.Debugf("%+v", pager)
 	return nil
 }
 
+var stats_reducers = []redisearch.Reducer{
+	redisearch.ReduceCount("count"),
+	redisearch.ReduceAvg("latency", "avg_latency"),
+	redisearch.ReduceAvg("stability", "avg_stability"),
+	redisearch.ReduceMin("latency", "min_latency"),
+	redisearch.ReduceMax("latency", "max_latency"),
+	redisearch.ReduceQuantile("latency", 0.5, "p50_latency"),
+	redisearch.ReduceQuantile("latency", 0.9, "p90_latency"),
+	redisearch.ReduceQuantile("latency", 0.99, "p99_latency"),
+}
+
+func poolStatsFromRow(row redisearch.AggregateRow) model.PoolStats {
+	return model.PoolStats{
+		Count:        row.Int("count"),
+		AvgLatency:   row.Float("avg_latency"),
+		AvgStability: row.Float("avg_stability"),
+		MinLatency:   row.Float("min_latency"),
+		MaxLatency:   row.Float("max_latency"),
+		P50Latency:   row.Float("p50_latency"),
+		P90Latency:   row.Float("p90_latency"),
+		P99Latency:   row.Float("p99_latency"),
+	}
+}
+
+// Stats aggregates the proxies matched by filter as a whole and grouped by each of group_by,
+// StatsProperties are grouped by if group_by is empty
+func (s ProxyStore) Stats(ctx context.Context, filter *pb.Filter, group_by ...string) (*model.PoolStats, []model.PoolStatsGroup, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "Stats",
+		"param":  fmt.Sprintf("%+v", map[string]string{"filter": fmt.Sprintf("%+v", filter), "group_by": fmt.Sprintf("%+v", group_by)}),
+	})
+	query_field, err := createFieldFromFilter(filter, s.kinds)
+	if err != nil {
+		logger.WithField("error", err).Error("invalid filter")
+		return nil, nil, err
+	}
+	if query_field == nil {
+		query_field = redisearch.NewAnyField()
+	}
+	if len(group_by) < 1 {
+		group_by = StatsProperties
+	}
+	for _, property := range group_by {
+		if _, ok := s.kinds[property]; !ok {
+			return nil, nil, errors.WithStack(fmt.Errorf("%w: property %s is not indexed", InvalidFilterError, property))
+		}
+	}
+	pipe := s.client.Pipeline()
+	total_cmd := pipe.Do(ctx, redisearch.FtAggregateGroups("idx:proxy", redisearch.NewAggregation(query_field).Reduce(stats_reducers...))...)
+	group_cmds := make([]*redis.Cmd, len(group_by))
+	for i, property := range group_by {
+		aggregation := redisearch.NewAggregation(query_field).GroupBy(property).Reduce(stats_reducers...)
+		group_cmds[i] = pipe.Do(ctx, redisearch.FtAggregateGroups("idx:proxy", aggregation)...)
+	}
+	pipe.Exec(ctx)
+	result, err := total_cmd.Result()
+	if err != nil {
+		logger.WithField("error", err).Error("failed to aggregate proxies")
+		return nil, nil, errors.WithStack(err)
+	}
+	rows, err := redisearch.ParseAggregateResult(result)
+	if err != nil {
+		logger.WithField("error", err).Error("failed to aggregate proxies")
+		return nil, nil, errors.WithStack(err)
+	}
+	total := model.PoolStats{}
+	if len(rows) > 0 {
+		total = poolStatsFromRow(rows[0])
+	}
+	var groups []model.PoolStatsGroup
+	for i, property := range group_by {
+		result, err := group_cmds[i].Result()
+		if err != nil {
+			logger.WithField("error", err).Errorf("failed to aggregate proxies by %s", property)
+			return nil, nil, errors.WithStack(err)
+		}
+		rows, err := redisearch.ParseAggregateResult(result)
+		if err != nil {
+			logger.WithField("error", err).Errorf("failed to aggregate proxies by %s", property)
+			return nil, nil, errors.WithStack(err)
+		}
+		for _, row := range rows {
+			groups = append(groups, model.PoolStatsGroup{Property: property, Value: row[property], Stats: poolStatsFromRow(row)})
+		}
+	}
+	return &total, groups, nil
+}
+
 func NewProxyStore(client *redis.Client, option ...StoreOption) *ProxyStore {
 	var _option StoreOption
 	if len(option) == 0 {
@@ -426,7 +1087,15 @@ func NewProxyStore(client *redis.Client, option ...StoreOption) *ProxyStore {
 		log.Fields{
 			"class": "ProxyStore",
 		})
-	store := &ProxyStore{client: client, option: _option, logger: logger}
+	kinds := make(map[string]redisearch.SchemaKind, len(_option.Schemas))
+	sortable := make(map[string]bool)
+	for _, schema := range _option.Schemas {
+		kinds[schema.Name()] = schema.Kind()
+		if schema.Sortable() {
+			sortable[schema.Name()] = true
+		}
+	}
+	store := &ProxyStore{client: client, option: _option, kinds: kinds, sortable: sortable, publisher: event.NewPublisher(event.SOURCE_CACHE), logger: logger}
 	store.init()
 	return store
 }
@@ -3,13 +3,86 @@ package cache
 import (
 	"context"
 	"testing"
+	"time"
 
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	redisearch "github.com/WALL-EEEEEEE/proxy-service/manager/util/redisearch"
 
 	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
 )
 
+// newTestRedisProxyStore returns the store on the redis stack at 127.0.0.1:6379, the test is skipped without it.
+// The proxies are added with an api id of their own, which filters them apart from the others, and deleted once the test ends
+func newTestRedisProxyStore(t *testing.T, proxies ...model.Proxy) (*ProxyStore, *redis.Client, []string) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	ctx := context.Background()
+	if err := client.Do(ctx, "FT._LIST").Err(); err != nil {
+		client.Close()
+		t.Skipf("no redis stack at 127.0.0.1:6379 (error: %s)", err)
+	}
+	store := NewProxyStore(client)
+	api_id := uuid.New().String()
+	ids := make([]string, 0, len(proxies))
+	for i := range proxies {
+		proxies[i].ApiId = api_id
+		id, err := store.Add(ctx, &proxies[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, *id)
+	}
+	t.Cleanup(func() {
+		for _, id := range ids {
+			store.Delete(ctx, id)
+		}
+		client.Close()
+	})
+	return store, client, ids
+}
+
+func apiFilter(api_id string) *pb.Filter {
+	return &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "api_id"}, Op: pb.PropertyFilter_EQUAL, Value: api_id,
+	}}}
+}
+
+func TestProxyStoreLease(t *testing.T) {
+	store, client, ids := newTestRedisProxyStore(t,
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.1", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}},
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.2", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}},
+	)
+	ctx := context.Background()
+	var proxy model.Proxy
+	assert.Nil(t, store.GetById(ctx, ids[0], &proxy))
+	filter := apiFilter(proxy.ApiId)
+	first, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c1")
+	assert.Nil(t, err)
+	second, err := store.Acquire(ctx, filter, time.Minute, true, "crawler", "c2")
+	assert.Nil(t, err)
+	//the exclusive leases are on different proxies, held by one script for all the candidates
+	assert.NotEqual(t, first.ProxyId, second.ProxyId)
+	assert.ElementsMatch(t, ids, []string{first.ProxyId, second.ProxyId})
+	_, err = store.Acquire(ctx, filter, time.Minute, false, "crawler", "c3")
+	assert.ErrorIs(t, err, LeaseUnavailableError)
+	assert.Nil(t, store.Release(ctx, first.Id, model.LEASE_OUTCOME_SUCCESS))
+	assert.ErrorIs(t, store.Release(ctx, first.Id, model.LEASE_OUTCOME_SUCCESS), LeaseNotFoundError)
+	assert.Nil(t, store.Release(ctx, second.Id, model.LEASE_OUTCOME_FAILURE))
+	//the outcomes are counted in the documents of the proxies
+	assert.Nil(t, store.GetById(ctx, first.ProxyId, &proxy))
+	assert.Equal(t, &model.LeaseOutcomes{Success: 1}, proxy.LeaseOutcomes)
+	assert.Nil(t, store.GetById(ctx, second.ProxyId, &proxy))
+	assert.Equal(t, &model.LeaseOutcomes{Failure: 1}, proxy.LeaseOutcomes)
+	//and go away with them, no key of the lease is left
+	assert.Nil(t, store.Delete(ctx, second.ProxyId))
+	keys, err := client.Keys(ctx, lease_prefix+sep+"*"+second.ProxyId+"*").Result()
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
 func TestProxyStore(t *testing.T) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     "127.0.0.1:6379",
@@ -51,3 +124,392 @@ func TestProxyStore(t *testing.T) {
 	}
 	test.Run(cases, t)
 }
+
+func TestCreateFieldFromFilter(t *testing.T) {
+	kinds := map[string]redisearch.SchemaKind{}
+	for _, schema := range DefaultStoreOption.Schemas {
+		kinds[schema.Name()] = schema.Kind()
+	}
+	prop := func(name string, op pb.PropertyFilter_Operator, value string) *pb.Filter {
+		return &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+			Property: &pb.PropertyReference{Name: name}, Op: op, Value: value,
+		}}}
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Filter.Tag",
+			Input:    prop("country", pb.PropertyFilter_EQUAL, "US"),
+			Error:    nil,
+			Expected: `@country:{US}`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Numeric.LessThan",
+			Input:    prop("latency", pb.PropertyFilter_LESS_THAN, "300"),
+			Error:    nil,
+			Expected: `@latency:[-inf,(300]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Numeric.GreaterThanOrEqual",
+			Input:    prop("stability", pb.PropertyFilter_GREATER_THAN_OR_EQUAL, "0.5"),
+			Error:    nil,
+			Expected: `@stability:[0.5,+inf]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Numeric.NotEqual",
+			Input:    prop("port", pb.PropertyFilter_NOT_EQUAL, "80"),
+			Error:    nil,
+			Expected: `-(@port:[80,80])`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Numeric.Leased",
+			Input:    prop("leased_at", pb.PropertyFilter_LESS_THAN_OR_EQUAL, "1704067200000"),
+			Error:    nil,
+			Expected: `@leased_at:[-inf,1704067200000]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Numeric.Time",
+			Input:    prop("checked_at", pb.PropertyFilter_GREATER_THAN, "2024-01-01T00:00:00Z"),
+			Error:    nil,
+			Expected: `@checked_at:[(1704067200,+inf]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Geo",
+			Input:    prop("loc", pb.PropertyFilter_GEO_RADIUS, "-73.98 40.75 50 km"),
+			Error:    nil,
+			Expected: `@loc:[-73.98 40.75 50 km]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Geo.DefaultUnit",
+			Input:    prop("loc", pb.PropertyFilter_GEO_RADIUS, "2.35 48.85 10"),
+			Error:    nil,
+			Expected: `@loc:[2.35 48.85 10 km]`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+		{
+			Name:     "Filter.Geo.Invalid",
+			Input:    prop("loc", pb.PropertyFilter_GEO_RADIUS, "-73.98 95 50 km"),
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Filter.Geo.Operator",
+			Input:    prop("loc", pb.PropertyFilter_EQUAL, "-73.98 40.75 50 km"),
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Filter.Numeric.Invalid",
+			Input:    prop("latency", pb.PropertyFilter_LESS_THAN, "fast"),
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Filter.Tag.Range",
+			Input:    prop("country", pb.PropertyFilter_LESS_THAN, "US"),
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Filter.Unknown",
+			Input:    prop("color", pb.PropertyFilter_EQUAL, "red"),
+			Error:    InvalidFilterError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name: "Filter.Composite",
+			Input: &pb.Filter{FilterType: &pb.Filter_CompositeFilter{CompositeFilter: &pb.CompositeFilter{
+				Op: pb.CompositeFilter_AND,
+				Filters: []*pb.Filter{
+					prop("country", pb.PropertyFilter_EQUAL, "US"),
+					prop("latency", pb.PropertyFilter_LESS_THAN, "300"),
+				},
+			}}},
+			Error:    nil,
+			Expected: `(@country:{US} @latency:[-inf,(300])`,
+			Check: func(tc test.TestCase[any, any]) {
+				field, err := createFieldFromFilter(tc.Input.(*pb.Filter), kinds)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, field).Args()[0])
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestCreateSortKeysFromOrders(t *testing.T) {
+	sortable := map[string]bool{}
+	for _, schema := range DefaultStoreOption.Schemas {
+		if schema.Sortable() {
+			sortable[schema.Name()] = true
+		}
+	}
+	order := func(name string, direction pb.PropertyOrder_Direction) *pb.PropertyOrder {
+		return &pb.PropertyOrder{Property: &pb.PropertyReference{Name: name}, Direction: direction}
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Order.Single",
+			Input:    []*pb.PropertyOrder{order("latency", pb.PropertyOrder_DIRECTION_UNSPECIFIED)},
+			Error:    nil,
+			Expected: []interface{}{"*", "SORTBY", "latency", "ASC", "LIMIT", 0, 10},
+			Check: func(tc test.TestCase[any, any]) {
+				keys, err := createSortKeysFromOrders(tc.Input.([]*pb.PropertyOrder), sortable)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, redisearch.NewAnyField()).SortBy(keys...).Args())
+			},
+		},
+		{
+			Name:     "Order.Multiple",
+			Input:    []*pb.PropertyOrder{order("latency", pb.PropertyOrder_ASCENDING), order("checked_at", pb.PropertyOrder_DESCENDING)},
+			Error:    nil,
+			Expected: []interface{}{"*", "LOAD", 1, "$", "SORTBY", 4, "@latency", "ASC", "@checked_at", "DESC", "LIMIT", 0, 10},
+			Check: func(tc test.TestCase[any, any]) {
+				keys, err := createSortKeysFromOrders(tc.Input.([]*pb.PropertyOrder), sortable)
+				assert.Nil(t, err)
+				//the queries sorted by several keys are aggregated
+				assert.Equal(t, tc.Expected, redisearch.NewQuery(10, 0, redisearch.NewAnyField()).SortBy(keys...).AggregateArgs())
+			},
+		},
+		{
+			Name:     "Order.NotSortable",
+			Input:    []*pb.PropertyOrder{order("country", pb.PropertyOrder_ASCENDING)},
+			Error:    InvalidOrderError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := createSortKeysFromOrders(tc.Input.([]*pb.PropertyOrder), sortable)
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestNewProxyIndex(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Index.Location.Coordinates",
+			Input:    &model.Attr{Latitude: 40.75, Longitude: -73.98},
+			Error:    nil,
+			Expected: "-73.98,40.75",
+			Check: func(tc test.TestCase[any, any]) {
+				index := newProxyIndex(model.Proxy{Attr: tc.Input.(*model.Attr)})
+				assert.Equal(t, tc.Expected, index.Location)
+			},
+		},
+		{
+			Name:     "Index.Location.String",
+			Input:    &model.Attr{Location: "48.85, 2.35"},
+			Error:    nil,
+			Expected: "2.35,48.85",
+			Check: func(tc test.TestCase[any, any]) {
+				index := newProxyIndex(model.Proxy{Attr: tc.Input.(*model.Attr)})
+				assert.Equal(t, tc.Expected, index.Location)
+			},
+		},
+		{
+			Name:     "Index.Location.OutOfRange",
+			Input:    &model.Attr{Latitude: 89, Longitude: 10},
+			Error:    nil,
+			Expected: "",
+			Check: func(tc test.TestCase[any, any]) {
+				index := newProxyIndex(model.Proxy{Attr: tc.Input.(*model.Attr)})
+				assert.Equal(t, tc.Expected, index.Location)
+			},
+		},
+		{
+			Name:     "Index.Location.None",
+			Input:    &model.Attr{Location: "somewhere"},
+			Error:    nil,
+			Expected: "",
+			Check: func(tc test.TestCase[any, any]) {
+				index := newProxyIndex(model.Proxy{Attr: tc.Input.(*model.Attr)})
+				assert.Equal(t, tc.Expected, index.Location)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestValidateProxy(t *testing.T) {
+	valid := model.Proxy{Ip: "192.0.2.1", Port: 8080, ProviderId: "p", ApiId: "a", Ttl: -1}
+	with := func(f func(p *model.Proxy)) model.Proxy {
+		p := valid
+		f(&p)
+		return p
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Validate.Valid",
+			Input:    valid,
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Nil(t, validateProxy(tc.Input.(model.Proxy)))
+			},
+		},
+		{
+			Name:     "Validate.Ttl",
+			Input:    with(func(p *model.Proxy) { p.Ttl = 60 }),
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Nil(t, validateProxy(tc.Input.(model.Proxy)))
+			},
+		},
+		{
+			Name:     "Validate.NoIp",
+			Input:    with(func(p *model.Proxy) { p.Ip = "" }),
+			Error:    InvalidProxyError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, validateProxy(tc.Input.(model.Proxy)), tc.Error)
+			},
+		},
+		{
+			Name:     "Validate.Port",
+			Input:    with(func(p *model.Proxy) { p.Port = 70000 }),
+			Error:    InvalidProxyError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, validateProxy(tc.Input.(model.Proxy)), tc.Error)
+			},
+		},
+		{
+			Name:     "Validate.NoApi",
+			Input:    with(func(p *model.Proxy) { p.ApiId = "" }),
+			Error:    InvalidProxyError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, validateProxy(tc.Input.(model.Proxy)), tc.Error)
+			},
+		},
+		{
+			Name:     "Validate.ZeroTtl",
+			Input:    with(func(p *model.Proxy) { p.Ttl = 0 }),
+			Error:    InvalidProxyError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.ErrorIs(t, validateProxy(tc.Input.(model.Proxy)), tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestIndexVersion(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "IndexVersion.Versioned",
+			Input:    indexName(3),
+			Error:    nil,
+			Expected: 3,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, indexVersion(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "IndexVersion.Legacy",
+			Input:    proxy_index,
+			Error:    nil,
+			Expected: 0,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, indexVersion(tc.Input.(string)))
+			},
+		},
+		{
+			Name:     "IndexVersion.Other",
+			Input:    "idx:other:v2",
+			Error:    nil,
+			Expected: 0,
+			Check: func(tc test.TestCase[any, any]) {
+				assert.Equal(t, tc.Expected, indexVersion(tc.Input.(string)))
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestProxyStoreDelete(t *testing.T) {
+	store, client, ids := newTestRedisProxyStore(t,
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.5", Port: 80, Ttl: 60, Proto: []model.PROTO{model.PROTO_HTTP}},
+		model.Proxy{ProviderId: "p", Ip: "192.0.2.6", Port: 80, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP}},
+	)
+	ctx := context.Background()
+	for _, filter := range []*pb.Filter{nil, {}} {
+		_, err := store.DeleteWithFilters(ctx, filter)
+		assert.ErrorIs(t, err, EmptyFilterError)
+	}
+	var proxy model.Proxy
+	assert.Nil(t, store.GetById(ctx, ids[0], &proxy))
+	_, err := store.AddCheckResult(ctx, ids[0], model.CheckResult{CheckedAt: time.Now(), Dialable: true, Latency: 100})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), client.Exists(ctx, shadowKey(proxyKey(ids[0])), historyKey(ids[0])).Val())
+	deleted, err := store.DeleteWithFilters(ctx, apiFilter(proxy.ApiId))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, ids, deleted)
+	//the shadow and the history go away with the proxy
+	assert.Equal(t, int64(0), client.Exists(ctx, proxyKey(ids[0]), shadowKey(proxyKey(ids[0])), historyKey(ids[0]), proxyKey(ids[1])).Val())
+	deleted, err = store.DeleteWithFilters(ctx, apiFilter(proxy.ApiId))
+	assert.Nil(t, err)
+	assert.Empty(t, deleted)
+	assert.ErrorIs(t, store.Delete(ctx, ids[0]), ProxyNotFoundError)
+}
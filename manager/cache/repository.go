@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/common"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+// ProxyRepository is the store of proxies the services depend on. ProxyStore keeps proxies in Redis Stack,
+// MemoryProxyStore keeps them in process for unit tests and single-node deployments,
+// both of them evaluate filters and orders by the same schemas and fail with the same errors
+type ProxyRepository interface {
+	GetById(ctx context.Context, id string, proxy *model.Proxy) error
+	GetByIp(ctx context.Context, ip string, proxy *model.Proxy) error
+	ExistsId(ctx context.Context, id string) (bool, error)
+	ExistsIp(ctx context.Context, ip string) (bool, error)
+	ListWithFilters(ctx context.Context, pager *common.Paginator[model.Proxy], filter *pb.Filter, fields []string, orders ...*pb.PropertyOrder) error
+	Stats(ctx context.Context, filter *pb.Filter, group_by ...string) (*model.PoolStats, []model.PoolStatsGroup, error)
+	Add(ctx context.Context, proxy *model.Proxy, options ...SetOption) (*string, error)
+	AddBatch(ctx context.Context, proxies []model.Proxy, upsert bool) ([]model.AddProxyResult, error)
+	Update(ctx context.Context, id string, proxy model.Proxy, paths []string) error
+	// SetAvailable flips the availability of the proxy, a proxy made unavailable until a time is made available again then
+	SetAvailable(ctx context.Context, id string, available bool, until time.Time) error
+	Delete(ctx context.Context, id string) error
+	DeleteWithFilters(ctx context.Context, filter *pb.Filter) ([]string, error)
+	Acquire(ctx context.Context, filter *pb.Filter, duration time.Duration, exclusive bool, scope string, consumer string) (*model.Lease, error)
+	Release(ctx context.Context, id string, outcome model.LEASE_OUTCOME) error
+	AddCheckResult(ctx context.Context, id string, result model.CheckResult) (float64, error)
+	ListCheckResults(ctx context.Context, id string, limit int) ([]model.CheckResult, float64, error)
+	// Watch sends the events of proxies published after it returns until ctx is done, all the events of proxies if events is empty
+	Watch(ctx context.Context, events ...event.Event) (<-chan ProxyEvent, error)
+	// WatchExpiry publishes the expiry of proxies and makes the proxies whose unavailability is over available until ctx is done
+	WatchExpiry(ctx context.Context) error
+}
+
+// ProxyEvent is an event published for a proxy
+type ProxyEvent struct {
+	Type  event.Event
+	Proxy model.Proxy
+}
+
+// ProxyEvents are the events published for proxies
+var ProxyEvents = []event.Event{
+	event.EVENT_PROXY_CREATED,
+	event.EVENT_PROXY_UPDATED,
+	event.EVENT_PROXY_DELETED,
+	event.EVENT_PROXY_EXPIRED,
+}
+
+var (
+	_ ProxyRepository = (*ProxyStore)(nil)
+	_ ProxyRepository = (*MemoryProxyStore)(nil)
+)
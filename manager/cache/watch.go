@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const watch_block = time.Second
+const watch_retry_interval = time.Second
+
+// Watch reads the event streams of proxies from their last entries at the time it's called,
+// so that no event published after it returns is missed
+func (s ProxyStore) Watch(ctx context.Context, events ...event.Event) (<-chan ProxyEvent, error) {
+	logger := s.logger.WithFields(log.Fields{
+		"method": "Watch",
+	})
+	if len(events) < 1 {
+		events = ProxyEvents
+	}
+	ids := make([]string, len(events))
+	for i, stream := range events {
+		last, err := s.client.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logger.WithField("error", err).Errorf("failed to read stream %s", stream)
+			return nil, errors.WithStack(err)
+		}
+		ids[i] = "0-0"
+		if len(last) > 0 {
+			ids[i] = last[0].ID
+		}
+	}
+	ch := make(chan ProxyEvent)
+	go func() {
+		defer close(ch)
+		logger.Infof("watch event streams: %+v", events)
+		for {
+			streams := append(append([]string{}, events...), ids...)
+			results, err := s.client.XRead(ctx, &redis.XReadArgs{Streams: streams, Block: watch_block}).Result()
+			if ctx.Err() != nil {
+				logger.Info("exit")
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, redis.Nil) {
+					logger.WithField("error", err).Error("failed to read event streams")
+					time.Sleep(watch_retry_interval)
+				}
+				continue
+			}
+			for _, result := range results {
+				for i, stream := range events {
+					if stream != result.Stream {
+						continue
+					}
+					for _, msg := range result.Messages {
+						ids[i] = msg.ID
+						envelope, err := event.Decode(msg.Values)
+						if err != nil {
+							logger.WithField("error", err).Errorf("failed to decode event %s", msg.ID)
+							continue
+						}
+						p, err := event.ProxyOf(envelope)
+						if err != nil {
+							logger.WithField("error", err).Errorf("failed to decode event %s", msg.ID)
+							continue
+						}
+						select {
+						case ch <- ProxyEvent{Type: stream, Proxy: *p}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -49,8 +49,13 @@ var (
 				cmd.PrintErrf("can't connect to redis server: %s", ret.Err())
 				return
 			}
+			cipher, err := manager.SetupCipher(ctx, &conf)
+			if err != nil {
+				cmd.PrintErr(err)
+				return
+			}
 			uid := uuid.New().String()
-			proxy_api_check_job, err := job.NewProxyApiCheckJob(ctx, uid, manager_api, redis, db)
+			proxy_api_check_job, err := job.NewProxyApiCheckJob(ctx, uid, manager_api, redis, db, cipher)
 			if err != nil {
 				cmd.PrintErrf("failed to initialized api check job: %s", err.Error())
 				return
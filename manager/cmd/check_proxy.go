@@ -43,8 +43,13 @@ var (
 				cmd.PrintErrf("can't connect to redis server: %s", ret.Err())
 				return
 			}
+			cipher, err := manager.SetupCipher(ctx, &conf)
+			if err != nil {
+				cmd.PrintErr(err)
+				return
+			}
 			uid := uuid.New().String()
-			proxy_check_job, err := job.NewProxyCheckJob(ctx, uid, manager_api, redis)
+			proxy_check_job, err := job.NewProxyCheckJob(ctx, uid, manager_api, redis, cipher)
 			if err != nil {
 				cmd.PrintErr(err)
 			}
@@ -1,12 +1,19 @@
 package cmd
 
 import (
+	"context"
+
 	common "github.com/WALL-EEEEEEE/proxy-service/common"
 
 	manager "github.com/WALL-EEEEEEE/proxy-service/manager"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
 	conf "github.com/WALL-EEEEEEE/proxy-service/manager/config"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/job"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/google/uuid"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/spf13/cobra"
 )
@@ -36,11 +43,29 @@ var (
 				cmd.PrintErrln(err)
 				return
 			}
-			manager.StartServer(&conf, grpc_port, http_port)
+			var watchers []manager.ProxyWatcher
+			if conf.Store.Backend == "memory" {
+				//no check_proxy job could read the events of proxies kept in memory, they're checked in process
+				watchers = append(watchers, checkProxyWatcher("localhost:"+grpc_port))
+			}
+			manager.StartServer(&conf, grpc_port, http_port, watchers...)
 		},
 	}
 )
 
+// checkProxyWatcher runs the check job of proxies on the store of the server, which loads the checks through manager_api
+func checkProxyWatcher(manager_api string) manager.ProxyWatcher {
+	return func(ctx context.Context, proxy_store cache.ProxyRepository, cipher *secret.Cipher) {
+		proxy_check_job, err := job.NewWatchProxyCheckJob(ctx, uuid.New().String(), manager_api, proxy_store, cipher)
+		if err != nil {
+			logger.Errorf("failed to init proxy check job! (error: %+v) ", err)
+			return
+		}
+		proxy_check_job.Start()
+		proxy_check_job.Join()
+	}
+}
+
 func init() {
 
 	ServerCmd.Flags().StringVarP(&loglevel, "log", "l", "INFO", "log level")
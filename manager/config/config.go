@@ -12,4 +12,13 @@ type Config struct {
 		Password string `yaml:"password" envconfig:"MYSQL_PASSWORD"`
 		Database string `yaml:"database" envconfig:"MYSQL_DATABASE"`
 	} `yaml:"mysql"`
+	Store struct {
+		Backend string `yaml:"backend" envconfig:"STORE_BACKEND"` //redis (by default) or memory for a single node, which keeps proxies in process and checks them by the server
+	} `yaml:"store"`
+	Secret struct {
+		KeyFile string `yaml:"key_file" envconfig:"SECRET_KEY_FILE"` //key of 32 bytes sealing credentials, they're kept in plain if it's empty
+	} `yaml:"secret"`
+	Auth struct {
+		Tokens map[string]string `yaml:"tokens" envconfig:"AUTH_TOKENS"` //tokens mapped to the scopes they grant, separated by spaces
+	} `yaml:"auth"`
 }
@@ -0,0 +1,38 @@
+package endpoint
+
+import (
+	"context"
+
+	common_param "github.com/WALL-EEEEEEE/proxy-service/common/param"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/param"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/service"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Endpoints struct holds the list of endpoints definition
+type GatewayServiceEndpoint struct {
+	ReportProxyEvent endpoint.Endpoint
+}
+
+// MakeEndpoints func initializes the Endpoint instances
+func NewGatewayServiceEndpoint(s service.IGatewayService) GatewayServiceEndpoint {
+	return GatewayServiceEndpoint{
+		ReportProxyEvent: newGatewayServiceReportProxyEventEndpoint(s),
+	}
+}
+
+func newGatewayServiceReportProxyEventEndpoint(s service.IGatewayService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.ReportProxyEventRequest)
+		err = s.ReportProxyEvent(ctx, req.ProxyId, req.Type, req.Reason, req.Time, req.Until)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.ReportProxyEventResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		response = resp
+		return
+	}
+}
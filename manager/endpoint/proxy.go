@@ -16,30 +16,44 @@ type Proxy = model.Proxy
 
 // Endpoints struct holds the list of endpoints definition
 type ProxyServiceEndpoint struct {
-	ListProxies  endpoint.Endpoint
-	AddProxy     endpoint.Endpoint
-	UpdateProxy  endpoint.Endpoint
-	DeleteProxy  endpoint.Endpoint
-	GetProxy     endpoint.Endpoint
-	GetProxyByIp endpoint.Endpoint
+	ListProxies      endpoint.Endpoint
+	AddProxy         endpoint.Endpoint
+	AddProxies       endpoint.Endpoint
+	UpdateProxy      endpoint.Endpoint
+	DeleteProxy      endpoint.Endpoint
+	DeleteProxies    endpoint.Endpoint
+	GetPoolStats     endpoint.Endpoint
+	AcquireProxy     endpoint.Endpoint
+	ReleaseProxy     endpoint.Endpoint
+	GetProxy         endpoint.Endpoint
+	GetProxyByIp     endpoint.Endpoint
+	RecordProxyCheck endpoint.Endpoint
+	GetProxyHistory  endpoint.Endpoint
 }
 
 // MakeEndpoints func initializes the Endpoint instances
 func NewProxyServiceEndpoint(s service.IProxyService) ProxyServiceEndpoint {
 	return ProxyServiceEndpoint{
-		ListProxies:  newProxyServiceListProxiesEndpoint(s),
-		AddProxy:     newProxyServiceAddProxyEndpoint(s),
-		UpdateProxy:  newProxyServiceUpdateProxyEndpoint(s),
-		DeleteProxy:  newProxyServiceDeleteProxyEndpoint(s),
-		GetProxy:     newProxyServiceGetProxyEndpoint(s),
-		GetProxyByIp: newProxyServiceGetProxyByIpEndpoint(s),
+		ListProxies:      newProxyServiceListProxiesEndpoint(s),
+		AddProxy:         newProxyServiceAddProxyEndpoint(s),
+		AddProxies:       newProxyServiceAddProxiesEndpoint(s),
+		UpdateProxy:      newProxyServiceUpdateProxyEndpoint(s),
+		DeleteProxy:      newProxyServiceDeleteProxyEndpoint(s),
+		DeleteProxies:    newProxyServiceDeleteProxiesEndpoint(s),
+		GetPoolStats:     newProxyServiceGetPoolStatsEndpoint(s),
+		AcquireProxy:     newProxyServiceAcquireProxyEndpoint(s),
+		ReleaseProxy:     newProxyServiceReleaseProxyEndpoint(s),
+		GetProxy:         newProxyServiceGetProxyEndpoint(s),
+		GetProxyByIp:     newProxyServiceGetProxyByIpEndpoint(s),
+		RecordProxyCheck: newProxyServiceRecordProxyCheckEndpoint(s),
+		GetProxyHistory:  newProxyServiceGetProxyHistoryEndpoint(s),
 	}
 }
 
 func newProxyServiceListProxiesEndpoint(s service.IProxyService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(param.ListProxiesRequest)
-		paginator, err := s.ListProxies(ctx, req.Limit, req.Offset, req.Filter)
+		paginator, err := s.ListProxies(ctx, req.Limit, req.Offset, req.Filter, req.ListMask, req.OrderBy...)
 		if err != nil {
 			return nil, err
 
@@ -72,6 +86,37 @@ func newProxyServiceAddProxyEndpoint(s service.IProxyService) endpoint.Endpoint
 	}
 }
 
+func newProxyServiceAddProxiesEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.AddProxiesRequest)
+		//only the valid proxies are added, their results are merged back with the invalid ones in the order requested
+		proxies := make([]model.Proxy, 0, len(req.Proxies))
+		for i, proxy := range req.Proxies {
+			if _, ok := req.Invalid[i]; !ok {
+				proxies = append(proxies, proxy)
+			}
+		}
+		added, err := s.AddProxies(ctx, proxies, req.Upsert)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]model.AddProxyResult, 0, len(req.Proxies))
+		for i := range req.Proxies {
+			if reason, ok := req.Invalid[i]; ok {
+				results = append(results, model.AddProxyResult{Result: model.ADD_RESULT_INVALID, Message: reason})
+				continue
+			}
+			results = append(results, added[0])
+			added = added[1:]
+		}
+		resp := param.AddProxiesResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Results = results
+		response = resp
+		return
+	}
+}
+
 func newProxyServiceUpdateProxyEndpoint(s service.IProxyService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(param.UpdateProxyRequest)
@@ -118,6 +163,105 @@ func newProxyServiceGetProxyByIpEndpoint(s service.IProxyService) endpoint.Endpo
 
 func newProxyServiceDeleteProxyEndpoint(s service.IProxyService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.DeleteProxyRequest)
+		err = s.DeleteProxy(ctx, req.Id)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.DeleteProxyResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceDeleteProxiesEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.DeleteProxiesRequest)
+		ids, err := s.DeleteProxies(ctx, req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.DeleteProxiesResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Ids = ids
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceAcquireProxyEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.AcquireProxyRequest)
+		lease, err := s.AcquireProxy(ctx, req.Filter, req.LeaseDuration, req.Exclusive, req.Scope, req.Consumer)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.AcquireProxyResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Lease = *lease
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceRecordProxyCheckEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.RecordProxyCheckRequest)
+		stability, err := s.RecordProxyCheck(ctx, req.Id, req.Result)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.RecordProxyCheckResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Stability = stability
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceGetProxyHistoryEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.GetProxyHistoryRequest)
+		results, stability, err := s.GetProxyHistory(ctx, req.Id, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.GetProxyHistoryResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Results = results
+		resp.Stability = stability
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceReleaseProxyEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.ReleaseProxyRequest)
+		err = s.ReleaseProxy(ctx, req.LeaseId, req.Outcome)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.ReleaseProxyResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		response = resp
+		return
+	}
+}
+
+func newProxyServiceGetPoolStatsEndpoint(s service.IProxyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(param.GetPoolStatsRequest)
+		total, groups, err := s.GetPoolStats(ctx, req.Filter, req.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+		resp := param.GetPoolStatsResponse{}
+		resp.StatusResponse = common_param.STATUS_OK
+		resp.Total = *total
+		resp.Groups = groups
+		response = resp
 		return
 	}
 }
@@ -0,0 +1,98 @@
+package event
+
+import (
+	"context"
+	"strings"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Message is an event read from its stream
+type Message struct {
+	Id       string //id of the stream entry
+	Stream   Event
+	Envelope *pb.EventEnvelope
+}
+
+// Consumer reads the event streams as a member of a consumer group, each event is read by one of the members
+type Consumer struct {
+	client redis.Cmdable
+	group  string
+	id     string
+	events []Event
+	logger *log.Entry
+}
+
+func NewConsumer(client redis.Cmdable, group string, id string, events ...Event) *Consumer {
+	return &Consumer{
+		client: client,
+		group:  group,
+		id:     id,
+		events: events,
+		logger: log.WithFields(log.Fields{
+			"class": "Consumer",
+			"group": group,
+		}),
+	}
+}
+
+// Subscribe creates the consumer group on the streams if it doesn't exist, reading them from their first events
+func (c *Consumer) Subscribe(ctx context.Context) error {
+	for _, stream := range c.events {
+		err := c.client.XGroupCreateMkStream(ctx, stream, c.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			c.logger.WithField("error", err).Errorf("failed to create consumer group in stream %s", stream)
+			return errors.WithStack(err)
+		}
+	}
+	c.logger.Infof("subscribe to event streams: %+v", c.events)
+	return nil
+}
+
+// Read blocks until new events arrive. The entries failed to decode are acknowledged and skipped with an error logged,
+// so that events of an unknown schema are rejected loudly instead of misread. The envelopes of entries sent before
+// envelopes are given the ids of the entries and the types of their streams
+func (c *Consumer) Read(ctx context.Context) ([]Message, error) {
+	streams := append(append([]string{}, c.events...), strings.Split(strings.Repeat(">", len(c.events)), "")...)
+	results, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: c.group, Consumer: c.id, Streams: streams}).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var msgs []Message
+	for _, result := range results {
+		for _, entry := range result.Messages {
+			envelope, err := Decode(entry.Values)
+			if err != nil {
+				c.logger.WithFields(log.Fields{
+					"event": result.Stream,
+					"id":    entry.ID,
+					"error": err,
+				}).Error("failed to decode event")
+				c.client.XAck(ctx, result.Stream, c.group, entry.ID)
+				continue
+			}
+			if envelope.Id == "" {
+				envelope.Id = entry.ID
+			}
+			if envelope.Type == "" {
+				envelope.Type = result.Stream
+			}
+			msgs = append(msgs, Message{Id: entry.ID, Stream: result.Stream, Envelope: envelope})
+		}
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges msgs processed, so that they're removed from the pending entries of the group
+func (c *Consumer) Ack(ctx context.Context, msgs ...Message) error {
+	for _, msg := range msgs {
+		if err := c.client.XAck(ctx, msg.Stream, c.group, msg.Id).Err(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/util"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SCHEMA_VERSION is the version of the data of events sent, bump it whenever the data changes incompatibly
+// so that consumers reject the events they can't read instead of misreading them
+const SCHEMA_VERSION uint32 = 1
+
+// envelope_field is the field of stream entries holding the envelope encoded
+const envelope_field = "event"
+
+// the fields of stream entries holding the proxies and apis in json before envelopes were sent,
+// they're decoded for one release so that the entries left in streams by upgrading are not dropped
+const (
+	legacy_proxy_field = "proxy"
+	legacy_api_field   = "data"
+)
+
+var (
+	InvalidEventError      = errors.New("invalid event")
+	UnsupportedSchemaError = errors.New("unsupported schema version")
+)
+
+func newEnvelope(event_type Event, source string) *pb.EventEnvelope {
+	return &pb.EventEnvelope{
+		Id:            uuid.New().String(),
+		Type:          event_type,
+		Source:        source,
+		Time:          timestamppb.Now(),
+		SchemaVersion: SCHEMA_VERSION,
+	}
+}
+
+func NewProxyEnvelope(event_type Event, source string, proxy model.Proxy) *pb.EventEnvelope {
+	envelope := newEnvelope(event_type, source)
+	envelope.Data = &pb.EventEnvelope_Proxy{Proxy: &pb.ProxyEventData{Proxy: util.PbFromProxy(&proxy), Ttl: proxy.Ttl}}
+	return envelope
+}
+
+func NewApiEnvelope(event_type Event, source string, api model.ProxyApi) *pb.EventEnvelope {
+	envelope := newEnvelope(event_type, source)
+	envelope.Data = &pb.EventEnvelope_Api{Api: &pb.ApiEventData{Id: api.Id, ProviderId: api.ProviderId, Api: util.PbFromProxyApi(&api)}}
+	return envelope
+}
+
+// Encode returns the values of the stream entry holding envelope
+func Encode(envelope *pb.EventEnvelope) (map[string]interface{}, error) {
+	data, err := proto.Marshal(envelope)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return map[string]interface{}{envelope_field: data}, nil
+}
+
+// Decode decodes the envelope held by the values of a stream entry, the envelopes of schema versions
+// newer than SCHEMA_VERSION are rejected. The entries sent before envelopes are wrapped in envelopes
+// with no id, type and time, which are left to the reader
+func Decode(values map[string]interface{}) (*pb.EventEnvelope, error) {
+	data, ok := values[envelope_field].(string)
+	if !ok {
+		return decodeLegacy(values)
+	}
+	var envelope pb.EventEnvelope
+	if err := proto.Unmarshal([]byte(data), &envelope); err != nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidEventError, err.Error()))
+	}
+	if envelope.SchemaVersion < 1 || envelope.SchemaVersion > SCHEMA_VERSION {
+		return nil, errors.WithStack(fmt.Errorf("%w: event %s is of version %d, versions up to %d are supported", UnsupportedSchemaError, envelope.Id, envelope.SchemaVersion, SCHEMA_VERSION))
+	}
+	return &envelope, nil
+}
+
+// decodeLegacy wraps the proxy or api in json of an entry sent before envelopes
+func decodeLegacy(values map[string]interface{}) (*pb.EventEnvelope, error) {
+	var envelope *pb.EventEnvelope
+	if data, ok := values[legacy_proxy_field].(string); ok {
+		var proxy model.Proxy
+		if err := json.Unmarshal([]byte(data), &proxy); err != nil {
+			return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidEventError, err.Error()))
+		}
+		envelope = NewProxyEnvelope("", SOURCE_CACHE, proxy)
+	} else if data, ok := values[legacy_api_field].(string); ok {
+		var api model.ProxyApi
+		if err := json.Unmarshal([]byte(data), &api); err != nil {
+			return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidEventError, err.Error()))
+		}
+		envelope = NewApiEnvelope("", SOURCE_API_SERVICE, api)
+	} else {
+		return nil, errors.WithStack(fmt.Errorf("%w: entry has no field %s", InvalidEventError, envelope_field))
+	}
+	envelope.Id = ""
+	envelope.Time = nil
+	return envelope, nil
+}
+
+// ProxyOf returns the proxy carried by envelope
+func ProxyOf(envelope *pb.EventEnvelope) (*model.Proxy, error) {
+	data := envelope.GetProxy()
+	if data == nil || data.Proxy == nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: event %s of type %s carries no proxy", InvalidEventError, envelope.Id, envelope.Type))
+	}
+	proxy := util.ProxyFromPb(data.Proxy)
+	proxy.Ttl = data.Ttl
+	return proxy, nil
+}
+
+// ApiOf returns the api carried by envelope
+func ApiOf(envelope *pb.EventEnvelope) (*model.ProxyApi, error) {
+	data := envelope.GetApi()
+	if data == nil || data.Api == nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: event %s of type %s carries no api", InvalidEventError, envelope.Id, envelope.Type))
+	}
+	api := util.ProxyApiFromPb(data.Api)
+	api.Id = data.Id
+	api.ProviderId = data.ProviderId
+	return api, nil
+}
@@ -0,0 +1,145 @@
+package event
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+
+	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// entry returns the values of a stream entry as redis returns them
+func entry(t *testing.T, envelope *pb.EventEnvelope) map[string]interface{} {
+	values, err := Encode(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{envelope_field: string(values[envelope_field].([]byte))}
+}
+
+func TestEnvelope(t *testing.T) {
+	created_at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	checked_at := created_at.Add(time.Minute)
+	proxy := model.Proxy{
+		Id: "id", ProviderId: "p", ApiId: "a", Provider: "provider", Api: "api", Ip: "192.0.2.1", Port: 1080, Ttl: -1,
+		Proto: []model.PROTO{model.PROTO_HTTP, model.PROTO_SOCKET}, Status: model.STATUS_CHECKED,
+		Attr:      &model.Attr{Latency: 100, Country: "US", ExitIp: "198.51.100.1"},
+		UseConfig: &model.UseConfig{User: "user", Password: "pass"},
+		CreatedAt: &created_at, UpdatedAt: &created_at, CheckedAt: &checked_at,
+	}
+	api := model.ProxyApi{Id: "id", ProviderId: "p", Name: "api", UpdateInterval: 60, Service: model.Service{Host: "localhost:8080", Name: "Adapter.List", Params: map[string]string{"zone": "us"}}}
+	//the entries sent before envelopes hold the proxies and apis in json
+	legacy_proxy, _ := json.Marshal(proxy)
+	legacy_api, _ := json.Marshal(api)
+	newer := NewProxyEnvelope(EVENT_PROXY_CREATED, SOURCE_CACHE, proxy)
+	newer.SchemaVersion = SCHEMA_VERSION + 1
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Envelope.Proxy",
+			Input:    entry(t, NewProxyEnvelope(EVENT_PROXY_CREATED, SOURCE_CACHE, proxy)),
+			Error:    nil,
+			Expected: proxy,
+			Check: func(tc test.TestCase[any, any]) {
+				envelope, err := Decode(tc.Input.(map[string]interface{}))
+				assert.Nil(t, err)
+				assert.NotEmpty(t, envelope.Id)
+				assert.NotNil(t, envelope.Time)
+				assert.Equal(t, SCHEMA_VERSION, envelope.SchemaVersion)
+				assert.Equal(t, SOURCE_CACHE, envelope.Source)
+				p, err := ProxyOf(envelope)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, *p)
+				_, err = ApiOf(envelope)
+				assert.ErrorIs(t, err, InvalidEventError)
+			},
+		},
+		{
+			Name:     "Envelope.Api",
+			Input:    entry(t, NewApiEnvelope(EVENT_CHECKAPI_CREATED, SOURCE_API_SERVICE, api)),
+			Error:    nil,
+			Expected: api,
+			Check: func(tc test.TestCase[any, any]) {
+				envelope, err := Decode(tc.Input.(map[string]interface{}))
+				assert.Nil(t, err)
+				assert.Equal(t, SOURCE_API_SERVICE, envelope.Source)
+				a, err := ApiOf(envelope)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, *a)
+			},
+		},
+		{
+			Name:     "Envelope.NewerSchema",
+			Input:    entry(t, newer),
+			Error:    UnsupportedSchemaError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := Decode(tc.Input.(map[string]interface{}))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Envelope.Legacy.Proxy",
+			Input:    map[string]interface{}{legacy_proxy_field: string(legacy_proxy)},
+			Error:    nil,
+			Expected: proxy,
+			Check: func(tc test.TestCase[any, any]) {
+				envelope, err := Decode(tc.Input.(map[string]interface{}))
+				assert.Nil(t, err)
+				assert.Empty(t, envelope.Id)
+				assert.Equal(t, SOURCE_CACHE, envelope.Source)
+				p, err := ProxyOf(envelope)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, *p)
+			},
+		},
+		{
+			Name:     "Envelope.Legacy.Api",
+			Input:    map[string]interface{}{legacy_api_field: string(legacy_api)},
+			Error:    nil,
+			Expected: api,
+			Check: func(tc test.TestCase[any, any]) {
+				envelope, err := Decode(tc.Input.(map[string]interface{}))
+				assert.Nil(t, err)
+				assert.Equal(t, SOURCE_API_SERVICE, envelope.Source)
+				a, err := ApiOf(envelope)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, *a)
+			},
+		},
+		{
+			Name:     "Envelope.Legacy.Malformed",
+			Input:    map[string]interface{}{legacy_proxy_field: "malformed"},
+			Error:    InvalidEventError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := Decode(tc.Input.(map[string]interface{}))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Envelope.Unknown",
+			Input:    map[string]interface{}{"other": "value"},
+			Error:    InvalidEventError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := Decode(tc.Input.(map[string]interface{}))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+		{
+			Name:     "Envelope.Malformed",
+			Input:    map[string]interface{}{envelope_field: "malformed"},
+			Error:    InvalidEventError,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := Decode(tc.Input.(map[string]interface{}))
+				assert.ErrorIs(t, err, tc.Error)
+			},
+		},
+	}
+	test.Run(cases, t)
+}
@@ -9,4 +9,5 @@ const (
 	EVENT_PROXY_CREATED    Event = "proxy_created"
 	EVENT_PROXY_DELETED    Event = "proxy_deleted"
 	EVENT_PROXY_UPDATED    Event = "proxy_updated"
+	EVENT_PROXY_EXPIRED    Event = "proxy_expired"
 )
@@ -0,0 +1,47 @@
+package event
+
+import (
+	"context"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// sources of the events sent by the manager
+const (
+	SOURCE_CACHE       = "manager/cache"
+	SOURCE_API_SERVICE = "manager/service/api"
+)
+
+// Publisher sends the events of source to the event streams
+type Publisher struct {
+	source string
+}
+
+func NewPublisher(source string) Publisher {
+	return Publisher{source: source}
+}
+
+// Publish adds envelope to the stream of its type by client, which could be a pipeline so that it's sent along with other commands
+func (p Publisher) Publish(ctx context.Context, client redis.Cmdable, envelope *pb.EventEnvelope) *redis.StringCmd {
+	values, err := Encode(envelope)
+	if err != nil {
+		cmd := redis.NewStringCmd(ctx)
+		cmd.SetErr(err)
+		return cmd
+	}
+	return client.XAdd(ctx, &redis.XAddArgs{
+		Stream:     envelope.Type,
+		NoMkStream: false,
+		Values:     values,
+	})
+}
+
+func (p Publisher) PublishProxy(ctx context.Context, client redis.Cmdable, event_type Event, proxy model.Proxy) *redis.StringCmd {
+	return p.Publish(ctx, client, NewProxyEnvelope(event_type, p.source, proxy))
+}
+
+func (p Publisher) PublishApi(ctx context.Context, client redis.Cmdable, event_type Event, api model.ProxyApi) *redis.StringCmd {
+	return p.Publish(ctx, client, NewApiEnvelope(event_type, p.source, api))
+}
@@ -14,6 +14,7 @@ import (
 	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/repository"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/util"
 
 	common_param "github.com/WALL-EEEEEEE/proxy-service/common/param"
@@ -28,9 +29,7 @@ import (
 	cron "github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -46,6 +45,11 @@ type CheckItem interface {
 
 const default_limit = 100
 
+const (
+	load_batch_size     = 500
+	load_flush_interval = time.Duration(1) * time.Second
+)
+
 type InvalidArgumentError struct {
 	msg string
 }
@@ -68,6 +72,7 @@ type ProxyApiCheck struct {
 	proxy_channel chan<- ProxyCheckItem
 	batch_process chan<- string
 	db            *gorm.DB
+	cipher        *secret.Cipher
 	cache         map[string]interface{}
 }
 
@@ -76,12 +81,12 @@ type ProxyCheckItem struct {
 	CheckId string
 }
 
-func NewProxyApiCheck(proxy_api model.ProxyApi, proxy_channel chan<- ProxyCheckItem, batch_process chan<- string, store *gorm.DB) ProxyApiCheck {
+func NewProxyApiCheck(proxy_api model.ProxyApi, proxy_channel chan<- ProxyCheckItem, batch_process chan<- string, store *gorm.DB, cipher *secret.Cipher) ProxyApiCheck {
 	retryClient := retry_http.NewClient()
 	retryClient.RetryMax = 0
 	client := retryClient.StandardClient()
 	cache := make(map[string]interface{})
-	return ProxyApiCheck{proxy_api: proxy_api, client: client, proxy_channel: proxy_channel, batch_process: batch_process, db: store, cache: cache}
+	return ProxyApiCheck{proxy_api: proxy_api, client: client, proxy_channel: proxy_channel, batch_process: batch_process, db: store, cipher: cipher, cache: cache}
 }
 
 func (p ProxyApiCheck) proxy_adapter_handler(client *http.Client, adapter_api string, params map[string]string, results chan<- ProxyCheckItem) {
@@ -191,7 +196,12 @@ func (p ProxyApiCheck) Check() {
 	api_name := p.proxy_api.Service.Name
 	api_host := p.proxy_api.Service.Host
 	api_url := strings.Join([]string{api_host, strings.ReplaceAll(api_name, ".", "/")}, "/")
-	api_params := p.proxy_api.Service.Params
+	//params are sealed at rest, so they're opened only to request the api
+	api_params, err := p.cipher.OpenParams(context.Background(), p.proxy_api.Service.Params)
+	if err != nil {
+		log.Errorf("failed to open params of api %s: %s", p.proxy_api.Id, err.Error())
+		return
+	}
 	p.proxy_adapter_handler(p.client, api_url, api_params, p.proxy_channel)
 }
 
@@ -225,12 +235,14 @@ type ProxyApiCheckJob struct {
 	proxy_service  pb.ProxyServiceClient
 	channel        chan ProxyCheckItem
 	batch_process  chan string
+	cipher         *secret.Cipher
 	ctx            context.Context
 	cancel         context.CancelFunc
 	stop           chan bool
 }
 
-func NewProxyApiCheckJob(ctx context.Context, id string, manager_api string, event_bus *redis.Client, db *gorm.DB) (*ProxyApiCheckJob, error) {
+// NewProxyApiCheckJob creates the job requesting apis at intervals, whose params are opened by cipher
+func NewProxyApiCheckJob(ctx context.Context, id string, manager_api string, event_bus *redis.Client, db *gorm.DB, cipher *secret.Cipher) (*ProxyApiCheckJob, error) {
 	grpc_conn, err := grpc.Dial(manager_api, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, err
@@ -251,6 +263,7 @@ func NewProxyApiCheckJob(ctx context.Context, id string, manager_api string, eve
 		event_begin_id: ">",
 		channel:        channel,
 		batch_process:  make(chan string),
+		cipher:         cipher,
 		cancel:         cancel,
 		stop:           make(chan bool),
 		entry_to_check: entry_to_check,
@@ -261,25 +274,25 @@ func NewProxyApiCheckJob(ctx context.Context, id string, manager_api string, eve
 	return inst, nil
 }
 
-func (p *ProxyApiCheckJob) createProxy(logger log.Entry, proxy model.Proxy) error {
-	logger.Debugf("proxy: %+v", proxy)
-	*proxy.CreatedAt = time.Now()
-
-	var add_proxy = util.PbFromProxy(&proxy)
-	req := &pb.AddProxyRequest{
-		Proxy:      add_proxy,
-		ProviderId: proxy.ProviderId,
-		ApiId:      proxy.ApiId,
+func (p *ProxyApiCheckJob) createProxies(logger log.Entry, proxies []model.Proxy) ([]*pb.AddProxyResult, error) {
+	logger.Debugf("proxies: %d", len(proxies))
+	created_at := time.Now()
+	req := &pb.AddProxiesRequest{
+		Proxies: make([]*pb.Proxy, 0, len(proxies)),
+	}
+	for i := range proxies {
+		proxy := proxies[i]
+		proxy.CreatedAt = &created_at
+		req.Proxies = append(req.Proxies, util.PbFromProxy(&proxy))
 	}
-	resp, err := p.proxy_service.AddProxy(p.ctx, req)
+	resp, err := p.proxy_service.AddProxies(p.ctx, req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.Status.Code != 0 {
-		return fmt.Errorf("error while load proxy: %s", resp.Status.Message)
+		return nil, fmt.Errorf("error while load proxies: %s", resp.Status.Message)
 	}
-	logger.Debugf("loaded in %s", resp.Id)
-	return nil
+	return resp.Results, nil
 }
 
 func (p *ProxyApiCheckJob) startLoadBuzzer() {
@@ -288,19 +301,46 @@ func (p *ProxyApiCheckJob) startLoadBuzzer() {
 	})
 	logger.Infof("start")
 	var load_status map[string]int64 = make(map[string]int64)
+	//proxies are loaded in batches, flushed once full, at intervals or when a check finishes
+	var pending []ProxyCheckItem
+	flush := func() {
+		if len(pending) < 1 {
+			return
+		}
+		proxies := make([]model.Proxy, 0, len(pending))
+		for _, item := range pending {
+			proxies = append(proxies, item.Proxy)
+		}
+		results, err := p.createProxies(*logger, proxies)
+		if err != nil {
+			logger.Error(err)
+			pending = pending[:0]
+			return
+		}
+		for i, result := range results {
+			switch result.Result {
+			case pb.AddResult_ADD_RESULT_CREATED, pb.AddResult_ADD_RESULT_UPDATED:
+				load_status[pending[i].CheckId] += 1
+			case pb.AddResult_ADD_RESULT_ALREADY_EXISTS:
+			default:
+				logger.Errorf("error while load proxy %s: %s", pending[i].Proxy.Ip, result.Message)
+			}
+		}
+		pending = pending[:0]
+	}
+	ticker := time.NewTicker(load_flush_interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case proxy_check_item := <-p.channel:
-			err := p.createProxy(*logger, proxy_check_item.Proxy)
-			if err != nil {
-				errStatus, ok := status.FromError(err)
-				if !(ok && errStatus.Code() == codes.AlreadyExists) {
-					logger.Error(err)
-				}
-				continue
+			pending = append(pending, proxy_check_item)
+			if len(pending) >= load_batch_size {
+				flush()
 			}
-			load_status[proxy_check_item.CheckId] += 1
+		case <-ticker.C:
+			flush()
 		case check_id := <-p.batch_process:
+			flush()
 			check_load_status := load_status[check_id]
 			logger.Infof("check %s loaded %d proxy", check_id, check_load_status)
 		}
@@ -313,110 +353,46 @@ func (p *ProxyApiCheckJob) startCheckEventsListener() {
 		"task": "check_event_listener",
 	})
 	logger.Info("start")
-	var resp *redis.StatusCmd
-	events := []event.Event{
-		event.EVENT_CHECKAPI_CREATED,
-		event.EVENT_CHECKAPI_UPDATED,
-		event.EVENT_CHECKAPI_DELETED,
-	}
-	for _, event := range events {
-		resp = p.event_bus.XGroupCreateMkStream(p.ctx, event, p.event_group_id, "0")
-		if resp.Err() != nil && resp.Err().Error() != "BUSYGROUP Consumer Group name already exists" {
-			logger.Errorf("error when creating consumer group [%s] in stream [%s] : %s", p.event_group_id, event, resp.Err())
-			return
-		}
+	consumer := event.NewConsumer(p.event_bus, p.event_group_id, p.id, event.EVENT_CHECKAPI_CREATED, event.EVENT_CHECKAPI_UPDATED, event.EVENT_CHECKAPI_DELETED)
+	if err := consumer.Subscribe(p.ctx); err != nil {
+		logger.Errorf("error when subscribing to event streams: %s", err)
+		return
 	}
-	logger.Infof("subscribe to event streams: %+v", events)
 	for {
 		select {
 		case <-p.ctx.Done():
 			logger.Info("exit")
 			return
 		default:
-			var streams []string = append(events, strings.Split(strings.Repeat(">", len(events)), "")...)
-			results, err := p.event_bus.XReadGroup(p.ctx, &redis.XReadGroupArgs{Group: p.event_group_id, Consumer: p.id, Streams: streams}).Result()
+			msgs, err := consumer.Read(p.ctx)
 			if err != nil {
 				logger.Errorf("error while reading event from event bus: %s", err)
 				continue
 			}
-			process_event := func(event_type event.Event, event_msgs []redis.XMessage) error {
-				logger = logger.WithFields(log.Fields{
-					"event": event_type,
+			for _, msg := range msgs {
+				logger := logger.WithFields(log.Fields{
+					"event": msg.Stream,
 				})
-				process_created_messages := func(msgs []redis.XMessage) {
-					for _, msg := range msgs {
-						msg_id := msg.ID
-						logger.Infof("msg: %+v (id: %s)", msg.Values, msg_id)
-						check_data, ok := msg.Values["data"].(string)
-						if !ok {
-							logger.Warnf("invalid message format: %+v (message must contains data field)", msg.Values)
-							continue
-						}
-						var proxy_api model.ProxyApi
-						err := json.Unmarshal([]byte(check_data), &proxy_api)
-						if err != nil {
-							logger.Warnf("invalid message format: %s", err.Error())
-							continue
-						}
-						check_op := NewProxyApiCheck(proxy_api, p.channel, p.batch_process, p.db)
-						p.AddCheck(check_op)
-					}
-				}
-				process_updated_messages := func(msgs []redis.XMessage) {
-					for _, msg := range msgs {
-						msg_id := msg.ID
-						logger.Infof("msg: %+v (id: %s)", msg.Values, msg_id)
-						check_data, ok := msg.Values["data"].(string)
-						if !ok {
-							logger.Warnf("invalid message format: %+v (message must contains data field)", msg.Values)
-							continue
-						}
-						var proxy_api model.ProxyApi
-						err := json.Unmarshal([]byte(check_data), &proxy_api)
-						if err != nil {
-							logger.Warnf("invalid message format: %s", err.Error())
-							continue
-						}
-						check_op := NewProxyApiCheck(proxy_api, p.channel, p.batch_process, p.db)
-						p.RemoveCheck(check_op.GetName())
-						p.AddCheck(check_op)
-					}
-				}
-				process_deleted_message := func(msgs []redis.XMessage) {
-					for _, msg := range msgs {
-						msg_id := msg.ID
-						logger.Infof("msg: %+v (id: %s)", msg.Values, msg_id)
-						check_data, ok := msg.Values["data"].(string)
-						if !ok {
-							logger.Warnf("invalid message format: %+v (message must contains 'data' field)", msg.Values)
-							continue
-						}
-						var proxy_api model.ProxyApi
-						err := json.Unmarshal([]byte(check_data), &proxy_api)
-						if err != nil {
-							logger.Warnf("invalid message format: %s", err.Error())
-							continue
-						}
-						check_op := NewProxyApiCheck(proxy_api, p.channel, p.batch_process, p.db)
-						p.RemoveCheck(check_op.GetName())
-					}
+				logger.Infof("msg: %+v (id: %s)", msg.Envelope, msg.Id)
+				proxy_api, err := event.ApiOf(msg.Envelope)
+				if err != nil {
+					logger.Warnf("invalid message format: %s", err.Error())
+					consumer.Ack(p.ctx, msg)
+					continue
 				}
-
-				switch event_type {
+				check_op := NewProxyApiCheck(*proxy_api, p.channel, p.batch_process, p.db, p.cipher)
+				switch msg.Stream {
 				case event.EVENT_CHECKAPI_CREATED:
-					process_created_messages(event_msgs)
+					p.AddCheck(check_op)
 				case event.EVENT_CHECKAPI_UPDATED:
-					process_updated_messages(event_msgs)
+					p.RemoveCheck(check_op.GetName())
+					p.AddCheck(check_op)
 				case event.EVENT_CHECKAPI_DELETED:
-					process_deleted_message(event_msgs)
+					p.RemoveCheck(check_op.GetName())
 				default:
 					logger.Warnf("unknown event")
 				}
-				return nil
-			}
-			for _, stream := range results {
-				err := process_event(stream.Stream, stream.Messages)
-				if err != nil {
+				if err := consumer.Ack(p.ctx, msg); err != nil {
 					logger.Error(err)
 				}
 			}
@@ -454,7 +430,7 @@ func (p *ProxyApiCheckJob) startCheckSynchronizer() {
 				Name:           api.Name,
 				ProviderId:     api.ProviderId,
 				Id:             api.ApiId,
-			}, p.channel, p.batch_process, p.db)
+			}, p.channel, p.batch_process, p.db, p.cipher)
 			mutual_checks[check.GetId()] = struct{}{}
 			_, ok := p.checks[check.GetName()]
 			if !ok {
@@ -2,19 +2,19 @@ package job
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/WALL-EEEEEEE/proxy-service/provider-adapter/param"
 
 	manager "github.com/WALL-EEEEEEE/proxy-service/manager"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
 	event "github.com/WALL-EEEEEEE/proxy-service/manager/event"
 	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/util"
 
 	retry_http "github.com/hashicorp/go-retryablehttp"
@@ -25,8 +25,12 @@ import (
 	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
+// deleted_ttl is how long the proxies deleted are remembered to skip their checks and loads pending
+const deleted_ttl = 10 * time.Minute
+
 type ProxyCheck struct {
 	proxy  model.Proxy
+	result model.CheckResult //result of the last check, recorded in the history of the proxy
 	client *http.Client
 }
 
@@ -58,11 +62,23 @@ func (p *ProxyCheck) Check() {
 	if p.proxy.Attr == nil {
 		p.proxy.Attr = &model.Attr{}
 	}
-	if stats.Dialable && stats.Latency > 0 {
+	now := time.Now()
+	p.result = model.CheckResult{
+		CheckedAt:        now,
+		Latency:          stats.Latency,
+		Dialable:         stats.Dialable,
+		HttpSupport:      stats.HttpSupport,
+		SocketSupport:    stats.SocketSupport,
+		WebSocketSupport: stats.WebSocketSupport,
+		Error:            stats.Error,
+	}
+	if p.result.Succeeded() {
 		p.proxy.Attr.Availiable = true
 	}
 	p.proxy.Attr.Latency = stats.Latency
-	now := time.Now()
+	if stats.ExitIp != "" {
+		p.proxy.Attr.ExitIp = stats.ExitIp
+	}
 	p.proxy.CheckedAt = &now
 	p.proxy.Status = model.STATUS_CHECKED
 	log.Infof("%+v", p.proxy)
@@ -92,25 +108,41 @@ type ProxyCheckJob struct {
 	manager_client        pb.ProxyServiceClient
 	proxy_channel         chan param.RawProxy
 	check_channel         chan CheckItem
-	checked_proxy_channel chan model.Proxy
+	checked_proxy_channel chan ProxyCheck
 	checker_quota         int
+	deleted               sync.Map //ids of proxies deleted while waiting for check or load, to the time deleted
+	cipher                *secret.Cipher
+	proxy_store           cache.ProxyRepository //watched for the events of proxies instead of event_bus if it's set
 	ctx                   context.Context
 	cancel                context.CancelFunc
 	stop                  chan bool
 }
 
-func NewProxyCheckJob(ctx context.Context, id string, manager_api string, event_bus *redis.Client) (*ProxyCheckJob, error) {
+// NewProxyCheckJob creates the job checking the proxies created, whose credentials are opened by cipher to connect them
+func NewProxyCheckJob(ctx context.Context, id string, manager_api string, event_bus *redis.Client, cipher *secret.Cipher) (*ProxyCheckJob, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	proxy_channel := make(chan param.RawProxy)
 	check_channel := make(chan CheckItem)
-	checked_proxy_channel := make(chan model.Proxy)
+	checked_proxy_channel := make(chan ProxyCheck)
 	log.Infof("start proxy check job ...")
 	conn, err := grpc.Dial(manager_api, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 	manager_client := pb.NewProxyServiceClient(conn)
-	job := &ProxyCheckJob{ctx: ctx, checker_quota: 5, manager_client: manager_client, event_bus: event_bus, id: id, event_group_id: "proxy_check_job", event_begin_id: ">", proxy_channel: proxy_channel, check_channel: check_channel, checked_proxy_channel: checked_proxy_channel, cancel: cancel, stop: make(chan bool)}
+	job := &ProxyCheckJob{ctx: ctx, checker_quota: 5, manager_client: manager_client, event_bus: event_bus, id: id, event_group_id: "proxy_check_job", event_begin_id: ">", proxy_channel: proxy_channel, check_channel: check_channel, checked_proxy_channel: checked_proxy_channel, cipher: cipher, cancel: cancel, stop: make(chan bool)}
+	return job, nil
+}
+
+// NewWatchProxyCheckJob creates the job checking the proxies created in proxy_store, whose events are watched in process
+// instead of read from the redis streams, e.g. the memory store of a single node
+func NewWatchProxyCheckJob(ctx context.Context, id string, manager_api string, proxy_store cache.ProxyRepository, cipher *secret.Cipher) (*ProxyCheckJob, error) {
+	job, err := NewProxyCheckJob(ctx, id, manager_api, nil, cipher)
+	if err != nil {
+		return nil, err
+	}
+	job.proxy_store = proxy_store
 	return job, nil
 }
 
@@ -119,66 +151,41 @@ func (p *ProxyCheckJob) startProxyEventsListener() {
 		"task": "proxy_event_listener",
 	})
 	logger.Info("start")
-	var resp *redis.StatusCmd
-	events := []event.Event{
-		event.EVENT_PROXY_CREATED,
+	if p.proxy_store != nil {
+		p.watchProxyEvents(logger)
+		return
 	}
-	for _, event := range events {
-		resp = p.event_bus.XGroupCreateMkStream(p.ctx, event, p.event_group_id, "0")
-		if resp.Err() != nil && resp.Err().Error() != "BUSYGROUP Consumer Group name already exists" {
-			logger.Errorf("error when creating consumer group [%s] in stream [%s] : %s", p.event_group_id, event, resp.Err())
-			return
-		}
+	consumer := event.NewConsumer(p.event_bus, p.event_group_id, p.id, event.EVENT_PROXY_CREATED, event.EVENT_PROXY_DELETED)
+	if err := consumer.Subscribe(p.ctx); err != nil {
+		logger.Errorf("error when subscribing to event streams: %s", err)
+		return
 	}
-	logger.Infof("subscribe to event streams: %+v", events)
 	for {
 		select {
 		case <-p.ctx.Done():
 			logger.Info("exit")
 			return
 		default:
-			var streams []string = append(events, strings.Split(strings.Repeat(">", len(events)), "")...)
-			results, err := p.event_bus.XReadGroup(p.ctx, &redis.XReadGroupArgs{Group: p.event_group_id, Consumer: p.id, Streams: streams}).Result()
+			msgs, err := consumer.Read(p.ctx)
 			if err != nil {
 				logger.Errorf("error while reading event from event bus: %s", err)
 				continue
 			}
-			process_event := func(event_type event.Event, event_msgs []redis.XMessage) error {
-				logger = logger.WithFields(log.Fields{
-					"event": event_type,
+			for _, msg := range msgs {
+				logger := logger.WithFields(log.Fields{
+					"event": msg.Stream,
 				})
-				process_created_messages := func(msgs []redis.XMessage) {
-					for _, msg := range msgs {
-						msg_id := msg.ID
-						logger.Debugf("msg: %+v (id: %s)", msg.Values, msg_id)
-						check_data, ok := msg.Values["proxy"].(string)
-						if !ok {
-							logger.Warnf("invalid message format: %+v (message must contains proxy field)", msg.Values)
-							continue
-						}
-						var proxy model.Proxy
-						err := json.Unmarshal([]byte(check_data), &proxy)
-						if err != nil {
-							logger.Warnf("invalid message format: %s", err.Error())
-							continue
-						}
-						logger.Infof("%+v", proxy)
-						check_op := NewProxyCheck(proxy)
-						p.AddCheck(&check_op)
-					}
+				logger.Debugf("msg: %+v (id: %s)", msg.Envelope, msg.Id)
+				proxy, err := event.ProxyOf(msg.Envelope)
+				if err != nil {
+					logger.Warnf("invalid message format: %s", err.Error())
+					consumer.Ack(p.ctx, msg)
+					continue
 				}
-
-				switch event_type {
-				case event.EVENT_PROXY_CREATED:
-					process_created_messages(event_msgs)
-				default:
-					logger.Warnf("unknown event")
+				if check := p.handleProxyEvent(logger, msg.Stream, proxy); check != nil {
+					p.AddCheck(check)
 				}
-				return nil
-			}
-			for _, stream := range results {
-				err := process_event(stream.Stream, stream.Messages)
-				if err != nil {
+				if err := consumer.Ack(p.ctx, msg); err != nil {
 					logger.Error(err)
 				}
 			}
@@ -186,14 +193,68 @@ func (p *ProxyCheckJob) startProxyEventsListener() {
 	}
 }
 
+// watchProxyEvents checks the proxies created in proxy_store until the job is closed. The watch drops the events
+// once it falls behind, so the checks are queued without blocking it
+func (p *ProxyCheckJob) watchProxyEvents(logger *log.Entry) {
+	events, err := p.proxy_store.Watch(p.ctx, event.EVENT_PROXY_CREATED, event.EVENT_PROXY_DELETED)
+	if err != nil {
+		logger.Errorf("error when watching events of proxies: %s", err)
+		return
+	}
+	for e := range events {
+		proxy := e.Proxy
+		if check := p.handleProxyEvent(logger.WithField("event", e.Type), e.Type, &proxy); check != nil {
+			go p.AddCheck(check)
+		}
+	}
+	logger.Info("exit")
+}
+
+// handleProxyEvent returns the check of the proxy created, the proxies deleted are remembered to skip their checks
+func (p *ProxyCheckJob) handleProxyEvent(logger *log.Entry, stream event.Event, proxy *model.Proxy) CheckItem {
+	switch stream {
+	case event.EVENT_PROXY_CREATED:
+		if err := p.cipher.OpenUseConfig(p.ctx, proxy.UseConfig); err != nil {
+			logger.Warnf("failed to open credentials of proxy %s: %s", proxy.Id, err.Error())
+			return nil
+		}
+		logger.Infof("%+v", proxy)
+		p.deleted.Delete(proxy.Id)
+		check_op := NewProxyCheck(*proxy)
+		return &check_op
+	case event.EVENT_PROXY_DELETED:
+		logger.Infof("%s deleted", proxy.Ip)
+		p.pruneDeleted()
+		p.deleted.Store(proxy.Id, time.Now())
+	default:
+		logger.Warnf("unknown event")
+	}
+	return nil
+}
+
+// pruneDeleted forgets the proxies deleted longer than deleted_ttl ago, which were not waiting for check or load
+func (p *ProxyCheckJob) pruneDeleted() {
+	now := time.Now()
+	p.deleted.Range(func(id, deleted_at any) bool {
+		if now.Sub(deleted_at.(time.Time)) > deleted_ttl {
+			p.deleted.Delete(id)
+		}
+		return true
+	})
+}
+
 func (p *ProxyCheckJob) startProxyChecker() {
 	var wg sync.WaitGroup
 	check_func := func(channel chan CheckItem) {
 		defer wg.Done()
 		for {
 			check := <-p.check_channel
+			if _, ok := p.deleted.LoadAndDelete(check.GetId()); ok {
+				log.Infof("skip check of deleted proxy %s", check.GetName())
+				continue
+			}
 			check.Check()
-			p.checked_proxy_channel <- check.(*ProxyCheck).proxy
+			p.checked_proxy_channel <- *check.(*ProxyCheck)
 		}
 	}
 	for i := 0; i < p.checker_quota; i++ {
@@ -232,13 +293,38 @@ func (p *ProxyCheckJob) startLoadBuzzer() {
 		logger.Infof("%s loaded ", proxy.Ip)
 		return nil
 	}
+	stevedore_record := func(proxy model.Proxy, result model.CheckResult) error {
+		req := &pb.RecordProxyCheckRequest{
+			Id:     proxy.Id,
+			Result: util.PbFromCheckResult(&result),
+		}
+		resp, err := p.manager_client.RecordProxyCheck(p.ctx, req)
+		if err != nil {
+			return err
+		}
+		if resp.Status.Code != 0 {
+			return fmt.Errorf("error while record check of proxy: %s", resp.Status.Message)
+		}
+		logger.Infof("%s recorded (stability: %f)", proxy.Ip, resp.Stability)
+		return nil
+	}
 	for {
-		proxy := <-p.checked_proxy_channel
+		check := <-p.checked_proxy_channel
+		proxy := check.proxy
+		if _, ok := p.deleted.LoadAndDelete(proxy.Id); ok {
+			logger.Infof("skip load of deleted proxy %s", proxy.Ip)
+			continue
+		}
 		err := stevedore_load(proxy)
 		if err != nil {
 			logger.Error(err)
 			continue
 		}
+		err = stevedore_record(proxy, check.result)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
 	}
 }
 
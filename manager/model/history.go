@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// CheckResult is the outcome of one check of a proxy, latency is in milliseconds
+type CheckResult struct {
+	CheckedAt        time.Time `json:"checked_at"`
+	Latency          int64     `json:"latency"`
+	Dialable         bool      `json:"dialable"`
+	HttpSupport      bool      `json:"http_support"`
+	SocketSupport    bool      `json:"socket_support"`
+	WebSocketSupport bool      `json:"websocket_support"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// Succeeded tells whether the proxy was found available by the check
+func (r CheckResult) Succeeded() bool {
+	return r.Dialable && r.Latency > 0
+}
+
+// Stability is the ratio of the checks succeeded among results, 0 if there is none
+func Stability(results []CheckResult) float64 {
+	if len(results) < 1 {
+		return 0
+	}
+	succeeded := 0
+	for _, result := range results {
+		if result.Succeeded() {
+			succeeded++
+		}
+	}
+	return float64(succeeded) / float64(len(results))
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type LEASE_OUTCOME = string
+
+const (
+	LEASE_OUTCOME_UNSPECIFIED LEASE_OUTCOME = "LEASE_OUTCOME_UNSPECIFIED"
+	LEASE_OUTCOME_SUCCESS     LEASE_OUTCOME = "LEASE_OUTCOME_SUCCESS"
+	LEASE_OUTCOME_FAILURE     LEASE_OUTCOME = "LEASE_OUTCOME_FAILURE"
+)
+
+// LeaseOutcomes counts the outcomes the leases of a proxy were released with
+type LeaseOutcomes struct {
+	Success int64 `json:"success"`
+	Failure int64 `json:"failure"`
+}
+
+// Lease is a hold of a proxy by a consumer until it's released or expires,
+// an exclusive lease keeps the other leases of its scope off the proxy
+type Lease struct {
+	Id         string    `json:"id"`
+	ProxyId    string    `json:"proxy_id"`
+	Proxy      *Proxy    `json:"proxy,omitempty"`
+	Scope      string    `json:"scope,omitempty"`
+	Consumer   string    `json:"consumer,omitempty"`
+	Exclusive  bool      `json:"exclusive"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiredAt  time.Time `json:"expired_at"`
+}
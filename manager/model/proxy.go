@@ -107,6 +107,7 @@ type UseConfig struct {
 	User     string            `json:"user" validate:"required" example:"user"`
 	Password string            `json:"password" validate:"required" example:"password"`
 	Extra    map[string]string `json:"extra" validate:"required" example:"{}"`
+	Redacted bool              `json:"redacted,omitempty"` // password left out for the callers without the scope of credentials
 }
 
 type Attr struct {
@@ -118,8 +119,11 @@ type Attr struct {
 	Country      string   `json:"country,omitempty"`
 	City         string   `json:"city,omitempty"`
 	Organization string   `json:"organization,omitempty"`
-	Location     string   `json:"location,omitempty"`
+	Location     string   `json:"location,omitempty"` //`latitude,longitude`, e.g. `40.75,-73.98`, used if Latitude and Longitude are not set
 	Region       string   `json:"region,omitempty"`
+	Latitude     float64  `json:"latitude,omitempty"`
+	Longitude    float64  `json:"longitude,omitempty"`
+	ExitIp       string   `json:"exit_ip,omitempty"` //ip the proxy is seen from, it may differ from Ip and be shared by proxies of other providers
 }
 
 type Proxy struct {
@@ -139,4 +143,42 @@ type Proxy struct {
 	CreatedAt  *time.Time `json:"created_at,omitempty"`
 	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
 	ExpiredAt  *time.Time `json:"expired_at,omitempty"`
+	// outcomes of the leases released, which are counted in the lease of the document stored rather than the proxy
+	LeaseOutcomes *LeaseOutcomes `json:"-"`
+}
+
+type ADD_RESULT = string
+
+const (
+	ADD_RESULT_CREATED        ADD_RESULT = "ADD_RESULT_CREATED"
+	ADD_RESULT_UPDATED        ADD_RESULT = "ADD_RESULT_UPDATED"
+	ADD_RESULT_ALREADY_EXISTS ADD_RESULT = "ADD_RESULT_ALREADY_EXISTS"
+	ADD_RESULT_INVALID        ADD_RESULT = "ADD_RESULT_INVALID"
+	ADD_RESULT_FAILED         ADD_RESULT = "ADD_RESULT_FAILED"
+)
+
+// AddProxyResult is the outcome of adding one proxy of a batch
+type AddProxyResult struct {
+	Result  ADD_RESULT `json:"result"`
+	Id      string     `json:"id,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// PoolStats summarizes a set of proxies, latencies are in milliseconds
+type PoolStats struct {
+	Count        int64   `json:"count"`
+	AvgLatency   float64 `json:"avg_latency"`
+	AvgStability float64 `json:"avg_stability"`
+	MinLatency   float64 `json:"min_latency"`
+	MaxLatency   float64 `json:"max_latency"`
+	P50Latency   float64 `json:"p50_latency"`
+	P90Latency   float64 `json:"p90_latency"`
+	P99Latency   float64 `json:"p99_latency"`
+}
+
+// PoolStatsGroup is the stats of proxies whose property is value
+type PoolStatsGroup struct {
+	Property string    `json:"property"`
+	Value    string    `json:"value"`
+	Stats    PoolStats `json:"stats"`
 }
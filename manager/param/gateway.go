@@ -0,0 +1,34 @@
+package param
+
+import (
+	"time"
+
+	common_param "github.com/WALL-EEEEEEE/proxy-service/common/param"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+)
+
+type ReportProxyEventRequest struct {
+	ProxyId string
+	Type    pb.ProxyEventType
+	Reason  string
+	Time    time.Time
+	Until   time.Time
+}
+
+func (req ReportProxyEventRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"ReportProxyEventRequest.ProxyId", req.ProxyId,
+		"ReportProxyEventRequest.Type", req.Type.String(),
+		"ReportProxyEventRequest.Reason", req.Reason,
+		"ReportProxyEventRequest.Time", req.Time,
+		"ReportProxyEventRequest.Until", req.Until,
+	)
+}
+
+type ReportProxyEventResponse struct {
+	common_param.StatusResponse
+}
+
+func (resp ReportProxyEventResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return resp.StatusResponse.AppendKeyvals(keyvals)
+}
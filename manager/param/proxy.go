@@ -2,6 +2,7 @@ package param
 
 import (
 	"fmt"
+	"time"
 
 	common_param "github.com/WALL-EEEEEEE/proxy-service/common/param"
 	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
@@ -11,6 +12,7 @@ import (
 type ListProxiesRequest struct {
 	common_param.Pager
 	Filter   *pb.Filter
+	OrderBy  []*pb.PropertyOrder
 	ListMask []string
 }
 
@@ -18,6 +20,7 @@ func (req ListProxiesRequest) AppendKeyvals(keyvals []interface{}) []interface{}
 	keyvals = req.Pager.AppendKeyvals(keyvals)
 	return append(keyvals,
 		"ListProxiesRequest.Filter", req.Filter,
+		"ListProxiesRequest.OrderBy", req.OrderBy,
 		"ListProxiesRequest.ListMask", req.ListMask,
 	)
 }
@@ -64,6 +67,32 @@ func (resp AddProxyResponse) AppendKeyvals(keyvals []interface{}) []interface{}
 	)
 }
 
+type AddProxiesRequest struct {
+	Proxies []model.Proxy
+	Invalid map[int]string //index of the proxies failed validation to why
+	Upsert  bool
+}
+
+func (req AddProxiesRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"AddProxiesRequest.Proxies", len(req.Proxies),
+		"AddProxiesRequest.Invalid", len(req.Invalid),
+		"AddProxiesRequest.Upsert", req.Upsert,
+	)
+}
+
+type AddProxiesResponse struct {
+	common_param.StatusResponse
+	Results []model.AddProxyResult
+}
+
+func (resp AddProxiesResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals,
+		"AddProxiesResponse.Results", len(resp.Results),
+	)
+}
+
 type UpdateProxyRequest struct {
 	Id         string
 	Proxy      model.Proxy
@@ -106,6 +135,171 @@ func (resp GetProxyResponse) AppendKeyvals(keyvals []interface{}) []interface{}
 	return append(keyvals, "GetProxyResponse.Proxy", fmt.Sprintf("%+v", resp.Proxy))
 }
 
+type DeleteProxyRequest struct {
+	Id string
+}
+
+func (req DeleteProxyRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"DeleteProxyRequest.Id", req.Id,
+	)
+}
+
+type DeleteProxyResponse struct {
+	common_param.StatusResponse
+}
+
+func (resp DeleteProxyResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return resp.StatusResponse.AppendKeyvals(keyvals)
+}
+
+type DeleteProxiesRequest struct {
+	Filter *pb.Filter
+}
+
+func (req DeleteProxiesRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"DeleteProxiesRequest.Filter", req.Filter,
+	)
+}
+
+type DeleteProxiesResponse struct {
+	common_param.StatusResponse
+	Ids []string
+}
+
+func (resp DeleteProxiesResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals,
+		"DeleteProxiesResponse.Ids", len(resp.Ids),
+	)
+}
+
+type GetPoolStatsRequest struct {
+	Filter  *pb.Filter
+	GroupBy []string
+}
+
+func (req GetPoolStatsRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"GetPoolStatsRequest.Filter", req.Filter,
+		"GetPoolStatsRequest.GroupBy", req.GroupBy,
+	)
+}
+
+type GetPoolStatsResponse struct {
+	common_param.StatusResponse
+	Total  model.PoolStats
+	Groups []model.PoolStatsGroup
+}
+
+func (resp GetPoolStatsResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals,
+		"GetPoolStatsResponse.Total", fmt.Sprintf("%+v", resp.Total),
+		"GetPoolStatsResponse.Groups", len(resp.Groups),
+	)
+}
+
+type AcquireProxyRequest struct {
+	Filter        *pb.Filter
+	LeaseDuration time.Duration
+	Exclusive     bool
+	Scope         string
+	Consumer      string
+}
+
+func (req AcquireProxyRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"AcquireProxyRequest.Filter", req.Filter,
+		"AcquireProxyRequest.LeaseDuration", req.LeaseDuration,
+		"AcquireProxyRequest.Exclusive", req.Exclusive,
+		"AcquireProxyRequest.Scope", req.Scope,
+		"AcquireProxyRequest.Consumer", req.Consumer,
+	)
+}
+
+type AcquireProxyResponse struct {
+	common_param.StatusResponse
+	Lease model.Lease
+}
+
+func (resp AcquireProxyResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals,
+		"AcquireProxyResponse.Lease", resp.Lease.Id,
+		"AcquireProxyResponse.Proxy", resp.Lease.ProxyId,
+	)
+}
+
+type ReleaseProxyRequest struct {
+	LeaseId string
+	Outcome model.LEASE_OUTCOME
+}
+
+func (req ReleaseProxyRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"ReleaseProxyRequest.LeaseId", req.LeaseId,
+		"ReleaseProxyRequest.Outcome", req.Outcome,
+	)
+}
+
+type ReleaseProxyResponse struct {
+	common_param.StatusResponse
+}
+
+func (resp ReleaseProxyResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return resp.StatusResponse.AppendKeyvals(keyvals)
+}
+
+type RecordProxyCheckRequest struct {
+	Id     string
+	Result model.CheckResult
+}
+
+func (req RecordProxyCheckRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"RecordProxyCheckRequest.Id", req.Id,
+		"RecordProxyCheckRequest.Result", fmt.Sprintf("%+v", req.Result),
+	)
+}
+
+type RecordProxyCheckResponse struct {
+	common_param.StatusResponse
+	Stability float64
+}
+
+func (resp RecordProxyCheckResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals, "RecordProxyCheckResponse.Stability", resp.Stability)
+}
+
+type GetProxyHistoryRequest struct {
+	Id    string
+	Limit int
+}
+
+func (req GetProxyHistoryRequest) AppendKeyvals(keyvals []interface{}) []interface{} {
+	return append(keyvals,
+		"GetProxyHistoryRequest.Id", req.Id,
+		"GetProxyHistoryRequest.Limit", req.Limit,
+	)
+}
+
+type GetProxyHistoryResponse struct {
+	common_param.StatusResponse
+	Results   []model.CheckResult
+	Stability float64
+}
+
+func (resp GetProxyHistoryResponse) AppendKeyvals(keyvals []interface{}) []interface{} {
+	keyvals = resp.StatusResponse.AppendKeyvals(keyvals)
+	return append(keyvals,
+		"GetProxyHistoryResponse.Results", len(resp.Results),
+		"GetProxyHistoryResponse.Stability", resp.Stability,
+	)
+}
+
 type GetProxyByIpRequest struct {
 	Ip string
 }
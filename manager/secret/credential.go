@@ -0,0 +1,119 @@
+package secret
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+)
+
+// sensitive_params are the substrings of the names of api params holding credentials
+var sensitive_params = []string{"password", "passwd", "secret", "token", "key", "credential"}
+
+// IsSensitiveParam tells whether the api param named name holds credentials
+func IsSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitive_params {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// SealUseConfig seals the password and psn of use_config, which embeds the password
+func (c *Cipher) SealUseConfig(ctx context.Context, use_config *model.UseConfig) error {
+	if use_config == nil {
+		return nil
+	}
+	var err error
+	if use_config.Password, err = c.Seal(ctx, use_config.Password); err != nil {
+		return err
+	}
+	if use_config.Psn, err = c.Seal(ctx, use_config.Psn); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Cipher) OpenUseConfig(ctx context.Context, use_config *model.UseConfig) error {
+	if use_config == nil {
+		return nil
+	}
+	var err error
+	if use_config.Password, err = c.Open(ctx, use_config.Password); err != nil {
+		return err
+	}
+	if use_config.Psn, err = c.Open(ctx, use_config.Psn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RedactUseConfig leaves out the password of use_config and flags it redacted, the psn keeps its user and host,
+// no placeholder is put in place of the password so it can't be sent to the proxy by mistake
+func (c *Cipher) RedactUseConfig(ctx context.Context, use_config *model.UseConfig) {
+	if use_config == nil {
+		return
+	}
+	use_config.Password = ""
+	use_config.Redacted = true
+	psn, err := c.Open(ctx, use_config.Psn)
+	if err != nil {
+		use_config.Psn = ""
+		return
+	}
+	if u, err := url.Parse(psn); err == nil && u.User != nil {
+		u.User = url.User(u.User.Username())
+		psn = u.String()
+	}
+	use_config.Psn = psn
+}
+
+// SealParams seals the sensitive ones of api params
+func (c *Cipher) SealParams(ctx context.Context, params map[string]string) (map[string]string, error) {
+	return mapParams(params, func(name string, value string) (string, error) {
+		if !IsSensitiveParam(name) {
+			return value, nil
+		}
+		return c.Seal(ctx, value)
+	})
+}
+
+func (c *Cipher) OpenParams(ctx context.Context, params map[string]string) (map[string]string, error) {
+	return mapParams(params, func(name string, value string) (string, error) {
+		return c.Open(ctx, value)
+	})
+}
+
+// RedactParams copies params without the sensitive ones, which are left out rather than replaced by a placeholder
+func RedactParams(params map[string]string) map[string]string {
+	if params == nil {
+		return nil
+	}
+	redacted_params := make(map[string]string, len(params))
+	for name, value := range params {
+		if value != "" && (IsSensitiveParam(name) || IsSealed(value)) {
+			continue
+		}
+		redacted_params[name] = value
+	}
+	return redacted_params
+}
+
+// mapParams copies params with their values mapped, so the params given are left untouched
+func mapParams(params map[string]string, f func(name string, value string) (string, error)) (map[string]string, error) {
+	if params == nil {
+		return nil, nil
+	}
+	mapped := make(map[string]string, len(params))
+	for name, value := range params {
+		v, err := f(name, value)
+		if err != nil {
+			return nil, err
+		}
+		mapped[name] = v
+	}
+	return mapped, nil
+}
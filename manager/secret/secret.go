@@ -0,0 +1,234 @@
+package secret
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Values are sealed by envelope encryption: each of them is encrypted by a data key with AES-256-GCM,
+// and the data key is encrypted by the key of a KeyProvider and stored along with it, formatted as
+// `enc:v1:<key id>:<data key encrypted>:<value encrypted>`
+const sealed_prefix = "enc:v1:"
+const key_size = 32
+
+var (
+	InvalidKeyError    = errors.New("invalid key")
+	InvalidSealedError = errors.New("invalid sealed value")
+	UnknownKeyError    = errors.New("unknown key")
+)
+
+// KeyProvider encrypts data keys by a key it holds, which a KMS could hold instead of the manager
+type KeyProvider interface {
+	// KeyId identifies the key data keys are wrapped by now
+	KeyId() string
+	WrapKey(ctx context.Context, data_key []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, key_id string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyProvider wraps data keys by a key read from a file
+type LocalKeyProvider struct {
+	id  string
+	gcm cipher.AEAD
+}
+
+// NewLocalKeyProvider reads the key from path, which holds 32 bytes either in raw, hex or base64
+func NewLocalKeyProvider(path string) (*LocalKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key, err := parseKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalKeyProviderFromKey(key)
+}
+
+func NewLocalKeyProviderFromKey(key []byte) (*LocalKeyProvider, error) {
+	if len(key) != key_size {
+		return nil, errors.WithStack(fmt.Errorf("%w: key must be %d bytes, got %d", InvalidKeyError, key_size, len(key)))
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &LocalKeyProvider{id: hex.EncodeToString(sum[:4]), gcm: gcm}, nil
+}
+
+func parseKey(data []byte) ([]byte, error) {
+	if len(data) == key_size {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == key_size {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == key_size {
+		return key, nil
+	}
+	return nil, errors.WithStack(fmt.Errorf("%w: key file must hold %d bytes in raw, hex or base64", InvalidKeyError, key_size))
+}
+
+func (p *LocalKeyProvider) KeyId() string {
+	return p.id
+}
+
+func (p *LocalKeyProvider) WrapKey(ctx context.Context, data_key []byte) ([]byte, error) {
+	return seal(p.gcm, data_key)
+}
+
+func (p *LocalKeyProvider) UnwrapKey(ctx context.Context, key_id string, wrapped []byte) ([]byte, error) {
+	if key_id != p.id {
+		return nil, errors.WithStack(fmt.Errorf("%w: data key is wrapped by key %s, not %s", UnknownKeyError, key_id, p.id))
+	}
+	return open(p.gcm, wrapped)
+}
+
+// Cipher seals values by a data key generated when it's created, and opens the values sealed by any data key
+// its provider unwraps. A nil Cipher leaves values as they are, so credentials are kept in plain until a key is configured
+type Cipher struct {
+	provider    KeyProvider
+	key_id      string
+	wrapped_key string
+	gcm         cipher.AEAD
+	mu          sync.Mutex
+	gcms        map[string]cipher.AEAD //data keys unwrapped by the data keys wrapped
+}
+
+func NewCipher(ctx context.Context, provider KeyProvider) (*Cipher, error) {
+	data_key := make([]byte, key_size)
+	if _, err := io.ReadFull(rand.Reader, data_key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	wrapped, err := provider.WrapKey(ctx, data_key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(data_key)
+	if err != nil {
+		return nil, err
+	}
+	wrapped_key := base64.RawURLEncoding.EncodeToString(wrapped)
+	return &Cipher{
+		provider:    provider,
+		key_id:      provider.KeyId(),
+		wrapped_key: wrapped_key,
+		gcm:         gcm,
+		gcms:        map[string]cipher.AEAD{wrapped_key: gcm},
+	}, nil
+}
+
+// IsSealed tells whether value is sealed by a Cipher
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealed_prefix)
+}
+
+// Seal encrypts value, values empty or sealed already are returned as they are
+func (c *Cipher) Seal(ctx context.Context, value string) (string, error) {
+	if c == nil || value == "" || IsSealed(value) {
+		return value, nil
+	}
+	sealed, err := seal(c.gcm, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return sealed_prefix + strings.Join([]string{c.key_id, c.wrapped_key, base64.RawURLEncoding.EncodeToString(sealed)}, ":"), nil
+}
+
+// Open decrypts value sealed, values not sealed are returned as they are
+func (c *Cipher) Open(ctx context.Context, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", errors.WithStack(fmt.Errorf("%w: no key is configured to open it", UnknownKeyError))
+	}
+	parts := strings.Split(strings.TrimPrefix(value, sealed_prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.WithStack(InvalidSealedError)
+	}
+	gcm, err := c.dataKey(ctx, parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.WithStack(fmt.Errorf("%w: %s", InvalidSealedError, err.Error()))
+	}
+	data, err := open(gcm, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// dataKey unwraps the data key once, values sealed by a manager share its data key
+func (c *Cipher) dataKey(ctx context.Context, key_id string, wrapped_key string) (cipher.AEAD, error) {
+	c.mu.Lock()
+	gcm, ok := c.gcms[wrapped_key]
+	c.mu.Unlock()
+	if ok {
+		return gcm, nil
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(wrapped_key)
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidSealedError, err.Error()))
+	}
+	data_key, err := c.provider.UnwrapKey(ctx, key_id, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err = newGCM(data_key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.gcms[wrapped_key] = gcm
+	c.mu.Unlock()
+	return gcm, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidKeyError, err.Error()))
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return gcm, nil
+}
+
+// seal encrypts data by gcm with a random nonce, which is prepended to the result
+func seal(gcm cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func open(gcm cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.WithStack(InvalidSealedError)
+	}
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("%w: %s", InvalidSealedError, err.Error()))
+	}
+	return data, nil
+}
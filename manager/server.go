@@ -8,10 +8,12 @@ import (
 
 	"github.com/WALL-EEEEEEE/proxy-service/common"
 
+	"github.com/WALL-EEEEEEE/proxy-service/manager/auth"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
 	conf "github.com/WALL-EEEEEEE/proxy-service/manager/config"
 	ends "github.com/WALL-EEEEEEE/proxy-service/manager/endpoint"
 	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 	servs "github.com/WALL-EEEEEEE/proxy-service/manager/service"
 	trans "github.com/WALL-EEEEEEE/proxy-service/manager/transport"
 
@@ -32,7 +34,10 @@ var logger = log.StandardLogger()
 
 var LoggingEndpointMiddleware = common.LoggingMiddleware
 
-func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
+// ProxyWatcher runs in process along with the server on its store of proxies, e.g. the check job of a single node
+type ProxyWatcher func(ctx context.Context, proxy_store cache.ProxyRepository, cipher *secret.Cipher)
+
+func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string, watchers ...ProxyWatcher) {
 	logger.Debugf("Config: %+v", conf)
 	redis_cli, err := SetupRedis(conf)
 	if err != nil {
@@ -42,15 +47,40 @@ func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
 	if err != nil {
 		logger.Fatalf("failed to init db! (error: %+v) ", err)
 	}
+	cipher, err := SetupCipher(ctx, conf)
+	if err != nil {
+		logger.Fatalf("failed to init cipher! (error: %+v) ", err)
+	}
+	if err := auth.ValidateTokens(conf.Auth.Tokens); err != nil {
+		logger.Fatalf("failed to init auth! (error: %+v) ", err)
+	}
 	//proxy service
-	proxy_store := cache.NewProxyStore(redis_cli)
-	proxy_service := servs.NewProxyService(logger, proxy_store)
+	proxy_store, err := SetupProxyStore(conf, redis_cli)
+	if err != nil {
+		logger.Fatalf("failed to init proxy store! (error: %+v) ", err)
+	}
+	go func() {
+		if err := proxy_store.WatchExpiry(ctx); err != nil {
+			logger.Errorf("failed to watch expiry of proxies! (error: %+v) ", err)
+		}
+	}()
+	for _, watcher := range watchers {
+		go watcher(ctx, proxy_store, cipher)
+	}
+	proxy_service := servs.NewProxyService(logger, proxy_store, cipher)
 	proxy_service_end := ends.NewProxyServiceEndpoint(proxy_service)
 	//add request auto logging
 	proxy_service_end.ListProxies = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.ListProxies)
 	proxy_service_end.AddProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.AddProxy)
+	proxy_service_end.AddProxies = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.AddProxies)
 	proxy_service_end.UpdateProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.UpdateProxy)
 	proxy_service_end.DeleteProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.DeleteProxy)
+	proxy_service_end.DeleteProxies = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.DeleteProxies)
+	proxy_service_end.GetPoolStats = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.GetPoolStats)
+	proxy_service_end.AcquireProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.AcquireProxy)
+	proxy_service_end.ReleaseProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.ReleaseProxy)
+	proxy_service_end.RecordProxyCheck = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.RecordProxyCheck)
+	proxy_service_end.GetProxyHistory = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.GetProxyHistory)
 	proxy_service_end.GetProxy = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.GetProxy)
 	proxy_service_end.GetProxyByIp = LoggingEndpointMiddleware(logger, logger)(proxy_service_end.GetProxyByIp)
 
@@ -68,7 +98,7 @@ func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
 	proxy_provider_service_grpc_server := trans.NewProxyProviderServiceTransport(proxy_provider_service_end, logger)
 
 	//proxy api service
-	proxy_api_service := servs.NewProxyApiService(db, redis_cli)
+	proxy_api_service := servs.NewProxyApiService(db, redis_cli, cipher)
 	proxy_api_service_end := ends.NewProxyApiServiceEndpoint(proxy_api_service)
 
 	//add request auto logging
@@ -79,6 +109,14 @@ func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
 
 	proxy_api_service_grpc_server := trans.NewProxyApiServiceTransport(proxy_api_service_end, logger)
 
+	//gateway service
+	gateway_service := servs.NewGatewayService(logger, proxy_store)
+	gateway_service_end := ends.NewGatewayServiceEndpoint(gateway_service)
+	//add request auto logging
+	gateway_service_end.ReportProxyEvent = LoggingEndpointMiddleware(logger, logger)(gateway_service_end.ReportProxyEvent)
+
+	gateway_service_grpc_server := trans.NewGatewayServiceTransport(gateway_service_end, logger)
+
 	// The gRPC listener mounts the Go kit gRPC server we created.
 	grpcAddr := fmt.Sprintf(":%s", grpcPort)
 	grpcListener, err := net.Listen("tcp", grpcAddr)
@@ -93,7 +131,7 @@ func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
 	if err != nil {
 		logger.Fatalf("failed to init validator! (error: %+v) ", err)
 	}
-	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(protovalidate_middleware.UnaryServerInterceptor(validator), gokit_grpc.Interceptor))
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(protovalidate_middleware.UnaryServerInterceptor(validator), auth.UnaryServerInterceptor(conf.Auth.Tokens), gokit_grpc.Interceptor))
 
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(grpcServer, healthcheck)
@@ -105,6 +143,8 @@ func startGrpcServer(ctx context.Context, conf *conf.Config, grpcPort string) {
 	pb.RegisterProxyProviderServiceServer(grpcServer, proxy_provider_service_grpc_server)
 	//register the proxy api service grpc server
 	pb.RegisterProxyApiServiceServer(grpcServer, proxy_api_service_grpc_server)
+	//register the gateway service grpc server
+	pb.RegisterGatewayServiceServer(grpcServer, gateway_service_grpc_server)
 	//enable reflection service on gRPC server.
 	reflection.Register(grpcServer)
 
@@ -130,6 +170,10 @@ func startHttpServer(ctx context.Context, conf *conf.Config, grpcPort, httpPort
 		logger.Fatalf("failed to register http handler for proxy api service in the gateway: %v", err)
 	}
 
+	if err := pb.RegisterGatewayServiceHandlerFromEndpoint(ctx, mux, "localhost:"+grpcPort, opts); err != nil {
+		logger.Fatalf("failed to register http handler for gateway service in the gateway: %v", err)
+	}
+
 	srv := &http.Server{
 		Addr:    ":" + httpPort,
 		Handler: mux,
@@ -138,9 +182,10 @@ func startHttpServer(ctx context.Context, conf *conf.Config, grpcPort, httpPort
 	srv.ListenAndServe()
 }
 
-func StartServer(conf *conf.Config, grpcPort, httpPort string) {
+// StartServer starts the grpc and http servers, watchers are run on the store of proxies once it's set up
+func StartServer(conf *conf.Config, grpcPort, httpPort string, watchers ...ProxyWatcher) {
 	ctx := context.Background()
-	go startGrpcServer(ctx, conf, grpcPort)
+	go startGrpcServer(ctx, conf, grpcPort, watchers...)
 	go startHttpServer(ctx, conf, grpcPort, httpPort)
 	<-ctx.Done()
 }
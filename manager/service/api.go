@@ -4,13 +4,14 @@ package service
 import (
 	"context"
 	"crypto/md5"
-	"encoding/json"
 	"errors"
 	"fmt"
 
+	"github.com/WALL-EEEEEEE/proxy-service/manager/auth"
 	event "github.com/WALL-EEEEEEE/proxy-service/manager/event"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/repository"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
@@ -30,6 +31,8 @@ type IProxyApiService interface {
 type ProxyApiService struct {
 	db        *gorm.DB
 	event_bus *redis.Client
+	publisher event.Publisher
+	cipher    *secret.Cipher
 }
 
 func exists[T any](db *gorm.DB, condition T) (bool, error) {
@@ -44,13 +47,28 @@ func exists[T any](db *gorm.DB, condition T) (bool, error) {
 	return true, nil
 }
 
-func NewProxyApiService(db *gorm.DB, event_bus *redis.Client) *ProxyApiService {
+// NewProxyApiService creates the service of apis, whose sensitive params are sealed by cipher before stored, nil keeps them in plain
+func NewProxyApiService(db *gorm.DB, event_bus *redis.Client, cipher *secret.Cipher) *ProxyApiService {
 	return &ProxyApiService{
 		db:        db,
 		event_bus: event_bus,
+		publisher: event.NewPublisher(event.SOURCE_API_SERVICE),
+		cipher:    cipher,
 	}
 }
 
+// revealParams opens the sensitive params of an api for the callers granted auth.SCOPE_CREDENTIALS, and redacts them for the others
+func (p ProxyApiService) revealParams(ctx context.Context, params map[string]string) (map[string]string, error) {
+	if !auth.HasScope(ctx, auth.SCOPE_CREDENTIALS) {
+		return secret.RedactParams(params), nil
+	}
+	params, err := p.cipher.OpenParams(ctx, params)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to open params (err: %s)", err.Error()))
+	}
+	return params, nil
+}
+
 func (p ProxyApiService) GetApi(ctx context.Context, id string) (*model.ProxyApi, error) {
 	var api repository.ProxyApi
 	result := p.db.Where(repository.ProxyApi{ApiId: id}).First(&api)
@@ -65,7 +83,11 @@ func (p ProxyApiService) GetApi(ctx context.Context, id string) (*model.ProxyApi
 	ret_api.UpdateInterval = api.UpdateInterval
 	ret_api.Name = api.Name
 	ret_api.ProviderId = api.ProviderId
-	ret_api.Service = model.Service{Host: api.Service.Host, Name: api.Service.Name, Params: api.Service.Params}
+	params, err := p.revealParams(ctx, api.Service.Params)
+	if err != nil {
+		return nil, err
+	}
+	ret_api.Service = model.Service{Host: api.Service.Host, Name: api.Service.Name, Params: params}
 	return &ret_api, nil
 }
 
@@ -92,7 +114,11 @@ func (p ProxyApiService) GetApiByProvider(ctx context.Context, provider_id strin
 		ret_api.UpdateInterval = api.UpdateInterval
 		ret_api.Name = api.Name
 		ret_api.ProviderId = api.ProviderId
-		ret_api.Service = model.Service{Host: api.Service.Host, Name: api.Service.Name, Params: api.Service.Params}
+		params, err := p.revealParams(ctx, api.Service.Params)
+		if err != nil {
+			return nil, err
+		}
+		ret_api.Service = model.Service{Host: api.Service.Host, Name: api.Service.Name, Params: params}
 		ret_apis = append(ret_apis, ret_api)
 	}
 	return ret_apis, nil
@@ -118,11 +144,16 @@ func (p ProxyApiService) AddApi(ctx context.Context, proxy_api model.ProxyApi) (
 	if err != nil {
 		return nil, err
 	}
+	//params are sealed before stored and published in events, the api check job opens them to request the api
+	params, err := p.cipher.SealParams(ctx, proxy_api.Service.Params)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to seal params of proxy api %s (err: %s)", proxy_api.Name, err.Error()))
+	}
 	var api repository.ProxyApi = repository.ProxyApi{
 		ProviderId:     provider_id,
 		Name:           proxy_api.Name,
 		ApiId:          id,
-		Service:        repository.Service{Host: proxy_api.Service.Host, Name: proxy_api.Service.Name, Params: proxy_api.Service.Params},
+		Service:        repository.Service{Host: proxy_api.Service.Host, Name: proxy_api.Service.Name, Params: params},
 		UpdateInterval: proxy_api.UpdateInterval,
 	}
 	result := p.db.Where(repository.ProxyApi{ApiId: id}).FirstOrCreate(&api)
@@ -136,19 +167,10 @@ func (p ProxyApiService) AddApi(ctx context.Context, proxy_api model.ProxyApi) (
 		Id:             id,
 		UpdateInterval: proxy_api.UpdateInterval,
 		Name:           proxy_api.Name,
-		Service:        model.Service{Host: proxy_api.Service.Host, Name: proxy_api.Service.Name, Params: proxy_api.Service.Params},
+		Service:        model.Service{Host: proxy_api.Service.Host, Name: proxy_api.Service.Name, Params: params},
 		ProviderId:     provider_id,
 	}
-	check_api_item_data, err := json.Marshal(check_api_item)
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	retCmd := p.event_bus.XAdd(ctx, &redis.XAddArgs{
-		Stream: event.EVENT_CHECKAPI_CREATED,
-		Values: map[string]interface{}{
-			"data": check_api_item_data,
-		},
-	})
+	retCmd := p.publisher.PublishApi(ctx, p.event_bus, event.EVENT_CHECKAPI_CREATED, check_api_item)
 	err = retCmd.Err()
 	if err != nil {
 		log.Warnf("Failed check_api (id: %s) event failed: %s (code: %s)", id, err.Error(), retCmd.Val())
@@ -2,17 +2,67 @@ package service
 
 // Proxy provides operations on proxy.
 import (
-	"github.com/redis/go-redis/v9"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type IGatewayService interface {
+	ReportProxyEvent(context.Context, string, pb.ProxyEventType, string, time.Time, time.Time) error
 }
 
 type GatewayService struct {
-	logger *logrus.Logger
+	logger      *logrus.Logger
+	proxy_store cache.ProxyRepository
+}
+
+func NewGatewayService(logger *logrus.Logger, proxy_store cache.ProxyRepository) *GatewayService {
+	return &GatewayService{
+		logger:      logger,
+		proxy_store: proxy_store,
+	}
 }
 
-func NewGatewayService(logger *logrus.Logger, redis_cli *redis.Client) *GatewayService {
+// ReportProxyEvent sets the availability of the proxy reported by a gateway at reported_at, a proxy reported unavailable
+// until the gateway probes it again is made available again then, so that it isn't left unavailable
+// if the gateway never reports it available
+func (g GatewayService) ReportProxyEvent(ctx context.Context, id string, event_type pb.ProxyEventType, reason string, reported_at time.Time, until time.Time) error {
+	logger := g.logger.WithFields(logrus.Fields{
+		"class":  "GatewayService",
+		"method": "ReportProxyEvent",
+		"id":     id,
+		"event":  event_type.String(),
+	})
+	var available bool
+	switch event_type {
+	case pb.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE:
+		available = false
+	case pb.ProxyEventType_PROXY_EVENT_TYPE_AVAILABLE:
+		available = true
+	default:
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid proxy event type %s", event_type.String()))
+	}
+	if !until.IsZero() && !reported_at.IsZero() && !until.After(reported_at) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("until %s isn't after the time %s reported at", until, reported_at))
+	}
+	if available {
+		until = time.Time{}
+	}
+	logger.Infof("reason: %s, reported at: %s, until: %s", reason, reported_at, until)
+	err := g.proxy_store.SetAvailable(ctx, id, available, until)
+	if err != nil {
+		if errors.Is(err, cache.ProxyNotFoundError) {
+			return status.Error(codes.NotFound, fmt.Sprintf("proxy with id %s doesn't exists", id))
+		}
+		return status.Error(codes.Internal, fmt.Sprintf("failed to report event of proxy %s (error: %s)", id, err.Error()))
+	}
 	return nil
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+
+	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayServiceReportProxyEvent(t *testing.T) {
+	_, store, ids := newTestProxyService(t, newTestProxy("192.0.2.1", "US"))
+	service := NewGatewayService(logrus.StandardLogger(), store)
+	ctx := context.Background()
+	available := func() bool {
+		var proxy model.Proxy
+		assert.Nil(t, store.GetById(ctx, ids[0], &proxy))
+		return proxy.Attr.Availiable
+	}
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "ReportProxyEvent.Unavailable",
+			Input:    time.Now().Add(time.Hour),
+			Error:    nil,
+			Expected: false,
+			Check: func(tc test.TestCase[any, any]) {
+				err := service.ReportProxyEvent(ctx, ids[0], pb.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE, "breaker opened", time.Now(), tc.Input.(time.Time))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, available())
+			},
+		},
+		{
+			Name:     "ReportProxyEvent.Available",
+			Input:    time.Time{},
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				err := service.ReportProxyEvent(ctx, ids[0], pb.ProxyEventType_PROXY_EVENT_TYPE_AVAILABLE, "breaker closed", time.Now(), tc.Input.(time.Time))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, available())
+			},
+		},
+		{
+			Name:     "ReportProxyEvent.UnavailableUntilPassed",
+			Input:    time.Now().Add(-time.Second),
+			Error:    nil,
+			Expected: true,
+			Check: func(tc test.TestCase[any, any]) {
+				//the proxy is made available again once until is passed, without the gateway reporting it
+				err := service.ReportProxyEvent(ctx, ids[0], pb.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE, "breaker opened", time.Now().Add(-time.Minute), tc.Input.(time.Time))
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, available())
+			},
+		},
+		{
+			Name:     "ReportProxyEvent.UntilBeforeTime",
+			Input:    time.Now().Add(-time.Minute),
+			Error:    nil,
+			Expected: codes.InvalidArgument,
+			Check: func(tc test.TestCase[any, any]) {
+				err := service.ReportProxyEvent(ctx, ids[0], pb.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE, "breaker opened", time.Now(), tc.Input.(time.Time))
+				assert.Equal(t, tc.Expected, status.Code(err))
+			},
+		},
+		{
+			Name:     "ReportProxyEvent.InvalidType",
+			Input:    time.Time{},
+			Error:    nil,
+			Expected: codes.InvalidArgument,
+			Check: func(tc test.TestCase[any, any]) {
+				err := service.ReportProxyEvent(ctx, ids[0], pb.ProxyEventType_PROXY_EVENT_TYPE_UNSPECIFIED, "", time.Now(), tc.Input.(time.Time))
+				assert.Equal(t, tc.Expected, status.Code(err))
+			},
+		},
+		{
+			Name:     "ReportProxyEvent.NotFound",
+			Input:    time.Time{},
+			Error:    nil,
+			Expected: codes.NotFound,
+			Check: func(tc test.TestCase[any, any]) {
+				err := service.ReportProxyEvent(ctx, "none", pb.ProxyEventType_PROXY_EVENT_TYPE_UNAVAILABLE, "", time.Now(), tc.Input.(time.Time))
+				assert.Equal(t, tc.Expected, status.Code(err))
+			},
+		},
+	}
+	test.Run(cases, t)
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/WALL-EEEEEEE/proxy-service/common"
 
+	"github.com/WALL-EEEEEEE/proxy-service/manager/auth"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
 	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 
 	"github.com/rotisserie/eris"
 	"github.com/sirupsen/logrus"
@@ -31,27 +34,61 @@ type Filter = common.Filter[any]
 type Paginator common.Paginator[model.Proxy]
 
 type IProxyService interface {
-	ListProxies(context.Context, int64, int64, *pb.Filter) (*Paginator, error)
+	ListProxies(context.Context, int64, int64, *pb.Filter, []string, ...*pb.PropertyOrder) (*Paginator, error)
 	GetProxy(context.Context, string) (*model.Proxy, error)
 	GetProxyByIp(context.Context, string) (*model.Proxy, error)
 	AddProxy(context.Context, model.Proxy) (*string, error)
+	AddProxies(context.Context, []model.Proxy, bool) ([]model.AddProxyResult, error)
 	UpdateProxy(context.Context, string, model.Proxy, []string) error
 	DeleteProxy(context.Context, string) error
+	DeleteProxies(context.Context, *pb.Filter) ([]string, error)
+	GetPoolStats(context.Context, *pb.Filter, []string) (*model.PoolStats, []model.PoolStatsGroup, error)
+	AcquireProxy(context.Context, *pb.Filter, time.Duration, bool, string, string) (*model.Lease, error)
+	ReleaseProxy(context.Context, string, model.LEASE_OUTCOME) error
+	RecordProxyCheck(context.Context, string, model.CheckResult) (float64, error)
+	GetProxyHistory(context.Context, string, int) ([]model.CheckResult, float64, error)
 }
 
 type ProxyService struct {
 	logger      *logrus.Logger
-	proxy_store *cache.ProxyStore
+	proxy_store cache.ProxyRepository
+	cipher      *secret.Cipher
 }
 
-func NewProxyService(logger *logrus.Logger, proxy_store *cache.ProxyStore) *ProxyService {
+// NewProxyService creates the service of proxies, whose credentials are sealed by cipher before stored, nil keeps them in plain
+func NewProxyService(logger *logrus.Logger, proxy_store cache.ProxyRepository, cipher *secret.Cipher) *ProxyService {
 	return &ProxyService{
 		logger:      logger,
 		proxy_store: proxy_store,
+		cipher:      cipher,
 	}
 }
 
-func (p ProxyService) ListProxies(ctx context.Context, limit, offset int64, filter *pb.Filter) (*Paginator, error) {
+// sealProxy seals the credentials of proxy before it's stored and published in events
+func (p ProxyService) sealProxy(ctx context.Context, proxy *model.Proxy) error {
+	if err := p.cipher.SealUseConfig(ctx, proxy.UseConfig); err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("failed to seal credentials of proxy %s (err: %s)", proxy.Ip, err.Error()))
+	}
+	return nil
+}
+
+// revealProxy opens the credentials of proxy for the callers granted auth.SCOPE_CREDENTIALS, and redacts them for the others
+func (p ProxyService) revealProxy(ctx context.Context, proxy *model.Proxy) error {
+	if proxy == nil || proxy.UseConfig == nil {
+		return nil
+	}
+	if !auth.HasScope(ctx, auth.SCOPE_CREDENTIALS) {
+		p.cipher.RedactUseConfig(ctx, proxy.UseConfig)
+		return nil
+	}
+	if err := p.cipher.OpenUseConfig(ctx, proxy.UseConfig); err != nil {
+		return status.Error(codes.Internal, fmt.Sprintf("failed to open credentials of proxy %s (err: %s)", proxy.Id, err.Error()))
+	}
+	return nil
+}
+
+// ListProxies lists the proxies with fields only, all of them if fields is empty
+func (p ProxyService) ListProxies(ctx context.Context, limit, offset int64, filter *pb.Filter, fields []string, orders ...*pb.PropertyOrder) (*Paginator, error) {
 	_ = logrus.WithFields(logrus.Fields{
 		"class":  "ProxyService",
 		"method": "ListProxies",
@@ -64,10 +101,18 @@ func (p ProxyService) ListProxies(ctx context.Context, limit, offset int64, filt
 		Items:  proxies,
 	}
 	_paginator := common.Paginator[model.Proxy](paginator)
-	err := p.proxy_store.ListWithFilters(ctx, &_paginator, filter)
+	err := p.proxy_store.ListWithFilters(ctx, &_paginator, filter, fields, orders...)
 	if err != nil {
+		if errors.Is(err, cache.InvalidFilterError) || errors.Is(err, cache.InvalidOrderError) || errors.Is(err, cache.InvalidFieldError) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed list proxy with filters %+v (err: %s)", filter, err.Error()))
 	}
+	for i := range _paginator.Items {
+		if err := p.revealProxy(ctx, &_paginator.Items[i]); err != nil {
+			return nil, err
+		}
+	}
 	ret_paginator := Paginator(_paginator)
 	return &ret_paginator, nil
 }
@@ -81,6 +126,9 @@ func (p ProxyService) GetProxy(ctx context.Context, id string) (*model.Proxy, er
 		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed get proxy by id %s (err: %s)", id, err.Error()))
 	}
+	if err := p.revealProxy(ctx, &proxy); err != nil {
+		return nil, err
+	}
 	return &proxy, nil
 }
 
@@ -93,6 +141,9 @@ func (p ProxyService) GetProxyByIp(ctx context.Context, ip string) (*model.Proxy
 		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed get proxy %s (err: %s)", ip, err.Error()))
 	}
+	if err := p.revealProxy(ctx, &proxy); err != nil {
+		return nil, err
+	}
 	return &proxy, nil
 }
 
@@ -101,12 +152,20 @@ func (p ProxyService) AddProxy(ctx context.Context, proxy model.Proxy) (*string,
 		"class":  "ProxyService",
 		"method": "AddProxy",
 	})
-	if_exists, err := p.proxy_store.ExistsIp(ctx, proxy.Ip)
+	//the same ip may be served by several providers or apis, so proxies are told apart by id
+	id, err := cache.ProxyId(proxy)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to add proxy %s (err: %s)", proxy.Ip, err.Error()))
+	}
+	if_exists, err := p.proxy_store.ExistsId(ctx, id)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to add proxy %s (err: %s)", proxy.Ip, err.Error()))
 	}
 	if if_exists {
-		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("proxy %s already exists", proxy.Ip))
+		return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("proxy %s:%d of api %s already exists", proxy.Ip, proxy.Port, proxy.ApiId))
+	}
+	if err := p.sealProxy(ctx, &proxy); err != nil {
+		return nil, err
 	}
 	proxy_id, err := p.proxy_store.Add(ctx, &proxy)
 	if err != nil {
@@ -116,12 +175,29 @@ func (p ProxyService) AddProxy(ctx context.Context, proxy model.Proxy) (*string,
 	return proxy_id, nil
 }
 
+// AddProxies adds proxies in batch, a proxy failed doesn't fail the others but is reported in its result
+func (p ProxyService) AddProxies(ctx context.Context, proxies []model.Proxy, upsert bool) ([]model.AddProxyResult, error) {
+	for i := range proxies {
+		if err := p.sealProxy(ctx, &proxies[i]); err != nil {
+			return nil, err
+		}
+	}
+	results, err := p.proxy_store.AddBatch(ctx, proxies, upsert)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to add %d proxies (err: %s)", len(proxies), err.Error()))
+	}
+	return results, nil
+}
+
 func (p ProxyService) UpdateProxy(ctx context.Context, id string, proxy model.Proxy, paths []string) error {
 	logger := logrus.WithFields(logrus.Fields{
 		"class":  "ProxyService",
 		"method": "UpdateProxy",
 		"paths":  paths,
 	})
+	if err := p.sealProxy(ctx, &proxy); err != nil {
+		return err
+	}
 	logger.Infof("%#v", proxy)
 	err := p.proxy_store.Update(ctx, id, proxy, paths)
 	if err != nil {
@@ -133,5 +209,92 @@ func (p ProxyService) UpdateProxy(ctx context.Context, id string, proxy model.Pr
 	return nil
 }
 func (p ProxyService) DeleteProxy(ctx context.Context, id string) error {
+	err := p.proxy_store.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, cache.ProxyNotFoundError) {
+			return status.Error(codes.NotFound, fmt.Sprintf("proxy with id %s doesn't exists", id))
+		}
+		return status.Error(codes.Internal, fmt.Sprintf("failed to delete proxy %s (error: %s)", id, err.Error()))
+	}
 	return nil
 }
+
+func (p ProxyService) GetPoolStats(ctx context.Context, filter *pb.Filter, group_by []string) (*model.PoolStats, []model.PoolStatsGroup, error) {
+	total, groups, err := p.proxy_store.Stats(ctx, filter, group_by...)
+	if err != nil {
+		if errors.Is(err, cache.InvalidFilterError) {
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, nil, status.Error(codes.Internal, fmt.Sprintf("failed to get stats of proxies with filters %+v (error: %s)", filter, err.Error()))
+	}
+	return total, groups, nil
+}
+
+// AcquireProxy leases a proxy matched by filter for duration, see ProxyStore.Acquire
+func (p ProxyService) AcquireProxy(ctx context.Context, filter *pb.Filter, duration time.Duration, exclusive bool, scope string, consumer string) (*model.Lease, error) {
+	lease, err := p.proxy_store.Acquire(ctx, filter, duration, exclusive, scope, consumer)
+	if err != nil {
+		if errors.Is(err, cache.InvalidFilterError) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, cache.ProxyNotFoundError) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no proxy matched filters %+v", filter))
+		}
+		if errors.Is(err, cache.LeaseUnavailableError) {
+			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("all the proxies matched filters %+v are leased exclusively in scope %q", filter, scope))
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to acquire proxy with filters %+v (error: %s)", filter, err.Error()))
+	}
+	if err := p.revealProxy(ctx, lease.Proxy); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func (p ProxyService) ReleaseProxy(ctx context.Context, lease_id string, outcome model.LEASE_OUTCOME) error {
+	err := p.proxy_store.Release(ctx, lease_id, outcome)
+	if err != nil {
+		if errors.Is(err, cache.LeaseNotFoundError) {
+			return status.Error(codes.NotFound, fmt.Sprintf("lease %s doesn't exist or has expired", lease_id))
+		}
+		return status.Error(codes.Internal, fmt.Sprintf("failed to release lease %s (error: %s)", lease_id, err.Error()))
+	}
+	return nil
+}
+
+// RecordProxyCheck keeps result in the history of the proxy and returns its stability, see ProxyStore.AddCheckResult
+func (p ProxyService) RecordProxyCheck(ctx context.Context, id string, result model.CheckResult) (float64, error) {
+	stability, err := p.proxy_store.AddCheckResult(ctx, id, result)
+	if err != nil {
+		if errors.Is(err, cache.ProxyNotFoundError) {
+			return 0, status.Error(codes.NotFound, fmt.Sprintf("proxy %s doesn't exist", id))
+		}
+		return 0, status.Error(codes.Internal, fmt.Sprintf("failed to record check of proxy %s (error: %s)", id, err.Error()))
+	}
+	return stability, nil
+}
+
+func (p ProxyService) GetProxyHistory(ctx context.Context, id string, limit int) ([]model.CheckResult, float64, error) {
+	results, stability, err := p.proxy_store.ListCheckResults(ctx, id, limit)
+	if err != nil {
+		if errors.Is(err, cache.ProxyNotFoundError) {
+			return nil, 0, status.Error(codes.NotFound, fmt.Sprintf("proxy %s doesn't exist", id))
+		}
+		return nil, 0, status.Error(codes.Internal, fmt.Sprintf("failed to get history of proxy %s (error: %s)", id, err.Error()))
+	}
+	return results, stability, nil
+}
+
+func (p ProxyService) DeleteProxies(ctx context.Context, filter *pb.Filter) ([]string, error) {
+	ids, err := p.proxy_store.DeleteWithFilters(ctx, filter)
+	if err != nil {
+		if errors.Is(err, cache.InvalidFilterError) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, cache.EmptyFilterError) {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("filter %+v matches no field, refused to delete all proxies", filter))
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to delete proxies with filters %+v, %d deleted (error: %s)", filter, len(ids), err.Error()))
+	}
+	return ids, nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WALL-EEEEEEE/proxy-service/manager/auth"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/event"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/model"
+
+	"github.com/WALL-EEEEEEE/Axiom/test"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestProxy(ip string, country string) model.Proxy {
+	return model.Proxy{ProviderId: "p", ApiId: "a", Ip: ip, Port: 8080, Ttl: -1, Proto: []model.PROTO{model.PROTO_HTTP},
+		Attr:      &model.Attr{Latency: 100, Availiable: true, Country: country},
+		UseConfig: &model.UseConfig{Host: ip, Port: 8080, User: "user", Password: "pass", Psn: "http://user:pass@" + ip + ":8080"}}
+}
+
+// newTestProxyService returns the service of proxies on a memory store with the proxies added, in the order of ids returned
+func newTestProxyService(t *testing.T, proxies ...model.Proxy) (*ProxyService, *cache.MemoryProxyStore, []string) {
+	store := cache.NewMemoryProxyStore()
+	service := NewProxyService(logrus.StandardLogger(), store, nil)
+	ids := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		id, err := service.AddProxy(context.Background(), proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, *id)
+	}
+	return service, store, ids
+}
+
+func countryFilter(country string) *pb.Filter {
+	return &pb.Filter{FilterType: &pb.Filter_PropertyFilter{PropertyFilter: &pb.PropertyFilter{
+		Property: &pb.PropertyReference{Name: "country"}, Op: pb.PropertyFilter_EQUAL, Value: country,
+	}}}
+}
+
+func TestProxyServiceGetProxy(t *testing.T) {
+	service, _, ids := newTestProxyService(t, newTestProxy("192.0.2.1", "US"))
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "GetProxy.Redacted",
+			Input:    context.Background(),
+			Error:    nil,
+			Expected: nil,
+			Check: func(tc test.TestCase[any, any]) {
+				proxy, err := service.GetProxy(tc.Input.(context.Context), ids[0])
+				assert.Nil(t, err)
+				assert.Equal(t, "", proxy.UseConfig.Password)
+				assert.True(t, proxy.UseConfig.Redacted)
+				assert.Equal(t, "http://user@192.0.2.1:8080", proxy.UseConfig.Psn)
+			},
+		},
+		{
+			Name:     "GetProxy.Credentials",
+			Input:    auth.NewContext(context.Background(), auth.SCOPE_CREDENTIALS),
+			Error:    nil,
+			Expected: "pass",
+			Check: func(tc test.TestCase[any, any]) {
+				proxy, err := service.GetProxy(tc.Input.(context.Context), ids[0])
+				assert.Nil(t, err)
+				assert.Equal(t, tc.Expected, proxy.UseConfig.Password)
+				assert.False(t, proxy.UseConfig.Redacted)
+			},
+		},
+		{
+			Name:     "GetProxy.NotFound",
+			Input:    context.Background(),
+			Error:    nil,
+			Expected: codes.NotFound,
+			Check: func(tc test.TestCase[any, any]) {
+				_, err := service.GetProxy(tc.Input.(context.Context), "none")
+				assert.Equal(t, tc.Expected, status.Code(err))
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestProxyServiceAddProxy(t *testing.T) {
+	service, _, _ := newTestProxyService(t, newTestProxy("192.0.2.1", "US"))
+	_, err := service.AddProxy(context.Background(), newTestProxy("192.0.2.1", "US"))
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	id, err := service.AddProxy(context.Background(), newTestProxy("192.0.2.2", "FR"))
+	assert.Nil(t, err)
+	paginator, err := service.ListProxies(context.Background(), 10, 0, countryFilter("FR"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), paginator.Total)
+	assert.Equal(t, *id, paginator.Items[0].Id)
+	_, err = service.ListProxies(context.Background(), 10, 0, countryFilter("FR"), []string{"unknown"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestProxyServiceDeleteProxies(t *testing.T) {
+	service, _, ids := newTestProxyService(t, newTestProxy("192.0.2.1", "US"), newTestProxy("192.0.2.2", "FR"), newTestProxy("192.0.2.3", "US"))
+	ctx := context.Background()
+	_, err := service.DeleteProxies(ctx, &pb.Filter{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	deleted, err := service.DeleteProxies(ctx, countryFilter("US"))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{ids[0], ids[2]}, deleted)
+	_, err = service.GetProxy(ctx, ids[0])
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = service.GetProxy(ctx, ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(service.DeleteProxy(ctx, ids[0])))
+	assert.Nil(t, service.DeleteProxy(ctx, ids[1]))
+}
+
+func TestProxyServiceLease(t *testing.T) {
+	service, _, ids := newTestProxyService(t, newTestProxy("192.0.2.1", "US"))
+	ctx := context.Background()
+	lease, err := service.AcquireProxy(ctx, countryFilter("US"), time.Minute, true, "crawler", "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, ids[0], lease.ProxyId)
+	assert.True(t, lease.Proxy.UseConfig.Redacted)
+	_, err = service.AcquireProxy(ctx, countryFilter("US"), time.Minute, true, "crawler", "c2")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = service.AcquireProxy(ctx, countryFilter("FR"), time.Minute, true, "crawler", "c2")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Nil(t, service.ReleaseProxy(ctx, lease.Id, model.LEASE_OUTCOME_SUCCESS))
+	assert.Equal(t, codes.NotFound, status.Code(service.ReleaseProxy(ctx, lease.Id, model.LEASE_OUTCOME_SUCCESS)))
+}
+
+// TestProxyServiceWatch checks the events the check job of a single node watches on the memory store
+func TestProxyServiceWatch(t *testing.T) {
+	service, store, _ := newTestProxyService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := store.Watch(ctx, event.EVENT_PROXY_CREATED, event.EVENT_PROXY_DELETED)
+	assert.Nil(t, err)
+	id, err := service.AddProxy(ctx, newTestProxy("192.0.2.1", "US"))
+	assert.Nil(t, err)
+	created := <-events
+	assert.Equal(t, event.EVENT_PROXY_CREATED, created.Type)
+	assert.Equal(t, *id, created.Proxy.Id)
+	assert.Nil(t, service.DeleteProxy(ctx, *id))
+	deleted := <-events
+	assert.Equal(t, event.EVENT_PROXY_DELETED, deleted.Type)
+	assert.Equal(t, *id, deleted.Proxy.Id)
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+}
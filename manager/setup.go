@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -10,6 +11,7 @@ import (
 	"github.com/WALL-EEEEEEE/proxy-service/manager/cache"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/config"
 	"github.com/WALL-EEEEEEE/proxy-service/manager/repository"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/secret"
 
 	nested "github.com/antonfisher/nested-logrus-formatter"
 	"github.com/redis/go-redis/v9"
@@ -96,6 +98,32 @@ func SetupRedis(conf *config.Config) (*redis.Client, error) {
 
 }
 
+func SetupProxyStore(conf *config.Config, redis_cli *redis.Client) (cache.ProxyRepository, error) {
+	//init the store of proxies
+	switch conf.Store.Backend {
+	case "", "redis":
+		return cache.NewProxyStore(redis_cli), nil
+	case "memory":
+		//the events of proxies kept in memory are only sent to the watchers in process, which check them on a single node
+		return cache.NewMemoryProxyStore(), nil
+	default:
+		return nil, fmt.Errorf("invalid store config (store.backend %s is neither redis nor memory)", conf.Store.Backend)
+	}
+}
+
+func SetupCipher(ctx context.Context, conf *config.Config) (*secret.Cipher, error) {
+	//init the cipher of credentials, which are kept in plain without a key
+	if conf.Secret.KeyFile == "" {
+		log.Warn("no secret.key_file is configured, credentials of proxies and apis are stored in plain at rest")
+		return nil, nil
+	}
+	provider, err := secret.NewLocalKeyProvider(conf.Secret.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret config (error: %+v)", err)
+	}
+	return secret.NewCipher(ctx, provider)
+}
+
 func SetupRedisSearch(conf *config.Config) (redis_search.Client, error) {
 	//init redis client for cache
 	redis_addr := conf.Redis.Address
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"context"
+
+	ends "github.com/WALL-EEEEEEE/proxy-service/manager/endpoint"
+	pb "github.com/WALL-EEEEEEE/proxy-service/manager/gen/manager/v1"
+	"github.com/WALL-EEEEEEE/proxy-service/manager/param"
+
+	gt "github.com/go-kit/kit/transport/grpc"
+	"github.com/sirupsen/logrus"
+)
+
+type GatewayServiceTransport struct {
+	report_proxy_event gt.Handler
+	pb.UnimplementedGatewayServiceServer
+}
+
+// NewGatewayServiceTransport initializes a new Gateway Transport
+func NewGatewayServiceTransport(endpoint ends.GatewayServiceEndpoint, logger *logrus.Logger) pb.GatewayServiceServer {
+	return &GatewayServiceTransport{
+		report_proxy_event: gt.NewServer(
+			endpoint.ReportProxyEvent,
+			decodeGatewayServiceReportProxyEventRequest,
+			encodeGatewayServiceReportProxyEventResponse,
+		),
+	}
+}
+
+func (s *GatewayServiceTransport) ReportProxyEvent(ctx context.Context, req *pb.ReportProxyEventRequest) (*pb.ReportProxyEventResponse, error) {
+	_, resp, err := s.report_proxy_event.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.ReportProxyEventResponse), nil
+}
+
+func decodeGatewayServiceReportProxyEventRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.ReportProxyEventRequest)
+	decoded := param.ReportProxyEventRequest{
+		ProxyId: req.ProxyId,
+		Type:    req.Type,
+		Reason:  req.Reason,
+	}
+	if req.Time != nil {
+		decoded.Time = req.Time.AsTime()
+	}
+	if req.Until != nil {
+		decoded.Until = req.Until.AsTime()
+	}
+	return decoded, nil
+}
+
+func encodeGatewayServiceReportProxyEventResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.ReportProxyEventResponse)
+	return &pb.ReportProxyEventResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}}, nil
+}
@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"sync"
 
 	"github.com/WALL-EEEEEEE/proxy-service/common"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/WALL-EEEEEEE/proxy-service/manager/util"
 
 	"github.com/bobg/go-generics/slices"
+	protovalidate "github.com/bufbuild/protovalidate-go"
 	gt "github.com/go-kit/kit/transport/grpc"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
@@ -21,16 +23,26 @@ import (
 )
 
 var (
+	proxyValidator = sync.OnceValues(func() (*protovalidate.Validator, error) {
+		return protovalidate.New()
+	})
 	DEFAULT_LIST_MASK = []string{"id", "proto", "ip", "port", "status", "provider", "api", "provider_id", "api_id", "attr", "created_at", "updated_at", "checked_at", "expire_time", "use_config"}
 )
 
 type ProxyServiceTransport struct {
-	list_proxies    gt.Handler
-	add_proxy       gt.Handler
-	delete_proxy    gt.Handler
-	update_proxy    gt.Handler
-	get_proxy       gt.Handler
-	get_proxy_by_ip gt.Handler
+	list_proxies       gt.Handler
+	add_proxy          gt.Handler
+	add_proxies        gt.Handler
+	delete_proxy       gt.Handler
+	delete_proxies     gt.Handler
+	get_pool_stats     gt.Handler
+	acquire_proxy      gt.Handler
+	release_proxy      gt.Handler
+	record_proxy_check gt.Handler
+	get_proxy_history  gt.Handler
+	update_proxy       gt.Handler
+	get_proxy          gt.Handler
+	get_proxy_by_ip    gt.Handler
 	pb.UnimplementedProxyServiceServer
 }
 
@@ -47,11 +59,51 @@ func NewProxyServiceTransport(endpoint ends.ProxyServiceEndpoint, logger *logrus
 			decodeProxyServiceAddProxyRequest,
 			encodeProxyServiceAddProxyResponse,
 		),
+		add_proxies: gt.NewServer(
+			endpoint.AddProxies,
+			decodeProxyServiceAddProxiesRequest,
+			encodeProxyServiceAddProxiesResponse,
+		),
 		update_proxy: gt.NewServer(
 			endpoint.UpdateProxy,
 			decodeProxyServiceUpdateProxyRequest,
 			encodeProxyServiceUpdateProxyResponse,
 		),
+		delete_proxy: gt.NewServer(
+			endpoint.DeleteProxy,
+			decodeProxyServiceDeleteProxyRequest,
+			encodeProxyServiceDeleteProxyResponse,
+		),
+		delete_proxies: gt.NewServer(
+			endpoint.DeleteProxies,
+			decodeProxyServiceDeleteProxiesRequest,
+			encodeProxyServiceDeleteProxiesResponse,
+		),
+		get_pool_stats: gt.NewServer(
+			endpoint.GetPoolStats,
+			decodeProxyServiceGetPoolStatsRequest,
+			encodeProxyServiceGetPoolStatsResponse,
+		),
+		acquire_proxy: gt.NewServer(
+			endpoint.AcquireProxy,
+			decodeProxyServiceAcquireProxyRequest,
+			encodeProxyServiceAcquireProxyResponse,
+		),
+		release_proxy: gt.NewServer(
+			endpoint.ReleaseProxy,
+			decodeProxyServiceReleaseProxyRequest,
+			encodeProxyServiceReleaseProxyResponse,
+		),
+		record_proxy_check: gt.NewServer(
+			endpoint.RecordProxyCheck,
+			decodeProxyServiceRecordProxyCheckRequest,
+			encodeProxyServiceRecordProxyCheckResponse,
+		),
+		get_proxy_history: gt.NewServer(
+			endpoint.GetProxyHistory,
+			decodeProxyServiceGetProxyHistoryRequest,
+			encodeProxyServiceGetProxyHistoryResponse,
+		),
 		get_proxy: gt.NewServer(
 			endpoint.GetProxy,
 			decodeProxyServiceGetProxyRequest,
@@ -81,6 +133,14 @@ func (s *ProxyServiceTransport) AddProxy(ctx context.Context, req *pb.AddProxyRe
 	return resp.(*pb.AddProxyResponse), nil
 }
 
+func (s *ProxyServiceTransport) AddProxies(ctx context.Context, req *pb.AddProxiesRequest) (*pb.AddProxiesResponse, error) {
+	_, resp, err := s.add_proxies.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.AddProxiesResponse), nil
+}
+
 func (s *ProxyServiceTransport) UpdateProxy(ctx context.Context, req *pb.UpdateProxyRequest) (*pb.UpdateProxyResponse, error) {
 	_, resp, err := s.update_proxy.ServeGRPC(ctx, req)
 	if err != nil {
@@ -89,6 +149,62 @@ func (s *ProxyServiceTransport) UpdateProxy(ctx context.Context, req *pb.UpdateP
 	return resp.(*pb.UpdateProxyResponse), nil
 }
 
+func (s *ProxyServiceTransport) DeleteProxy(ctx context.Context, req *pb.DeleteProxyRequest) (*pb.DeleteProxyResponse, error) {
+	_, resp, err := s.delete_proxy.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.DeleteProxyResponse), nil
+}
+
+func (s *ProxyServiceTransport) DeleteProxies(ctx context.Context, req *pb.DeleteProxiesRequest) (*pb.DeleteProxiesResponse, error) {
+	_, resp, err := s.delete_proxies.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.DeleteProxiesResponse), nil
+}
+
+func (s *ProxyServiceTransport) AcquireProxy(ctx context.Context, req *pb.AcquireProxyRequest) (*pb.AcquireProxyResponse, error) {
+	_, resp, err := s.acquire_proxy.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.AcquireProxyResponse), nil
+}
+
+func (s *ProxyServiceTransport) ReleaseProxy(ctx context.Context, req *pb.ReleaseProxyRequest) (*pb.ReleaseProxyResponse, error) {
+	_, resp, err := s.release_proxy.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.ReleaseProxyResponse), nil
+}
+
+func (s *ProxyServiceTransport) RecordProxyCheck(ctx context.Context, req *pb.RecordProxyCheckRequest) (*pb.RecordProxyCheckResponse, error) {
+	_, resp, err := s.record_proxy_check.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.RecordProxyCheckResponse), nil
+}
+
+func (s *ProxyServiceTransport) GetProxyHistory(ctx context.Context, req *pb.GetProxyHistoryRequest) (*pb.GetProxyHistoryResponse, error) {
+	_, resp, err := s.get_proxy_history.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetProxyHistoryResponse), nil
+}
+
+func (s *ProxyServiceTransport) GetPoolStats(ctx context.Context, req *pb.GetPoolStatsRequest) (*pb.GetPoolStatsResponse, error) {
+	_, resp, err := s.get_pool_stats.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*pb.GetPoolStatsResponse), nil
+}
+
 func (s *ProxyServiceTransport) GetProxy(ctx context.Context, req *pb.GetProxyRequest) (*pb.GetProxyResponse, error) {
 	_, resp, err := s.get_proxy.ServeGRPC(ctx, req)
 	if err != nil {
@@ -112,6 +228,7 @@ func decodeProxyServiceListProxiesRequest(_ context.Context, request interface{}
 	if req.Query != nil {
 		list_req.Pager = common_param.Pager{Limit: req.Query.Limit, Offset: int64(req.Query.Offset)}
 		list_req.Filter = req.Query.Filter
+		list_req.OrderBy = req.Query.OrderBy
 
 	}
 	if req.Fields != nil {
@@ -150,6 +267,38 @@ func encodeProxyServiceAddProxyResponse(_ context.Context, response interface{})
 	return &pb.AddProxyResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Id: resp.Id}, nil
 }
 
+func decodeProxyServiceAddProxiesRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.AddProxiesRequest)
+	validator, err := proxyValidator()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	//the proxies are skipped by the validation of the request, so an invalid one fails itself only
+	ret_req := param.AddProxiesRequest{
+		Proxies: make([]model.Proxy, 0, len(req.Proxies)),
+		Invalid: make(map[int]string),
+		Upsert:  req.Upsert,
+	}
+	for i, proxy := range req.Proxies {
+		if err := validator.Validate(proxy); err != nil {
+			ret_req.Invalid[i] = err.Error()
+			ret_req.Proxies = append(ret_req.Proxies, model.Proxy{})
+			continue
+		}
+		ret_req.Proxies = append(ret_req.Proxies, *util.ProxyFromPb(proxy))
+	}
+	return ret_req, nil
+}
+
+func encodeProxyServiceAddProxiesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.AddProxiesResponse)
+	results := make([]*pb.AddProxyResult, 0, len(resp.Results))
+	for i := range resp.Results {
+		results = append(results, util.PbFromAddProxyResult(&resp.Results[i]))
+	}
+	return &pb.AddProxiesResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Results: results}, nil
+}
+
 func decodeProxyServiceUpdateProxyRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.UpdateProxyRequest)
 	logrus.Debugf("%+v", req.Fields)
@@ -170,6 +319,113 @@ func encodeProxyServiceUpdateProxyResponse(_ context.Context, response interface
 	return &pb.UpdateProxyResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}}, nil
 }
 
+func decodeProxyServiceDeleteProxyRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.DeleteProxyRequest)
+	var proxy_delete_req param.DeleteProxyRequest = param.DeleteProxyRequest{
+		Id: req.Id,
+	}
+	return proxy_delete_req, nil
+}
+
+func encodeProxyServiceDeleteProxyResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.DeleteProxyResponse)
+	return &pb.DeleteProxyResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}}, nil
+}
+
+func decodeProxyServiceDeleteProxiesRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.DeleteProxiesRequest)
+	var proxies_delete_req param.DeleteProxiesRequest = param.DeleteProxiesRequest{
+		Filter: req.Filter,
+	}
+	return proxies_delete_req, nil
+}
+
+func encodeProxyServiceDeleteProxiesResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.DeleteProxiesResponse)
+	return &pb.DeleteProxiesResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Ids: resp.Ids}, nil
+}
+
+func decodeProxyServiceGetPoolStatsRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetPoolStatsRequest)
+	var stats_req param.GetPoolStatsRequest = param.GetPoolStatsRequest{
+		Filter:  req.Filter,
+		GroupBy: req.GroupBy,
+	}
+	return stats_req, nil
+}
+
+func encodeProxyServiceGetPoolStatsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.GetPoolStatsResponse)
+	groups := make([]*pb.PoolStatsGroup, 0, len(resp.Groups))
+	for i := range resp.Groups {
+		groups = append(groups, util.PbFromPoolStatsGroup(&resp.Groups[i]))
+	}
+	return &pb.GetPoolStatsResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Total: util.PbFromPoolStats(&resp.Total), Groups: groups}, nil
+}
+
+func decodeProxyServiceAcquireProxyRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.AcquireProxyRequest)
+	var acquire_req param.AcquireProxyRequest = param.AcquireProxyRequest{
+		Filter:        req.Filter,
+		LeaseDuration: req.LeaseDuration.AsDuration(),
+		Exclusive:     req.Exclusive,
+		Scope:         req.Scope,
+		Consumer:      req.Consumer,
+	}
+	return acquire_req, nil
+}
+
+func encodeProxyServiceAcquireProxyResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.AcquireProxyResponse)
+	return &pb.AcquireProxyResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Lease: util.PbFromLease(&resp.Lease)}, nil
+}
+
+func decodeProxyServiceReleaseProxyRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.ReleaseProxyRequest)
+	var release_req param.ReleaseProxyRequest = param.ReleaseProxyRequest{
+		LeaseId: req.LeaseId,
+		Outcome: req.Outcome.String(),
+	}
+	return release_req, nil
+}
+
+func encodeProxyServiceReleaseProxyResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.ReleaseProxyResponse)
+	return &pb.ReleaseProxyResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}}, nil
+}
+
+func decodeProxyServiceRecordProxyCheckRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.RecordProxyCheckRequest)
+	var record_req param.RecordProxyCheckRequest = param.RecordProxyCheckRequest{
+		Id:     req.Id,
+		Result: *util.CheckResultFromPb(req.Result),
+	}
+	return record_req, nil
+}
+
+func encodeProxyServiceRecordProxyCheckResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.RecordProxyCheckResponse)
+	return &pb.RecordProxyCheckResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Stability: resp.Stability}, nil
+}
+
+func decodeProxyServiceGetProxyHistoryRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.GetProxyHistoryRequest)
+	var history_req param.GetProxyHistoryRequest = param.GetProxyHistoryRequest{
+		Id:    req.Id,
+		Limit: int(req.Limit),
+	}
+	return history_req, nil
+}
+
+func encodeProxyServiceGetProxyHistoryResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(param.GetProxyHistoryResponse)
+	results := make([]*pb.CheckResult, 0, len(resp.Results))
+	for i := range resp.Results {
+		results = append(results, util.PbFromCheckResult(&resp.Results[i]))
+	}
+	return &pb.GetProxyHistoryResponse{Status: &pb.ResponseStatus{Result: resp.Result, Message: resp.Message, Code: resp.Code}, Results: results, Stability: resp.Stability}, nil
+}
+
 func decodeProxyServiceGetProxyRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.GetProxyRequest)
 
@@ -76,6 +76,8 @@ func ProtosFromPb(proto []pb.Proto) []model.PROTO {
 			return model.PROTO_HTTPS, nil
 		case pb.Proto_PROTO_WEBSOCKET:
 			return model.PROTO_WEBSOCKET, nil
+		case pb.Proto_PROTO_SOCKET:
+			return model.PROTO_SOCKET, nil
 		default:
 			return model.PROTO{Value: "UNKNOW"}, nil
 		}
@@ -103,6 +105,8 @@ func PbFromProtos(protos []model.PROTO) []pb.Proto {
 			return pb.Proto_PROTO_HTTPS, nil
 		case model.PROTO_WEBSOCKET:
 			return pb.Proto_PROTO_WEBSOCKET, nil
+		case model.PROTO_SOCKET:
+			return pb.Proto_PROTO_SOCKET, nil
 		default:
 			return pb.Proto_PROTO_UNSPECIFIED, nil
 		}
@@ -121,6 +125,7 @@ func PbFromUseConfig(use_config *model.UseConfig) *pb.UseConfig {
 		User:     use_config.User,
 		Password: use_config.Password,
 		Extra:    use_config.Extra,
+		Redacted: use_config.Redacted,
 	}
 }
 
@@ -139,6 +144,9 @@ func PbFromAttr(attr *model.Attr) *pb.Attr {
 		Availiable:   attr.Availiable,
 		Anonymous:    attr.Anonymous,
 		Tags:         attr.Tags,
+		Latitude:     attr.Latitude,
+		Longitude:    attr.Longitude,
+		ExitIp:       attr.ExitIp,
 	}
 }
 
@@ -159,6 +167,9 @@ func PbFromProxy(proxy *model.Proxy) *pb.Proxy {
 		Status:     PbFromStatus(proxy.Status),
 		UseConfig:  PbFromUseConfig(proxy.UseConfig),
 	}
+	if proxy.LeaseOutcomes != nil {
+		ret_proxy.LeaseOutcomes = &pb.LeaseOutcomes{Success: proxy.LeaseOutcomes.Success, Failure: proxy.LeaseOutcomes.Failure}
+	}
 
 	if proxy.UpdatedAt != nil {
 		ret_proxy.UpdatedAt = timestamppb.New(*proxy.UpdatedAt)
@@ -166,6 +177,9 @@ func PbFromProxy(proxy *model.Proxy) *pb.Proxy {
 	if proxy.CreatedAt != nil {
 		ret_proxy.CreatedAt = timestamppb.New(*proxy.CreatedAt)
 	}
+	if proxy.CheckedAt != nil {
+		ret_proxy.CheckedAt = timestamppb.New(*proxy.CheckedAt)
+	}
 
 	//Ttl precedes Expiration if Ttl equate to -1
 	if proxy.Ttl == -1 {
@@ -174,6 +188,8 @@ func PbFromProxy(proxy *model.Proxy) *pb.Proxy {
 		//Expiration precedes Ttl while ExpiredAt is set and Ttl isn't equal to -1, otherwise caculate Expiration based CreatedAt and Ttl
 		if !(proxy.ExpiredAt == nil || proxy.ExpiredAt.IsZero()) {
 			ret_proxy.Expiration = &pb.Proxy_ExpireTime{ExpireTime: timestamppb.New(*proxy.ExpiredAt)}
+		} else if proxy.CreatedAt == nil {
+			ret_proxy.Expiration = &pb.Proxy_Ttl{Ttl: proxy.Ttl}
 		} else {
 			expired_at := timestamppb.New((*proxy.CreatedAt).Add(time.Duration(proxy.Ttl) * time.Second))
 			ret_proxy.Expiration = &pb.Proxy_ExpireTime{ExpireTime: expired_at}
@@ -194,6 +210,7 @@ func UseConfigFromPb(use_config *pb.UseConfig) *model.UseConfig {
 		User:     use_config.User,
 		Password: use_config.Password,
 		Extra:    use_config.Extra,
+		Redacted: use_config.Redacted,
 	}
 }
 
@@ -212,6 +229,9 @@ func AttrFromPb(attr *pb.Attr) *model.Attr {
 		Availiable:   attr.Availiable,
 		Anonymous:    attr.Anonymous,
 		Tags:         attr.Tags,
+		Latitude:     attr.Latitude,
+		Longitude:    attr.Longitude,
+		ExitIp:       attr.ExitIp,
 	}
 }
 
@@ -247,6 +267,7 @@ func ProxyFromPb(proxy *pb.Proxy) *model.Proxy {
 		return nil
 	}
 	ret_proxy := model.Proxy{
+		Id:         proxy.Id,
 		Ip:         proxy.Ip,
 		Port:       proxy.Port,
 		ProviderId: proxy.ProviderId,
@@ -258,6 +279,9 @@ func ProxyFromPb(proxy *pb.Proxy) *model.Proxy {
 		Status:     StatusFromPb(proxy.Status),
 		UseConfig:  UseConfigFromPb(proxy.UseConfig),
 	}
+	if proxy.LeaseOutcomes != nil {
+		ret_proxy.LeaseOutcomes = &model.LeaseOutcomes{Success: proxy.LeaseOutcomes.Success, Failure: proxy.LeaseOutcomes.Failure}
+	}
 	if proxy.UpdatedAt == nil {
 		ret_proxy.UpdatedAt = nil
 	} else {
@@ -270,6 +294,10 @@ func ProxyFromPb(proxy *pb.Proxy) *model.Proxy {
 		_created_at := proxy.CreatedAt.AsTime()
 		ret_proxy.CreatedAt = &_created_at
 	}
+	if proxy.CheckedAt != nil {
+		_checked_at := proxy.CheckedAt.AsTime()
+		ret_proxy.CheckedAt = &_checked_at
+	}
 	ExpirationFromPb(proxy, &ret_proxy)
 	return &ret_proxy
 }
@@ -291,3 +319,106 @@ func AddProxyRequestFromPb(req *pb.AddProxyRequest) *param.AddProxyRequest {
 	}
 	return &ret_req
 }
+
+func PbFromAddProxyResult(result *model.AddProxyResult) *pb.AddProxyResult {
+	return &pb.AddProxyResult{
+		Result:  pb.AddResult(pb.AddResult_value[result.Result]),
+		Id:      result.Id,
+		Message: result.Message,
+	}
+}
+
+func PbFromLease(lease *model.Lease) *pb.Lease {
+	ret_lease := &pb.Lease{
+		Id:          lease.Id,
+		Scope:       lease.Scope,
+		Consumer:    lease.Consumer,
+		Exclusive:   lease.Exclusive,
+		AcquireTime: timestamppb.New(lease.AcquiredAt),
+		ExpireTime:  timestamppb.New(lease.ExpiredAt),
+	}
+	if lease.Proxy != nil {
+		ret_lease.Proxy = PbFromProxy(lease.Proxy)
+	}
+	return ret_lease
+}
+
+func PbFromCheckResult(result *model.CheckResult) *pb.CheckResult {
+	return &pb.CheckResult{
+		CheckTime:        timestamppb.New(result.CheckedAt),
+		Latency:          result.Latency,
+		Dialable:         result.Dialable,
+		HttpSupport:      result.HttpSupport,
+		SocketSupport:    result.SocketSupport,
+		WebsocketSupport: result.WebSocketSupport,
+		Error:            result.Error,
+	}
+}
+
+func CheckResultFromPb(result *pb.CheckResult) *model.CheckResult {
+	if result == nil {
+		return nil
+	}
+	return &model.CheckResult{
+		CheckedAt:        result.CheckTime.AsTime(),
+		Latency:          result.Latency,
+		Dialable:         result.Dialable,
+		HttpSupport:      result.HttpSupport,
+		SocketSupport:    result.SocketSupport,
+		WebSocketSupport: result.WebsocketSupport,
+		Error:            result.Error,
+	}
+}
+
+func PbFromPoolStats(stats *model.PoolStats) *pb.PoolStats {
+	if stats == nil {
+		return nil
+	}
+	return &pb.PoolStats{
+		Count:        stats.Count,
+		AvgLatency:   stats.AvgLatency,
+		AvgStability: stats.AvgStability,
+		MinLatency:   stats.MinLatency,
+		MaxLatency:   stats.MaxLatency,
+		P50Latency:   stats.P50Latency,
+		P90Latency:   stats.P90Latency,
+		P99Latency:   stats.P99Latency,
+	}
+}
+
+func PbFromPoolStatsGroup(group *model.PoolStatsGroup) *pb.PoolStatsGroup {
+	return &pb.PoolStatsGroup{
+		Property: group.Property,
+		Value:    group.Value,
+		Stats:    PbFromPoolStats(&group.Stats),
+	}
+}
+
+func PbFromProxyApi(api *model.ProxyApi) *pb.ProxyAPI {
+	if api == nil {
+		return nil
+	}
+	return &pb.ProxyAPI{
+		Name:     api.Name,
+		Interval: api.UpdateInterval,
+		Service: &pb.Service{
+			Host:   api.Service.Host,
+			Name:   api.Service.Name,
+			Params: api.Service.Params,
+		},
+	}
+}
+
+func ProxyApiFromPb(api *pb.ProxyAPI) *model.ProxyApi {
+	if api == nil {
+		return nil
+	}
+	ret_api := model.ProxyApi{
+		Name:           api.Name,
+		UpdateInterval: api.Interval,
+	}
+	if api.Service != nil {
+		ret_api.Service = model.Service{Host: api.Service.Host, Name: api.Service.Name, Params: api.Service.Params}
+	}
+	return &ret_api
+}
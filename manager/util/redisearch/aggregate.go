@@ -0,0 +1,115 @@
+package redisearch
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Reducer reduces the documents of a group into a value named alias
+type Reducer struct {
+	fn    string
+	args  []interface{}
+	alias string
+}
+
+func (r Reducer) Args() []interface{} {
+	args := []interface{}{"REDUCE", r.fn, len(r.args)}
+	args = append(args, r.args...)
+	return append(args, "AS", r.alias)
+}
+
+func ReduceCount(alias string) Reducer {
+	return Reducer{fn: "COUNT", alias: alias}
+}
+
+func ReduceAvg(field string, alias string) Reducer {
+	return Reducer{fn: "AVG", args: []interface{}{"@" + field}, alias: alias}
+}
+
+func ReduceMin(field string, alias string) Reducer {
+	return Reducer{fn: "MIN", args: []interface{}{"@" + field}, alias: alias}
+}
+
+func ReduceMax(field string, alias string) Reducer {
+	return Reducer{fn: "MAX", args: []interface{}{"@" + field}, alias: alias}
+}
+
+// ReduceQuantile reduces the value of field at quantile q in [0, 1], e.g. 0.99 for the 99th percentile
+func ReduceQuantile(field string, q float64, alias string) Reducer {
+	return Reducer{fn: "QUANTILE", args: []interface{}{"@" + field, strconv.FormatFloat(q, 'f', -1, 64)}, alias: alias}
+}
+
+// Aggregation groups the documents matched by field, the whole result set is one group if not grouped by any field
+type Aggregation struct {
+	field    Field
+	group_by []string
+	reducers []Reducer
+}
+
+func NewAggregation(field Field) Aggregation {
+	return Aggregation{field: field}
+}
+
+func (a Aggregation) GroupBy(fields ...string) Aggregation {
+	a.group_by = append(append([]string{}, a.group_by...), fields...)
+	return a
+}
+
+func (a Aggregation) Reduce(reducers ...Reducer) Aggregation {
+	a.reducers = append(append([]Reducer{}, a.reducers...), reducers...)
+	return a
+}
+
+func (a Aggregation) Args() []interface{} {
+	args := []interface{}{a.field.toQuery()}
+	//fields grouped by are loaded since only sortable fields are available to the pipeline without loading
+	if len(a.group_by) > 0 {
+		args = append(args, "LOAD", len(a.group_by))
+		for _, field := range a.group_by {
+			args = append(args, "@"+field)
+		}
+	}
+	args = append(args, "GROUPBY", len(a.group_by))
+	for _, field := range a.group_by {
+		args = append(args, "@"+field)
+	}
+	for _, reducer := range a.reducers {
+		args = append(args, reducer.Args()...)
+	}
+	return args
+}
+
+// AggregateRow is a row of aggregation results, values are keyed by the fields grouped by and the aliases of reducers
+type AggregateRow map[string]string
+
+func (r AggregateRow) Float(name string) float64 {
+	v, _ := strconv.ParseFloat(r[name], 64)
+	return v
+}
+
+func (r AggregateRow) Int(name string) int64 {
+	v, _ := strconv.ParseInt(r[name], 10, 64)
+	return v
+}
+
+func ParseAggregateResult(raw_result RawSearchResult) ([]AggregateRow, error) {
+	_raw_result, ok := raw_result.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected aggregate result: %T", raw_result)
+	}
+	raw_rows, _ := _raw_result["results"].([]interface{})
+	rows := make([]AggregateRow, 0, len(raw_rows))
+	for _, raw_row := range raw_rows {
+		_raw_row, ok := raw_row.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		attrs, _ := _raw_row["extra_attributes"].(map[interface{}]interface{})
+		row := make(AggregateRow, len(attrs))
+		for k, v := range attrs {
+			row[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,54 @@
+package redisearch
+
+import (
+	"testing"
+
+	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregation(t *testing.T) {
+	cases := []test.TestCase[any, any]{
+		{
+			Name:     "Aggregate.All",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`*`, "GROUPBY", 0, "REDUCE", "COUNT", 0, "AS", "count", "REDUCE", "QUANTILE", 2, "@latency", "0.5", "AS", "p50"},
+			Check: func(tc test.TestCase[any, any]) {
+				a := NewAggregation(NewAnyField()).Reduce(ReduceCount("count"), ReduceQuantile("latency", 0.5, "p50"))
+				assert.Equal(t, tc.Expected, a.Args())
+			},
+		},
+		{
+			Name:     "Aggregate.GroupBy",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@status:{checked}`, "LOAD", 1, "@provider", "GROUPBY", 1, "@provider", "REDUCE", "AVG", 1, "@latency", "AS", "avg_latency"},
+			Check: func(tc test.TestCase[any, any]) {
+				a := NewAggregation(NewTagField("status", NewStringValue("checked"))).GroupBy("provider").Reduce(ReduceAvg("latency", "avg_latency"))
+				assert.Equal(t, tc.Expected, a.Args())
+			},
+		},
+	}
+	test.Run(cases, t)
+}
+
+func TestParseAggregateResult(t *testing.T) {
+	raw := map[interface{}]interface{}{
+		"total_results": int64(1),
+		"results": []interface{}{
+			map[interface{}]interface{}{
+				"extra_attributes": map[interface{}]interface{}{"provider": "p1", "count": "3", "avg_latency": "120.5"},
+				"values":           []interface{}{},
+			},
+		},
+	}
+	rows, err := ParseAggregateResult(raw)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "p1", rows[0]["provider"])
+	assert.Equal(t, int64(3), rows[0].Int("count"))
+	assert.Equal(t, 120.5, rows[0].Float("avg_latency"))
+	_, err = ParseAggregateResult("OK")
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package redisearch
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// IndexInfo is the part of FT.INFO telling which index an alias points to and whether it's still indexing
+type IndexInfo struct {
+	Name           string
+	NumDocs        int64
+	Indexing       bool
+	PercentIndexed float64
+}
+
+// ParseInfoResult parses the reply of FT.INFO, which is a map in RESP3 and a flat list of pairs in RESP2
+func ParseInfoResult(raw_result RawSearchResult) (*IndexInfo, error) {
+	fields := make(map[string]interface{})
+	switch r := raw_result.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range r {
+			fields[fmt.Sprint(k)] = v
+		}
+	case []interface{}:
+		for i := 0; i+1 < len(r); i += 2 {
+			fields[fmt.Sprint(r[i])] = r[i+1]
+		}
+	default:
+		return nil, fmt.Errorf("unexpected info result: %T", raw_result)
+	}
+	name, ok := fields["index_name"]
+	if !ok {
+		return nil, fmt.Errorf("index_name is missing in info result")
+	}
+	number := func(key string) (float64, error) {
+		v, ok := fields[key]
+		if !ok {
+			return 0, nil
+		}
+		n, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %v in info result", key, v)
+		}
+		return n, nil
+	}
+	info := IndexInfo{Name: fmt.Sprint(name)}
+	num_docs, err := number("num_docs")
+	if err != nil {
+		return nil, err
+	}
+	info.NumDocs = int64(num_docs)
+	indexing, err := number("indexing")
+	if err != nil {
+		return nil, err
+	}
+	info.Indexing = indexing != 0
+	if info.PercentIndexed, err = number("percent_indexed"); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,29 @@
+package redisearch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInfoResult(t *testing.T) {
+	resp3 := map[interface{}]interface{}{
+		"index_name":      "idx:proxy:v2",
+		"num_docs":        int64(120),
+		"indexing":        int64(1),
+		"percent_indexed": 0.5,
+	}
+	info, err := ParseInfoResult(resp3)
+	assert.Nil(t, err)
+	assert.Equal(t, IndexInfo{Name: "idx:proxy:v2", NumDocs: 120, Indexing: true, PercentIndexed: 0.5}, *info)
+
+	resp2 := []interface{}{"index_name", "idx:proxy:v1", "num_docs", "7", "indexing", "0", "percent_indexed", "1"}
+	info, err = ParseInfoResult(resp2)
+	assert.Nil(t, err)
+	assert.Equal(t, IndexInfo{Name: "idx:proxy:v1", NumDocs: 7, Indexing: false, PercentIndexed: 1}, *info)
+
+	_, err = ParseInfoResult([]interface{}{"num_docs", "7"})
+	assert.NotNil(t, err)
+	_, err = ParseInfoResult("OK")
+	assert.NotNil(t, err)
+}
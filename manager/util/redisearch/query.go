@@ -3,6 +3,8 @@ package redisearch
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +15,7 @@ func escape(str string) string {
 		"@",
 		"~",
 		"|",
+		" ",
 	}
 	for _, c := range characters {
 		str = strings.ReplaceAll(str, c, "\\"+c)
@@ -26,6 +29,7 @@ const (
 	FIELD_KIND_TEXT    FieldKind = "TEXT"
 	FIELD_KIND_TAG     FieldKind = "TAG"
 	FIELD_KIND_NUMERIC FieldKind = "NUMERIC"
+	FIELD_KIND_GEO     FieldKind = "GEO"
 )
 
 type FieldValue[T any] interface {
@@ -51,23 +55,83 @@ func NewStringValue(v string) StringValue {
 	return StringValue{value: v}
 }
 
-type INumericValue = FieldValue[[2]int64]
+type INumericValue = FieldValue[[2]float64]
 
+// NumericValue is a range of numbers, bounds could be exclusive or infinite
 type NumericValue struct {
-	start int64
-	end   int64
+	start           float64
+	end             float64
+	exclusive_start bool
+	exclusive_end   bool
+}
+
+func formatBound(v float64, exclusive bool) string {
+	var bound string
+	switch {
+	case math.IsInf(v, -1):
+		return "-inf"
+	case math.IsInf(v, 1):
+		return "+inf"
+	default:
+		bound = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if exclusive {
+		bound = "(" + bound
+	}
+	return bound
 }
 
 func (v NumericValue) toQuery() string {
-	return fmt.Sprintf("[%d,%d]", v.start, v.end)
+	return fmt.Sprintf("[%s,%s]", formatBound(v.start, v.exclusive_start), formatBound(v.end, v.exclusive_end))
 }
 
-func (v NumericValue) GetValue() [2]int64 {
-	return [2]int64{v.start, v.end}
+func (v NumericValue) GetValue() [2]float64 {
+	return [2]float64{v.start, v.end}
 }
 
 func NewNumericValue(start int64, end int64) NumericValue {
-	return NumericValue{start: start, end: end}
+	return NumericValue{start: float64(start), end: float64(end)}
+}
+
+// NewNumericRangeValue creates a range whose bounds are excluded if exclusive, use math.Inf for unbounded sides
+func NewNumericRangeValue(start float64, exclusive_start bool, end float64, exclusive_end bool) NumericValue {
+	return NumericValue{start: start, end: end, exclusive_start: exclusive_start, exclusive_end: exclusive_end}
+}
+
+type GeoUnit string
+
+const (
+	GEO_UNIT_M  GeoUnit = "m"
+	GEO_UNIT_KM GeoUnit = "km"
+	GEO_UNIT_MI GeoUnit = "mi"
+	GEO_UNIT_FT GeoUnit = "ft"
+)
+
+// GeoValue is the circle within radius of the point at longitude and latitude
+type GeoValue struct {
+	lon    float64
+	lat    float64
+	radius float64
+	unit   GeoUnit
+}
+
+func (v GeoValue) toQuery() string {
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("[%s %s %s %s]", format(v.lon), format(v.lat), format(v.radius), v.unit)
+}
+
+func (v GeoValue) GetValue() [3]float64 {
+	return [3]float64{v.lon, v.lat, v.radius}
+}
+
+func (v GeoValue) Unit() GeoUnit {
+	return v.unit
+}
+
+func NewGeoValue(lon float64, lat float64, radius float64, unit GeoUnit) GeoValue {
+	return GeoValue{lon: lon, lat: lat, radius: radius, unit: unit}
 }
 
 type ValueOperatorAnd[T any] struct {
@@ -190,6 +254,22 @@ func NewNumericField(name string, value NumericValue) NumericField {
 	return NumericField{name: name, value: value}
 }
 
+type GeoField struct {
+	name  string
+	value GeoValue
+}
+
+func (f GeoField) toQuery() string {
+	return fmt.Sprintf(`@%s:%s`, f.name, f.value.toQuery())
+}
+func (f GeoField) GetName() string {
+	return f.name
+}
+
+func NewGeoField(name string, value GeoValue) GeoField {
+	return GeoField{name: name, value: value}
+}
+
 type FieldOperatorAnd struct {
 	loperand Field
 	roperand Field
@@ -241,14 +321,77 @@ func NewFieldOperatorNot(l Field) FieldOperatorNot {
 	return FieldOperatorNot{operand: l}
 }
 
+type SortOrder string
+
+const (
+	SORT_ORDER_ASC  SortOrder = "ASC"
+	SORT_ORDER_DESC SortOrder = "DESC"
+)
+
+type SortKey struct {
+	name  string
+	order SortOrder
+}
+
+func NewSortKey(name string, order SortOrder) SortKey {
+	return SortKey{name: name, order: order}
+}
+
 type Query struct {
-	field  Field
-	limit  int
-	offset int
+	field   Field
+	limit   int
+	offset  int
+	sort    []SortKey
+	returns []string
+}
+
+// Return returns a copy of q returning the values of paths instead of whole documents, they are keyed by the paths
+func (q Query) Return(paths ...string) Query {
+	q.returns = append(append([]string{}, q.returns...), paths...)
+	return q
+}
+
+// SortBy returns a copy of q sorted by keys, the keys after the first one break ties of the ones before
+func (q Query) SortBy(keys ...SortKey) Query {
+	q.sort = append(append([]SortKey{}, q.sort...), keys...)
+	return q
+}
+
+// Sorts returns the number of keys q is sorted by, FT.SEARCH sorts by one key at most
+func (q Query) Sorts() int {
+	return len(q.sort)
 }
 
 func (q Query) Args() []interface{} {
-	return []interface{}{q.field.toQuery(), "LIMIT", q.offset, q.limit}
+	args := []interface{}{q.field.toQuery()}
+	if len(q.returns) > 0 {
+		args = append(args, "RETURN", len(q.returns))
+		for _, path := range q.returns {
+			args = append(args, path)
+		}
+	}
+	if len(q.sort) > 0 {
+		args = append(args, "SORTBY", q.sort[0].name, string(q.sort[0].order))
+	}
+	return append(args, "LIMIT", q.offset, q.limit)
+}
+
+// AggregateArgs returns the arguments of FT.AGGREGATE loading documents and sorting by all the keys
+func (q Query) AggregateArgs() []interface{} {
+	args := []interface{}{q.field.toQuery(), "LOAD", 1, "$"}
+	if len(q.returns) > 0 {
+		args = []interface{}{q.field.toQuery(), "LOAD", len(q.returns)}
+		for _, path := range q.returns {
+			args = append(args, path)
+		}
+	}
+	if len(q.sort) > 0 {
+		args = append(args, "SORTBY", len(q.sort)*2)
+		for _, key := range q.sort {
+			args = append(args, "@"+key.name, string(key.order))
+		}
+	}
+	return append(args, "LIMIT", q.offset, q.limit)
 }
 
 func NewQuery(limit int, offset int, field Field) Query {
@@ -276,7 +419,8 @@ func ParseSearchResult[T any](raw_result RawSearchResult) (*SearchResult[T], err
 	var search_items []SearchResultItem[T] = make([]SearchResultItem[T], 0, total)
 	for _, raw_item := range raw_items {
 		_raw_item := raw_item.(map[interface{}]interface{})
-		id := _raw_item["id"].(string)
+		//results of FT.AGGREGATE have no id
+		id, _ := _raw_item["id"].(string)
 		search_item := SearchResultItem[T]{Id: id}
 		item := _raw_item["extra_attributes"].(map[interface{}]interface{})["$"].(string)
 		json.Unmarshal([]byte(item), &search_item.Item)
@@ -285,3 +429,43 @@ func ParseSearchResult[T any](raw_result RawSearchResult) (*SearchResult[T], err
 	result.Items = search_items
 	return &result, nil
 }
+
+// ParseSearchTotal parses the number of documents matched of a search result
+func ParseSearchTotal(raw_result RawSearchResult) (int, error) {
+	_raw_result, ok := raw_result.(map[interface{}]interface{})
+	if !ok {
+		return 0, fmt.Errorf("unexpected search result: %T", raw_result)
+	}
+	total, ok := _raw_result["total_results"].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected total of search result: %T", _raw_result["total_results"])
+	}
+	return int(total), nil
+}
+
+// ParseSearchAttributes parses the results of queries returning paths, the values of them are keyed by the paths,
+// strings are returned as they are and the other values in JSON
+func ParseSearchAttributes(raw_result RawSearchResult) (*SearchResult[map[string]string], error) {
+	_raw_result, ok := raw_result.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected search result: %T", raw_result)
+	}
+	total, _ := _raw_result["total_results"].(int64)
+	raw_items, _ := _raw_result["results"].([]interface{})
+	result := SearchResult[map[string]string]{Total: int(total), Items: make([]SearchResultItem[map[string]string], 0, len(raw_items))}
+	for _, raw_item := range raw_items {
+		_raw_item, ok := raw_item.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected search result item: %T", raw_item)
+		}
+		id, _ := _raw_item["id"].(string)
+		attributes := map[string]string{}
+		raw_attributes, _ := _raw_item["extra_attributes"].(map[interface{}]interface{})
+		for k, v := range raw_attributes {
+			name, _ := k.(string)
+			attributes[name] = fmt.Sprint(v)
+		}
+		result.Items = append(result.Items, SearchResultItem[map[string]string]{Id: id, Item: attributes})
+	}
+	return &result, nil
+}
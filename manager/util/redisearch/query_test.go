@@ -1,6 +1,7 @@
 package redisearch
 
 import (
+	"math"
 	"testing"
 
 	test "github.com/WALL-EEEEEEE/proxy-service/common/test"
@@ -50,6 +51,87 @@ func TestQuery(t *testing.T) {
 				assert.Equal(t, q.Args(), tc.Expected)
 			},
 		},
+		{
+			Name:     "Search.NumericField.Range",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@field1:[-inf,(300]`, "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewNumericField("field1", NewNumericRangeValue(math.Inf(-1), false, 300, true)))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Search.NumericField.Range.Float",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@field1:[0.5,+inf]`, "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewNumericField("field1", NewNumericRangeValue(0.5, false, math.Inf(1), false)))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Search.TagField.Escape",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@field1:{New\ York}`, "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewTagField("field1", NewStringValue("New York")))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Search.SortBy",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@field1:{value1}`, "SORTBY", "field2", "DESC", "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewTagField("field1", NewStringValue("value1"))).SortBy(NewSortKey("field2", SORT_ORDER_DESC))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Aggregate.SortBy",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`*`, "LOAD", 1, "$", "SORTBY", 4, "@field1", "ASC", "@field2", "DESC", "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewAnyField()).SortBy(NewSortKey("field1", SORT_ORDER_ASC), NewSortKey("field2", SORT_ORDER_DESC))
+				assert.Equal(t, 2, q.Sorts())
+				assert.Equal(t, q.AggregateArgs(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Search.Return",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`*`, "RETURN", 2, "$.id", "$.port", "SORTBY", "field1", "ASC", "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewAnyField()).Return("$.id", "$.port").SortBy(NewSortKey("field1", SORT_ORDER_ASC))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Aggregate.Return",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`*`, "LOAD", 2, "$.id", "$.port", "SORTBY", 4, "@field1", "ASC", "@field2", "DESC", "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewAnyField()).Return("$.id", "$.port").SortBy(NewSortKey("field1", SORT_ORDER_ASC), NewSortKey("field2", SORT_ORDER_DESC))
+				assert.Equal(t, q.AggregateArgs(), tc.Expected)
+			},
+		},
+		{
+			Name:     "Search.GeoField",
+			Input:    "",
+			Error:    nil,
+			Expected: []interface{}{`@loc:[-73.98 40.75 50 km]`, "LIMIT", 10, 0},
+			Check: func(tc test.TestCase[any, any]) {
+				q := NewQuery(0, 10, NewGeoField("loc", NewGeoValue(-73.98, 40.75, 50, GEO_UNIT_KM)))
+				assert.Equal(t, q.Args(), tc.Expected)
+			},
+		},
 		{
 			Name:     "Search.TagField.ValueOperatorAnd",
 			Input:    "",
@@ -227,3 +309,34 @@ func TestQuery(t *testing.T) {
 	}
 	test.Run(cases, t)
 }
+
+func TestParseSearchAttributes(t *testing.T) {
+	raw := map[interface{}]interface{}{
+		"total_results": int64(2),
+		"results": []interface{}{
+			map[interface{}]interface{}{
+				"id":               "proxy:1",
+				"extra_attributes": map[interface{}]interface{}{"$.id": "1", "$.port": "8080"},
+				"values":           []interface{}{},
+			},
+		},
+	}
+	result, err := ParseSearchAttributes(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Total)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, "proxy:1", result.Items[0].Id)
+	assert.Equal(t, map[string]string{"$.id": "1", "$.port": "8080"}, result.Items[0].Item)
+	_, err = ParseSearchAttributes("OK")
+	assert.Error(t, err)
+}
+
+func TestParseSearchTotal(t *testing.T) {
+	q := NewQuery(10, 0, NewTagField("country", NewStringValue("US"))).SortBy(NewSortKey("latency", SORT_ORDER_ASC), NewSortKey("checked_at", SORT_ORDER_DESC))
+	assert.Equal(t, []interface{}{"FT.SEARCH", "idx:proxy", `@country:{US}`, "LIMIT", 0, 0}, FtCount("idx:proxy", q))
+	total, err := ParseSearchTotal(map[interface{}]interface{}{"total_results": int64(42), "results": []interface{}{}})
+	assert.Nil(t, err)
+	assert.Equal(t, 42, total)
+	_, err = ParseSearchTotal("OK")
+	assert.Error(t, err)
+}
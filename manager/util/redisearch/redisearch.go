@@ -14,6 +14,28 @@ func FtSearch(idx string, query Query) []interface{} {
 
 }
 
+// FtAggregate searches like FtSearch but sorts by all the keys of query, since FT.SEARCH sorts by one key only,
+// documents are loaded as the $ attribute of each result
+func FtAggregate(idx string, query Query) []interface{} {
+	clause := []interface{}{
+		"FT.AGGREGATE",
+		idx,
+	}
+	clause = append(clause, query.AggregateArgs()...)
+	return clause
+}
+
+// FtCount counts the documents matched by query without returning them, FT.AGGREGATE doesn't report
+// the number of documents matched but of the rows it returns
+func FtCount(idx string, query Query) []interface{} {
+	return []interface{}{
+		"FT.SEARCH",
+		idx,
+		query.field.toQuery(),
+		"LIMIT", 0, 0,
+	}
+}
+
 func FtDropIndex(idxes ...string) []interface{} {
 	clause := []interface{}{
 		"FT.DROPINDEX",
@@ -55,6 +77,9 @@ func FtCreate(idx string, on FtCreateOn, prefixes []string, schemas []Schema) []
 			schema_clause = append(schema_clause, "AS", schema.alias)
 		}
 		schema_clause = append(schema_clause, schema.kind)
+		if schema.sortable {
+			schema_clause = append(schema_clause, "SORTABLE")
+		}
 	}
 	clause = append(clause, schema_clause...)
 	return clause
@@ -63,3 +88,22 @@ func FtCreate(idx string, on FtCreateOn, prefixes []string, schemas []Schema) []
 func FtConfigSet(option string, value string) []interface{} {
 	return []interface{}{"FT.CONFIG", "SET", option, value}
 }
+
+// FtAggregateGroups groups the documents matched by aggregation and reduces each group
+func FtAggregateGroups(idx string, aggregation Aggregation) []interface{} {
+	clause := []interface{}{
+		"FT.AGGREGATE",
+		idx,
+	}
+	clause = append(clause, aggregation.Args()...)
+	return clause
+}
+
+func FtInfo(idx string) []interface{} {
+	return []interface{}{"FT.INFO", idx}
+}
+
+// FtAliasUpdate points alias to idx, the alias is added if it doesn't exist
+func FtAliasUpdate(alias string, idx string) []interface{} {
+	return []interface{}{"FT.ALIASUPDATE", alias, idx}
+}
@@ -15,6 +15,7 @@ const (
 	SCHEMA_KIND_TAG     SchemaKind = "TAG"
 	SCHEMA_KIND_TEXT    SchemaKind = "TEXT"
 	SCHEMA_KIND_NUMERIC SchemaKind = "NUMERIC"
+	SCHEMA_KIND_GEO     SchemaKind = "GEO"
 )
 
 type SchemaOption func(*schemaOptions)
@@ -25,14 +26,23 @@ func AliasSchemaOption(alias string) SchemaOption {
 	}
 }
 
+// SortableSchemaOption makes the field sortable, results could be sorted only by sortable fields
+func SortableSchemaOption() SchemaOption {
+	return func(options *schemaOptions) {
+		options.sortable = true
+	}
+}
+
 type schemaOptions struct {
-	alias *string
+	alias    *string
+	sortable bool
 }
 
 type Schema struct {
-	field string
-	alias string
-	kind  SchemaKind
+	field    string
+	alias    string
+	kind     SchemaKind
+	sortable bool
 }
 
 func NewSchema(field string, kind SchemaKind, opts ...SchemaOption) Schema {
@@ -47,5 +57,27 @@ func NewSchema(field string, kind SchemaKind, opts ...SchemaOption) Schema {
 	if options.alias != nil {
 		s.alias = *options.alias
 	}
+	s.sortable = options.sortable
 	return s
 }
+
+// Name returns the name queried by, the alias if set or else the field
+func (s Schema) Name() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.field
+}
+
+// Field returns the json path of the indexed value without the leading `$.`
+func (s Schema) Field() string {
+	return s.field
+}
+
+func (s Schema) Kind() SchemaKind {
+	return s.kind
+}
+
+func (s Schema) Sortable() bool {
+	return s.sortable
+}